@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/VictorLowther/jsonpatch2/utils"
@@ -57,6 +58,13 @@ type MachineAgent struct {
 	doPower, exitOnNotRunnable, exitOnFailure bool
 	logger                                    io.Writer
 	err                                       error
+	// The rest are used when running as a daemon.
+	daemon       bool
+	healthSocket string
+	queue        *requestQueue
+	retryDelay   time.Duration
+	healthMux    sync.Mutex
+	health       AgentHealth
 }
 
 // NewAgent creates a new FSM based Machine Agent that starts out in
@@ -119,7 +127,9 @@ func (a *MachineAgent) power(cmdLine string) error {
 }
 
 func (a *MachineAgent) exitOrSleep() {
-	if a.exitOnFailure {
+	if a.daemon {
+		a.retryLater()
+	} else if a.exitOnFailure {
 		a.state = AGENT_EXIT
 	} else {
 		time.Sleep(30 * time.Second)
@@ -127,7 +137,10 @@ func (a *MachineAgent) exitOrSleep() {
 }
 
 func (a *MachineAgent) initOrExit() {
-	if a.exitOnFailure {
+	if a.daemon {
+		a.state = AGENT_INIT
+		a.retryLater()
+	} else if a.exitOnFailure {
 		a.state = AGENT_EXIT
 	} else {
 		a.state = AGENT_INIT
@@ -137,7 +150,9 @@ func (a *MachineAgent) initOrExit() {
 
 // Init resets the Machine Agent back to its initial state.  This
 // consists of marking any current running jobs as Failed and
-// repoening the event stream from dr-provision.
+// repoening the event stream from dr-provision.  When running as a
+// daemon, it first makes sure it can talk to dr-provision and sends
+// anything that was queued while it could not.
 func (a *MachineAgent) Init() {
 	if a.err != nil {
 		a.err = nil
@@ -146,7 +161,13 @@ func (a *MachineAgent) Init() {
 		a.events.Close()
 		a.events = nil
 	}
-	var err error
+	if a.daemon {
+		if a.err = a.reconnect(); a.err != nil {
+			a.Logf("MachineAgent: error talking to dr-provision: %v\n", a.err)
+			a.exitOrSleep()
+			return
+		}
+	}
 	currentJob := &models.Job{Uuid: a.machine.CurrentJob}
 	if a.client.Req().Fill(currentJob) == nil {
 		if currentJob.State == "running" || currentJob.State == "created" {
@@ -160,10 +181,12 @@ func (a *MachineAgent) Init() {
 	}
 	a.events, a.err = a.client.Events()
 	if a.err != nil {
-		a.Logf("MachineAgent: error attaching to event stream: %v", err)
+		a.Logf("MachineAgent: error attaching to event stream: %v", a.err)
 		a.exitOrSleep()
 		return
 	}
+	a.retryDelay = 0
+	a.setConnected(true)
 	a.state = AGENT_WAIT_FOR_RUNNABLE
 }
 
@@ -250,6 +273,9 @@ func (a *MachineAgent) RunTask() {
 		a.initOrExit()
 		return
 	}
+	if runner != nil {
+		runner.queue = a.queue
+	}
 	if runner == nil {
 		if a.machine.Workflow == "" {
 			a.Logf("Current tasks finished, check to see if stage needs to change\n")
@@ -412,13 +438,29 @@ func (a *MachineAgent) ChangeStage() {
 
 // Run kicks off the state machine for this agent.
 func (a *MachineAgent) Run() error {
+	if a.healthSocket != "" {
+		l, err := a.serveHealth()
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+	}
 	if a.machine.HasFeature("original-change-stage") ||
 		!a.machine.HasFeature("change-stage-v2") {
-		newM := models.Clone(a.machine).(*models.Machine)
-		newM.Runnable = true
-		if err := a.client.Req().PatchTo(a.machine, newM).Do(&newM); err == nil {
-			a.machine = newM
-		} else {
+		for {
+			newM := models.Clone(a.machine).(*models.Machine)
+			newM.Runnable = true
+			err := a.client.Req().PatchTo(a.machine, newM).Do(&newM)
+			if err == nil {
+				a.machine = newM
+				break
+			}
+			if a.daemon {
+				a.err = err
+				a.updateHealth()
+				a.retryLater()
+				continue
+			}
 			res := &models.Error{
 				Type:  "AGENT_WAIT",
 				Model: a.machine.Prefix(),
@@ -430,6 +472,7 @@ func (a *MachineAgent) Run() error {
 		}
 	}
 	for {
+		a.updateHealth()
 		switch a.state {
 		case AGENT_INIT:
 			a.Logf("Agent in init\n")
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// maxRetryDelay is the longest a MachineAgent running as a daemon
+// will wait before trying to talk to dr-provision again.
+const maxRetryDelay = time.Minute
+
+func (s AgentState) String() string {
+	switch s {
+	case AGENT_INIT:
+		return "init"
+	case AGENT_WAIT_FOR_RUNNABLE:
+		return "waitForRunnable"
+	case AGENT_RUN_TASK:
+		return "runTask"
+	case AGENT_WAIT_FOR_CHANGE_STAGE:
+		return "waitForChangeStage"
+	case AGENT_CHANGE_STAGE:
+		return "changeStage"
+	case AGENT_EXIT:
+		return "exit"
+	case AGENT_REBOOT:
+		return "reboot"
+	case AGENT_POWEROFF:
+		return "poweroff"
+	default:
+		return "unknown"
+	}
+}
+
+// AgentHealth is what a MachineAgent running as a daemon reports on
+// its health socket.
+type AgentHealth struct {
+	// Machine is the UUID of the Machine the agent is running for.
+	Machine string
+	// State is the state the agent is in.
+	State string
+	// Since is when the agent entered State.
+	Since time.Time
+	// Connected is true if the agent was able to talk to
+	// dr-provision the last time it tried.
+	Connected bool
+	// QueuedRequests is how many job log and state updates are
+	// waiting for dr-provision to become reachable.
+	QueuedRequests int
+	// LastError is the last error the agent ran into, if any.
+	LastError string
+}
+
+// Daemon has the MachineAgent run as a long-lived service.  Instead
+// of exiting when it cannot talk to dr-provision, it retries with
+// backoff and reopens its event stream, exchanges its token for a
+// fresh one when the token stops working, and queues job
+// log and state updates until they can be sent.  If healthSocket is
+// not empty, the agent reports its AgentHealth as JSON over HTTP on
+// that unix socket.
+func (a *MachineAgent) Daemon(healthSocket string) *MachineAgent {
+	a.daemon = true
+	a.exitOnFailure = false
+	a.exitOnNotRunnable = false
+	a.healthSocket = healthSocket
+	ref := &models.Machine{Uuid: a.machine.Uuid}
+	a.queue = &requestQueue{logf: a.Logf, reauth: func() error {
+		a.Logf("MachineAgent: getting a new token\n")
+		return a.client.ReauthMachine(ref)
+	}}
+	return a
+}
+
+// Health returns the current health of the MachineAgent.
+func (a *MachineAgent) Health() AgentHealth {
+	a.healthMux.Lock()
+	res := a.health
+	a.healthMux.Unlock()
+	res.QueuedRequests = a.queue.Len()
+	return res
+}
+
+func (a *MachineAgent) updateHealth() {
+	a.healthMux.Lock()
+	defer a.healthMux.Unlock()
+	a.health.Machine = a.machine.Key()
+	if a.health.State != a.state.String() {
+		a.health.State = a.state.String()
+		a.health.Since = time.Now()
+	}
+	if a.err != nil {
+		a.health.LastError = a.err.Error()
+	}
+}
+
+func (a *MachineAgent) setConnected(connected bool) {
+	a.healthMux.Lock()
+	a.health.Connected = connected
+	a.healthMux.Unlock()
+}
+
+// serveHealth starts answering health requests on the health socket.
+func (a *MachineAgent) serveHealth() (net.Listener, error) {
+	os.Remove(a.healthSocket)
+	l, err := net.Listen("unix", a.healthSocket)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Health())
+	}))
+	return l, nil
+}
+
+// retryLater waits before the agent tries to talk to dr-provision
+// again, backing off exponentially up to maxRetryDelay.
+func (a *MachineAgent) retryLater() {
+	a.setConnected(false)
+	if a.retryDelay == 0 {
+		a.retryDelay = time.Second
+	} else if a.retryDelay *= 2; a.retryDelay > maxRetryDelay {
+		a.retryDelay = maxRetryDelay
+	}
+	a.Logf("MachineAgent: retrying in %s\n", a.retryDelay)
+	time.Sleep(a.retryDelay)
+}
+
+// reconnect makes sure that dr-provision is reachable and will
+// accept our token, getting a new one if needed, and then replays
+// anything that was queued while it was unreachable.
+func (a *MachineAgent) reconnect() error {
+	m := &models.Machine{}
+	r := a.client.Req().UrlForM(a.machine)
+	err := r.Do(m)
+	if r.Resp != nil && (r.Resp.StatusCode == http.StatusUnauthorized || r.Resp.StatusCode == http.StatusForbidden) {
+		if err = a.queue.reauth(); err == nil {
+			err = a.client.Req().UrlForM(a.machine).Do(m)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	a.machine = m
+	return a.queue.Flush(a.client)
+}
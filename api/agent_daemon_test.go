@@ -0,0 +1,97 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestMachineReauth(t *testing.T) {
+	tk := &models.Task{
+		Name:      "reauth",
+		Templates: []models.TemplateInfo{{Name: "token", Contents: "{{.GenerateToken}}"}},
+	}
+	if err := session.CreateModel(tk); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	defer session.DeleteModel("tasks", tk.Key())
+	m := &models.Machine{Name: "reauth", Uuid: uuid.NewRandom(), Tasks: []string{"reauth"}, Runnable: true}
+	if err := session.CreateModel(m); err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+	defer session.DeleteModel("machines", m.Key())
+	if m.Secret != "" {
+		t.Errorf("The machine Secret should not be sent out")
+	}
+	// Get a machine token the same way the agent does.
+	job := &models.Job{Machine: m.Uuid}
+	if err := session.CreateModel(job); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	defer session.DeleteModel("jobs", job.Key())
+	actions, err := session.JobActions(job)
+	if err != nil || len(actions) != 1 {
+		t.Fatalf("Failed to render the token: %v", err)
+	}
+
+	// Other tokens cannot be exchanged for a machine token.
+	if err := session.ReauthMachine(m); err == nil {
+		t.Errorf("Getting a machine token with a user token should have failed")
+	}
+	anon, _ := TokenSession(session.Endpoint(), "")
+	if err := anon.ReauthMachine(m); err == nil {
+		t.Errorf("Getting a machine token without a token should have failed")
+	}
+	agentSession, _ := TokenSession(session.Endpoint(), actions[0].Content)
+	if err := agentSession.ReauthMachine(m); err != nil {
+		t.Fatalf("Failed to get a token with the machine token: %v", err)
+	}
+	if agentSession.Token() == actions[0].Content {
+		t.Errorf("ReauthMachine did not switch to the new token")
+	}
+	if err := agentSession.ReauthMachine(m); err == nil {
+		t.Errorf("Getting another machine token right away should have been refused")
+	}
+	got := &models.Machine{}
+	if err := agentSession.FillModel(got, m.Key()); err != nil {
+		t.Errorf("Failed to fetch machine with the new token: %v", err)
+	}
+}
+
+func TestRequestQueue(t *testing.T) {
+	offline, _ := TokenSession("https://127.0.0.1:1", "")
+	q := &requestQueue{}
+	if err := q.send(offline, "PUT", []byte("line 1\n"), "jobs", "foo", "log"); err != nil {
+		t.Errorf("Sending to an unreachable server should have been queued, not %v", err)
+	}
+	if err := q.send(offline, "PUT", []byte("line 2\n"), "jobs", "foo", "log"); err != nil {
+		t.Errorf("Sending to an unreachable server should have been queued, not %v", err)
+	}
+	if q.Len() != 2 {
+		t.Errorf("Expected 2 queued requests, not %d", q.Len())
+	}
+	if err := q.Flush(offline); err == nil {
+		t.Errorf("Flushing to an unreachable server should have failed")
+	}
+	// The job does not exist, so the server will reject the replayed
+	// requests and they should be dropped.
+	if err := q.Flush(session); err == nil {
+		t.Errorf("Replaying requests the server rejects should report an error")
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected the queue to be empty, not %d", q.Len())
+	}
+	// A full queue drops its oldest requests.
+	q = &requestQueue{max: 2}
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+		if err := q.send(offline, "PUT", []byte(line), "jobs", "foo", "log"); err != nil {
+			t.Errorf("Sending to an unreachable server should have been queued, not %v", err)
+		}
+	}
+	if q.Len() != 2 {
+		t.Errorf("Expected 2 queued requests, not %d", q.Len())
+	} else if string(q.entries[0].body.([]byte)) != "line 2\n" {
+		t.Errorf("Expected the oldest request to be dropped, got %q first", q.entries[0].body)
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+)
+
+// maxQueuedRequests is how many requests a requestQueue holds before
+// it starts dropping the oldest ones.
+const maxQueuedRequests = 10000
+
+// queuedRequest is a request that the agent could not send to
+// dr-provision.
+type queuedRequest struct {
+	method string
+	body   interface{}
+	path   []string
+}
+
+// requestQueue holds the job log appends and job state patches that
+// a MachineAgent running as a daemon could not send because
+// dr-provision was unreachable.  They are replayed in the order they
+// were made once it is reachable again.  If dr-provision stays away
+// long enough for the queue to fill up, the oldest requests are
+// dropped.
+type requestQueue struct {
+	mux     sync.Mutex
+	entries []queuedRequest
+	// max is how many requests can be queued.  0 means
+	// maxQueuedRequests.
+	max int
+	// logf, if set, is used to log dropped requests.
+	logf func(string, ...interface{})
+	// reauth is called to get a fresh token when a replayed request
+	// is refused for lack of authorization.
+	reauth func() error
+	// lastErr is the last error that caused a request to be dropped
+	// or left in the queue.
+	lastErr error
+}
+
+// send sends a request to dr-provision through the queue.  If the
+// queue is nil, the request is just sent.  Otherwise, the request is
+// queued behind any requests that are already waiting, and as many
+// of them as possible are sent.  A nil error means the request was
+// either sent or queued.
+func (q *requestQueue) send(c *Client, method string, body interface{}, path ...string) error {
+	if q == nil {
+		return c.Req().Meth(method).Body(body).UrlFor(path...).Do(nil)
+	}
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	max := q.max
+	if max <= 0 {
+		max = maxQueuedRequests
+	}
+	if dropped := len(q.entries) - max + 1; dropped > 0 {
+		q.entries = q.entries[dropped:]
+		if q.logf != nil {
+			q.logf("MachineAgent: request queue is full, dropped the %d oldest requests\n", dropped)
+		}
+	}
+	q.entries = append(q.entries, queuedRequest{method: method, body: body, path: path})
+	return q.flush(c)
+}
+
+// Flush tries to send everything in the queue.  It returns an error
+// if dr-provision is still unreachable.
+func (q *requestQueue) Flush(c *Client) error {
+	if q == nil {
+		return nil
+	}
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if err := q.flush(c); err != nil {
+		return err
+	}
+	if len(q.entries) > 0 {
+		return q.lastErr
+	}
+	return nil
+}
+
+// Len returns the number of requests waiting to be sent.
+func (q *requestQueue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.entries)
+}
+
+// try sends a single queued request, and reports whether it reached
+// dr-provision and the status code it got back.
+func (q *requestQueue) try(c *Client, e queuedRequest) (reached bool, code int, err error) {
+	r := c.Req().FailFast().Meth(e.method).Body(e.body).UrlFor(e.path...)
+	err = r.Do(nil)
+	if r.Resp == nil {
+		return false, 0, err
+	}
+	return true, r.Resp.StatusCode, err
+}
+
+// flush must be called with the queue locked.  Requests that
+// dr-provision rejects are dropped, since replaying them will not make
+// them succeed.  Only an error sending the newest request is returned
+// so that callers see the same errors they would without the queue.
+func (q *requestQueue) flush(c *Client) error {
+	for len(q.entries) > 0 {
+		e := q.entries[0]
+		reached, code, err := q.try(c, e)
+		if reached && (code == http.StatusUnauthorized || code == http.StatusForbidden) && q.reauth != nil {
+			if q.reauth() == nil {
+				reached, code, err = q.try(c, e)
+			}
+		}
+		if !reached {
+			// dr-provision is unreachable, leave everything queued.
+			q.lastErr = err
+			return nil
+		}
+		q.entries = q.entries[1:]
+		if err != nil {
+			q.lastErr = err
+			if len(q.entries) == 0 {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+func TestApiKeyLimits(t *testing.T) {
+	objs := []models.Model{
+		&models.Role{Name: "keyed-all", Claims: []*models.Claim{{Scope: "*", Action: "*", Specific: "*"}}},
+		&models.Role{Name: "keymaker", Claims: []*models.Claim{
+			{Scope: "users", Action: "apikey", Specific: "keyed"},
+			{Scope: "users", Action: "token", Specific: "keymaker"},
+			{Scope: "profiles", Action: "get", Specific: "*"},
+		}},
+		&models.User{Name: "keyed", Roles: []string{"keyed-all"}},
+		&models.User{Name: "keymaker", Roles: []string{"keymaker"}},
+	}
+	for _, obj := range objs {
+		if err := session.CreateModel(obj); err != nil {
+			t.Fatalf("Unable to create %s %s: %v", obj.Prefix(), obj.Key(), err)
+		}
+		defer session.DeleteModel(obj.Prefix(), obj.Key())
+	}
+	pwd := &models.UserPassword{Password: "Key-Maker-Passw0rd"}
+	if err := session.Req().Put(pwd).UrlFor("users", "keymaker", "password").Do(nil); err != nil {
+		t.Fatalf("Unable to set the password of keymaker: %v", err)
+	}
+	keymaker, err := UserSession(session.Endpoint(), "keymaker", pwd.Password)
+	if err != nil {
+		t.Fatalf("Unable to log in as keymaker: %v", err)
+	}
+	defer keymaker.Close()
+
+	// A key made for keyed by keymaker can only do what both of them
+	// can do.
+	res := &models.UserApiKey{}
+	if err := keymaker.Req().Post(&models.ApiKey{Name: "minted"}).UrlFor("users", "keyed", "apikeys").Do(res); err != nil {
+		t.Fatalf("Unable to create an API key for keyed: %v", err)
+	}
+	if len(res.ApiKey.Claims) != 3 {
+		t.Errorf("Expected the key to have the 3 Claims of keymaker, not %v", res.ApiKey.Claims)
+	}
+	keyed, err := ApiKeySession(session.Endpoint(), res.Key)
+	if err != nil {
+		t.Fatalf("Unable to use the API key: %v", err)
+	}
+	defer keyed.Close()
+	if _, err := keyed.GetModel("profiles", "global"); err != nil {
+		t.Errorf("The key should be able to get profiles: %v", err)
+	}
+	if _, err := keyed.GetModel("users", "rocketskates"); err == nil {
+		t.Errorf("The key should not be able to do everything keyed can")
+	}
+}
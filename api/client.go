@@ -37,10 +37,14 @@ type Client struct {
 	mux                          *sync.Mutex
 	endpoint, username, password string
 	token                        *models.UserToken
+	apiKey                       string
+	certAuth                     bool
 	closer                       chan struct{}
 	closed                       bool
+	authErr                      error
 	traceLvl                     string
 	traceToken                   string
+	etags                        map[string]string
 }
 
 func (c *Client) Endpoint() string {
@@ -50,6 +54,78 @@ func (c *Client) Username() string {
 	return c.username
 }
 
+// ETag returns the ETag the server last sent for the object of type
+// prefix with key, or "" if it has not sent one.
+func (c *Client) ETag(prefix, key string) string {
+	u, err := c.UrlFor(prefix, key)
+	if err != nil {
+		return ""
+	}
+	return c.etag(u.Path)
+}
+
+func (c *Client) etag(at string) string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.etags[at]
+}
+
+// paramsOwner returns the path of the object whose params at refers
+// to, or "" if at is not under the params of an object.
+func paramsOwner(at string) string {
+	i := strings.Index(at, APIPATH+"/")
+	if i == -1 {
+		return ""
+	}
+	base := i + len(APIPATH) + 1
+	parts := strings.SplitN(at[base:], "/", 4)
+	if len(parts) < 3 || parts[2] != "params" {
+		return ""
+	}
+	return at[:base] + parts[0] + "/" + parts[1]
+}
+
+// rememberETag keeps the ETag of a successful response, so that later
+// PUTs, PATCHes, and DELETEs of the same object can send it back in an
+// If-Match header.  POSTs go to the URL of the collection rather than
+// the object, so their ETags are not kept.  Writes to the params of
+// an object return the new ETag of the object, so it is kept for the
+// object.  Writes to other subpaths of an object, such as its actions,
+// change the object too, so they make the client forget its ETag.
+func (c *Client) rememberETag(method, at string, resp *http.Response) {
+	if resp.StatusCode >= 300 {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.etags == nil {
+		c.etags = map[string]string{}
+	}
+	if owner := paramsOwner(at); owner != "" && method != "GET" && method != "HEAD" {
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			c.etags[owner] = etag
+		} else {
+			delete(c.etags, owner)
+		}
+		return
+	}
+	if method != "GET" && method != "HEAD" {
+		for k := range c.etags {
+			if strings.HasPrefix(at, k+"/") {
+				delete(c.etags, k)
+			}
+		}
+	}
+	if method == "POST" {
+		return
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		c.etags[at] = etag
+	} else if method == "DELETE" {
+		delete(c.etags, at)
+	}
+}
+
 func (c *Client) UrlFor(args ...string) (*url.URL, error) {
 	return url.ParseRequestURI(c.endpoint + path.Join(APIPATH, path.Join(args...)))
 }
@@ -163,6 +239,14 @@ func (r *R) Patch(b jsonpatch2.Patch) *R {
 	return r.Meth("PATCH").Body(b)
 }
 
+// IfMatch makes the request fail with a 412 unless the object it acts
+// on still has the passed-in ETag.  PUTs, PATCHes, and DELETEs send the
+// ETag the server last sent for the object automatically.
+func (r *R) IfMatch(etag string) *R {
+	r.header.Set("If-Match", etag)
+	return r
+}
+
 // Must be used before PatchXXX calls
 func (r *R) ParanoidPatch() *R {
 	r.paranoid = true
@@ -415,6 +499,10 @@ func (r *R) Do(val interface{}) error {
 		r.err.Errorf("Connection Closed")
 		return r.err
 	}
+	if err := r.c.authError(); err != nil {
+		r.err.Errorf("Session is no longer valid: %v", err)
+		return r.err
+	}
 	if r.err.ContainsError() {
 		return r.err
 	}
@@ -423,6 +511,22 @@ func (r *R) Do(val interface{}) error {
 		r.Headers("X-Log-Token", r.traceToken)
 	}
 	r.Headers("Accept", "application/json")
+	etag := ""
+	if owner := paramsOwner(r.uri.Path); owner != "" {
+		// Params are part of the object they belong to.
+		switch r.method {
+		case "POST", "PUT", "PATCH", "DELETE":
+			etag = r.c.etag(owner)
+		}
+	} else {
+		switch r.method {
+		case "PUT", "PATCH", "DELETE":
+			etag = r.c.etag(r.uri.Path)
+		}
+	}
+	if etag != "" && r.header.Get("If-Match") == "" {
+		r.header.Set("If-Match", etag)
+	}
 	switch val.(type) {
 	case io.Writer:
 		r.Headers("Accept", "application/octet-stream")
@@ -472,6 +576,7 @@ func (r *R) Do(val interface{}) error {
 	r.Resp = resp
 	if resp != nil {
 		defer resp.Body.Close()
+		r.c.rememberETag(r.method, r.uri.Path, resp)
 	}
 	if wr, ok := val.(io.Writer); ok && resp.StatusCode < 300 {
 		_, err := io.Copy(wr, resp.Body)
@@ -532,12 +637,22 @@ func (c *Client) Close() {
 // Token returns the current authentication token associated with the
 // Client.
 func (c *Client) Token() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
 	if c.token == nil {
 		return ""
 	}
 	return c.token.Token
 }
 
+// authError returns why the Client could not refresh its token, if it
+// could not.
+func (c *Client) authError() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.authErr
+}
+
 // Info returns some basic system information that was retrieved as
 // part of the initial authentication.
 func (c *Client) Info() (*models.Info, error) {
@@ -556,7 +671,11 @@ func (c *Client) Logs() ([]logger.Line, error) {
 // you don't have to unless you are building your own http.Requests.
 func (c *Client) Authorize(req *http.Request) error {
 	if req.Header.Get("Authorization") == "" {
-		req.Header.Set("Authorization", "Bearer "+c.Token())
+		if c.apiKey != "" {
+			req.Header.Set("Authorization", "Key "+c.apiKey)
+		} else if !c.certAuth {
+			req.Header.Set("Authorization", "Bearer "+c.Token())
+		}
 	}
 	return nil
 }
@@ -682,6 +801,27 @@ func (c *Client) reauth(tok *models.UserToken) error {
 	return c.Req().UrlFor("users", c.username, "token").Params("ttl", "600").Do(&tok)
 }
 
+// ReauthMachine exchanges the current token of the Client, which must
+// be a token for the passed-in Machine, for a fresh one, and uses it
+// for all further requests made with the Client.  The current token
+// may have expired, but no longer ago than the knownTokenTimeout
+// preference.  The machine agent uses this to keep working when its
+// token expires.  Agents that can be cut off from dr-provision for
+// longer than that should use a client certificate instead.
+func (c *Client) ReauthMachine(m *models.Machine) error {
+	tok := &models.UserToken{}
+	if err := c.Req().
+		Meth("POST").
+		UrlFor("machines", m.Key(), "token").
+		Do(tok); err != nil {
+		return err
+	}
+	c.mux.Lock()
+	c.token = tok
+	c.mux.Unlock()
+	return nil
+}
+
 // PatchModel attempts to update the object matching the passed prefix
 // and key on the server side with the passed-in JSON patch (as
 // sepcified in https://tools.ietf.org/html/rfc6902).  To ensure that
@@ -706,9 +846,9 @@ func (c *Client) PatchToFull(old models.Model, new models.Model, paranoid bool)
 }
 
 // PutModel replaces the server-side object matching the passed-in
-// object with the passed-in object.  Note that PutModel does not
-// allow the server to detect and reject conflicting changes from
-// multiple sources.
+// object with the passed-in object.  If the Client has fetched or
+// changed the object before, the server rejects the PUT with a 412
+// when something else has changed the object since.
 func (c *Client) PutModel(obj models.Model) error {
 	return c.Req().Put(obj).UrlForM(obj).Do(&obj)
 }
@@ -736,6 +876,33 @@ func TokenSession(endpoint, token string) (*Client, error) {
 	return c, nil
 }
 
+// ApiKeySession creates a new api.Client that will use the passed-in
+// API key for authentication.  API keys do not expire unless they
+// were created to, so the Client never needs to refresh anything.
+func ApiKeySession(endpoint, apiKey string) (*Client, error) {
+	c, err := TokenSession(endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+	c.apiKey = apiKey
+	return c, nil
+}
+
+// CertSession creates a new api.Client that authenticates with the
+// passed-in client certificate instead of a token.  The server must
+// have been started with a client CA that the certificate verifies
+// against, and the certificate must name a User or a Machine.
+func CertSession(endpoint string, cert tls.Certificate) (*Client, error) {
+	c, err := TokenSession(endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+	tr := c.Client.Transport.(*http.Transport)
+	tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	c.certAuth = true
+	return c, nil
+}
+
 // UserSession creates a new api.Client that can act on behalf of a
 // user.  It will perform a single request using basic authentication
 // to get a token that expires 600 seconds from the time the session
@@ -744,6 +911,20 @@ func TokenSession(endpoint, token string) (*Client, error) {
 // UserSession does not currently attempt to cache tokens to
 // persistent storage, although that may change in the future.
 func UserSession(endpoint, username, password string) (*Client, error) {
+	return userSession(endpoint, username, password, "")
+}
+
+// TotpSession creates a new api.Client that acts on behalf of a user
+// that has TOTP enabled, using code as the one-time code for the
+// single request that uses basic authentication.  Since a code can
+// only be used once, the Client has to refresh its token before it
+// expires instead of falling back to basic authentication.  If it
+// cannot, all further requests made with the Client fail.
+func TotpSession(endpoint, username, password, code string) (*Client, error) {
+	return userSession(endpoint, username, password, code)
+}
+
+func userSession(endpoint, username, password, totp string) (*Client, error) {
 	tr := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
@@ -766,10 +947,14 @@ func UserSession(endpoint, username, password string) (*Client, error) {
 		closer:   make(chan struct{}, 0),
 	}
 	basicAuth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	headers := []string{"Authorization", "Basic " + basicAuth}
+	if totp != "" {
+		headers = append(headers, "X-DRP-TOTP", totp)
+	}
 	token := &models.UserToken{}
 	if err := c.Req().
 		UrlFor("users", c.username, "token").
-		Headers("Authorization", "Basic "+basicAuth).
+		Headers(headers...).
 		Do(&token); err != nil {
 		return nil, err
 	}
@@ -782,13 +967,23 @@ func UserSession(endpoint, username, password string) (*Client, error) {
 				return
 			case <-ticker.C:
 				token := &models.UserToken{}
-				if err := c.reauth(token); err != nil {
-					if err := c.Req().
+				err := c.reauth(token)
+				if err != nil && totp == "" {
+					err = c.Req().
 						UrlFor("users", c.username, "token").
 						Headers("Authorization", "Basic "+basicAuth).
-						Do(&token); err != nil {
-						log.Fatalf("Error reauthing token, aborting: %v", err)
-					}
+						Do(&token)
+				}
+				if err != nil {
+					// Every later request would fail anyway, so
+					// make them fail saying why.
+					log.Printf("Error reauthing token, session is no longer valid: %v", err)
+					ticker.Stop()
+					c.mux.Lock()
+					c.authErr = err
+					c.mux.Unlock()
+					<-c.closer
+					return
 				}
 				c.mux.Lock()
 				c.token = token
@@ -11,6 +11,7 @@ func TestContentCrud(t *testing.T) {
 	summary := `
 - Counts:
     bootenvs: 0
+    bulk_operations: 0
     jobs: 0
     leases: 0
     machines: 0
@@ -19,6 +20,7 @@ func TestContentCrud(t *testing.T) {
     preferences: 13
     profiles: 1
     reservations: 0
+    roles: 0
     stages: 0
     subnets: 0
     tasks: 0
@@ -73,6 +75,7 @@ func TestContentCrud(t *testing.T) {
     Writable: false
 - Counts:
     bootenvs: 2
+    roles: 1
     stages: 2
   Warnings: []
   meta:
@@ -101,6 +104,7 @@ meta:
   Writable: true
 sections:
   bootenvs: {}
+  bulk_operations: {}
   jobs: {}
   leases: {}
   machines: {}
@@ -173,6 +177,7 @@ sections:
       ReadOnly: false
       Validated: false
   reservations: {}
+  roles: {}
   stages: {}
   subnets: {}
   tasks: {}
@@ -186,6 +191,8 @@ sections:
       Name: rocketskates
       PasswordHash: elided
       ReadOnly: false
+      Roles:
+      - superuser
       Secret: elided
       Validated: false
   workflows: {}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/provision/models"
+)
+
+func TestETags(t *testing.T) {
+	p := &models.Profile{Name: "etag-test"}
+	if err := session.CreateModel(p); err != nil {
+		t.Fatalf("Unable to create etag-test: %v", err)
+	}
+	if _, err := session.GetModel("profiles", "etag-test"); err != nil {
+		t.Fatalf("Unable to fetch etag-test: %v", err)
+	}
+	first := session.ETag("profiles", "etag-test")
+	if first == "" {
+		t.Fatalf("No ETag for etag-test")
+	}
+	changed := models.Clone(p).(*models.Profile)
+	changed.Description = "changed"
+	if _, err := session.PatchTo(p, changed); err != nil {
+		t.Fatalf("Unable to patch etag-test: %v", err)
+	}
+	second := session.ETag("profiles", "etag-test")
+	if second == first {
+		t.Errorf("Patching etag-test did not change its ETag")
+	}
+
+	// Someone who last saw the first version cannot clobber the change.
+	stale := models.Clone(p).(*models.Profile)
+	stale.Description = "stale"
+	err := session.Req().Put(stale).UrlForM(stale).IfMatch(first).Do(nil)
+	if e, ok := err.(*models.Error); !ok || e.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 for a stale PUT, got %v", err)
+	}
+	err = session.Req().Del().UrlForM(stale).IfMatch(first).Do(nil)
+	if e, ok := err.(*models.Error); !ok || e.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 for a stale DELETE, got %v", err)
+	}
+
+	// The Client sends the ETag it last saw by itself.
+	changed.Description = "changed again"
+	if err := session.PutModel(changed); err != nil {
+		t.Errorf("Unable to put etag-test with the current ETag: %v", err)
+	}
+	if session.ETag("profiles", "etag-test") == second {
+		t.Errorf("Putting etag-test did not change its ETag")
+	}
+
+	// Writing to the params of etag-test sends its ETag, and the
+	// Client keeps the new ETag that comes back.
+	third := session.ETag("profiles", "etag-test")
+	err = session.Req().Post("value").UrlFor("profiles", "etag-test", "params", "etag-test-param").Do(nil)
+	if err != nil {
+		t.Errorf("Unable to set a param on etag-test: %v", err)
+	}
+	if fourth := session.ETag("profiles", "etag-test"); fourth == "" || fourth == third {
+		t.Errorf("Setting a param on etag-test should update its ETag, not %q", fourth)
+	}
+	err = session.Req().Post("stale").UrlFor("profiles", "etag-test", "params", "etag-test-param").IfMatch(third).Do(nil)
+	if e, ok := err.(*models.Error); !ok || e.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 for a stale param POST, got %v", err)
+	}
+	err = session.Req().Del().UrlFor("profiles", "etag-test", "params", "etag-test-param").IfMatch(third).Do(nil)
+	if e, ok := err.(*models.Error); !ok || e.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 for a stale param DELETE, got %v", err)
+	}
+
+	// PATCHes and DELETEs send the ETag they last saw too, so they
+	// fail once someone else has changed the object.
+	current, err := session.GetModel("profiles", "etag-test")
+	if err != nil {
+		t.Fatalf("Unable to fetch etag-test: %v", err)
+	}
+	other, err := UserSession("https://127.0.0.1:10011", "rocketskates", "r0cketsk8ts")
+	if err != nil {
+		t.Fatalf("Unable to create a second session: %v", err)
+	}
+	defer other.Close()
+	theirs := models.Clone(current).(*models.Profile)
+	theirs.Description = "theirs"
+	if err := other.PutModel(theirs); err != nil {
+		t.Fatalf("Unable to put etag-test from another session: %v", err)
+	}
+	ours := jsonpatch2.Patch{{Op: "replace", Path: "/Description", Value: "ours"}}
+	err = session.Req().Patch(ours).UrlFor("profiles", "etag-test").Do(nil)
+	if e, ok := err.(*models.Error); !ok || e.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 for a stale PATCH, got %v", err)
+	}
+	err = session.Req().Patch(ours).UrlFor("profiles", "etag-test", "params").Do(nil)
+	if e, ok := err.(*models.Error); !ok || e.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 for a stale params PATCH, got %v", err)
+	}
+	if _, err := session.DeleteModel("profiles", "etag-test"); err == nil {
+		t.Errorf("Expected a stale DELETE to fail")
+	} else if e, ok := err.(*models.Error); !ok || e.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 for a stale DELETE, got %v", err)
+	}
+	if _, err := session.GetModel("profiles", "etag-test"); err != nil {
+		t.Fatalf("Unable to fetch etag-test: %v", err)
+	}
+	if _, err := session.DeleteModel("profiles", "etag-test"); err != nil {
+		t.Errorf("Unable to delete etag-test: %v", err)
+	}
+	if session.ETag("profiles", "etag-test") != "" {
+		t.Errorf("The ETag of a deleted object should be forgotten")
+	}
+}
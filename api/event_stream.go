@@ -87,9 +87,12 @@ func (c *Client) ws() (*websocket.Conn, error) {
 		Proxy:           http.ProxyFromEnvironment,
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	header := http.Header{}
-	header.Set("Authorization", "Bearer "+c.Token())
-	res, _, err := dialer.Dial(ep.String(), header)
+	if tr, ok := c.Client.Transport.(*http.Transport); ok && tr.TLSClientConfig != nil {
+		dialer.TLSClientConfig = tr.TLSClientConfig
+	}
+	req := &http.Request{Header: http.Header{}}
+	c.Authorize(req)
+	res, _, err := dialer.Dial(ep.String(), req.Header)
 	return res, err
 }
 
@@ -362,10 +365,7 @@ func (es *EventStream) WaitFor(
 		select {
 		case evt := <-ch:
 			if evt.Err != nil {
-				return fmt.Sprintf("read: %v", err), err
-			}
-			if err != nil {
-				return fmt.Sprintf("read: %v", err), err
+				return fmt.Sprintf("read: %v", evt.Err), evt.Err
 			}
 		case <-interrupt:
 			return "interrupt", nil
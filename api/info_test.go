@@ -52,6 +52,8 @@ func TestInfo(t *testing.T) {
 				"workflows",
 				"default-workflow",
 				"http-range-header",
+				"bulk-operations",
+				"roles",
 			},
 		},
 		expectErr: nil,
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"github.com/digitalrebar/provision/models"
+)
+
+// PostInventory uploads inv as the newest inventory snapshot for the
+// Machine with the passed-in UUID.
+func (c *Client) PostInventory(uuid string, inv *models.Inventory) (*models.InventorySnapshot, error) {
+	res := &models.InventorySnapshot{}
+	return res, c.Req().Post(inv).UrlFor("machines", uuid, "inventory").Do(res)
+}
+
+// InventoryHistory returns the IDs of the inventory snapshots stored
+// for the Machine with the passed-in UUID, oldest first.
+func (c *Client) InventoryHistory(uuid string) ([]string, error) {
+	res := []string{}
+	return res, c.Req().UrlFor("machines", uuid, "inventory").Do(&res)
+}
+
+// GetInventory returns the inventory snapshot id of the Machine with
+// the passed-in UUID.  An id of "latest" returns the most recent
+// one.
+func (c *Client) GetInventory(uuid, id string) (*models.Inventory, error) {
+	res := &models.Inventory{}
+	return res, c.Req().UrlFor("machines", uuid, "inventory", id).Do(res)
+}
+
+// inventory collects the hardware inventory of the Machine the task
+// is running on and uploads it.
+func (r *TaskRunner) inventory() error {
+	inv, err := CollectInventory()
+	if err != nil {
+		return err
+	}
+	snap, err := r.c.PostInventory(r.m.Key(), inv)
+	if err != nil {
+		return err
+	}
+	r.Log("Uploaded inventory snapshot %s", snap.ID)
+	for _, change := range snap.Changes {
+		r.Log("Hardware change since %s: %s", snap.Previous, change)
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// sysRoot is where the /sys and /proc filesystems are looked for.
+var sysRoot = "/"
+
+func sysPath(parts ...string) string {
+	return filepath.Join(append([]string{sysRoot}, parts...)...)
+}
+
+// readSys returns the trimmed contents of a sysfs file, or "" if it
+// cannot be read.
+func readSys(parts ...string) string {
+	buf, err := ioutil.ReadFile(sysPath(parts...))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// linkBase returns the last part of where a sysfs symlink points.
+func linkBase(parts ...string) string {
+	dest, err := os.Readlink(sysPath(parts...))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(dest)
+}
+
+// runTool runs an optional helper program and returns its output.
+// Missing programs and failures just result in no output, since the
+// inventory is still useful without what they provide.
+func runTool(name string, args ...string) []byte {
+	cmdPath, err := exec.LookPath(name)
+	if err != nil {
+		return nil
+	}
+	out, _ := exec.Command(cmdPath, args...).Output()
+	return out
+}
+
+// CollectInventory gathers the hardware inventory of the system it
+// is running on.  Information that needs dmidecode, lldpctl, or
+// smartctl is left out if they are not installed.
+func CollectInventory() (*models.Inventory, error) {
+	cpuinfo, err := ioutil.ReadFile(sysPath("proc", "cpuinfo"))
+	if err != nil {
+		return nil, err
+	}
+	res := &models.Inventory{
+		Time:   time.Now(),
+		DMI:    collectDMI(),
+		CPUs:   parseCPUInfo(cpuinfo),
+		Memory: parseDIMMs(runTool("dmidecode", "-t", "17")),
+		NICs:   collectNICs(parseLLDP(runTool("lldpctl", "-f", "keyvalue"))),
+		Disks:  collectDisks(),
+		PCI:    collectPCI(),
+	}
+	res.Fill()
+	return res, nil
+}
+
+var dmiFields = []string{
+	"sys_vendor", "product_name", "product_version", "product_serial", "product_uuid",
+	"board_vendor", "board_name", "board_version", "board_serial",
+	"chassis_vendor", "chassis_type", "chassis_serial",
+	"bios_vendor", "bios_version", "bios_date",
+}
+
+func collectDMI() map[string]string {
+	res := map[string]string{}
+	for _, field := range dmiFields {
+		if val := readSys("sys", "class", "dmi", "id", field); val != "" {
+			res[field] = val
+		}
+	}
+	return res
+}
+
+// splitBlocks splits the output of tools like dmidecode and the
+// contents of /proc/cpuinfo into blocks of key: value pairs separated
+// by blank lines.
+func splitBlocks(buf []byte) [][]map[string]string {
+	res := [][]map[string]string{}
+	block := []map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(buf))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			if len(block) > 0 {
+				res = append(res, block)
+				block = []map[string]string{}
+			}
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		kv := map[string]string{"": line}
+		if len(parts) == 2 {
+			kv = map[string]string{strings.TrimSpace(parts[0]): strings.TrimSpace(parts[1])}
+		}
+		block = append(block, kv)
+	}
+	if len(block) > 0 {
+		res = append(res, block)
+	}
+	return res
+}
+
+func blockMap(block []map[string]string) map[string]string {
+	res := map[string]string{}
+	for _, kv := range block {
+		for k, v := range kv {
+			if _, ok := res[k]; !ok {
+				res[k] = v
+			}
+		}
+	}
+	return res
+}
+
+func parseCPUInfo(buf []byte) []models.InventoryCPU {
+	sockets := map[int]*models.InventoryCPU{}
+	for _, block := range splitBlocks(buf) {
+		vals := blockMap(block)
+		if _, ok := vals["processor"]; !ok {
+			continue
+		}
+		socket, _ := strconv.Atoi(vals["physical id"])
+		cpu, ok := sockets[socket]
+		if !ok {
+			cpu = &models.InventoryCPU{
+				Socket: socket,
+				Vendor: vals["vendor_id"],
+				Model:  vals["model name"],
+			}
+			cpu.Cores, _ = strconv.Atoi(vals["cpu cores"])
+			cpu.MHz, _ = strconv.ParseFloat(vals["cpu MHz"], 64)
+			sockets[socket] = cpu
+		}
+		cpu.Threads++
+	}
+	res := []models.InventoryCPU{}
+	for _, cpu := range sockets {
+		if cpu.Cores == 0 {
+			cpu.Cores = cpu.Threads
+		}
+		res = append(res, *cpu)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Socket < res[j].Socket })
+	return res
+}
+
+// dimmSize converts the Size reported by dmidecode to megabytes.
+func dimmSize(size string) int64 {
+	parts := strings.Fields(size)
+	if len(parts) != 2 {
+		return 0
+	}
+	val, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+	switch parts[1] {
+	case "kB":
+		return val / 1024
+	case "MB":
+		return val
+	case "GB":
+		return val * 1024
+	case "TB":
+		return val * 1024 * 1024
+	}
+	return 0
+}
+
+func parseDIMMs(buf []byte) []models.InventoryDIMM {
+	res := []models.InventoryDIMM{}
+	for _, block := range splitBlocks(buf) {
+		vals := blockMap(block)
+		if _, ok := vals[""]; !ok {
+			continue
+		}
+		isDevice := false
+		for _, kv := range block {
+			if kv[""] == "Memory Device" {
+				isDevice = true
+				break
+			}
+		}
+		size := dimmSize(vals["Size"])
+		if !isDevice || size == 0 || vals["Locator"] == "" {
+			continue
+		}
+		dimm := models.InventoryDIMM{
+			Locator:      vals["Locator"],
+			Manufacturer: vals["Manufacturer"],
+			PartNumber:   vals["Part Number"],
+			Serial:       vals["Serial Number"],
+			Type:         vals["Type"],
+			SizeMB:       size,
+		}
+		if speed := strings.Fields(vals["Speed"]); len(speed) > 0 {
+			dimm.Speed, _ = strconv.Atoi(speed[0])
+		}
+		res = append(res, dimm)
+	}
+	return res
+}
+
+// lldpField returns the field of the neighbor that an lldpctl
+// keyvalue key (without the lldp.<interface> prefix) fills in.
+func lldpField(n *models.InventoryLLDPNeighbor, key string) *string {
+	switch key {
+	case "chassis.mac", "chassis.id":
+		return &n.ChassisID
+	case "chassis.name":
+		return &n.SystemName
+	case "port.ifname", "port.mac", "port.local":
+		return &n.PortID
+	case "port.descr":
+		return &n.PortDescription
+	}
+	return nil
+}
+
+// parseLLDP parses the output of lldpctl -f keyvalue into the
+// neighbors seen on each interface.
+func parseLLDP(buf []byte) map[string][]models.InventoryLLDPNeighbor {
+	res := map[string][]models.InventoryLLDPNeighbor{}
+	sc := bufio.NewScanner(bytes.NewReader(buf))
+	for sc.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(sc.Text()), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.Split(parts[0], ".")
+		if len(key) < 4 || key[0] != "lldp" {
+			continue
+		}
+		iface, field := key[1], strings.Join(key[2:], ".")
+		if lldpField(&models.InventoryLLDPNeighbor{}, field) == nil {
+			continue
+		}
+		neighbors := res[iface]
+		// A field we already have starts another neighbor on the
+		// same interface.
+		if len(neighbors) == 0 || *lldpField(&neighbors[len(neighbors)-1], field) != "" {
+			neighbors = append(neighbors, models.InventoryLLDPNeighbor{})
+		}
+		*lldpField(&neighbors[len(neighbors)-1], field) = parts[1]
+		res[iface] = neighbors
+	}
+	return res
+}
+
+func collectNICs(lldp map[string][]models.InventoryLLDPNeighbor) []models.InventoryNIC {
+	res := []models.InventoryNIC{}
+	ents, err := ioutil.ReadDir(sysPath("sys", "class", "net"))
+	if err != nil {
+		return res
+	}
+	for _, ent := range ents {
+		name := ent.Name()
+		// Only interfaces backed by a device are physical.
+		if _, err := os.Stat(sysPath("sys", "class", "net", name, "device")); err != nil {
+			continue
+		}
+		nic := models.InventoryNIC{
+			Name:      name,
+			MAC:       readSys("sys", "class", "net", name, "address"),
+			Driver:    linkBase("sys", "class", "net", name, "device", "driver"),
+			Neighbors: lldp[name],
+		}
+		if speed, err := strconv.Atoi(readSys("sys", "class", "net", name, "speed")); err == nil && speed > 0 {
+			nic.SpeedMbps = speed
+		}
+		if nic.Neighbors == nil {
+			nic.Neighbors = []models.InventoryLLDPNeighbor{}
+		}
+		res = append(res, nic)
+	}
+	return res
+}
+
+// parseSmart picks the serial number and overall health out of the
+// output of smartctl -H -i.
+func parseSmart(buf []byte) (serial, status string) {
+	sc := bufio.NewScanner(bytes.NewReader(buf))
+	for sc.Scan() {
+		parts := strings.SplitN(sc.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "Serial Number", "Serial number":
+			serial = val
+		case "SMART overall-health self-assessment test result", "SMART Health Status":
+			status = val
+		}
+	}
+	return
+}
+
+func collectDisks() []models.InventoryDisk {
+	res := []models.InventoryDisk{}
+	ents, err := ioutil.ReadDir(sysPath("sys", "block"))
+	if err != nil {
+		return res
+	}
+	for _, ent := range ents {
+		name := ent.Name()
+		// Only block devices backed by a device are physical disks.
+		if _, err := os.Stat(sysPath("sys", "block", name, "device")); err != nil {
+			continue
+		}
+		disk := models.InventoryDisk{
+			Name:       name,
+			Vendor:     readSys("sys", "block", name, "device", "vendor"),
+			Model:      readSys("sys", "block", name, "device", "model"),
+			Serial:     readSys("sys", "block", name, "device", "serial"),
+			Rotational: readSys("sys", "block", name, "queue", "rotational") == "1",
+		}
+		if sectors, err := strconv.ParseInt(readSys("sys", "block", name, "size"), 10, 64); err == nil {
+			disk.SizeBytes = sectors * 512
+		}
+		serial, status := parseSmart(runTool("smartctl", "-H", "-i", "/dev/"+name))
+		if disk.Serial == "" {
+			disk.Serial = serial
+		}
+		disk.SmartStatus = status
+		res = append(res, disk)
+	}
+	return res
+}
+
+func collectPCI() []models.InventoryPCIDevice {
+	res := []models.InventoryPCIDevice{}
+	ents, err := ioutil.ReadDir(sysPath("sys", "bus", "pci", "devices"))
+	if err != nil {
+		return res
+	}
+	for _, ent := range ents {
+		addr := ent.Name()
+		res = append(res, models.InventoryPCIDevice{
+			Address: addr,
+			Class:   readSys("sys", "bus", "pci", "devices", addr, "class"),
+			Vendor:  readSys("sys", "bus", "pci", "devices", addr, "vendor"),
+			Device:  readSys("sys", "bus", "pci", "devices", addr, "device"),
+			Driver:  linkBase("sys", "bus", "pci", "devices", addr, "driver"),
+		})
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+func TestInventoryParsers(t *testing.T) {
+	cpus := parseCPUInfo([]byte(`processor	: 0
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) CPU
+physical id	: 0
+cpu cores	: 2
+cpu MHz		: 2400.000
+
+processor	: 1
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) CPU
+physical id	: 0
+cpu cores	: 2
+cpu MHz		: 2400.000
+
+processor	: 2
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) CPU
+physical id	: 1
+cpu cores	: 2
+cpu MHz		: 2400.000
+`))
+	if len(cpus) != 2 || cpus[0].Threads != 2 || cpus[1].Socket != 1 || cpus[1].Cores != 2 {
+		t.Errorf("Unexpected CPUs: %#v", cpus)
+	}
+	dimms := parseDIMMs([]byte(`# dmidecode 3.1
+
+Handle 0x0037, DMI type 17, 40 bytes
+Memory Device
+	Size: 16 GB
+	Locator: DIMM_A1
+	Type: DDR4
+	Speed: 2400 MT/s
+	Manufacturer: Samsung
+	Serial Number: 1234ABCD
+	Part Number: M393A2K40BB1-CRC
+
+Handle 0x0038, DMI type 17, 40 bytes
+Memory Device
+	Size: No Module Installed
+	Locator: DIMM_A2
+`))
+	if len(dimms) != 1 || dimms[0].Locator != "DIMM_A1" || dimms[0].SizeMB != 16384 || dimms[0].Speed != 2400 {
+		t.Errorf("Unexpected DIMMs: %#v", dimms)
+	}
+	lldp := parseLLDP([]byte(`lldp.eth0.via=LLDP
+lldp.eth0.chassis.mac=00:11:22:33:44:55
+lldp.eth0.chassis.name=switch1
+lldp.eth0.port.ifname=Ethernet1
+lldp.eth0.port.descr=uplink
+lldp.eth0.chassis.mac=00:11:22:33:44:66
+lldp.eth0.chassis.name=switch2
+lldp.eth0.port.ifname=Ethernet2
+`))
+	expect := []models.InventoryLLDPNeighbor{
+		{ChassisID: "00:11:22:33:44:55", SystemName: "switch1", PortID: "Ethernet1", PortDescription: "uplink"},
+		{ChassisID: "00:11:22:33:44:66", SystemName: "switch2", PortID: "Ethernet2"},
+	}
+	if len(lldp["eth0"]) != 2 || lldp["eth0"][0] != expect[0] || lldp["eth0"][1] != expect[1] {
+		t.Errorf("Unexpected LLDP neighbors: %#v", lldp)
+	}
+	serial, status := parseSmart([]byte(`=== START OF INFORMATION SECTION ===
+Device Model:     Samsung SSD 860
+Serial Number:    S3Z9NB0K
+=== START OF READ SMART DATA SECTION ===
+SMART overall-health self-assessment test result: PASSED
+`))
+	if serial != "S3Z9NB0K" || status != "PASSED" {
+		t.Errorf("Unexpected SMART data: %s %s", serial, status)
+	}
+}
@@ -0,0 +1,16 @@
+// +build !linux
+
+package api
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// CollectInventory gathers the hardware inventory of the system it
+// is running on.  It is only supported on Linux.
+func CollectInventory() (*models.Inventory, error) {
+	return nil, fmt.Errorf("Inventory collection is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// SetParamAction is the Content of a JobAction with the "set-param"
+// Interpreter.  The agent sets Name to Value on the Machine the Job
+// is running on.
+type SetParamAction struct {
+	Name  string
+	Value interface{}
+}
+
+// DownloadAction is the Content of a JobAction with the "download"
+// Interpreter.  The agent fetches Url and writes it to Path, which is
+// relative to the task directory unless it is absolute.  If Sha256 is
+// set, the download fails unless the checksum of what was fetched
+// matches it.
+type DownloadAction struct {
+	Url    string
+	Path   string
+	Sha256 string
+}
+
+// interpreters are the commands we will look for on the path to run
+// scripts for each script Interpreter, in order of preference.
+var interpreters = map[string][]string{
+	"python":     {"python3", "python"},
+	"powershell": {"pwsh", "powershell"},
+}
+
+// scriptCommand returns the command that will run taskFile according
+// to the Interpreter of the action.
+func (r *TaskRunner) scriptCommand(action *models.JobAction, taskFile string) (*exec.Cmd, error) {
+	candidates, ok := interpreters[action.Interpreter]
+	if !ok {
+		return exec.Command("./" + path.Base(taskFile)), nil
+	}
+	for _, candidate := range candidates {
+		cmdPath, err := exec.LookPath(candidate)
+		if err != nil {
+			continue
+		}
+		if action.Interpreter == "powershell" {
+			return exec.Command(cmdPath, "-NoProfile", "-NonInteractive", "-File", "./"+path.Base(taskFile)), nil
+		}
+		return exec.Command(cmdPath, "./"+path.Base(taskFile)), nil
+	}
+	return nil, fmt.Errorf("No %s interpreter found, tried %s",
+		action.Interpreter,
+		strings.Join(candidates, ", "))
+}
+
+// Builtin performs an action that the agent handles by itself
+// instead of running an external command.  Problems with the action
+// fail the task instead of the runner.
+func (r *TaskRunner) Builtin(action *models.JobAction, taskDir string) error {
+	r.Log("%s: Running built-in %s action %s", time.Now(), action.Interpreter, action.Name)
+	var err error
+	switch action.Interpreter {
+	case "set-param":
+		err = r.setParam(action)
+	case "reboot":
+		if msg := strings.TrimSpace(action.Content); msg != "" {
+			r.Log("%s", msg)
+		}
+		r.reboot = true
+	case "download":
+		err = r.download(action, taskDir)
+	case "inventory":
+		err = r.inventory()
+	default:
+		err = fmt.Errorf("Unknown built-in action type %s", action.Interpreter)
+	}
+	if err != nil {
+		r.Log("Action %s failed: %v", action.Name, err)
+		r.failed = true
+	}
+	return nil
+}
+
+func (r *TaskRunner) setParam(action *models.JobAction) error {
+	sp := &SetParamAction{}
+	if err := json.Unmarshal([]byte(action.Content), sp); err != nil {
+		return fmt.Errorf("Invalid set-param action: %v", err)
+	}
+	if sp.Name == "" {
+		return fmt.Errorf("Invalid set-param action: missing Name")
+	}
+	res := map[string]interface{}{}
+	if err := r.c.Req().Post(sp.Value).UrlFor("machines", r.m.Key(), "params", sp.Name).Do(&res); err != nil {
+		return err
+	}
+	r.Log("Set param %s on machine %s", sp.Name, r.m.Key())
+	return nil
+}
+
+func (r *TaskRunner) download(action *models.JobAction, taskDir string) error {
+	dl := &DownloadAction{}
+	if err := json.Unmarshal([]byte(action.Content), dl); err != nil {
+		return fmt.Errorf("Invalid download action: %v", err)
+	}
+	if dl.Url == "" || dl.Path == "" {
+		return fmt.Errorf("Invalid download action: Url and Path must be set")
+	}
+	if !strings.HasPrefix(dl.Path, "/") {
+		dl.Path = path.Join(taskDir, path.Clean(dl.Path))
+	}
+	r.Log("Downloading %s to %s", dl.Url, dl.Path)
+	resp, err := r.c.Get(dl.Url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Download of %s failed: %s", dl.Url, resp.Status)
+	}
+	if err := os.MkdirAll(filepath.Dir(dl.Path), os.ModePerm); err != nil {
+		return err
+	}
+	tmpName := dl.Path + ".part"
+	fi, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpName)
+	sum := sha256.New()
+	_, err = io.Copy(io.MultiWriter(fi, sum), resp.Body)
+	fi.Close()
+	if err != nil {
+		return err
+	}
+	if dl.Sha256 != "" {
+		if got := hex.EncodeToString(sum.Sum(nil)); !strings.EqualFold(got, dl.Sha256) {
+			return fmt.Errorf("Checksum mismatch for %s: expected %s, got %s", dl.Url, dl.Sha256, got)
+		}
+	}
+	return os.Rename(tmpName, dl.Path)
+}
@@ -4,6 +4,7 @@ package api
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,6 +12,7 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -26,6 +28,91 @@ func (c *Client) JobLog(j *models.Job, dst io.Writer) error {
 	return c.Req().UrlFor("jobs", j.Key(), "log").Do(dst)
 }
 
+// JobLogFrom gets the log for a specific Job starting at the passed
+// byte offset and writes it to the passed io.Writer.  It returns the
+// number of bytes written.
+func (c *Client) JobLogFrom(j *models.Job, offset int64, dst io.Writer) (int64, error) {
+	cw := &countingWriter{w: dst}
+	err := c.Req().UrlFor("jobs", j.Key(), "log").Params("offset", strconv.FormatInt(offset, 10)).Do(cw)
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(buf []byte) (int, error) {
+	n, err := cw.w.Write(buf)
+	cw.n += int64(n)
+	return n, err
+}
+
+// FollowJobLog writes the log for a specific Job to dst starting at
+// the passed byte offset, and then keeps writing anything appended to
+// the log until the Job is finished or failed.  It uses the
+// jobs.log events published by the server, and will refetch from the
+// last offset it wrote if it misses any of them.
+func (c *Client) FollowJobLog(j *models.Job, offset int64, dst io.Writer) error {
+	es, err := c.Events()
+	if err != nil {
+		return err
+	}
+	defer es.Close()
+	handle, ch, err := es.Register(
+		"jobs.log."+j.Key(),
+		"jobs.update."+j.Key(),
+		"jobs.save."+j.Key())
+	if err != nil {
+		return err
+	}
+	defer es.Deregister(handle)
+	catchUp := func() error {
+		n, err := c.JobLogFrom(j, offset, dst)
+		offset += n
+		return err
+	}
+	if err := c.FillModel(j, j.Key()); err != nil {
+		return err
+	}
+	if err := catchUp(); err != nil {
+		return err
+	}
+	for j.State != "finished" && j.State != "failed" {
+		evt, ok := <-ch
+		if !ok {
+			return fmt.Errorf("Event stream closed")
+		}
+		if evt.Err != nil {
+			return evt.Err
+		}
+		if evt.E.Action != "log" {
+			if err := utils.Remarshal(evt.E.Object, j); err != nil {
+				return err
+			}
+			continue
+		}
+		chunk := &models.JobLogChunk{}
+		if err := utils.Remarshal(evt.E.Object, chunk); err != nil {
+			return err
+		}
+		switch {
+		case chunk.Offset > offset:
+			// We missed something, get it all from the server.
+			if err := catchUp(); err != nil {
+				return err
+			}
+		case chunk.Offset+int64(len(chunk.Data)) > offset:
+			n, err := dst.Write(chunk.Data[offset-chunk.Offset:])
+			offset += int64(n)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return catchUp()
+}
+
 // JobActions returns the expanded list of templates that should be
 // written or executed for a specific Job.
 func (c *Client) JobActions(j *models.Job) ([]*models.JobAction, error) {
@@ -33,6 +120,36 @@ func (c *Client) JobActions(j *models.Job) ([]*models.JobAction, error) {
 	return res, c.Req().UrlFor("jobs", j.Key(), "actions").Do(&res)
 }
 
+// JobArtifacts returns the list of artifacts that have been uploaded
+// for a specific Job.
+func (c *Client) JobArtifacts(j *models.Job) ([]models.JobArtifact, error) {
+	res := []models.JobArtifact{}
+	return res, c.Req().UrlFor("jobs", j.Key(), "artifacts").Do(&res)
+}
+
+// JobArtifact gets a single artifact for a specific Job and writes it
+// to the passed io.Writer
+func (c *Client) JobArtifact(j *models.Job, name string, dst io.Writer) error {
+	return c.Req().UrlFor("jobs", j.Key(), "artifacts", name).Do(dst)
+}
+
+// UploadJobArtifact uploads the contents of src as the artifact name
+// for a specific Job.  If contentType is empty, the server will guess
+// it based on the extension of name.
+func (c *Client) UploadJobArtifact(j *models.Job, name, contentType string, src io.Reader) (*models.JobArtifact, error) {
+	res := &models.JobArtifact{}
+	req := c.Req().Post(src).UrlFor("jobs", j.Key(), "artifacts", name)
+	if contentType != "" {
+		req.header.Set("Content-Type", contentType)
+	}
+	return res, req.Do(res)
+}
+
+// DeleteJobArtifact removes a single artifact from a specific Job.
+func (c *Client) DeleteJobArtifact(j *models.Job, name string) error {
+	return c.Req().Del().UrlFor("jobs", j.Key(), "artifacts", name).Do(nil)
+}
+
 // TaskRunner is responsible for expanding templates and running
 // scripts for a single task.
 type TaskRunner struct {
@@ -54,6 +171,13 @@ type TaskRunner struct {
 	pipeWriter       *os.File
 	agentDir, jobDir string
 	logger           io.Writer
+	// The limits that script actions will run under, if any.
+	sandbox *models.TaskSandbox
+	// The cgroup the current action is running in, if any.
+	cgroup string
+	// Where job log and state updates are queued when the agent
+	// is running as a daemon and dr-provision is unreachable.
+	queue *requestQueue
 }
 
 // NewTaskRunner creates a new TaskRunner for the passed-in machine.
@@ -143,28 +267,63 @@ func (r *TaskRunner) Expand(action *models.JobAction, taskDir string) error {
 	return nil
 }
 
-// Perform runs a single script action.
+// Perform runs a single script action, using the interpreter the
+// action asks for if it is not a plain shell script.
 func (r *TaskRunner) Perform(action *models.JobAction, taskDir string) error {
 	taskFile := path.Join(taskDir, r.j.Task+"-"+action.Name)
+	if action.Interpreter == "powershell" && !strings.HasSuffix(taskFile, ".ps1") {
+		// powershell refuses to run scripts without this extension.
+		taskFile += ".ps1"
+	}
 	if err := ioutil.WriteFile(taskFile, []byte(action.Content), 0700); err != nil {
 		r.Log("Unable to write to script %s: %v", taskFile, err)
 		return err
 	}
-	cmd := exec.Command("./" + path.Base(taskFile))
+	cmd, err := r.scriptCommand(action, taskFile)
+	if err != nil {
+		r.Log("Unable to run script %s: %v", taskFile, err)
+		r.failed = true
+		return nil
+	}
 	cmd.Dir = taskDir
-	cmd.Env = append(os.Environ(), "RS_TASK_DIR="+taskDir, "RS_RUNNER_DIR="+r.agentDir)
+	cmd.Env, err = r.sandboxEnv(taskDir, []string{
+		"RS_TASK_DIR=" + taskDir,
+		"RS_RUNNER_DIR=" + r.agentDir,
+		"RS_ARTIFACT_DIR=" + path.Join(taskDir, "artifacts"),
+		"RS_OUTPUT_FILE=" + path.Join(taskDir, "outputs.json")})
+	if err == nil {
+		err = r.sandboxPrepare(cmd, taskDir, path.Base(taskFile))
+	}
+	if err != nil {
+		r.Log("Unable to set up sandbox for %s: %v", taskFile, err)
+		r.failed = true
+		return nil
+	}
 	cmd.Stdout = r.in
 	cmd.Stderr = r.in
 	r.Log("Starting command %s\n\n", cmd.Path)
-	if err := cmd.Start(); err != nil {
+	if err := r.sandboxStart(cmd); err != nil {
 		r.Log("Command failed to start: %v", err)
+		r.sandboxDone(cmd)
 		return err
 	}
+	timedOut := r.sandboxTimeout(cmd)
 	// Wait on the process, not the command to exit.
 	// We don't want to auto-close stdout and stderr,
 	// as we will continue to use them.
 	r.Log("Command running")
 	pState, _ := cmd.Process.Wait()
+	if timedOut() {
+		r.Log("Command killed after running for more than %d seconds", r.sandbox.Timeout)
+		r.sandboxDone(cmd)
+		r.failed = true
+		return nil
+	}
+	if r.sandboxDone(cmd) {
+		r.Log("Command killed for using more than %d MB of memory", r.sandbox.MemoryMB)
+		r.failed = true
+		return nil
+	}
 	status := pState.Sys().(syscall.WaitStatus)
 	sane := r.t.HasFeature("sane-exit-codes")
 	if !sane {
@@ -203,6 +362,51 @@ func (r *TaskRunner) Perform(action *models.JobAction, taskDir string) error {
 	return nil
 }
 
+// uploadArtifacts uploads every regular file under dir as an artifact
+// of the Job, named by its path relative to dir.
+func (r *TaskRunner) uploadArtifacts(dir string) {
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		fi, err := os.Open(p)
+		if err != nil {
+			r.Log("Failed to open artifact %s: %v", name, err)
+			return nil
+		}
+		defer fi.Close()
+		if _, err := r.c.UploadJobArtifact(r.j, filepath.ToSlash(name), "", fi); err != nil {
+			r.Log("Failed to upload artifact %s: %v", name, err)
+		} else {
+			r.Log("Uploaded artifact %s", name)
+		}
+		return nil
+	})
+}
+
+// readOutputs reads the values for the OutputParams of the Task
+// from the JSON object that the task actions left in fileName.  The
+// values will be validated and set on the Machine by the server when
+// the Job finishes.
+func (r *TaskRunner) readOutputs(fileName string) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	buf, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &res); err != nil {
+		return nil, fmt.Errorf("Invalid outputs in %s: %v", path.Base(fileName), err)
+	}
+	return res, nil
+}
+
 // Run loops over all of the actions for a particular job,
 // placing files and executing scripts as appropriate.
 // It also arranges for all logging output for the actions
@@ -231,7 +435,7 @@ func (r *TaskRunner) Run() error {
 				return
 			}
 			line := scanner.Text() + "\n"
-			if r.c.Req().Put([]byte(line)).UrlFor("jobs", key, "log").Do(nil) != nil {
+			if r.queue.send(r.c, "PUT", []byte(line), "jobs", key, "log") != nil {
 				return
 			}
 		}
@@ -249,10 +453,24 @@ func (r *TaskRunner) Run() error {
 		finalErr.AddError(err)
 		return finalErr
 	}
+	// Anything the task leaves in the artifacts directory will be
+	// uploaded to the Job when the task is done.
+	artifactDir := path.Join(taskDir, "artifacts")
+	if err := os.MkdirAll(artifactDir, 0700); err != nil {
+		r.Log("Failed to create artifact dir: %v", err)
+		finalErr.AddError(err)
+		return finalErr
+	}
 	// No matter how the function exits, we will try to patch the Job
 	// to an appropriate final state.
 	defer os.RemoveAll(taskDir)
 	defer func() {
+		r.uploadArtifacts(artifactDir)
+		outputs, err := r.readOutputs(path.Join(taskDir, "outputs.json"))
+		if err != nil {
+			r.Log("Failed to read task outputs: %v", err)
+			finalState = "failed"
+		}
 		if r.failed || r.reboot || r.stop || r.poweroff || r.incomplete {
 			newM := models.Clone(r.m).(*models.Machine)
 			newM.Runnable = false
@@ -279,7 +497,16 @@ func (r *TaskRunner) Run() error {
 			{Op: "replace", Path: "/State", Value: finalState},
 			{Op: "replace", Path: "/ExitState", Value: exitState},
 		}
-		if err := r.c.Req().Patch(finalPatch).UrlForM(r.j).Do(&r.j); err != nil {
+		if finalState == "finished" && len(outputs) > 0 {
+			finalPatch = append(finalPatch, jsonpatch2.Operation{Op: "replace", Path: "/Outputs", Value: outputs})
+		}
+		if r.queue != nil {
+			if err := r.queue.send(r.c, "PATCH", finalPatch, "jobs", r.j.Key()); err != nil {
+				r.Log("Failed to update job %s to its final state %s", r.j.Key(), finalState)
+			} else {
+				r.Log("Updated or queued update of job %s to %s", r.j.Key(), finalState)
+			}
+		} else if err := r.c.Req().Patch(finalPatch).UrlForM(r.j).Do(&r.j); err != nil {
 			r.Log("Failed to update job %s to its final state %s", r.j.Key(), finalState)
 		} else {
 			r.Log("Updated job %s to %s", r.j.Key(), finalState)
@@ -299,6 +526,11 @@ func (r *TaskRunner) Run() error {
 		finalErr.AddError(err)
 		return finalErr
 	}
+	if err := r.loadSandbox(); err != nil {
+		r.Log("Failed to load task sandbox: %v", err)
+		finalErr.AddError(err)
+		return finalErr
+	}
 	for i, action := range actions {
 		final := len(actions)-1 == i
 		r.failed = false
@@ -307,9 +539,14 @@ func (r *TaskRunner) Run() error {
 		r.reboot = false
 		r.stop = false
 		var err error
-		if action.Path != "" {
-			err = r.Expand(action, taskDir)
-		} else {
+		switch action.Interpreter {
+		case "set-param", "reboot", "download", "inventory":
+			err = r.Builtin(action, taskDir)
+		default:
+			if action.Path != "" {
+				err = r.Expand(action, taskDir)
+				break
+			}
 			if !helperWritten {
 				err = ioutil.WriteFile(path.Join(taskDir, "helper"), cmdHelper, 0600)
 				if err != nil {
@@ -318,8 +555,8 @@ func (r *TaskRunner) Run() error {
 				}
 				helperWritten = true
 			}
-			err = r.Perform(action, taskDir)
 			// Contents is a script to run, run it.
+			err = r.Perform(action, taskDir)
 		}
 		if err != nil {
 			finalErr.AddError(err)
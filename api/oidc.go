@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// OidcConfig returns how to log in to the server through OpenID
+// Connect.  It does not need the Client to be authenticated.
+func (c *Client) OidcConfig() (*models.OidcConfig, error) {
+	res := &models.OidcConfig{}
+	return res, c.Req().UrlFor("oidc").Do(res)
+}
+
+type oidcDeviceAuth struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type oidcTokenResponse struct {
+	IdToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func oidcPost(client *http.Client, endpoint string, form url.Values, res interface{}) error {
+	resp, err := client.PostForm(endpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return fmt.Errorf("POST %s: %s: %v", endpoint, resp.Status, err)
+	}
+	return nil
+}
+
+// OidcDeviceLogin logs in to the OpenID Connect provider in cfg with
+// the OAuth2 device authorization flow.  prompt is called with the URL
+// the user should visit and the code they should enter there, and
+// OidcDeviceLogin then waits for them to do so.  It returns the ID
+// token the provider issued, which can be used as a bearer token for
+// the server.
+func OidcDeviceLogin(cfg *models.OidcConfig, prompt func(uri, code string)) (string, error) {
+	if cfg.DeviceAuthorizationEndpoint == "" {
+		return "", fmt.Errorf("%s does not support device logins", cfg.Issuer)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+	auth := &oidcDeviceAuth{}
+	if err := oidcPost(client, cfg.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {cfg.ClientId},
+		"scope":     {strings.Join(scopes, " ")},
+	}, auth); err != nil {
+		return "", err
+	}
+	if auth.DeviceCode == "" {
+		return "", fmt.Errorf("%s did not return a device code", cfg.DeviceAuthorizationEndpoint)
+	}
+	uri := auth.VerificationUriComplete
+	if uri == "" {
+		uri = auth.VerificationUri
+	}
+	prompt(uri, auth.UserCode)
+	interval := time.Duration(auth.Interval) * time.Second
+	if auth.Interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expires := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	if auth.ExpiresIn <= 0 {
+		expires = time.Now().Add(10 * time.Minute)
+	}
+	for time.Now().Before(expires) {
+		time.Sleep(interval)
+		tok := &oidcTokenResponse{}
+		if err := oidcPost(client, cfg.TokenEndpoint, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {cfg.ClientId},
+		}, tok); err != nil {
+			return "", err
+		}
+		switch tok.Error {
+		case "":
+			if tok.IdToken == "" {
+				return "", fmt.Errorf("%s did not return an ID token", cfg.TokenEndpoint)
+			}
+			return tok.IdToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			if tok.ErrorDescription != "" {
+				return "", fmt.Errorf("login failed: %s: %s", tok.Error, tok.ErrorDescription)
+			}
+			return "", fmt.Errorf("login failed: %s", tok.Error)
+		}
+	}
+	return "", fmt.Errorf("login timed out")
+}
+
+// OidcUsername returns the name of the User that token, an ID token
+// from OidcDeviceLogin, is for.  It does not check the signature of
+// token; the server does that when the token is used.
+func OidcUsername(cfg *models.OidcConfig, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("token is not a JWT")
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("token payload: %v", err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &claims); err != nil {
+		return "", fmt.Errorf("token payload: %v", err)
+	}
+	name, _ := claims[cfg.UsernameClaim].(string)
+	if name == "" {
+		return "", fmt.Errorf("token has no %s claim", cfg.UsernameClaim)
+	}
+	return name, nil
+}
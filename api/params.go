@@ -0,0 +1,11 @@
+package api
+
+import "github.com/digitalrebar/provision/models"
+
+// CheckParam reports which values of the Param stored on other
+// objects would not match the Schema of param, without changing
+// anything on the server.
+func (c *Client) CheckParam(param *models.Param) (*models.ParamReport, error) {
+	res := &models.ParamReport{}
+	return res, c.Req().Post(param).UrlFor("params", "check").Do(res)
+}
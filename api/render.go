@@ -0,0 +1,10 @@
+package api
+
+import "github.com/digitalrebar/provision/models"
+
+// Render renders the templates selected by req without running a Job
+// or changing anything on the server.
+func (c *Client) Render(req *models.RenderRequest) (*models.RenderResult, error) {
+	res := &models.RenderResult{}
+	return res, c.Req().Post(req).UrlFor("render").Do(res)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestRenderSecureParams(t *testing.T) {
+	param := &models.Param{Name: "render-secret", Secure: true, Schema: map[string]interface{}{"type": "string"}}
+	tmpl := &models.Template{ID: "render-secret", Contents: `{{.Param "render-secret"}}`}
+	m := &models.Machine{Name: "render-secret", Uuid: uuid.NewRandom(), Params: map[string]interface{}{"render-secret": "hunter2"}}
+	role := &models.Role{Name: "render-only", Claims: []*models.Claim{
+		{Scope: "templates", Action: "render", Specific: "*"},
+		{Scope: "machines", Action: "get", Specific: "*"},
+		{Scope: "users", Action: "token", Specific: "renderer"},
+	}}
+	user := &models.User{Name: "renderer", Roles: []string{"render-only"}}
+	for _, obj := range []models.Model{param, tmpl, m, role, user} {
+		if err := session.CreateModel(obj); err != nil {
+			t.Fatalf("Unable to create %s %s: %v", obj.Prefix(), obj.Key(), err)
+		}
+		defer session.DeleteModel(obj.Prefix(), obj.Key())
+	}
+	pwd := &models.UserPassword{Password: "Render-0nly-Passw0rd"}
+	if err := session.Req().Put(pwd).UrlFor("users", "renderer", "password").Do(nil); err != nil {
+		t.Fatalf("Unable to set the password of renderer: %v", err)
+	}
+	req := &models.RenderRequest{Template: "render-secret", Machine: m.Uuid}
+
+	// Callers that can getSecure the machine see the value.
+	res, err := session.Render(req)
+	if err != nil || len(res.Templates) != 1 || res.Templates[0].Content != "hunter2" {
+		t.Errorf("Expected the secure param to be rendered: %#v, %v", res, err)
+	}
+
+	// Callers that cannot only see that it is there.
+	renderer, err := UserSession(session.Endpoint(), "renderer", pwd.Password)
+	if err != nil {
+		t.Fatalf("Unable to log in as renderer: %v", err)
+	}
+	defer renderer.Close()
+	res, err = renderer.Render(req)
+	if err != nil || len(res.Templates) != 1 || res.Templates[0].Content != models.RedactedValue {
+		t.Errorf("Expected the secure param to be redacted: %#v, %v", res, err)
+	}
+}
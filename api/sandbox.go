@@ -0,0 +1,89 @@
+package api
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"time"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+	"github.com/digitalrebar/provision/models"
+)
+
+// loadSandbox figures out which TaskSandbox the actions for the
+// current Task should run under.  The Sandbox on the Task wins,
+// followed by the task-sandbox param on the Machine.
+func (r *TaskRunner) loadSandbox() error {
+	r.sandbox = r.t.Sandbox
+	if r.sandbox != nil {
+		return nil
+	}
+	sb := &models.TaskSandbox{}
+	var res interface{}
+	req := r.c.Req().UrlFor("machines", r.m.Key(), "params", "task-sandbox").Params("aggregate", "true")
+	if err := req.Do(&res); err != nil {
+		return err
+	}
+	if res == nil {
+		return nil
+	}
+	if err := utils.Remarshal(res, sb); err != nil {
+		return err
+	}
+	e := &models.Error{Type: "RUNNER_ERR", Model: "params", Key: "task-sandbox"}
+	sb.Validate(e)
+	if err := e.HasError(); err != nil {
+		return err
+	}
+	r.sandbox = sb
+	return nil
+}
+
+// sandboxEnv returns the environment an action will run with.  Without
+// a sandbox, actions get the whole environment of the agent.
+// Otherwise they only get PATH, the variables the sandbox allows, and
+// the ones the agent sets for the action.
+func (r *TaskRunner) sandboxEnv(taskDir string, env []string) ([]string, error) {
+	if r.sandbox == nil {
+		return append(os.Environ(), env...), nil
+	}
+	res := []string{}
+	for _, name := range append([]string{"PATH"}, r.sandbox.Env...) {
+		if val, ok := os.LookupEnv(name); ok {
+			res = append(res, name+"="+val)
+		}
+	}
+	if r.sandbox.PrivateTmp {
+		tmpDir := path.Join(taskDir, "tmp")
+		if err := os.MkdirAll(tmpDir, 01777); err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(tmpDir, 01777); err != nil {
+			return nil, err
+		}
+		res = append(res, "TMPDIR="+tmpDir, "TMP="+tmpDir, "TEMP="+tmpDir)
+	}
+	return append(res, env...), nil
+}
+
+// sandboxTimeout arranges for the action running in cmd to be killed
+// if it runs for longer than the sandbox allows.  The returned
+// function must be called once the action has exited, and reports
+// whether the action was killed.
+func (r *TaskRunner) sandboxTimeout(cmd *exec.Cmd) func() bool {
+	if r.sandbox == nil || r.sandbox.Timeout <= 0 {
+		return func() bool { return false }
+	}
+	killed := make(chan struct{})
+	timer := time.AfterFunc(time.Duration(r.sandbox.Timeout)*time.Second, func() {
+		close(killed)
+		r.sandboxKill(cmd)
+	})
+	return func() bool {
+		if timer.Stop() {
+			return false
+		}
+		<-killed
+		return true
+	}
+}
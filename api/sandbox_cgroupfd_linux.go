@@ -0,0 +1,21 @@
+// +build linux,go1.20
+
+package api
+
+import (
+	"os"
+	"os/exec"
+)
+
+// cgroupStart has the kernel start cmd directly in the cgroup of the
+// action.  This needs Linux 5.7 or later.
+func (r *TaskRunner) cgroupStart(cmd *exec.Cmd) error {
+	dir, err := os.Open(r.cgroup)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return cmd.Start()
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroupRoot is where the unified (v2) cgroup hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupPeriod is the period, in microseconds, that CPU limits are
+// enforced over.
+const cgroupPeriod = 100000
+
+func writeCgroupFile(dir, name, val string) error {
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(val), 0644)
+}
+
+// makeCgroup creates the cgroup an action will be run in, with the
+// CPU and memory limits of the sandbox.
+func (r *TaskRunner) makeCgroup(name string) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is not available: %v", err)
+	}
+	parent := filepath.Join(cgroupRoot, "drp-agent")
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	for _, dir := range []string{cgroupRoot, parent} {
+		if err := writeCgroupFile(dir, "cgroup.subtree_control", "+cpu +memory"); err != nil {
+			return "", fmt.Errorf("Unable to enable cgroup controllers in %s: %v", dir, err)
+		}
+	}
+	dir := filepath.Join(parent, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", err
+	}
+	if r.sandbox.CPUs > 0 {
+		quota := int64(r.sandbox.CPUs * cgroupPeriod)
+		if err := writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, cgroupPeriod)); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+	}
+	if r.sandbox.MemoryMB > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.FormatInt(r.sandbox.MemoryMB<<20, 10)); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+		// Not all kernels have swap accounting, so this is best effort.
+		writeCgroupFile(dir, "memory.swap.max", "0")
+	}
+	return dir, nil
+}
+
+// sandboxPrepare sets up cmd to run in the sandbox for the Task.
+func (r *TaskRunner) sandboxPrepare(cmd *exec.Cmd, taskDir, name string) error {
+	r.cgroup = ""
+	if r.sandbox == nil {
+		return nil
+	}
+	// Run the action in its own process group so that a timeout can
+	// kill everything it started.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if r.sandbox.User != "" {
+		u, err := user.Lookup(r.sandbox.User)
+		if err != nil {
+			return err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return err
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return err
+		}
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+		// The user needs to be able to get at everything in the task directory.
+		if err := filepath.Walk(taskDir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(p, int(uid), int(gid))
+		}); err != nil {
+			return err
+		}
+	}
+	if r.sandbox.CPUs > 0 || r.sandbox.MemoryMB > 0 {
+		dir, err := r.makeCgroup(r.j.Key() + "-" + name)
+		if err != nil {
+			return err
+		}
+		r.cgroup = dir
+	}
+	return nil
+}
+
+// sandboxStart starts an action.  Actions with CPU or memory limits
+// are started in their cgroup rather than moved into it afterwards, so
+// nothing they run can get out from under the limits.
+func (r *TaskRunner) sandboxStart(cmd *exec.Cmd) error {
+	if r.cgroup == "" {
+		return cmd.Start()
+	}
+	return r.cgroupStart(cmd)
+}
+
+// sandboxKill kills an action and everything it started.
+func (r *TaskRunner) sandboxKill(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	if r.cgroup != "" && writeCgroupFile(r.cgroup, "cgroup.kill", "1") == nil {
+		return
+	}
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// sandboxDone cleans up after an action has exited, and reports
+// whether the kernel killed it for using too much memory.
+func (r *TaskRunner) sandboxDone(cmd *exec.Cmd) (oomKilled bool) {
+	if r.cgroup == "" {
+		return false
+	}
+	if buf, err := ioutil.ReadFile(filepath.Join(r.cgroup, "memory.events")); err == nil {
+		for _, line := range strings.Split(string(buf), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "oom_kill" && fields[1] != "0" {
+				oomKilled = true
+			}
+		}
+	}
+	// Anything the action left running goes away with the cgroup.
+	r.sandboxKill(cmd)
+	for i := 0; i < 10; i++ {
+		if err := os.Remove(r.cgroup); err == nil || os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	r.cgroup = ""
+	return
+}
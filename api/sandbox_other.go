@@ -0,0 +1,46 @@
+// +build !linux
+
+package api
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// sandboxPrepare sets up cmd to run in the sandbox for the Task.
+// Only the environment and timeout limits can be enforced on this
+// platform, so the others are logged and ignored.
+func (r *TaskRunner) sandboxPrepare(cmd *exec.Cmd, taskDir, name string) error {
+	if r.sandbox == nil {
+		return nil
+	}
+	ignored := []string{}
+	if r.sandbox.CPUs > 0 {
+		ignored = append(ignored, "CPUs")
+	}
+	if r.sandbox.MemoryMB > 0 {
+		ignored = append(ignored, "MemoryMB")
+	}
+	if r.sandbox.User != "" {
+		ignored = append(ignored, "User")
+	}
+	if len(ignored) > 0 {
+		r.Log("Sandbox %s limits are not supported on this platform, ignoring them",
+			strings.Join(ignored, ", "))
+	}
+	return nil
+}
+
+func (r *TaskRunner) sandboxStart(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+func (r *TaskRunner) sandboxKill(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
+
+func (r *TaskRunner) sandboxDone(cmd *exec.Cmd) bool {
+	return false
+}
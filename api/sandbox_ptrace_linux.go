@@ -0,0 +1,43 @@
+// +build linux,!go1.20
+
+package api
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+// cgroupStart starts cmd traced, so that it stops right after exec
+// before running anything, moves it into the cgroup of the action,
+// and only then lets it go.  Go before 1.20 cannot have the kernel
+// start a process in a cgroup.
+func (r *TaskRunner) cgroupStart(cmd *exec.Cmd) error {
+	// The thread that starts a traced process is its tracer, and the
+	// only thread that can let it go.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	cmd.SysProcAttr.Ptrace = true
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+	var ws syscall.WaitStatus
+	_, err := syscall.Wait4(pid, &ws, 0, nil)
+	if err == nil && !ws.Stopped() {
+		err = fmt.Errorf("Command did not stop after exec: %v", ws)
+	}
+	if err == nil {
+		err = writeCgroupFile(r.cgroup, "cgroup.procs", strconv.Itoa(pid))
+	}
+	if err == nil {
+		err = syscall.PtraceDetach(pid)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Process.Wait()
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestLoadSandbox(t *testing.T) {
+	m := &models.Machine{Name: "sandbox", Uuid: uuid.NewRandom()}
+	if err := session.CreateModel(m); err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+	defer session.DeleteModel("machines", m.Key())
+	onTask := &models.TaskSandbox{Timeout: 10}
+	tests := []struct {
+		name  string
+		task  *models.TaskSandbox
+		param interface{}
+		want  *models.TaskSandbox
+		pass  bool
+	}{
+		{"No sandbox", nil, nil, nil, true},
+		{"Sandbox on the Task", onTask, nil, onTask, true},
+		{"Sandbox on the Task wins", onTask, map[string]interface{}{"Timeout": 20}, onTask, true},
+		{"Sandbox from the param", nil, map[string]interface{}{"Timeout": 20, "Env": []string{"HOME"}},
+			&models.TaskSandbox{Timeout: 20, Env: []string{"HOME"}}, true},
+		{"Invalid sandbox from the param", nil, map[string]interface{}{"Timeout": -1}, nil, false},
+	}
+	for _, test := range tests {
+		req := session.Req().Del()
+		if test.param != nil {
+			req = session.Req().Post(test.param)
+		}
+		req.UrlFor("machines", m.Key(), "params", "task-sandbox").Do(nil)
+		r := &TaskRunner{c: session, m: m, t: &models.Task{Name: "sandbox", Sandbox: test.task}}
+		err := r.loadSandbox()
+		if (err == nil) != test.pass {
+			t.Errorf("%s: wanted to pass: %v, got error %v", test.name, test.pass, err)
+			continue
+		}
+		if test.pass && !reflect.DeepEqual(r.sandbox, test.want) {
+			t.Errorf("%s: expected sandbox %#v, got %#v", test.name, test.want, r.sandbox)
+		}
+	}
+}
+
+func TestSandboxEnv(t *testing.T) {
+	taskDir, err := ioutil.TempDir("", "sandbox-env-")
+	if err != nil {
+		t.Fatalf("Failed to create task dir: %v", err)
+	}
+	defer os.RemoveAll(taskDir)
+	os.Setenv("DRP_SANDBOX_ALLOWED", "yes")
+	os.Setenv("DRP_SANDBOX_SECRET", "no")
+	defer os.Unsetenv("DRP_SANDBOX_ALLOWED")
+	defer os.Unsetenv("DRP_SANDBOX_SECRET")
+	tmpDir := path.Join(taskDir, "tmp")
+	tests := []struct {
+		name    string
+		sandbox *models.TaskSandbox
+		want    []string
+		notWant []string
+	}{
+		{"No sandbox", nil,
+			[]string{"PATH=", "DRP_SANDBOX_ALLOWED=yes", "DRP_SANDBOX_SECRET=no", "RS_TASK_DIR="},
+			[]string{"TMPDIR="}},
+		{"Empty sandbox", &models.TaskSandbox{},
+			[]string{"PATH=", "RS_TASK_DIR="},
+			[]string{"DRP_SANDBOX_ALLOWED=", "DRP_SANDBOX_SECRET=", "TMPDIR="}},
+		{"Sandbox with Env", &models.TaskSandbox{Env: []string{"DRP_SANDBOX_ALLOWED", "DRP_SANDBOX_MISSING"}},
+			[]string{"PATH=", "DRP_SANDBOX_ALLOWED=yes", "RS_TASK_DIR="},
+			[]string{"DRP_SANDBOX_SECRET=", "DRP_SANDBOX_MISSING="}},
+		{"Sandbox with PrivateTmp", &models.TaskSandbox{PrivateTmp: true},
+			[]string{"PATH=", "TMPDIR=" + tmpDir, "TMP=" + tmpDir, "TEMP=" + tmpDir, "RS_TASK_DIR="},
+			[]string{"DRP_SANDBOX_ALLOWED="}},
+	}
+	for _, test := range tests {
+		r := &TaskRunner{sandbox: test.sandbox}
+		env, err := r.sandboxEnv(taskDir, []string{"RS_TASK_DIR=" + taskDir})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		has := func(prefix string) bool {
+			for _, v := range env {
+				if strings.HasPrefix(v, prefix) {
+					return true
+				}
+			}
+			return false
+		}
+		for _, prefix := range test.want {
+			if !has(prefix) {
+				t.Errorf("%s: expected %s in %v", test.name, prefix, env)
+			}
+		}
+		for _, prefix := range test.notWant {
+			if has(prefix) {
+				t.Errorf("%s: did not expect %s in %v", test.name, prefix, env)
+			}
+		}
+	}
+	if st, err := os.Stat(tmpDir); err != nil || st.Mode()&os.ModeSticky == 0 || st.Mode().Perm() != 0777 {
+		t.Errorf("PrivateTmp should make a world writable sticky %s: %v %v", tmpDir, st, err)
+	}
+}
+
+func TestSandboxTimeout(t *testing.T) {
+	taskDir, err := ioutil.TempDir("", "sandbox-timeout-")
+	if err != nil {
+		t.Fatalf("Failed to create task dir: %v", err)
+	}
+	defer os.RemoveAll(taskDir)
+	tests := []struct {
+		name    string
+		sandbox *models.TaskSandbox
+		sleep   string
+		killed  bool
+	}{
+		{"No sandbox", nil, "0", false},
+		{"No Timeout", &models.TaskSandbox{}, "0", false},
+		{"Exits in time", &models.TaskSandbox{Timeout: 5}, "0", false},
+		{"Runs too long", &models.TaskSandbox{Timeout: 1}, "30", true},
+	}
+	for _, test := range tests {
+		r := &TaskRunner{sandbox: test.sandbox}
+		cmd := exec.Command("sleep", test.sleep)
+		if err := r.sandboxPrepare(cmd, taskDir, "sleep"); err != nil {
+			t.Errorf("%s: failed to prepare sandbox: %v", test.name, err)
+			continue
+		}
+		if err := r.sandboxStart(cmd); err != nil {
+			t.Errorf("%s: failed to start: %v", test.name, err)
+			continue
+		}
+		timedOut := r.sandboxTimeout(cmd)
+		cmd.Process.Wait()
+		if killed := timedOut(); killed != test.killed {
+			t.Errorf("%s: expected killed to be %v, not %v", test.name, test.killed, killed)
+		}
+	}
+}
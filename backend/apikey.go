@@ -0,0 +1,211 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/store"
+	sc "github.com/elithrar/simple-scrypt"
+)
+
+const (
+	// How long a checked API key is remembered, so that every
+	// request does not need to run scrypt.
+	apiKeyCacheTTL = time.Minute
+	// How stale LastUsed on an API key may get before it is saved.
+	apiKeyLastUsedSlack = time.Minute
+)
+
+// AddApiKey generates a secret for key, adds key to the User, and
+// returns what clients should present to use it.  It must be called
+// with users and roles locked.
+func (u *User) AddApiKey(rt *RequestTracker, key *models.ApiKey) (string, error) {
+	if u.ApiKey(key.Name) != nil {
+		return "", &models.Error{
+			Code:     http.StatusConflict,
+			Type:     "POST",
+			Model:    "users",
+			Key:      u.Name,
+			Messages: []string{fmt.Sprintf("ApiKey %s already exists", key.Name)},
+		}
+	}
+	secret := randString(32)
+	hash, err := sc.GenerateFromPassword([]byte(secret), sc.DefaultParams)
+	if err != nil {
+		return "", err
+	}
+	key.KeyHash = hash
+	key.LastUsed = time.Time{}
+	old := u.ApiKeys
+	u.ApiKeys = append(append([]*models.ApiKey{}, old...), key)
+	if _, err := rt.Save(u); err != nil {
+		u.ApiKeys = old
+		return "", err
+	}
+	return u.Name + ":" + key.Name + ":" + secret, nil
+}
+
+// RemoveApiKey removes the API key called name from the User.  It
+// must be called with users and roles locked.
+func (u *User) RemoveApiKey(rt *RequestTracker, name string) error {
+	if u.ApiKey(name) == nil {
+		return &models.Error{
+			Code:     http.StatusNotFound,
+			Type:     "DELETE",
+			Model:    "users",
+			Key:      u.Name,
+			Messages: []string{fmt.Sprintf("ApiKey %s not found", name)},
+		}
+	}
+	old := u.ApiKeys
+	u.ApiKeys = []*models.ApiKey{}
+	for _, k := range old {
+		if k != nil && k.Name != name {
+			u.ApiKeys = append(u.ApiKeys, k)
+		}
+	}
+	if _, err := rt.Save(u); err != nil {
+		u.ApiKeys = old
+		return err
+	}
+	return nil
+}
+
+// OnCreate drops any API keys a new User comes with.  Keys are only
+// created by AddApiKey, so that their hashes are always ours.  The
+// same goes for passwords, which are only set through setPassword so
+// that they always go through the password policy.
+func (u *User) OnCreate() error {
+	u.ApiKeys = nil
+	u.PasswordHistory = nil
+	if len(u.PasswordHash) != 0 {
+		e := &models.Error{Code: http.StatusUnprocessableEntity, Type: ValidationError, Model: u.Prefix(), Key: u.Key()}
+		e.Errorf("PasswordHash cannot be set directly, set the password through the password API")
+		return e
+	}
+	return u.checkRoles(nil)
+}
+
+// OnChange keeps the API keys and the password of the stored User,
+// since updates cannot add, remove, or change keys, and passwords can
+// only be changed by setPassword.  This also keeps the hashes that are
+// removed from everything the API returns, so saving a User that was
+// fetched through the API does not break its keys or its password.
+func (u *User) OnChange(oldThing store.KeySaver) error {
+	old := AsUser(oldThing)
+	u.ApiKeys = old.ApiKeys
+	u.PasswordHash = old.PasswordHash
+	u.PasswordHistory = old.PasswordHistory
+	return u.checkRoles(old.Roles)
+}
+
+type apiKeyCacheEntry struct {
+	sum     [sha256.Size]byte
+	hash    []byte
+	expires time.Time
+}
+
+// ApiKeyAuth authenticates requests that present an API key.
+type ApiKeyAuth struct {
+	mux   *sync.Mutex
+	salt  []byte
+	cache map[string]*apiKeyCacheEntry
+}
+
+func NewApiKeyAuth() *ApiKeyAuth {
+	salt := make([]byte, 32)
+	rand.Read(salt)
+	return &ApiKeyAuth{
+		mux:   &sync.Mutex{},
+		salt:  salt,
+		cache: map[string]*apiKeyCacheEntry{},
+	}
+}
+
+func (a *ApiKeyAuth) sum(secret string) [sha256.Size]byte {
+	return sha256.Sum256(append(append([]byte{}, a.salt...), secret...))
+}
+
+// check tests secret against key, remembering the answer for a
+// little while.  Changing the key invalidates what was remembered.
+func (a *ApiKeyAuth) check(id string, key *models.ApiKey, secret string) bool {
+	sum := a.sum(secret)
+	a.mux.Lock()
+	ent, ok := a.cache[id]
+	a.mux.Unlock()
+	if ok && time.Now().Before(ent.expires) && bytes.Equal(ent.hash, key.KeyHash) &&
+		subtle.ConstantTimeCompare(sum[:], ent.sum[:]) == 1 {
+		return true
+	}
+	if !key.CheckKey(secret) {
+		return false
+	}
+	a.mux.Lock()
+	a.cache[id] = &apiKeyCacheEntry{sum: sum, hash: key.KeyHash, expires: time.Now().Add(apiKeyCacheTTL)}
+	a.mux.Unlock()
+	return true
+}
+
+// Authenticate checks apiKey, which is in user:name:secret form, for
+// a request from ip.  It returns the User and the ApiKey the request
+// acts as.  rt must be able to lock users and roles, and must not be
+// locked.
+func (a *ApiKeyAuth) Authenticate(rt *RequestTracker, apiKey string, ip net.IP) (*User, *models.ApiKey, error) {
+	parts := strings.SplitN(apiKey, ":", 3)
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("malformed API key")
+	}
+	id := parts[0] + ":" + parts[1]
+	var key *models.ApiKey
+	rt.Do(func(d Stores) {
+		if obj := rt.Find("users", parts[0]); obj != nil {
+			if k := AsUser(obj).ApiKey(parts[1]); k != nil {
+				c := *k
+				key = &c
+			}
+		}
+	})
+	switch {
+	case key == nil:
+		return nil, nil, fmt.Errorf("no API key %s", id)
+	case !key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt):
+		return nil, nil, fmt.Errorf("API key %s has expired", id)
+	case !key.AllowedFrom(ip):
+		return nil, nil, fmt.Errorf("API key %s cannot be used from %s", id, ip)
+	case !a.check(id, key, parts[2]):
+		// scrypt is slow, so this is done without holding any locks.
+		return nil, nil, fmt.Errorf("bad secret for API key %s", id)
+	}
+	var user *User
+	rt.Do(func(d Stores) {
+		obj := rt.Find("users", parts[0])
+		if obj == nil {
+			return
+		}
+		u := AsUser(obj)
+		k := u.ApiKey(parts[1])
+		if k == nil || !bytes.Equal(k.KeyHash, key.KeyHash) {
+			return
+		}
+		if time.Since(k.LastUsed) > apiKeyLastUsedSlack {
+			k.LastUsed = time.Now()
+			if _, err := rt.Save(u); err != nil {
+				rt.Warnf("Unable to save LastUsed of API key %s: %v", id, err)
+			}
+		}
+		user, key = u, k
+	})
+	if user == nil {
+		return nil, nil, fmt.Errorf("API key %s was removed", id)
+	}
+	return user, key, nil
+}
@@ -0,0 +1,166 @@
+package backend
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+func TestApiKeys(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "users", "roles")
+	local := net.ParseIP("127.0.0.1")
+	var ciKey, oldKey, lanKey string
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(&models.User{Name: "ci"}); err != nil {
+			t.Fatalf("Unable to create ci user: %v", err)
+		}
+		u := AsUser(rt.Find("users", "ci"))
+		var err error
+		ciKey, err = u.AddApiKey(rt, &models.ApiKey{
+			Name:   "deploy",
+			Claims: []*models.Claim{{Scope: "machines", Action: "get", Specific: "*"}},
+		})
+		if err != nil {
+			t.Fatalf("Unable to add deploy key: %v", err)
+		}
+		if _, err := u.AddApiKey(rt, &models.ApiKey{Name: "deploy"}); err == nil {
+			t.Errorf("Adding a second deploy key should fail")
+		}
+		oldKey, _ = u.AddApiKey(rt, &models.ApiKey{Name: "old", ExpiresAt: time.Now().Add(-time.Minute)})
+		lanKey, _ = u.AddApiKey(rt, &models.ApiKey{Name: "lan", AllowedCIDRs: []string{"10.0.0.0/8"}})
+		if _, err := u.AddApiKey(rt, &models.ApiKey{Name: "bad cidr", AllowedCIDRs: []string{"10.0.0.0"}}); err == nil {
+			t.Errorf("Adding a key with a bad CIDR should fail")
+		}
+		if _, err := u.AddApiKey(rt, &models.ApiKey{
+			Name:   "filtered",
+			Claims: []*models.Claim{{Scope: "machines", Action: "*", Specific: "*", Filter: "Profiles=ci"}},
+		}); err == nil {
+			t.Errorf("Adding a key with a filtered claim should fail")
+		}
+		if len(u.ApiKeys) != 3 {
+			t.Errorf("Expected 3 keys, not %d", len(u.ApiKeys))
+		}
+	})
+	if !strings.HasPrefix(ciKey, "ci:deploy:") {
+		t.Fatalf("Unexpected key format: %s", ciKey)
+	}
+
+	a := NewApiKeyAuth()
+	u, k, err := a.Authenticate(rt, ciKey, local)
+	if err != nil || u == nil || k.Name != "deploy" {
+		t.Fatalf("deploy key should have authenticated: %v", err)
+	}
+	if k.LastUsed.IsZero() {
+		t.Errorf("LastUsed should have been set")
+	}
+	// Cached checks must still refuse the wrong secret.
+	for _, bad := range []string{ciKey + "x", "ci:deploy:", "ci:missing:secret", "nobody:deploy:secret", "garbage"} {
+		if u, _, err := a.Authenticate(rt, bad, local); u != nil || err == nil {
+			t.Errorf("%q should not authenticate", bad)
+		}
+	}
+	if u, _, err := a.Authenticate(rt, oldKey, local); u != nil || err == nil {
+		t.Errorf("An expired key should not authenticate")
+	}
+	if u, _, err := a.Authenticate(rt, lanKey, local); u != nil || err == nil {
+		t.Errorf("The lan key should not authenticate from %s", local)
+	}
+	if u, _, err := a.Authenticate(rt, lanKey, net.ParseIP("10.1.2.3")); u == nil || err != nil {
+		t.Errorf("The lan key should authenticate from 10.1.2.3: %v", err)
+	}
+
+	// Saving a User as the API returns it keeps the key hashes.
+	rt.Do(func(d Stores) {
+		sanitized := AsUser(rt.Find("users", "ci")).Sanitize().(*models.User)
+		sanitized.Description = "CI robot"
+		if _, err := rt.Update(sanitized); err != nil {
+			t.Fatalf("Unable to update sanitized user: %v", err)
+		}
+	})
+	if u, _, err := a.Authenticate(rt, ciKey, local); u == nil || err != nil {
+		t.Errorf("deploy key should survive saving a sanitized user: %v", err)
+	}
+	rt.Do(func(d Stores) {
+		forged := &models.ApiKey{Name: "forged", KeyHash: []byte("chosen by the client")}
+		if _, err := rt.Create(&models.User{Name: "forger", ApiKeys: []*models.ApiKey{forged}}); err != nil {
+			t.Errorf("Unable to create forger user: %v", err)
+		} else if len(AsUser(rt.Find("users", "forger")).ApiKeys) != 0 {
+			t.Errorf("Creating a User should not create its keys")
+		}
+		updated := AsUser(rt.Find("users", "ci")).Sanitize().(*models.User)
+		updated.ApiKeys = append(updated.ApiKeys, forged)
+		if _, err := rt.Update(updated); err != nil {
+			t.Errorf("Unable to update ci user: %v", err)
+		}
+		if AsUser(rt.Find("users", "ci")).ApiKey("forged") != nil {
+			t.Errorf("Updating a User should not add keys")
+		}
+		if err := AsUser(rt.Find("users", "ci")).RemoveApiKey(rt, "deploy"); err != nil {
+			t.Errorf("Unable to remove deploy key: %v", err)
+		}
+	})
+	if u, _, err := a.Authenticate(rt, ciKey, local); u != nil || err == nil {
+		t.Errorf("A removed key should not authenticate, even when cached")
+	}
+}
+
+func TestAddLimited(t *testing.T) {
+	limits := []*Claim{
+		{Scope: "machines", Action: "get", Specific: "*"},
+		{Scope: "machines", Action: "*", Specific: "*", Filter: "Profiles=team-a"},
+	}
+	c := NewClaim("fred", "fred", 30)
+	if !c.AddLimited(limits, "machines", "get", "*") || len(c.DrpClaims) != 1 || c.DrpClaims[0].Filter != "" {
+		t.Errorf("machines get should be added unfiltered: %v", c.DrpClaims)
+	}
+	c = NewClaim("fred", "fred", 30)
+	if !c.AddLimited(limits, "machines", "update", "*") || len(c.DrpClaims) != 1 || c.DrpClaims[0].Filter != "Profiles=team-a" {
+		t.Errorf("machines update should be added with the Filter: %v", c.DrpClaims)
+	}
+	c = NewClaim("fred", "fred", 30)
+	if c.AddLimited(limits, "users", "get", "*") || len(c.DrpClaims) != 0 {
+		t.Errorf("users get should not be added: %v", c.DrpClaims)
+	}
+}
+
+func TestLimitClaims(t *testing.T) {
+	caller := NewClaim("fred", "fred", 30).
+		Add("machines", "get", "*").
+		AddFiltered("profiles", "*", "*", "Meta.team=a")
+	claims := caller.Limit([]*Claim{
+		{Scope: "*", Action: "*", Specific: "*"},
+		{Scope: "profiles", Action: "update", Specific: "*", Filter: "Meta.env=prod"},
+		{Scope: "profiles", Action: "get", Specific: "*", Filter: "Meta.team=b"},
+	})
+	limited := NewClaim("fred", "fred", 30).AddClaims(claims...)
+	if !limited.Match("machines", "get", "m1") || limited.Match("machines", "update", "m1") {
+		t.Errorf("Superuser claims should be limited to machines get: %v", claims)
+	}
+	if limited.Match("users", "get", "fred") {
+		t.Errorf("Limited claims should not allow users: %v", claims)
+	}
+	p1 := &models.Profile{Name: "p1", Meta: models.Meta{"team": "a", "env": "prod"}}
+	p2 := &models.Profile{Name: "p2", Meta: models.Meta{"team": "a"}}
+	p3 := &models.Profile{Name: "p2", Meta: models.Meta{"team": "b", "env": "prod"}}
+	if !limited.MatchObject("profiles", "update", "p1", p1) {
+		t.Errorf("Joined filters should allow updating p1: %v", claims)
+	}
+	if limited.MatchObject("profiles", "update", "p2", p3) {
+		t.Errorf("Joined filters should both apply: %v", claims)
+	}
+	if limited.MatchObject("profiles", "delete", "p2", p3) {
+		t.Errorf("Filters should still apply to limited claims: %v", claims)
+	}
+	if !limited.MatchObject("profiles", "delete", "p2", p2) {
+		t.Errorf("Caller filter should apply to a superuser claim: %v", claims)
+	}
+	for _, c := range claims {
+		if c.Action == "get" && c.Filter != "" && c.Filter != "Meta.team=a" {
+			t.Errorf("Filters on the same field should not be joined: %v", c)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+)
+
+// auditForwarder is where audit entries are copied to as well as the
+// audit log.  A *syslog.Writer is one.
+type auditForwarder interface {
+	Notice(string) error
+	Close() error
+}
+
+const (
+	// auditQueueLen is how many entries can wait to be written before
+	// Record has to wait for the writer.
+	auditQueueLen = 1024
+	// auditMaxSize is how big audit.log can get before it is rotated.
+	auditMaxSize = 64 << 20
+	// auditKeep is how many rotated files are kept.
+	auditKeep = 8
+)
+
+// auditLine is an entry waiting to be written, or a request to be
+// told when everything queued before it has been written.
+type auditLine struct {
+	buf  []byte
+	done chan struct{}
+}
+
+// AuditLog appends an AuditEntry for every change made through the
+// API to audit.log in its directory, one JSON object per line, and
+// optionally forwards them to syslog.  Entries are written by a single
+// goroutine, so recording one never waits on the disk or on syslog
+// unless the queue is full.  The file is opened for each batch of
+// entries, so it can be rotated by moving it aside, and it is rotated
+// to audit.log.1 through audit.log.8 when it grows past 64MB.  It is
+// kept in the log root, next to the job logs.
+type AuditLog struct {
+	dir       string
+	mux       *sync.Mutex
+	last      int64
+	queue     chan auditLine
+	fwdMux    *sync.Mutex
+	forwarder auditForwarder
+	maxSize   int64
+	keep      int
+	l         logger.Logger
+}
+
+// NewAuditLog returns an AuditLog that keeps its files in dir and
+// logs the errors writing them to l.
+func NewAuditLog(dir string, l logger.Logger) *AuditLog {
+	a := &AuditLog{
+		dir:     dir,
+		mux:     &sync.Mutex{},
+		queue:   make(chan auditLine, auditQueueLen),
+		fwdMux:  &sync.Mutex{},
+		maxSize: auditMaxSize,
+		keep:    auditKeep,
+		l:       l,
+	}
+	go a.run()
+	return a
+}
+
+func (a *AuditLog) path() string {
+	return filepath.Join(a.dir, "audit.log")
+}
+
+func (a *AuditLog) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", a.path(), i)
+}
+
+// parseAuditSyslog parses the auditSyslog preference, which is empty,
+// local, or a udp:// or tcp:// URL with a host and port.
+func parseAuditSyslog(target string) (network, addr string, err error) {
+	if target == "" || target == "local" {
+		return "", "", nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", err
+	}
+	if (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" {
+		return "", "", fmt.Errorf("Must be local or a udp:// or tcp:// URL with a port: %s", target)
+	}
+	return u.Scheme, u.Host, nil
+}
+
+// forwardTo starts forwarding entries to the syslog target, which is
+// in the form of the auditSyslog preference.  An empty target stops
+// forwarding.
+func (a *AuditLog) forwardTo(target string) error {
+	var fwd auditForwarder
+	if target != "" {
+		network, addr, err := parseAuditSyslog(target)
+		if err != nil {
+			return err
+		}
+		if fwd, err = dialAuditSyslog(network, addr); err != nil {
+			return err
+		}
+	}
+	a.fwdMux.Lock()
+	old := a.forwarder
+	a.forwarder = fwd
+	a.fwdMux.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Record fills in the Id and Time of entry and queues it to be
+// appended to the log.  Entries are written in the order they are
+// recorded.
+func (a *AuditLog) Record(entry *models.AuditEntry) error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	now := time.Now()
+	seq := now.UnixNano()
+	if seq <= a.last {
+		seq = a.last + 1
+	}
+	a.last = seq
+	entry.Id = fmt.Sprintf("%016x", seq)
+	entry.Time = now
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.queue <- auditLine{buf: buf}
+	return nil
+}
+
+// Flush waits until the entries recorded so far have been written.
+func (a *AuditLog) Flush() {
+	done := make(chan struct{})
+	a.mux.Lock()
+	a.queue <- auditLine{done: done}
+	a.mux.Unlock()
+	<-done
+}
+
+// run writes the queued entries, as many at a time as are waiting.
+func (a *AuditLog) run() {
+	for line := range a.queue {
+		lines := []auditLine{line}
+	drain:
+		for {
+			select {
+			case line := <-a.queue:
+				lines = append(lines, line)
+			default:
+				break drain
+			}
+		}
+		a.write(lines)
+	}
+}
+
+func (a *AuditLog) write(lines []auditLine) {
+	buf := []byte{}
+	count := 0
+	for _, line := range lines {
+		if line.buf != nil {
+			buf = append(append(buf, line.buf...), '\n')
+			count++
+		}
+	}
+	if count > 0 {
+		if err := a.append(buf); err != nil {
+			a.l.Errorf("Failed to write %d audit entries: %v", count, err)
+		}
+		a.fwdMux.Lock()
+		if a.forwarder != nil {
+			for _, line := range lines {
+				if line.buf != nil {
+					a.forwarder.Notice(string(line.buf))
+				}
+			}
+		}
+		a.fwdMux.Unlock()
+	}
+	for _, line := range lines {
+		if line.done != nil {
+			close(line.done)
+		}
+	}
+}
+
+// append appends buf to audit.log, and rotates it if it has grown too
+// big.
+func (a *AuditLog) append(buf []byte) error {
+	if err := os.MkdirAll(a.dir, 0700); err != nil {
+		return err
+	}
+	fi, err := os.OpenFile(a.path(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fi.Write(buf)
+	var size int64
+	if st, serr := fi.Stat(); serr == nil {
+		size = st.Size()
+	}
+	if cerr := fi.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size >= a.maxSize {
+		err = a.rotate()
+	}
+	return err
+}
+
+// rotate moves audit.log to audit.log.1, audit.log.1 to audit.log.2,
+// and so on, dropping the oldest file.
+func (a *AuditLog) rotate() error {
+	if err := os.Remove(a.rotated(a.keep)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := a.keep - 1; i > 0; i-- {
+		if err := os.Rename(a.rotated(i), a.rotated(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(a.path(), a.rotated(1))
+}
+
+// Scan calls fn with each entry in the log, oldest first, starting
+// with the oldest rotated file.  The files are read one entry at a
+// time, so the log is never all in memory.  If the log is rotated
+// while it is scanned, entries can be skipped or seen twice.  Scan
+// stops at the first error fn returns and returns it.
+func (a *AuditLog) Scan(fn func(*models.AuditEntry) error) error {
+	a.Flush()
+	for i := a.keep; i >= 0; i-- {
+		name := a.path()
+		if i > 0 {
+			name = a.rotated(i)
+		}
+		if err := scanAuditFile(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanAuditFile(name string, fn func(*models.AuditEntry) error) error {
+	fi, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer fi.Close()
+	r := bufio.NewReader(fi)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			entry := &models.AuditEntry{}
+			if jerr := json.Unmarshal(line, entry); jerr == nil {
+				if ferr := fn(entry); ferr != nil {
+					return ferr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// List returns all the entries in the log, oldest first.
+func (a *AuditLog) List() ([]*models.AuditEntry, error) {
+	res := []*models.AuditEntry{}
+	err := a.Scan(func(entry *models.AuditEntry) error {
+		res = append(res, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Audit returns the audit log.
+func (p *DataTracker) Audit() *AuditLog {
+	return p.audit
+}
+
+// AuditAs makes rt record the changes it makes in the audit log as
+// made by user with the token tokenId from the client at clientIP.
+// Changes made by a RequestTracker without a user are not recorded.
+func (rt *RequestTracker) AuditAs(user, tokenId, clientIP string) *RequestTracker {
+	rt.auditUser, rt.auditToken, rt.auditFrom = user, tokenId, clientIP
+	return rt
+}
+
+// auditJSON returns the JSON that an object is diffed as, with its
+// secrets removed.
+func (rt *RequestTracker) auditJSON(m models.Model) []byte {
+	if m == nil {
+		return []byte("{}")
+	}
+	// Only diff what the API shows, not backend state such as the
+	// resource version.
+	if s, ok := m.(interface{ Sanitize() models.Model }); ok {
+		m = s.Sanitize()
+	} else {
+		m = models.Clone(m)
+	}
+	buf, err := json.Marshal(rt.dt.RedactModel(m, false))
+	if err != nil {
+		return []byte("{}")
+	}
+	return buf
+}
+
+func (rt *RequestTracker) audit(entry *models.AuditEntry) {
+	if rt.auditUser == "" || rt.dt.audit == nil {
+		return
+	}
+	entry.User, entry.TokenId, entry.ClientIP = rt.auditUser, rt.auditToken, rt.auditFrom
+	if err := rt.dt.audit.Record(entry); err != nil {
+		rt.Errorf("Failed to record audit entry for %s %s:%s: %v",
+			entry.Action, entry.Model, entry.ObjectKey, err)
+	}
+}
+
+// auditChange records that action changed the object with prefix and
+// key from old to new.  Either of them can be nil.
+func (rt *RequestTracker) auditChange(action, prefix, key string, old, new models.Model) {
+	if rt.auditUser == "" || rt.dt.audit == nil {
+		return
+	}
+	patch, err := jsonpatch2.Generate(rt.auditJSON(old), rt.auditJSON(new), true)
+	if err != nil {
+		rt.Errorf("Failed to diff %s:%s for the audit log: %v", prefix, key, err)
+	}
+	rt.audit(&models.AuditEntry{
+		Action:    action,
+		Model:     prefix,
+		ObjectKey: key,
+		Patch:     patch,
+	})
+}
+
+// AuditAction records that command was run on the object with prefix
+// and key.
+func (rt *RequestTracker) AuditAction(prefix, key, command string) {
+	rt.audit(&models.AuditEntry{
+		Action:    "action",
+		Model:     prefix,
+		ObjectKey: key,
+		Command:   command,
+	})
+}
+
+// AuditEntry makes a models.AuditEntry filterable like the objects in
+// the stores.
+type AuditEntry struct {
+	*models.AuditEntry
+}
+
+func auditStringIndex(get func(*models.AuditEntry) string, set func(*models.AuditEntry, string)) index.Maker {
+	fix := func(m models.Model) string { return get(m.(*AuditEntry).AuditEntry) }
+	return index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i) < fix(j) },
+		func(ref models.Model) (gte, gt index.Test) {
+			refVal := fix(ref)
+			return func(s models.Model) bool {
+					return fix(s) >= refVal
+				},
+				func(s models.Model) bool {
+					return fix(s) > refVal
+				}
+		},
+		func(s string) (models.Model, error) {
+			res := &AuditEntry{&models.AuditEntry{}}
+			set(res.AuditEntry, s)
+			return res, nil
+		})
+}
+
+func (a *AuditEntry) Indexes() map[string]index.Maker {
+	fix := func(m models.Model) *models.AuditEntry { return m.(*AuditEntry).AuditEntry }
+	res := index.MakeBaseIndexes(a)
+	res["Time"] = index.Make(
+		false,
+		"dateTime",
+		func(i, j models.Model) bool {
+			return fix(i).Time.Before(fix(j).Time)
+		},
+		func(ref models.Model) (gte, gt index.Test) {
+			refTime := fix(ref).Time
+			return func(s models.Model) bool {
+					cmpTime := fix(s).Time
+					return refTime.Equal(cmpTime) || cmpTime.After(refTime)
+				},
+				func(s models.Model) bool {
+					return fix(s).Time.After(refTime)
+				}
+		},
+		func(s string) (models.Model, error) {
+			parsedTime, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, err
+			}
+			return &AuditEntry{&models.AuditEntry{Time: parsedTime}}, nil
+		})
+	res["User"] = auditStringIndex(
+		func(e *models.AuditEntry) string { return e.User },
+		func(e *models.AuditEntry, s string) { e.User = s })
+	res["TokenId"] = auditStringIndex(
+		func(e *models.AuditEntry) string { return e.TokenId },
+		func(e *models.AuditEntry, s string) { e.TokenId = s })
+	res["ClientIP"] = auditStringIndex(
+		func(e *models.AuditEntry) string { return e.ClientIP },
+		func(e *models.AuditEntry, s string) { e.ClientIP = s })
+	res["Action"] = auditStringIndex(
+		func(e *models.AuditEntry) string { return e.Action },
+		func(e *models.AuditEntry, s string) { e.Action = s })
+	res["Model"] = auditStringIndex(
+		func(e *models.AuditEntry) string { return e.Model },
+		func(e *models.AuditEntry, s string) { e.Model = s })
+	res["ObjectKey"] = auditStringIndex(
+		func(e *models.AuditEntry) string { return e.ObjectKey },
+		func(e *models.AuditEntry, s string) { e.ObjectKey = s })
+	res["Command"] = auditStringIndex(
+		func(e *models.AuditEntry) string { return e.Command },
+		func(e *models.AuditEntry, s string) { e.Command = s })
+	return res
+}
@@ -0,0 +1,11 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package backend
+
+import "log/syslog"
+
+// dialAuditSyslog connects to the syslog daemon at addr, or to the
+// local one if network is empty.
+func dialAuditSyslog(network, addr string) (auditForwarder, error) {
+	return syslog.Dial(network, addr, syslog.LOG_NOTICE|syslog.LOG_AUTH, "dr-provision-audit")
+}
@@ -0,0 +1,9 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package backend
+
+import "fmt"
+
+func dialAuditSyslog(network, addr string) (auditForwarder, error) {
+	return nil, fmt.Errorf("Forwarding to syslog is not supported on this platform")
+}
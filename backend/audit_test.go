@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+)
+
+func TestAuditLog(t *testing.T) {
+	dt := mkDT(nil)
+	quiet := dt.Request(dt.Logger, "users")
+	rt := dt.Request(dt.Logger, "users").AuditAs("rocketskates", "tok-1", "192.168.124.10")
+	quiet.Do(func(d Stores) {
+		if _, err := quiet.Create(&models.User{Name: "audit-quiet"}); err != nil {
+			t.Fatalf("Unable to create audit-quiet: %v", err)
+		}
+	})
+	u := &User{}
+	Fill(u)
+	u.Name = "audit-user"
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(u); err != nil {
+			t.Fatalf("Unable to create audit-user: %v", err)
+		}
+		if err := u.ChangePassword(rt, "audit-password"); err != nil {
+			t.Fatalf("Unable to set password: %v", err)
+		}
+		if _, err := rt.Remove(u); err != nil {
+			t.Fatalf("Unable to remove audit-user: %v", err)
+		}
+	})
+	rt.AuditAction("machines", "global", "reboot")
+
+	entries, err := dt.Audit().List()
+	if err != nil {
+		t.Fatalf("Unable to list the audit log: %v", err)
+	}
+	mine := []*models.AuditEntry{}
+	for _, e := range entries {
+		if e.ObjectKey == "audit-quiet" {
+			t.Errorf("Changes without a user should not be audited: %#v", e)
+		}
+		if e.ObjectKey == "audit-user" || e.Command == "reboot" {
+			mine = append(mine, e)
+		}
+	}
+	actions := []string{}
+	for _, e := range mine {
+		actions = append(actions, e.Action)
+		if e.User != "rocketskates" || e.TokenId != "tok-1" || e.ClientIP != "192.168.124.10" {
+			t.Errorf("Entry has the wrong origin: %#v", e)
+		}
+	}
+	if strings.Join(actions, ",") != "create,save,delete,action" {
+		t.Fatalf("Expected create,save,delete,action, got %v", actions)
+	}
+	for i := 1; i < len(mine); i++ {
+		if mine[i].Id <= mine[i-1].Id {
+			t.Errorf("Entry IDs should increase: %s then %s", mine[i-1].Id, mine[i].Id)
+		}
+	}
+	if len(mine[0].Patch) == 0 || mine[0].Model != "users" {
+		t.Errorf("The create entry should have a patch: %#v", mine[0])
+	}
+	buf, _ := json.Marshal(mine)
+	if strings.Contains(string(buf), base64.StdEncoding.EncodeToString(u.PasswordHash)) {
+		t.Errorf("The audit log should not contain the password hash")
+	}
+
+	// The entries can be filtered like the objects in the stores.
+	items := []models.Model{}
+	for _, e := range entries {
+		items = append(items, &AuditEntry{e})
+	}
+	ref := &AuditEntry{}
+	maker := ref.Indexes()["Action"]
+	filtered, err := index.All(index.Sort(maker), index.Eq("delete"))(index.Create(items))
+	if err != nil {
+		t.Fatalf("Unable to filter the audit log: %v", err)
+	}
+	found := false
+	for _, item := range filtered.Items() {
+		e := item.(*AuditEntry)
+		if e.Action != "delete" {
+			t.Errorf("Filter returned a %s entry", e.Action)
+		}
+		found = found || e.ObjectKey == "audit-user"
+	}
+	if !found {
+		t.Errorf("Filter did not return the delete of audit-user")
+	}
+
+	if err := dt.Audit().forwardTo("syslog://nowhere"); err == nil {
+		t.Errorf("A bad auditSyslog target should be refused")
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	dt := mkDT(nil)
+	a := NewAuditLog(filepath.Join(tmpDir, "audit-rotation"), dt.Logger)
+	a.maxSize, a.keep = 1, 2
+	for i := 0; i < 5; i++ {
+		if err := a.Record(&models.AuditEntry{Action: "action", Command: fmt.Sprintf("cmd-%d", i)}); err != nil {
+			t.Fatalf("Unable to record entry %d: %v", i, err)
+		}
+		a.Flush()
+	}
+	entries, err := a.List()
+	if err != nil {
+		t.Fatalf("Unable to list the audit log: %v", err)
+	}
+	cmds := []string{}
+	for _, e := range entries {
+		cmds = append(cmds, e.Command)
+	}
+	if strings.Join(cmds, ",") != "cmd-3,cmd-4" {
+		t.Errorf("Expected the 2 newest entries to be kept, got %v", cmds)
+	}
+	seen := 0
+	stop := fmt.Errorf("stop")
+	if err := a.Scan(func(e *models.AuditEntry) error { seen++; return stop }); err != stop || seen != 1 {
+		t.Errorf("Scan should stop at the first error, saw %d entries and %v", seen, err)
+	}
+}
@@ -51,7 +51,7 @@ func (obj *BootEnv) SetReadOnly(b bool) {
 func (obj *BootEnv) SaveClean() store.KeySaver {
 	mod := *obj.BootEnv
 	mod.ClearValidation()
-	return ModelToBackend(&mod)
+	return keepVersion(ModelToBackend(&mod), obj)
 }
 
 func (b *BootEnv) Indexes() map[string]index.Maker {
@@ -218,7 +218,7 @@ func (b *BootEnv) genRoot(commonRoot *template.Template, e models.ErrorAdder) *t
 		}
 	}
 	if b.BootParams != "" {
-		tmpl, err := template.New("machine").Parse(b.BootParams)
+		tmpl, err := models.NewTemplate("machine").Parse(b.BootParams)
 		if err != nil {
 			e.Errorf("Error compiling boot parameter template: %v", err)
 		} else {
@@ -346,6 +346,7 @@ func (b *BootEnv) Validate() {
 	if b.NetBoot() && b.OS.Name == "" {
 		b.Errorf("bootenv: Missing OS.Name")
 	}
+	b.rt.validateParamValues(b.Params, b)
 	b.fillInstallRepo()
 	// OK, we are sane, if not useable.  Check to see if we are useable
 	seenPxeLinux := false
@@ -450,6 +451,7 @@ func (b *BootEnv) New() store.KeySaver {
 }
 
 func (b *BootEnv) BeforeSave() error {
+	b.rt.secureParams(b, b)
 	b.Validate()
 	if !b.Validated {
 		return b.MakeError(422, ValidationError, b)
@@ -561,7 +563,7 @@ func (b *BootEnv) AfterSave() {
 }
 
 var bootEnvLockMap = map[string][]string{
-	"get":     []string{"bootenvs"},
+	"get":     []string{"bootenvs", "profiles", "params"},
 	"create":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
 	"update":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
 	"patch":   []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
@@ -0,0 +1,296 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/store"
+	"github.com/pborman/uuid"
+)
+
+// BulkOperation applies a patch, workflow change, or stage change to
+// a fixed set of machines a few at a time.  The machine set is
+// resolved by the frontend when the operation is created, and
+// progress is driven by the bulk operation controller in the
+// midlayer.
+//
+// swagger:model
+type BulkOperation struct {
+	*models.BulkOperation
+	validate
+	oldState string
+}
+
+func (b *BulkOperation) SetReadOnly(v bool) {
+	b.ReadOnly = v
+}
+
+func (b *BulkOperation) SaveClean() store.KeySaver {
+	mod := *b.BulkOperation
+	mod.ClearValidation()
+	return keepVersion(toBackend(&mod, b.rt), b)
+}
+
+func AsBulkOperation(o models.Model) *BulkOperation {
+	return o.(*BulkOperation)
+}
+
+func AsBulkOperations(o []models.Model) []*BulkOperation {
+	res := make([]*BulkOperation, len(o))
+	for i := range o {
+		res[i] = AsBulkOperation(o[i])
+	}
+	return res
+}
+
+func (b *BulkOperation) New() store.KeySaver {
+	res := &BulkOperation{BulkOperation: &models.BulkOperation{}}
+	if b.BulkOperation != nil && b.ChangeForced() {
+		res.ForceChange()
+	}
+	res.rt = b.rt
+	return res
+}
+
+func (b *BulkOperation) UUID() string {
+	return b.Uuid.String()
+}
+
+func (b *BulkOperation) Indexes() map[string]index.Maker {
+	fix := AsBulkOperation
+	res := index.MakeBaseIndexes(b)
+	res["Uuid"] = index.Make(
+		true,
+		"UUID string",
+		func(i, j models.Model) bool { return fix(i).Uuid.String() < fix(j).Uuid.String() },
+		func(ref models.Model) (gte, gt index.Test) {
+			refUuid := fix(ref).Uuid.String()
+			return func(s models.Model) bool {
+					return fix(s).Uuid.String() >= refUuid
+				},
+				func(s models.Model) bool {
+					return fix(s).Uuid.String() > refUuid
+				}
+		},
+		func(s string) (models.Model, error) {
+			id := uuid.Parse(s)
+			if id == nil {
+				return nil, fmt.Errorf("Invalid UUID: %s", s)
+			}
+			op := fix(b.New())
+			op.Uuid = id
+			return op, nil
+		})
+	res["State"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i).State < fix(j).State },
+		func(ref models.Model) (gte, gt index.Test) {
+			refState := fix(ref).State
+			return func(s models.Model) bool {
+					return fix(s).State >= refState
+				},
+				func(s models.Model) bool {
+					return fix(s).State > refState
+				}
+		},
+		func(s string) (models.Model, error) {
+			op := fix(b.New())
+			op.State = s
+			return op, nil
+		})
+	res["Workflow"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i).Workflow < fix(j).Workflow },
+		func(ref models.Model) (gte, gt index.Test) {
+			refWorkflow := fix(ref).Workflow
+			return func(s models.Model) bool {
+					return fix(s).Workflow >= refWorkflow
+				},
+				func(s models.Model) bool {
+					return fix(s).Workflow > refWorkflow
+				}
+		},
+		func(s string) (models.Model, error) {
+			op := fix(b.New())
+			op.Workflow = s
+			return op, nil
+		})
+	res["Stage"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i).Stage < fix(j).Stage },
+		func(ref models.Model) (gte, gt index.Test) {
+			refStage := fix(ref).Stage
+			return func(s models.Model) bool {
+					return fix(s).Stage >= refStage
+				},
+				func(s models.Model) bool {
+					return fix(s).Stage > refStage
+				}
+		},
+		func(s string) (models.Model, error) {
+			op := fix(b.New())
+			op.Stage = s
+			return op, nil
+		})
+	return res
+}
+
+func (b *BulkOperation) Validate() {
+	b.BulkOperation.Validate()
+	if b.Workflow != "" && b.Stage != "" {
+		b.Errorf("Workflow and Stage cannot both be set")
+	}
+	if len(b.Filter) == 0 {
+		b.Errorf("BulkOperation must have a Filter")
+	}
+	if b.Workflow != "" && b.rt.find("workflows", b.Workflow) == nil {
+		b.Errorf("Workflow %s does not exist", b.Workflow)
+	}
+	if b.Stage != "" && b.rt.find("stages", b.Stage) == nil {
+		b.Errorf("Stage %s does not exist", b.Stage)
+	}
+	if b.oldState != b.State {
+		switch b.State {
+		case "running":
+			if b.StartTime.IsZero() {
+				b.StartTime = time.Now()
+			}
+		case "aborted", "failed", "finished":
+			b.EndTime = time.Now()
+			// Nothing else will happen to machines that have not
+			// finished yet.
+			for i := range b.Machines {
+				switch b.Machines[i].State {
+				case "pending", "running":
+					b.Machines[i].State = "skipped"
+					b.Machines[i].Message = fmt.Sprintf("Operation %s", b.State)
+					b.Machines[i].EndTime = b.EndTime
+				}
+			}
+		}
+	}
+	b.SetValid()
+	b.SetAvailable()
+}
+
+func (b *BulkOperation) BeforeSave() error {
+	b.Fill()
+	b.Validate()
+	if !b.Validated {
+		return b.MakeError(422, ValidationError, b)
+	}
+	return nil
+}
+
+func (b *BulkOperation) OnLoad() error {
+	defer func() { b.rt = nil }()
+	b.Fill()
+	b.oldState = b.State
+	return b.BeforeSave()
+}
+
+func (b *BulkOperation) OnCreate() error {
+	if b.State != "created" {
+		b.Errorf("BulkOperation must be created in the created state, not %s", b.State)
+	}
+	for i := range b.Machines {
+		b.Machines[i].State = "pending"
+	}
+	b.oldState = b.State
+	return b.HasError()
+}
+
+func (b *BulkOperation) OnChange(oldThing store.KeySaver) error {
+	old := AsBulkOperation(oldThing)
+	b.oldState = old.State
+	e := &models.Error{
+		Code:  http.StatusUnprocessableEntity,
+		Type:  ValidationError,
+		Model: b.Prefix(),
+		Key:   b.Key(),
+	}
+	if old.Done() && old.State != b.State {
+		e.Errorf("Cannot change State from %s to %s", old.State, b.State)
+	}
+	if b.State == "created" && old.State != "created" {
+		e.Errorf("Cannot change State from %s to %s", old.State, b.State)
+	}
+	if b.rt != nil && b.rt.caller != nil {
+		b.checkFixed(old, e)
+	}
+	return e.HasError()
+}
+
+// checkFixed makes sure an API request only changes the State,
+// Description, and Meta of an operation after it has been created.
+// The machine set and what is done to each machine were checked when
+// the operation was created, and progress is only tracked by the
+// controller.
+func (b *BulkOperation) checkFixed(old *BulkOperation, e *models.Error) {
+	if !sameFilter(old.Filter, b.Filter) {
+		e.Errorf("Cannot change Filter")
+	}
+	if (len(old.Patch) > 0 || len(b.Patch) > 0) && !reflect.DeepEqual(old.Patch, b.Patch) {
+		e.Errorf("Cannot change Patch")
+	}
+	if old.Workflow != b.Workflow {
+		e.Errorf("Cannot change Workflow")
+	}
+	if old.Stage != b.Stage {
+		e.Errorf("Cannot change Stage")
+	}
+	if old.Force != b.Force {
+		e.Errorf("Cannot change Force")
+	}
+	if old.Concurrency != b.Concurrency {
+		e.Errorf("Cannot change Concurrency")
+	}
+	if old.MaxFailures != b.MaxFailures {
+		e.Errorf("Cannot change MaxFailures")
+	}
+	same := len(old.Machines) == len(b.Machines)
+	for i := 0; same && i < len(b.Machines); i++ {
+		same = uuid.Equal(old.Machines[i].Uuid, b.Machines[i].Uuid)
+	}
+	if !same {
+		e.Errorf("Cannot change Machines")
+	}
+	// Whatever progress the client sent back is stale at best.
+	b.Machines = append([]models.BulkOperationMachine{}, old.Machines...)
+}
+
+func sameFilter(a, b map[string][]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (b *BulkOperation) BeforeDelete() error {
+	e := &models.Error{Code: 422, Type: ValidationError, Model: b.Prefix(), Key: b.Key()}
+	switch b.State {
+	case "running", "paused":
+		e.Errorf("BulkOperation %s is %s, it must be aborted before it can be deleted", b.UUID(), b.State)
+	}
+	return e.HasError()
+}
+
+var bulkOperationLockMap = map[string][]string{
+	"get":     []string{"bulk_operations"},
+	"create":  []string{"stages", "machines", "profiles", "params", "workflows", "bulk_operations"},
+	"update":  []string{"stages", "workflows", "bulk_operations"},
+	"patch":   []string{"stages", "workflows", "bulk_operations"},
+	"delete":  []string{"bulk_operations"},
+	"actions": []string{"bulk_operations"},
+}
+
+func (b *BulkOperation) Locks(action string) []string {
+	return bulkOperationLockMap[action]
+}
@@ -0,0 +1,138 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestBulkOperationCrud(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "machines", "profiles", "params", "workflows", "bulk_operations")
+	filter := map[string][]string{"Name": []string{"Eq(fred)"}}
+	mUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create BulkOperation with no UUID", rt.Create, &models.BulkOperation{Filter: filter, Stage: "none"}, false},
+		{"Create BulkOperation with no Filter", rt.Create, &models.BulkOperation{Uuid: uuid.NewRandom(), Stage: "none"}, false},
+		{"Create BulkOperation with nothing to do", rt.Create, &models.BulkOperation{Uuid: uuid.NewRandom(), Filter: filter}, false},
+		{"Create BulkOperation with missing Stage", rt.Create, &models.BulkOperation{Uuid: uuid.NewRandom(), Filter: filter, Stage: "missing"}, false},
+		{"Create BulkOperation with missing Workflow", rt.Create, &models.BulkOperation{Uuid: uuid.NewRandom(), Filter: filter, Workflow: "missing"}, false},
+		{"Create BulkOperation with Stage and Workflow", rt.Create, &models.BulkOperation{Uuid: uuid.NewRandom(), Filter: filter, Stage: "none", Workflow: "none"}, false},
+		{"Create BulkOperation with negative Concurrency", rt.Create, &models.BulkOperation{Uuid: uuid.NewRandom(), Filter: filter, Stage: "none", Concurrency: -1}, false},
+		{"Create BulkOperation in running State", rt.Create, &models.BulkOperation{Uuid: uuid.NewRandom(), Filter: filter, Stage: "none", State: "running"}, false},
+		{"Create BulkOperation with Stage", rt.Create, &models.BulkOperation{
+			Uuid:   uuid.Parse("3e7031fe-3062-45f1-835c-92541bc9cbd3"),
+			Filter: filter,
+			Stage:  "none",
+			Machines: []models.BulkOperationMachine{
+				{Uuid: mUuid, Name: "fred"},
+			},
+		}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var op *models.BulkOperation
+	rt.Do(func(d Stores) {
+		op = models.Clone(rt.Find("bulk_operations", "3e7031fe-3062-45f1-835c-92541bc9cbd3")).(*models.BulkOperation)
+	})
+	if op.State != "created" || op.Concurrency != 1 || op.Machines[0].State != "pending" {
+		t.Errorf("BulkOperation was not created with correct defaults: %#v", op)
+	}
+	op.State = "aborted"
+	tests = []crudTest{
+		{"Abort BulkOperation", rt.Update, op, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		op = models.Clone(rt.Find("bulk_operations", op.Key())).(*models.BulkOperation)
+	})
+	if op.Machines[0].State != "skipped" || op.EndTime.IsZero() {
+		t.Errorf("Aborted BulkOperation did not skip pending machines: %#v", op)
+	}
+	restarted := models.Clone(op).(*models.BulkOperation)
+	restarted.State = "running"
+	tests = []crudTest{
+		{"Restart aborted BulkOperation", rt.Update, restarted, false},
+		{"Delete aborted BulkOperation", rt.Remove, op, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+}
+
+func TestBulkOperationFixedFields(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "machines", "profiles", "params", "workflows", "bulk_operations")
+	op := &models.BulkOperation{
+		Uuid:   uuid.NewRandom(),
+		Filter: map[string][]string{"Name": []string{"Eq(fred)"}},
+		Stage:  "none",
+		Machines: []models.BulkOperationMachine{
+			{Uuid: uuid.NewRandom(), Name: "fred"},
+		},
+	}
+	tests := []crudTest{
+		{"Create BulkOperation", rt.Create, op, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	api := dt.Request(dt.Logger, "stages", "machines", "profiles", "params", "workflows", "bulk_operations").
+		LimitTo(NewClaim("fred", "fred", 30).Add("*", "*", "*"))
+	var saved *models.BulkOperation
+	api.Do(func(d Stores) {
+		saved = models.Clone(api.Find("bulk_operations", op.Key())).(*models.BulkOperation)
+	})
+	addMachine := models.Clone(saved).(*models.BulkOperation)
+	addMachine.Machines = append(addMachine.Machines, models.BulkOperationMachine{Uuid: uuid.NewRandom(), Name: "barney"})
+	changeStage := models.Clone(saved).(*models.BulkOperation)
+	changeStage.Stage = "local"
+	changeFilter := models.Clone(saved).(*models.BulkOperation)
+	changeFilter.Filter = map[string][]string{}
+	fakeProgress := models.Clone(saved).(*models.BulkOperation)
+	pause := models.Clone(saved).(*models.BulkOperation)
+	pause.State = "paused"
+	pause.Description = "Waiting for the change window"
+	controller := models.Clone(saved).(*models.BulkOperation)
+	controller.State = "running"
+	controller.Machines[0].State = "running"
+	tests = []crudTest{
+		{"Add machine to BulkOperation", api.Update, addMachine, false},
+		{"Change BulkOperation Stage", api.Update, changeStage, false},
+		{"Change BulkOperation Filter", api.Update, changeFilter, false},
+		{"Pause BulkOperation", api.Update, pause, true},
+	}
+	for _, test := range tests {
+		test.Test(t, api)
+	}
+	tests = []crudTest{
+		{"Update BulkOperation progress from the controller", rt.Update, controller, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	api.Do(func(d Stores) {
+		saved = models.Clone(api.Find("bulk_operations", op.Key())).(*models.BulkOperation)
+	})
+	if saved.Machines[0].State != "running" {
+		t.Errorf("Controller progress was not saved: %#v", saved.Machines[0])
+	}
+	fakeProgress.State = "running"
+	fakeProgress.Machines[0].State = "finished"
+	tests = []crudTest{
+		{"Update BulkOperation with stale progress", api.Update, fakeProgress, true},
+	}
+	for _, test := range tests {
+		test.Test(t, api)
+	}
+	api.Do(func(d Stores) {
+		saved = models.Clone(api.Find("bulk_operations", op.Key())).(*models.BulkOperation)
+	})
+	if saved.Machines[0].State != "running" {
+		t.Errorf("Client supplied progress should have been ignored: %#v", saved.Machines[0])
+	}
+}
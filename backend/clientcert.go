@@ -0,0 +1,31 @@
+package backend
+
+import (
+	"crypto/x509"
+
+	"github.com/pborman/uuid"
+)
+
+// CertIdentity returns the Machine or User that a verified client
+// certificate names.  A Machine is named by its UUID as the common
+// name of the subject, and a User by its name as an email SAN.  Nothing
+// else is used: DNS names in particular identify hosts, and a host
+// that shares its name with a User must not authenticate as that User.
+// rt must be able to lock users and machines, and must not be locked.
+func (p *DataTracker) CertIdentity(rt *RequestTracker, cert *x509.Certificate) (user *User, machine *Machine) {
+	rt.Do(func(d Stores) {
+		if id := uuid.Parse(cert.Subject.CommonName); id != nil {
+			if obj := rt.Find("machines", id.String()); obj != nil {
+				machine = AsMachine(obj)
+				return
+			}
+		}
+		for _, name := range cert.EmailAddresses {
+			if obj := rt.Find("users", name); obj != nil {
+				user = AsUser(obj)
+				return
+			}
+		}
+	})
+	return
+}
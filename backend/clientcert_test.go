@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create CA cert: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a client certificate signed by ca that has been
+// verified the way the API server verifies them.
+func (ca *testCA) issue(t *testing.T, cn string, dnsNames, emails []string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate client key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	tmpl := &x509.Certificate{
+		SerialNumber:   serial,
+		Subject:        pkix.Name{CommonName: cn},
+		DNSNames:       dnsNames,
+		EmailAddresses: emails,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Unable to create client cert for %s: %v", cn, err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:     ca.pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		t.Fatalf("Client cert for %s does not verify: %v", cn, err)
+	}
+	return cert
+}
+
+func TestCertIdentity(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "machines", "tasks", "bootenvs", "profiles", "workflows", "users")
+	machineUUID := uuid.NewRandom()
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(&models.User{Name: "cert-user"}); err != nil {
+			t.Fatalf("Unable to create cert-user: %v", err)
+		}
+		if _, err := rt.Create(&models.Machine{Uuid: machineUUID, Name: "cert-machine"}); err != nil {
+			t.Fatalf("Unable to create cert-machine: %v", err)
+		}
+	})
+	ca := newTestCA(t)
+	other := newTestCA(t)
+	if _, err := other.issue(t, "nobody", nil, []string{"cert-user"}).Verify(x509.VerifyOptions{Roots: ca.pool}); err == nil {
+		t.Errorf("A cert from another CA should not verify")
+	}
+
+	tests := []struct {
+		name          string
+		cert          *x509.Certificate
+		user, machine string
+	}{
+		{"user by email SAN", ca.issue(t, "nobody", nil, []string{"nobody@example.com", "cert-user"}), "cert-user", ""},
+		{"machine by common name", ca.issue(t, machineUUID.String(), nil, nil), "", machineUUID.String()},
+		{"machine wins over user", ca.issue(t, machineUUID.String(), nil, []string{"cert-user"}), "", machineUUID.String()},
+		{"unknown UUID falls back to user", ca.issue(t, uuid.NewRandom().String(), nil, []string{"cert-user"}), "cert-user", ""},
+		{"user is not named by common name", ca.issue(t, "cert-user", nil, nil), "", ""},
+		{"user is not named by DNS SAN", ca.issue(t, "host.example.com", []string{"cert-user", "host.example.com"}, nil), "", ""},
+		{"machine is not named by DNS SAN", ca.issue(t, "host.example.com", []string{machineUUID.String()}, nil), "", ""},
+		{"nobody", ca.issue(t, "nobody", []string{"nobody.example.com"}, nil), "", ""},
+	}
+	for _, test := range tests {
+		user, machine := dt.CertIdentity(dt.Request(dt.Logger, "users", "machines"), test.cert)
+		gotUser, gotMachine := "", ""
+		if user != nil {
+			gotUser = user.Name
+		}
+		if machine != nil {
+			gotMachine = machine.Key()
+		}
+		if gotUser != test.user || gotMachine != test.machine {
+			t.Errorf("%s: expected user %q machine %q, got user %q machine %q",
+				test.name, test.user, test.machine, gotUser, gotMachine)
+		}
+	}
+}
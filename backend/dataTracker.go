@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -126,22 +128,36 @@ exit
 				"title": "Digital Rebar Provision",
 			},
 		}
+		superuserRole = &models.Role{
+			Name:        "superuser",
+			Description: "Role that allows access to everything.",
+			Claims:      []*models.Claim{{Scope: "*", Action: "*", Specific: "*"}},
+			Meta: map[string]string{
+				"icon":  "user secret",
+				"color": "blue",
+				"title": "Digital Rebar Provision",
+			},
+		}
 	)
 	res, _ := store.Open("memory:///")
 	bootEnvs, _ := res.MakeSub("bootenvs")
 	stages, _ := res.MakeSub("stages")
+	roles, _ := res.MakeSub("roles")
 	localBoot.ClearValidation()
 	ignoreBoot.ClearValidation()
 	noneStage.ClearValidation()
 	localStage.ClearValidation()
+	superuserRole.ClearValidation()
 	localBoot.Fill()
 	ignoreBoot.Fill()
 	noneStage.Fill()
 	localStage.Fill()
+	superuserRole.Fill()
 	bootEnvs.Save("local", localBoot)
 	bootEnvs.Save("ignore", ignoreBoot)
 	stages.Save("none", noneStage)
 	stages.Save("local", localStage)
+	roles.Save("superuser", superuserRole)
 	res.(*store.Memory).SetMetaData(map[string]string{
 		"Name":        "BasicStore",
 		"Description": "Default objects that must be present",
@@ -174,6 +190,7 @@ type Store struct {
 	sync.Mutex
 	index.Index
 	backingStore store.Store
+	loadedAt     uint64
 }
 
 func (s *Store) getBackend(obj models.Model) store.Store {
@@ -195,6 +212,10 @@ func Fill(t store.KeySaver) {
 		if obj.BootEnv == nil {
 			obj.BootEnv = &models.BootEnv{}
 		}
+	case *BulkOperation:
+		if obj.BulkOperation == nil {
+			obj.BulkOperation = &models.BulkOperation{}
+		}
 	case *Job:
 		if obj.Job == nil {
 			obj.Job = &models.Job{}
@@ -227,6 +248,10 @@ func Fill(t store.KeySaver) {
 		if obj.Reservation == nil {
 			obj.Reservation = &models.Reservation{}
 		}
+	case *Role:
+		if obj.Role == nil {
+			obj.Role = &models.Role{}
+		}
 	case *Subnet:
 		if obj.Subnet == nil {
 			obj.Subnet = &models.Subnet{}
@@ -260,6 +285,8 @@ func ModelToBackend(m models.Model) store.KeySaver {
 		return &Stage{Stage: obj}
 	case *models.BootEnv:
 		return &BootEnv{BootEnv: obj}
+	case *models.BulkOperation:
+		return &BulkOperation{BulkOperation: obj}
 	case *models.Job:
 		return &Job{Job: obj}
 	case *models.Lease:
@@ -276,6 +303,8 @@ func ModelToBackend(m models.Model) store.KeySaver {
 		return &Profile{Profile: obj}
 	case *models.Reservation:
 		return &Reservation{Reservation: obj}
+	case *models.Role:
+		return &Role{Role: obj}
 	case *models.Subnet:
 		return &Subnet{Subnet: obj}
 	case *models.Task:
@@ -330,6 +359,16 @@ func toBackend(m models.Model, rt *RequestTracker) store.KeySaver {
 		res.BootEnv = obj
 		res.rt = rt
 		return &res
+	case *models.BulkOperation:
+		var res BulkOperation
+		if ours != nil {
+			res = *ours.(*BulkOperation)
+		} else {
+			res = BulkOperation{}
+		}
+		res.BulkOperation = obj
+		res.rt = rt
+		return &res
 	case *models.Job:
 		var res Job
 		if ours != nil {
@@ -410,6 +449,16 @@ func toBackend(m models.Model, rt *RequestTracker) store.KeySaver {
 		res.Reservation = obj
 		res.rt = rt
 		return &res
+	case *models.Role:
+		var res Role
+		if ours != nil {
+			res = *ours.(*Role)
+		} else {
+			res = Role{}
+		}
+		res.Role = obj
+		res.rt = rt
+		return &res
 	case *models.Subnet:
 		var res Subnet
 		if ours != nil {
@@ -529,6 +578,10 @@ type DataTracker struct {
 	allMux              *sync.RWMutex
 	GlobalProfileName   string
 	tokenManager        *JwtManager
+	tokens              *TokenRegistry
+	audit               *AuditLog
+	logins              *LoginLimiter
+	versions            *versionClock
 	rootTemplate        *template.Template
 	tmplMux             *sync.Mutex
 	thunks              []func()
@@ -552,6 +605,7 @@ func allKeySavers() []models.Model {
 	return []models.Model{
 		&Pref{},
 		&Param{},
+		&Role{},
 		&User{},
 		&Template{},
 		&Task{},
@@ -565,6 +619,7 @@ func allKeySavers() []models.Model {
 		&Lease{},
 		&Plugin{},
 		&Job{},
+		&BulkOperation{},
 	}
 }
 
@@ -619,6 +674,14 @@ func (p *DataTracker) lockAll() (stores Stores, unlocker func()) {
 		}
 }
 
+// HasStore reports whether prefix names one of the object stores.
+func (p *DataTracker) HasStore(prefix string) bool {
+	p.allMux.RLock()
+	defer p.allMux.RUnlock()
+	_, ok := p.objs[prefix]
+	return ok
+}
+
 func (p *DataTracker) LocalIP(remote net.IP) string {
 	// If we are behind a NAT, always use Our Address
 	if p.ForceOurAddress && p.OurAddress != "" {
@@ -666,6 +729,7 @@ func (p *DataTracker) rebuildCache(loadRT *RequestTracker) (hard, soft *models.E
 		res := make([]models.Model, len(storeObjs))
 		for i := range storeObjs {
 			res[i] = models.Model(storeObjs[i])
+			p.versions.seen(res[i].(versioner).resourceVersion())
 			if v, ok := res[i].(models.Validator); ok && v.Useable() {
 				soft.AddError(v.HasError())
 			}
@@ -696,6 +760,7 @@ func (p *DataTracker) rebuildCache(loadRT *RequestTracker) (hard, soft *models.E
 		}
 
 		p.objs[prefix].Index = *index.Create(res)
+		p.objs[prefix].loadedAt = p.versions.next()
 		if prefix == "bootenvs" {
 			for _, thing := range p.objs[prefix].Items() {
 				benv := AsBootEnv(thing)
@@ -711,7 +776,7 @@ func (p *DataTracker) rebuildCache(loadRT *RequestTracker) (hard, soft *models.E
 				tmpl := AsTemplate(thing)
 				fmt.Fprintf(buf, `{{define "%s"}}%s{{end}}`, tmpl.ID, tmpl.Contents)
 			}
-			root, err := template.New("").Parse(buf.String())
+			root, err := models.NewTemplate("").Parse(buf.String())
 			if err != nil {
 				hard.Errorf("Unable to load root templates: %v", err)
 				return
@@ -735,6 +800,7 @@ func ValidateDataTrackerStore(fileRoot string, backend store.Store, logger logge
 		defaultPrefs:      map[string]string{},
 		runningPrefs:      map[string]string{},
 		tokenManager:      NewJwtManager([]byte{}, JwtConfig{Method: jwt.SigningMethodHS256}),
+		versions:          newVersionClock(),
 		prefMux:           &sync.Mutex{},
 		allMux:            &sync.RWMutex{},
 		FS:                NewFS(".", logger),
@@ -775,6 +841,10 @@ func NewDataTracker(backend store.Store,
 		defaultPrefs:      defaultPrefs,
 		runningPrefs:      map[string]string{},
 		tokenManager:      NewJwtManager([]byte{}, JwtConfig{Method: jwt.SigningMethodHS256}),
+		tokens:            NewTokenRegistry(filepath.Join(logRoot, "tokens")),
+		audit:             NewAuditLog(filepath.Join(logRoot, "audit"), logger),
+		logins:            NewLoginLimiter(),
+		versions:          newVersionClock(),
 		prefMux:           &sync.Mutex{},
 		allMux:            &sync.RWMutex{},
 		FS:                NewFS(fileRoot, logger),
@@ -787,6 +857,11 @@ func NewDataTracker(backend store.Store,
 		macAddrMux:        &sync.RWMutex{},
 	}
 
+	// Throw away any artifact uploads that were interrupted.
+	if err := os.RemoveAll(artifactUploadRoot(res)); err != nil {
+		logger.Errorf("dataTracker: Unable to clean up artifact uploads: %v", err)
+	}
+
 	// Make sure incoming writable backend has all stores created
 	loadRT := res.Request(logger)
 	loadRT.AllLocked(func(d Stores) {
@@ -805,7 +880,7 @@ func NewDataTracker(backend store.Store,
 		}
 	})
 	// Create minimal content.
-	rt := res.Request(res.Logger, "stages", "bootenvs", "preferences", "users", "machines", "profiles", "params", "workflows")
+	rt := res.Request(res.Logger, "stages", "bootenvs", "preferences", "users", "roles", "machines", "profiles", "params", "workflows")
 	rt.Do(func(d Stores) {
 		// Load the prefs - overriding defaults.
 		savePrefs := false
@@ -814,9 +889,9 @@ func NewDataTracker(backend store.Store,
 			res.runningPrefs[pref.Name] = pref.Val
 		}
 
-		// Set systemGrantorSecret and baseTokenSecret if unset and save it to backing store.
+		// Set systemGrantorSecret, baseTokenSecret, and secureParamSecret if unset and save it to backing store.
 		prefs := res.Prefs()
-		for _, pref := range []string{"systemGrantorSecret", "baseTokenSecret"} {
+		for _, pref := range []string{"systemGrantorSecret", "baseTokenSecret", "secureParamSecret"} {
 			if val, ok := prefs[pref]; !ok || val == "" {
 				prefs[pref] = randString(32)
 				savePrefs = true
@@ -849,6 +924,9 @@ func NewDataTracker(backend store.Store,
 			res.SetPrefs(rt, prefs)
 		}
 		res.tokenManager.updateKey([]byte(res.pref("baseTokenSecret")))
+		if err := res.audit.forwardTo(res.pref("auditSyslog")); err != nil {
+			res.Errorf("dataTracker: Not forwarding the audit log to syslog: %v", err)
+		}
 
 		if d("profiles").Find(res.GlobalProfileName) == nil {
 			res.Infof("Creating %s profile", res.GlobalProfileName)
@@ -869,7 +947,8 @@ func NewDataTracker(backend store.Store,
 			user := &User{}
 			Fill(user)
 			user.Name = "rocketskates"
-			if err := user.ChangePassword(rt, "r0cketsk8ts"); err != nil {
+			user.Roles = []string{"superuser"}
+			if err := user.setPassword(rt, "r0cketsk8ts"); err != nil {
 				logger.Fatalf("Failed to create rocketskates user: %v", err)
 			}
 			rt.Create(user)
@@ -965,6 +1044,14 @@ func (p *DataTracker) SetPrefs(rt *RequestTracker, prefs map[string]string) erro
 		err.Errorf("%s: %s", name, e.Error())
 		return false
 	}
+	boolCheck := func(name, val string) bool {
+		_, e := strconv.ParseBool(val)
+		if e == nil {
+			return true
+		}
+		err.Errorf("%s: %s", name, e.Error())
+		return false
+	}
 
 	savePref := func(name, val string) bool {
 		p.prefMux.Lock()
@@ -987,6 +1074,13 @@ func (p *DataTracker) SetPrefs(rt *RequestTracker, prefs map[string]string) erro
 			if lenCheck(name, val) && savePref(name, val) {
 				p.tokenManager.updateKey([]byte(val))
 			}
+		case "secureParamSecret":
+			// Changing it would make every stored secure param unreadable.
+			if cur := p.pref(name); cur != "" && cur != val {
+				err.Errorf("%s: Cannot be changed once it is set", name)
+			} else if lenCheck(name, val) {
+				savePref(name, val)
+			}
 		case "defaultBootEnv":
 			be := benvCheck(name, val)
 			if be != nil && !be.OnlyUnknown {
@@ -1005,10 +1099,72 @@ func (p *DataTracker) SetPrefs(rt *RequestTracker, prefs map[string]string) erro
 				err.AddError(p.RenderUnknown(rt))
 			}
 		case "unknownTokenTimeout",
-			"knownTokenTimeout":
+			"knownTokenTimeout",
+			"jobArtifactMaxSize",
+			"jobArtifactQuota",
+			"jobLogMaxSize",
+			"jobRetentionAge",
+			"jobRetentionCount",
+			"jobPurgeAge",
+			"inventoryHistory",
+			"passwordMinLength",
+			"passwordMinClasses",
+			"passwordHistory",
+			"loginMaxFailures",
+			"loginMaxIpFailures",
+			"loginLockoutTime":
+			if intCheck(name, val) {
+				savePref(name, val)
+			}
+		case "jobPurgeExport", "ldapStartTLS", "tokenRegistry":
+			if boolCheck(name, val) {
+				savePref(name, val)
+			}
+		case "ldapUrl":
+			if val == "" {
+				savePref(name, val)
+			} else if _, e := parseLdapUrl(val); e != nil {
+				err.AddError(e)
+			} else {
+				savePref(name, val)
+			}
+		case "auditSyslog":
+			if _, _, e := parseAuditSyslog(val); e != nil {
+				err.Errorf("%s: %v", name, e)
+			} else if e := p.audit.forwardTo(val); e != nil {
+				err.Errorf("%s: %v", name, e)
+			} else {
+				savePref(name, val)
+			}
+		case "ldapBindDN", "ldapBindPassword", "ldapBaseDN", "ldapGroupAttr":
+			savePref(name, val)
+		case "ldapUserFilter":
+			if val != "" && strings.Count(val, "%s") != 1 {
+				err.Errorf("%s: Must contain %%s exactly once: %s", name, val)
+			} else {
+				savePref(name, val)
+			}
+		case "ldapCacheTTL":
 			if intCheck(name, val) {
 				savePref(name, val)
 			}
+		case "oidcIssuer":
+			if val == "" {
+				savePref(name, val)
+			} else if e := checkOidcIssuer(val); e != nil {
+				err.AddError(e)
+			} else {
+				savePref(name, val)
+			}
+		case "oidcClientId", "oidcAudience", "oidcUsernameClaim", "oidcGroupsClaim", "oidcScopes":
+			savePref(name, val)
+		case "ldapGroupRoles", "oidcGroupRoles":
+			groupRoles := map[string][]string{}
+			if e := json.Unmarshal([]byte(val), &groupRoles); val != "" && e != nil {
+				err.Errorf("%s: %v", name, e)
+			} else {
+				savePref(name, val)
+			}
 		case "debugDhcp",
 			"debugRenderer",
 			"debugBootEnv",
@@ -1067,15 +1223,42 @@ func (p *DataTracker) getBackend(t models.Model) store.Store {
 }
 
 func (p *DataTracker) GetToken(tokenString string) (*DrpCustomClaims, error) {
-	return p.tokenManager.get(tokenString)
+	claims, err := p.tokenManager.get(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if p.tokens != nil && p.tokens.Revoked(claims.TokenId) {
+		return nil, fmt.Errorf("Token %s has been revoked", claims.TokenId)
+	}
+	return claims, nil
+}
+
+// GetExpiredToken is like GetToken, except that it also returns the
+// claims of a token that expired no more than KnownTokenTTL ago.
+// Tokens that expired before that are refused, so that a token that
+// leaked does not stay useful forever.
+func (p *DataTracker) GetExpiredToken(tokenString string) (*DrpCustomClaims, error) {
+	claims, err := p.tokenManager.getExpired(tokenString, p.KnownTokenTTL())
+	if err != nil {
+		return nil, err
+	}
+	if p.tokens != nil && p.tokens.Revoked(claims.TokenId) {
+		return nil, fmt.Errorf("Token %s has been revoked", claims.TokenId)
+	}
+	return claims, nil
 }
 
 func (p *DataTracker) SealClaims(claims *DrpCustomClaims) (string, error) {
 	return claims.Seal(p.tokenManager)
 }
 
-func (p *DataTracker) Backup() ([]byte, error) {
-	keys := make([]string, len(p.objs))
+// Backup returns all the objects as JSON.  Secure params keep their
+// encrypted values, so that restoring the backup along with the
+// secureParamSecret preference keeps them, unless decrypt is true.
+// Only callers that are allowed to get secure params should decrypt
+// them.
+func (p *DataTracker) Backup(decrypt bool) ([]byte, error) {
+	keys := make([]string, 0, len(p.objs))
 	for k := range p.objs {
 		keys = append(keys, k)
 	}
@@ -1083,7 +1266,13 @@ func (p *DataTracker) Backup() ([]byte, error) {
 	defer unlocker()
 	res := map[string][]models.Model{}
 	for _, k := range keys {
-		res[k] = p.objs[k].Items()
+		items := p.objs[k].Items()
+		if decrypt {
+			for i := range items {
+				items[i] = p.RedactModel(items[i], true)
+			}
+		}
+		res[k] = items
 	}
 	return json.Marshal(res)
 }
@@ -19,6 +19,10 @@ type validator interface {
 
 type validate struct {
 	rt *RequestTracker
+	// ResourceVersion is the resource version of the object.  It
+	// lives here instead of in the models so that it is saved with
+	// the object without being part of the API.
+	ResourceVersion uint64 `json:",omitempty"`
 }
 
 func (v *validate) setRT(rt *RequestTracker) {
@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+)
+
+// FilterMatch tests whether obj matches filter, which is the Filter
+// of a Claim.  Filters that cannot be parsed match nothing.
+func FilterMatch(filter string, obj models.Model) bool {
+	terms, err := url.ParseQuery(filter)
+	if err != nil || len(terms) == 0 {
+		return false
+	}
+	for field, vals := range terms {
+		matched := false
+		for _, val := range vals {
+			if filterTermMatch(field, val, obj) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func filterTermMatch(field, val string, obj models.Model) bool {
+	if field == "Profiles" {
+		p, ok := obj.(models.Profiler)
+		if !ok {
+			return false
+		}
+		for _, name := range p.GetProfiles() {
+			if name == val {
+				return true
+			}
+		}
+		return false
+	}
+	if strings.HasPrefix(field, "Meta.") {
+		m, ok := obj.(models.MetaHaver)
+		if !ok {
+			return false
+		}
+		v, ok := m.GetMeta()[strings.TrimPrefix(field, "Meta.")]
+		return ok && v == val
+	}
+	indexer, ok := obj.(index.Indexer)
+	if !ok {
+		return false
+	}
+	maker, ok := indexer.Indexes()[field]
+	if !ok {
+		return false
+	}
+	ref, err := maker.Fill(val)
+	if err != nil {
+		return false
+	}
+	gte, gt := maker.Tests(ref)
+	return gte(obj) && !gt(obj)
+}
@@ -0,0 +1,75 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestFilterMatch(t *testing.T) {
+	m := &Machine{Machine: &models.Machine{}}
+	m.Fill()
+	m.Uuid = uuid.NewRandom()
+	m.Name = "team-a-1"
+	m.Profiles = []string{"base", "team-a"}
+	m.Meta = models.Meta{"team": "a"}
+	tests := []struct {
+		filter string
+		match  bool
+	}{
+		{"Profiles=team-a", true},
+		{"Profiles=team-b", false},
+		{"Profiles=team-b&Profiles=team-a", true},
+		{"Meta.team=a", true},
+		{"Meta.team=b", false},
+		{"Meta.owner=", false},
+		{"Name=team-a-1", true},
+		{"Name=team-b-1", false},
+		{"Profiles=team-a&Meta.team=a", true},
+		{"Profiles=team-a&Meta.team=b", false},
+		{"NoSuchIndex=foo", false},
+		{"", false},
+		{"%zz", false},
+	}
+	for _, test := range tests {
+		if res := FilterMatch(test.filter, m); res != test.match {
+			t.Errorf("Filter %q: expected %v, got %v", test.filter, test.match, res)
+		}
+	}
+}
+
+func TestMatchObject(t *testing.T) {
+	teamA := &Machine{Machine: &models.Machine{}}
+	teamA.Fill()
+	teamA.Uuid = uuid.NewRandom()
+	teamA.Profiles = []string{"team-a"}
+	teamB := &Machine{Machine: &models.Machine{}}
+	teamB.Fill()
+	teamB.Uuid = uuid.NewRandom()
+	teamB.Profiles = []string{"team-b"}
+	claims := NewClaim("fred", "fred", 30).
+		Add("profiles", "get", "*").
+		AddFiltered("machines", "*", "*", "Profiles=team-a")
+	if claims.Match("machines", "get", teamA.Key()) {
+		t.Errorf("Match should skip claims with a Filter")
+	}
+	if !claims.HasFilters("machines", "update") {
+		t.Errorf("HasFilters should find the machines claim")
+	}
+	if claims.HasFilters("profiles", "get") {
+		t.Errorf("HasFilters should not find a claim without a Filter")
+	}
+	if !claims.MatchObject("machines", "update", teamA.Key(), teamA) {
+		t.Errorf("MatchObject should allow updating a team-a machine")
+	}
+	if claims.MatchObject("machines", "update", teamB.Key(), teamB) {
+		t.Errorf("MatchObject should not allow updating a team-b machine")
+	}
+	if claims.MatchObject("machines", "update", teamA.Key(), nil) {
+		t.Errorf("MatchObject should not allow a Filter to match a missing object")
+	}
+	if !claims.MatchObject("profiles", "get", "team-b", nil) {
+		t.Errorf("MatchObject should allow claims without a Filter")
+	}
+}
@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// defaultInventoryHistory is how many inventory snapshots are kept
+// for each machine if the inventoryHistory preference is not set.
+const defaultInventoryHistory = 10
+
+// InventoryDir returns the directory the inventory snapshots for the
+// Machine are stored in.  They are kept in the log root instead of
+// the file root, since the file root is served to anyone who asks.
+func (n *Machine) InventoryDir(rt *RequestTracker) string {
+	return filepath.Join(rt.dt.LogRoot, "inventory", n.UUID())
+}
+
+func inventoryNotFound(uuid, id string) error {
+	return &models.Error{
+		Code:     http.StatusNotFound,
+		Type:     "GET",
+		Model:    "inventory",
+		Key:      uuid,
+		Messages: []string{fmt.Sprintf("Inventory snapshot %s not found", id)},
+	}
+}
+
+// InventoryHistory returns the IDs of the inventory snapshots stored
+// for the Machine, oldest first.
+func (n *Machine) InventoryHistory(rt *RequestTracker) ([]string, error) {
+	ents, err := ioutil.ReadDir(n.InventoryDir(rt))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, ent := range ents {
+		if !ent.Mode().IsRegular() || !strings.HasSuffix(ent.Name(), ".json") {
+			continue
+		}
+		res = append(res, strings.TrimSuffix(ent.Name(), ".json"))
+	}
+	// Snapshot IDs are timestamps, so make shorter ones sort first.
+	sort.Slice(res, func(i, j int) bool {
+		if len(res[i]) != len(res[j]) {
+			return len(res[i]) < len(res[j])
+		}
+		return res[i] < res[j]
+	})
+	return res, nil
+}
+
+// InventorySnapshot returns a stored inventory snapshot for the
+// Machine.  An id of "latest" returns the most recent one.
+func (n *Machine) InventorySnapshot(rt *RequestTracker, id string) (*models.Inventory, error) {
+	if id == "latest" {
+		ids, err := n.InventoryHistory(rt)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, inventoryNotFound(n.UUID(), id)
+		}
+		id = ids[len(ids)-1]
+	}
+	if strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, inventoryNotFound(n.UUID(), id)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(n.InventoryDir(rt), id+".json"))
+	if os.IsNotExist(err) {
+		return nil, inventoryNotFound(n.UUID(), id)
+	} else if err != nil {
+		return nil, err
+	}
+	res := &models.Inventory{}
+	if err := json.Unmarshal(buf, res); err != nil {
+		return nil, err
+	}
+	res.Fill()
+	return res, nil
+}
+
+// StoreInventory saves inv as the newest inventory snapshot for the
+// Machine with the passed-in UUID, compares it with the previous
+// one, and updates the inventory params on the Machine.  Only the
+// inventoryHistory most recent snapshots are kept.  A
+// machines.inventory event is published for every new snapshot, and
+// a machines.drift event is published as well when the hardware has
+// changed since the previous one.
+//
+// rt must have the locks needed to update machines, and
+// StoreInventory must be called outside of rt.Do.
+func (p *DataTracker) StoreInventory(rt *RequestTracker, uuid string, inv *models.Inventory) (*models.InventorySnapshot, error) {
+	e := &models.Error{Code: http.StatusUnprocessableEntity, Type: ValidationError, Model: "inventory", Key: uuid}
+	inv.Fill()
+	inv.Validate(e)
+	if e.ContainsError() {
+		return nil, e
+	}
+	var res *models.InventorySnapshot
+	rt.Do(func(d Stores) {
+		obj := rt.find("machines", uuid)
+		if obj == nil {
+			e.Code = http.StatusNotFound
+			e.Errorf("Not Found")
+			return
+		}
+		m := AsMachine(obj)
+		ids, err := m.InventoryHistory(rt)
+		if err != nil {
+			e.Code = http.StatusInternalServerError
+			e.AddError(err)
+			return
+		}
+		res = &models.InventorySnapshot{
+			ID:      fmt.Sprintf("%d", inv.Time.UnixNano()),
+			Changes: []models.InventoryChange{},
+		}
+		if len(ids) > 0 {
+			res.Previous = ids[len(ids)-1]
+			if res.Previous == res.ID {
+				e.Code = http.StatusConflict
+				e.Errorf("Inventory snapshot %s already exists", res.ID)
+				return
+			}
+			if prev, err := m.InventorySnapshot(rt, res.Previous); err == nil {
+				res.Changes = inv.Diff(prev)
+			} else {
+				rt.Errorf("Failed to load inventory snapshot %s for %s: %v", res.Previous, uuid, err)
+			}
+		}
+		buf, err := json.Marshal(inv)
+		if err == nil {
+			if err = os.MkdirAll(m.InventoryDir(rt), 0700); err == nil {
+				err = ioutil.WriteFile(filepath.Join(m.InventoryDir(rt), res.ID+".json"), buf, 0600)
+			}
+		}
+		if err != nil {
+			e.Code = http.StatusInternalServerError
+			e.AddError(err)
+			return
+		}
+		keep := defaultInventoryHistory
+		if rt.dt.pref("inventoryHistory") != "" {
+			keep = rt.dt.prefInt("inventoryHistory")
+		}
+		ids = append(ids, res.ID)
+		for keep > 0 && len(ids) > keep {
+			os.Remove(filepath.Join(m.InventoryDir(rt), ids[0]+".json"))
+			ids = ids[1:]
+		}
+		params := m.GetParams()
+		for k, v := range inv.Params() {
+			params[k] = v
+		}
+		if err := rt.SetParams(m, params); err != nil {
+			e.AddError(err)
+			return
+		}
+		rt.Publish("machines", "inventory", uuid, res)
+		if len(res.Changes) > 0 {
+			rt.Publish("machines", "drift", uuid, &models.InventoryDrift{Machine: uuid, InventorySnapshot: *res})
+		}
+	})
+	return res, e.HasError()
+}
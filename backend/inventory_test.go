@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestInventory(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "machines", "tasks", "profiles", "params", "workflows", "templates", "preferences")
+	mUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "inventory"}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	now := time.Now()
+	inv := &models.Inventory{
+		Time: now,
+		DMI:  map[string]string{"product_name": "fred"},
+		Memory: []models.InventoryDIMM{
+			{Locator: "DIMM_A1", SizeMB: 16384},
+			{Locator: "DIMM_A2", SizeMB: 16384},
+		},
+		Disks: []models.InventoryDisk{{Name: "sda", Serial: "1234", SmartStatus: "PASSED"}},
+	}
+	bad := &models.Inventory{Time: now, NICs: []models.InventoryNIC{{Name: "eth0", MAC: "not-a-mac"}}}
+	if _, err := dt.StoreInventory(rt, mUuid.String(), bad); err == nil {
+		t.Errorf("Storing an inventory with an invalid MAC should have failed")
+	}
+	if _, err := dt.StoreInventory(rt, uuid.NewRandom().String(), inv); err == nil {
+		t.Errorf("Storing an inventory for a missing machine should have failed")
+	}
+	snap, err := dt.StoreInventory(rt, mUuid.String(), inv)
+	if err != nil {
+		t.Fatalf("Unexpected error storing inventory: %v", err)
+	}
+	if snap.Previous != "" || len(snap.Changes) != 0 {
+		t.Errorf("First snapshot should not have changes: %#v", snap)
+	}
+	inv2 := &models.Inventory{
+		Time:   now.Add(time.Hour),
+		DMI:    inv.DMI,
+		Memory: inv.Memory[:1],
+		Disks:  []models.InventoryDisk{{Name: "sda", Serial: "1234", SmartStatus: "FAILED"}},
+	}
+	snap2, err := dt.StoreInventory(rt, mUuid.String(), inv2)
+	if err != nil {
+		t.Fatalf("Unexpected error storing inventory: %v", err)
+	}
+	if snap2.Previous != snap.ID {
+		t.Errorf("Expected previous snapshot %s, not %s", snap.ID, snap2.Previous)
+	}
+	if len(snap2.Changes) != 1 ||
+		snap2.Changes[0] != (models.InventoryChange{Kind: "memory", Key: "DIMM_A2", Change: "removed"}) {
+		t.Errorf("Expected only DIMM_A2 to be removed, not %v", snap2.Changes)
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", mUuid.String()))
+		v, _ := rt.GetParam(m, "inventory/memory", false)
+		if dimms, ok := v.([]models.InventoryDIMM); !ok || len(dimms) != 1 {
+			t.Errorf("inventory/memory param was not updated: %v", v)
+		}
+		ids, err := m.InventoryHistory(rt)
+		if err != nil || len(ids) != 2 || ids[1] != snap2.ID {
+			t.Errorf("Expected 2 snapshots, not %v: %v", ids, err)
+		}
+		latest, err := m.InventorySnapshot(rt, "latest")
+		if err != nil || latest.Disks[0].SmartStatus != "FAILED" {
+			t.Errorf("Latest snapshot was not the newest one: %v, %v", latest, err)
+		}
+		if _, err := m.InventorySnapshot(rt, "../../etc/passwd"); err == nil {
+			t.Errorf("Fetching a snapshot outside the inventory history should have failed")
+		}
+		if err := dt.SetPrefs(rt, map[string]string{"inventoryHistory": "1"}); err != nil {
+			t.Errorf("Unexpected error setting prefs: %v", err)
+		}
+	})
+	inv3 := &models.Inventory{Time: now.Add(2 * time.Hour), DMI: inv.DMI, Memory: inv.Memory[:1]}
+	if _, err := dt.StoreInventory(rt, mUuid.String(), inv3); err != nil {
+		t.Fatalf("Unexpected error storing inventory: %v", err)
+	}
+	rt.Do(func(d Stores) {
+		ids, _ := AsMachine(rt.find("machines", mUuid.String())).InventoryHistory(rt)
+		if len(ids) != 1 {
+			t.Errorf("Expected inventoryHistory to keep 1 snapshot, not %v", ids)
+		}
+	})
+}
@@ -0,0 +1,239 @@
+package backend
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// jobReapBatch is the most jobs that will be archived or purged while
+// holding the locks once.
+const jobReapBatch = 1000
+
+// jobRetention is the retention policy for finished jobs.
+type jobRetention struct {
+	// Jobs that ended longer ago than age are archived.
+	age time.Duration
+	// Only the count most recent unarchived jobs for a machine are kept.
+	count int
+}
+
+func (p *DataTracker) prefInt(name string) int {
+	res, _ := strconv.Atoi(p.pref(name))
+	return res
+}
+
+// jobRetentionFor returns the retention policy for jobs created in
+// the passed-in workflow.  The jobRetentionAge and jobRetentionCount
+// preferences can be overridden by Meta values with the same names on
+// the workflow.
+func (p *DataTracker) jobRetentionFor(rt *RequestTracker, workflow string, def jobRetention) jobRetention {
+	res := def
+	if workflow == "" {
+		return res
+	}
+	wo := rt.find("workflows", workflow)
+	if wo == nil {
+		return res
+	}
+	meta := AsWorkflow(wo).Meta
+	if v, err := strconv.Atoi(meta["jobRetentionAge"]); err == nil {
+		res.age = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(meta["jobRetentionCount"]); err == nil {
+		res.count = v
+	}
+	return res
+}
+
+type jobExporter struct {
+	fi   *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+	path string
+}
+
+func (p *DataTracker) newJobExporter(now time.Time) (*jobExporter, error) {
+	// Job logs can hold secrets, so exports go in the log root where
+	// the file servers cannot get at them.
+	dir := filepath.Join(p.LogRoot, "job-exports")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	fileName := filepath.Join(dir, fmt.Sprintf("jobs-%d.tar.gz", now.UnixNano()))
+	fi, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	res := &jobExporter{fi: fi, path: fileName}
+	res.gz = gzip.NewWriter(fi)
+	res.tw = tar.NewWriter(res.gz)
+	return res, nil
+}
+
+func (e *jobExporter) add(rt *RequestTracker, j *Job) error {
+	buf, err := json.MarshalIndent(j.Job, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := e.tw.WriteHeader(&tar.Header{
+		Name:    j.Key() + ".json",
+		Mode:    0644,
+		Size:    int64(len(buf)),
+		ModTime: j.EndTime,
+	}); err != nil {
+		return err
+	}
+	if _, err := e.tw.Write(buf); err != nil {
+		return err
+	}
+	log, err := os.Open(j.LogPath(rt))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer log.Close()
+	fi, err := log.Stat()
+	if err != nil {
+		return err
+	}
+	if err := e.tw.WriteHeader(&tar.Header{
+		Name:    j.Key() + ".log",
+		Mode:    0644,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.CopyN(e.tw, log, fi.Size())
+	return err
+}
+
+func (e *jobExporter) close() error {
+	e.tw.Close()
+	e.gz.Close()
+	return e.fi.Close()
+}
+
+// ReapJobs archives and purges finished and failed jobs according to
+// the job retention preferences.  Jobs that ended more than
+// jobRetentionAge seconds ago are archived, as are all but the
+// jobRetentionCount most recent unarchived jobs for each machine.
+// Archived jobs that ended more than jobPurgeAge seconds ago are
+// deleted along with their logs.  If jobPurgeExport is true, purged
+// jobs and their logs are first exported to a tarball in the
+// job-exports directory of the log root.  A zero value disables the
+// matching part of the policy, and the current job for a machine is
+// never archived or purged.
+//
+// rt must have the locks needed to update jobs, and ReapJobs must be
+// called outside of rt.Do.  If anything was archived or purged, a
+// jobs.reap event is published with the returned report.
+func (p *DataTracker) ReapJobs(rt *RequestTracker, now time.Time) (*models.JobReaperReport, error) {
+	res := &models.JobReaperReport{Archived: []string{}, Purged: []string{}}
+	def := jobRetention{
+		age:   time.Duration(p.prefInt("jobRetentionAge")) * time.Second,
+		count: p.prefInt("jobRetentionCount"),
+	}
+	purgeAge := time.Duration(p.prefInt("jobPurgeAge")) * time.Second
+	doExport, _ := strconv.ParseBool(p.pref("jobPurgeExport"))
+	if def.age <= 0 && def.count <= 0 && purgeAge <= 0 {
+		return res, nil
+	}
+	var exporter *jobExporter
+	e := &models.Error{Code: 500, Type: "JOBREAPER", Model: "jobs"}
+	for more := true; more && !e.ContainsError(); {
+		more = false
+		rt.Do(func(d Stores) {
+			byMachine := map[string][]*Job{}
+			for _, item := range d("jobs").Items() {
+				j := AsJob(item)
+				if j.Current || (j.State != "finished" && j.State != "failed") {
+					continue
+				}
+				byMachine[j.Machine.String()] = append(byMachine[j.Machine.String()], j)
+			}
+			toArchive, toPurge := []*Job{}, []*Job{}
+			for _, jobs := range byMachine {
+				sort.Slice(jobs, func(i, k int) bool { return jobs[i].EndTime.After(jobs[k].EndTime) })
+				kept := 0
+				for _, j := range jobs {
+					if j.Archived {
+						if purgeAge > 0 && now.Sub(j.EndTime) > purgeAge {
+							toPurge = append(toPurge, j)
+						}
+						continue
+					}
+					policy := p.jobRetentionFor(rt, j.Workflow, def)
+					if (policy.count > 0 && kept >= policy.count) ||
+						(policy.age > 0 && now.Sub(j.EndTime) > policy.age) {
+						toArchive = append(toArchive, j)
+						continue
+					}
+					kept++
+				}
+			}
+			if len(toArchive)+len(toPurge) > jobReapBatch {
+				more = true
+			}
+			done := 0
+			for _, j := range toPurge {
+				if done >= jobReapBatch {
+					return
+				}
+				done++
+				if doExport {
+					if exporter == nil {
+						var err error
+						if exporter, err = p.newJobExporter(now); err != nil {
+							e.Errorf("Failed to create job export: %v", err)
+							return
+						}
+						res.Export = filepath.Join("job-exports", filepath.Base(exporter.path))
+					}
+					if err := exporter.add(rt, j); err != nil {
+						e.Errorf("Failed to export job %s: %v", j.Key(), err)
+						return
+					}
+				}
+				if _, err := rt.Remove(j); err != nil {
+					e.Errorf("Failed to purge job %s: %v", j.Key(), err)
+					continue
+				}
+				res.Purged = append(res.Purged, j.Key())
+			}
+			for _, j := range toArchive {
+				if done >= jobReapBatch {
+					return
+				}
+				done++
+				nj := models.Clone(j).(*models.Job)
+				nj.Archived = true
+				if _, err := rt.Update(nj); err != nil {
+					e.Errorf("Failed to archive job %s: %v", j.Key(), err)
+					continue
+				}
+				res.Archived = append(res.Archived, j.Key())
+			}
+		})
+	}
+	if exporter != nil {
+		if err := exporter.close(); err != nil {
+			e.Errorf("Failed to write job export: %v", err)
+		}
+	}
+	if len(res.Archived) > 0 || len(res.Purged) > 0 {
+		rt.PublishEvent(&models.Event{Time: now, Type: "jobs", Action: "reap", Object: res})
+	}
+	return res, e.HasError()
+}
@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobReaper(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "params", "workflows", "templates", "preferences")
+	mUuid := uuid.NewRandom()
+	j1, j2, j3 := uuid.NewRandom(), uuid.NewRandom(), uuid.NewRandom()
+	tests := []crudTest{
+		{"Create Task", rt.Create, &models.Task{Name: "task1"}, true},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "fred"}, true},
+		{"Create Job 1", rt.Create, &models.Job{Uuid: j1, Previous: uuid.NIL, Machine: mUuid, Task: "task1", Stage: "none", State: "finished"}, true},
+		{"Create Job 2", rt.Create, &models.Job{Uuid: j2, Previous: j1, Machine: mUuid, Task: "task1", Stage: "none", State: "finished"}, true},
+		{"Create Job 3", rt.Create, &models.Job{Uuid: j3, Previous: j2, Machine: mUuid, Task: "task1", Stage: "none", State: "finished"}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	later := time.Now().Add(2 * time.Hour)
+	res, err := dt.ReapJobs(rt, later)
+	if err != nil || len(res.Archived) != 0 || len(res.Purged) != 0 {
+		t.Errorf("Reaper should not have done anything without a retention policy: %v, %v", res, err)
+	}
+	rt.Do(func(d Stores) {
+		if err := dt.SetPrefs(rt, map[string]string{"jobRetentionCount": "1"}); err != nil {
+			t.Errorf("Unexpected error setting prefs: %v", err)
+		}
+	})
+	res, err = dt.ReapJobs(rt, later)
+	if err != nil {
+		t.Errorf("Unexpected error reaping jobs: %v", err)
+	} else if len(res.Archived) != 1 || res.Archived[0] != j1.String() || len(res.Purged) != 0 {
+		t.Errorf("Reaper should have only archived job %s, not %#v", j1, res)
+	}
+	var logPath string
+	rt.Do(func(d Stores) {
+		j := AsJob(rt.find("jobs", j1.String()))
+		if !j.Archived {
+			t.Errorf("Job %s was not archived", j1)
+		}
+		logPath = j.LogPath(rt)
+		if err := dt.SetPrefs(rt, map[string]string{"jobPurgeAge": "60", "jobPurgeExport": "true"}); err != nil {
+			t.Errorf("Unexpected error setting prefs: %v", err)
+		}
+	})
+	res, err = dt.ReapJobs(rt, later)
+	if err != nil {
+		t.Errorf("Unexpected error reaping jobs: %v", err)
+	} else if len(res.Purged) != 1 || res.Purged[0] != j1.String() || len(res.Archived) != 0 {
+		t.Errorf("Reaper should have only purged job %s, not %#v", j1, res)
+	}
+	rt.Do(func(d Stores) {
+		if rt.find("jobs", j1.String()) != nil {
+			t.Errorf("Job %s was not purged", j1)
+		}
+		if rt.find("jobs", j2.String()) == nil || rt.find("jobs", j3.String()) == nil {
+			t.Errorf("Reaper purged too many jobs")
+		}
+	})
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("Log for job %s was not removed", j1)
+	}
+	if res.Export == "" {
+		t.Errorf("Purged jobs were not exported")
+	} else if _, err := os.Stat(filepath.Join(dt.LogRoot, res.Export)); err != nil {
+		t.Errorf("Job export %s was not written: %v", res.Export, err)
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -56,7 +59,9 @@ import (
 type Job struct {
 	*models.Job
 	validate
-	oldState string
+	oldState         string
+	artifactsChanged bool
+	outputsErr       error
 }
 
 func (obj *Job) SetReadOnly(b bool) {
@@ -74,7 +79,7 @@ func (j *Job) LogPath(rt *RequestTracker) string {
 func (obj *Job) SaveClean() store.KeySaver {
 	mod := *obj.Job
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 func AsJob(o models.Model) *Job {
 	return o.(*Job)
@@ -398,6 +403,13 @@ func (j *Job) OnChange(oldThing store.KeySaver) error {
 	ot := AsJob(oldThing)
 	j.Current = ot.Current
 	j.oldState = ot.State
+	// Artifacts are only managed through the artifact API.
+	if !j.artifactsChanged {
+		j.Artifacts = ot.Artifacts
+	}
+	if j.Archived {
+		j.Artifacts = []models.JobArtifact{}
+	}
 	return nil
 }
 
@@ -408,6 +420,12 @@ func (j *Job) Validate() {
 	if j.Previous == nil {
 		j.Errorf("Job %s does not have a Previous job", j.UUID())
 	}
+	if j.Current && j.oldState != j.State && j.State == "finished" {
+		if j.outputsErr = j.checkOutputs(); j.outputsErr != nil {
+			j.State = "failed"
+			j.ExitState = "failed"
+		}
+	}
 	if j.State == "finished" || j.State == "failed" {
 		if j.oldState != j.State {
 			j.EndTime = time.Now()
@@ -466,6 +484,85 @@ func (j *Job) Validate() {
 	}
 }
 
+// checkOutputs validates the Outputs of the Job against the
+// OutputParams of its Task and the Schemas of the matching Params.
+func (j *Job) checkOutputs() error {
+	if len(j.Outputs) == 0 {
+		return nil
+	}
+	e := &models.Error{Code: 422, Type: ValidationError, Model: j.Prefix(), Key: j.Key()}
+	to := j.rt.find("tasks", j.Task)
+	if to == nil {
+		e.Errorf("Task %s does not exist", j.Task)
+		return e
+	}
+	declared := map[string]struct{}{}
+	for _, name := range AsTask(to).OutputParams {
+		declared[name] = struct{}{}
+	}
+	for k, v := range j.Outputs {
+		if _, ok := declared[k]; !ok {
+			e.Errorf("Task %s does not declare output param %s", j.Task, k)
+			continue
+		}
+		po := j.rt.find("params", k)
+		if po == nil {
+			e.Errorf("Output param %s does not exist", k)
+			continue
+		}
+		if err := AsParam(po).ValidateValue(v); err != nil {
+			e.Errorf("Output param %s is not valid: %v", k, err)
+		}
+	}
+	return e.HasError()
+}
+
+// applyOutputs sets the Outputs of the Job on its Machine in a single
+// save.  They must have passed checkOutputs.
+func (j *Job) applyOutputs() error {
+	mo := j.rt.find("machines", j.Machine.String())
+	if mo == nil {
+		return fmt.Errorf("Machine %s does not exist", j.Machine.String())
+	}
+	m := AsMachine(mo)
+	params := m.GetParams()
+	for k, v := range j.Outputs {
+		params[k] = v
+	}
+	return j.rt.SetParams(m, params)
+}
+
+// finishOutputs runs once a Job that has finished has been saved.  The
+// Outputs are only applied then, so that they never change the Machine
+// if saving the Job fails.  If they cannot be applied, the Job is
+// failed instead.
+func (j *Job) finishOutputs() {
+	if j.outputsErr == nil && j.Current && j.oldState != j.State && j.State == "finished" && len(j.Outputs) > 0 {
+		if err := j.applyOutputs(); err == nil {
+			j.oldState = j.State
+		} else {
+			j.outputsErr = err
+			j.State = "failed"
+			j.ExitState = "failed"
+			rt := j.rt
+			if _, err := rt.Save(j); err != nil {
+				rt.Errorf("Failed to fail job %s: %v", j.Key(), err)
+			}
+			// Save clears rt when it is done.
+			j.setRT(rt)
+		}
+	}
+	if j.outputsErr == nil {
+		return
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Failed to apply outputs: %v\n", j.outputsErr)
+	j.outputsErr = nil
+	if err := j.Log(j.rt, buf); err != nil {
+		j.rt.Errorf("Failed to log to job %s: %v", j.Key(), err)
+	}
+}
+
 func (j *Job) BeforeSave() error {
 	j.Validate()
 	if !j.Validated {
@@ -475,6 +572,10 @@ func (j *Job) BeforeSave() error {
 }
 
 func (j *Job) AfterSave() {
+	if j.Archived {
+		j.removeArtifacts()
+	}
+	j.finishOutputs()
 	if !j.Current {
 		return
 	}
@@ -558,7 +659,7 @@ func (j *Job) RenderActions(rt *RequestTracker) ([]*models.JobAction, error) {
 			if err2 != nil {
 				err.AddError(err2)
 			} else {
-				na := &models.JobAction{Name: r.name, Path: r.path, Content: string(b)}
+				na := &models.JobAction{Name: r.name, Path: r.path, Content: string(b), Interpreter: r.interpreter}
 				actions = append(actions, na)
 			}
 		}
@@ -567,6 +668,10 @@ func (j *Job) RenderActions(rt *RequestTracker) ([]*models.JobAction, error) {
 	return actions, err.HasError()
 }
 
+// Log appends the contents of src to the log for the Job, and
+// publishes what was appended as a jobs.log event along with the
+// offset it was written at.  Logs are capped at the size given by
+// the jobLogMaxSize preference, anything past that is discarded.
 func (j *Job) Log(rt *RequestTracker, src io.Reader) error {
 	if j.rt == nil {
 		j.setRT(rt)
@@ -574,22 +679,288 @@ func (j *Job) Log(rt *RequestTracker, src io.Reader) error {
 	}
 	f, err := os.OpenFile(j.LogPath(rt), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
 	if err != nil {
-		fmt.Printf("Umm err: %v\n", err)
+		rt.Errorf("Failed to open log for Job %s: %v", j.Key(), err)
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := fi.Size()
+	maxSize := j.sizePref(rt, "jobLogMaxSize", defaultJobLogMaxSize)
+	if offset >= maxSize {
+		io.Copy(ioutil.Discard, src)
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(buf, io.LimitReader(src, maxSize-offset)); err != nil {
+		rt.Errorf("Failed to read log for Job %s: %v", j.Key(), err)
+		return err
+	}
+	if extra, _ := io.Copy(ioutil.Discard, src); extra > 0 {
+		fmt.Fprintf(buf, "\n*** Log truncated at %d bytes ***\n", maxSize)
+	}
+	_, err = f.Write(buf.Bytes())
+	if err != nil {
+		rt.Errorf("Failed to write log for Job %s: %v", j.Key(), err)
 		return err
 	}
-	_, err = io.Copy(f, src)
+	return rt.PublishEvent(&models.Event{
+		Time:   time.Now(),
+		Type:   j.Prefix(),
+		Action: "log",
+		Key:    j.Key(),
+		Object: &models.JobLogChunk{Offset: offset, Data: buf.Bytes()},
+	})
+}
+
+func (j *Job) AfterDelete() {
+	j.removeArtifacts()
+	if j.rt == nil {
+		return
+	}
+	if err := os.Remove(j.LogPath(j.rt)); err != nil && !os.IsNotExist(err) {
+		j.rt.Errorf("Failed to remove log for job %s: %v", j.Key(), err)
+	}
+}
+
+const (
+	defaultJobArtifactMaxSize int64 = 64 << 20
+	defaultJobArtifactQuota   int64 = 256 << 20
+	defaultJobLogMaxSize      int64 = 64 << 20
+)
+
+// ArtifactRoot returns the directory the artifacts for the Job are
+// stored in.
+func (j *Job) ArtifactRoot(rt *RequestTracker) string {
+	if j.rt == nil {
+		j.setRT(rt)
+		defer j.clearRT()
+	}
+	return filepath.Join(j.rt.dt.LogRoot, "artifacts", j.Uuid.String())
+}
+
+// artifactUploadRoot is where artifacts are written while they are
+// being uploaded.  It is on the same filesystem as the artifacts so
+// that finished uploads can be renamed into place, but outside of
+// them so that partial uploads never show up as artifacts.  It is
+// emptied when dr-provision starts.
+func artifactUploadRoot(dt *DataTracker) string {
+	return filepath.Join(dt.LogRoot, "artifact-uploads")
+}
+
+func cleanArtifactPath(name string) (string, error) {
+	res := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if res == "" {
+		return "", fmt.Errorf("Invalid artifact path '%s'", name)
+	}
+	return res, nil
+}
+
+// ArtifactPath returns the local path for the named artifact.  It
+// does not check to see if the artifact exists.
+func (j *Job) ArtifactPath(rt *RequestTracker, name string) (string, error) {
+	clean, err := cleanArtifactPath(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(j.ArtifactRoot(rt), filepath.FromSlash(clean)), nil
+}
+
+// Artifact returns the metadata for the named artifact, or nil if the
+// Job does not have it.
+func (j *Job) Artifact(name string) *models.JobArtifact {
+	clean, err := cleanArtifactPath(name)
+	if err != nil {
+		return nil
+	}
+	for i := range j.Artifacts {
+		if j.Artifacts[i].Path == clean {
+			return &j.Artifacts[i]
+		}
+	}
+	return nil
+}
+
+func (j *Job) removeArtifacts() {
+	if j.rt == nil {
+		return
+	}
+	if err := os.RemoveAll(j.ArtifactRoot(j.rt)); err != nil {
+		j.rt.Errorf("Failed to remove artifacts for job %s: %v", j.Key(), err)
+	}
+}
+
+func (j *Job) sizePref(rt *RequestTracker, name string, def int64) int64 {
+	if val := rt.dt.pref(name); val != "" {
+		if res, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return res
+		}
+	}
+	return def
+}
+
+// AddArtifact stores the contents of src as the named artifact
+// for the Job, replacing any artifact with the same name.  Artifacts
+// are limited in size by the jobArtifactMaxSize preference, and the
+// total size of all the artifacts for a Job is limited by the
+// jobArtifactQuota preference.
+//
+// AddArtifact must be called outside of rt.Do, and rt must have the
+// locks needed to update the Job.
+func (j *Job) AddArtifact(rt *RequestTracker, name, contentType string, src io.Reader) (*models.JobArtifact, error) {
+	e := &models.Error{
+		Code:  http.StatusBadRequest,
+		Type:  "ARTIFACT",
+		Model: j.Prefix(),
+		Key:   j.Key(),
+	}
+	clean, err := cleanArtifactPath(name)
+	if err != nil {
+		e.AddError(err)
+		return nil, e
+	}
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = "application/octet-stream"
+		if ext := mime.TypeByExtension(path.Ext(clean)); ext != "" {
+			contentType = ext
+		}
+	}
+	maxSize := j.sizePref(rt, "jobArtifactMaxSize", defaultJobArtifactMaxSize)
+	quota := j.sizePref(rt, "jobArtifactQuota", defaultJobArtifactQuota)
+	root := j.ArtifactRoot(rt)
+	uploads := artifactUploadRoot(rt.dt)
+	for _, dir := range []string{root, uploads} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			e.Code = http.StatusInternalServerError
+			e.AddError(err)
+			return nil, e
+		}
+	}
+	tmp, err := ioutil.TempFile(uploads, j.Key()+"-")
 	if err != nil {
-		fmt.Printf("Umm write err: %v\n", err)
+		e.Code = http.StatusInternalServerError
+		e.AddError(err)
+		return nil, e
+	}
+	defer os.Remove(tmp.Name())
+	copied, err := io.Copy(tmp, io.LimitReader(src, maxSize+1))
+	tmp.Close()
+	if err != nil {
+		e.Code = http.StatusInsufficientStorage
+		e.AddError(err)
+		return nil, e
+	}
+	if copied > maxSize {
+		e.Code = http.StatusRequestEntityTooLarge
+		e.Errorf("Artifact %s is larger than %d bytes", clean, maxSize)
+		return nil, e
+	}
+	res := &models.JobArtifact{
+		Path:        clean,
+		Size:        copied,
+		ContentType: contentType,
+		Time:        time.Now(),
+	}
+	rt.Do(func(d Stores) {
+		jo := d("jobs").Find(j.Key())
+		if jo == nil {
+			e.Code = http.StatusNotFound
+			e.Errorf("Job %s does not exist", j.Key())
+			return
+		}
+		cur := AsJob(jo)
+		if cur.Archived {
+			e.Code = http.StatusConflict
+			e.Errorf("Job %s is archived", j.Key())
+			return
+		}
+		artifacts := []models.JobArtifact{}
+		used := copied
+		for _, a := range cur.Artifacts {
+			if a.Path != clean {
+				used += a.Size
+				artifacts = append(artifacts, a)
+			}
+		}
+		if used > quota {
+			e.Code = http.StatusRequestEntityTooLarge
+			e.Errorf("Artifacts for job %s would use %d bytes, more than the %d allowed", j.Key(), used, quota)
+			return
+		}
+		target := filepath.Join(root, filepath.FromSlash(clean))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			e.Code = http.StatusConflict
+			e.AddError(err)
+			return
+		}
+		if err := os.Rename(tmp.Name(), target); err != nil {
+			e.Code = http.StatusConflict
+			e.AddError(err)
+			return
+		}
+		nj := ModelToBackend(models.Clone(cur)).(*Job)
+		nj.Artifacts = append(artifacts, *res)
+		nj.artifactsChanged = true
+		if _, err := rt.Update(nj); err != nil {
+			os.Remove(target)
+			e.AddError(err)
+		}
+	})
+	if e.ContainsError() {
+		return nil, e
+	}
+	return res, nil
+}
+
+// RemoveArtifact removes the named artifact from the Job.
+//
+// RemoveArtifact must be called inside of rt.Do, and rt must have the
+// locks needed to update the Job.
+func (j *Job) RemoveArtifact(rt *RequestTracker, name string) error {
+	e := &models.Error{
+		Code:  http.StatusNotFound,
+		Type:  "ARTIFACT",
+		Model: j.Prefix(),
+		Key:   j.Key(),
+	}
+	clean, err := cleanArtifactPath(name)
+	if err != nil {
+		e.Code = http.StatusBadRequest
+		e.AddError(err)
+		return e
+	}
+	if j.Artifact(clean) == nil {
+		e.Errorf("Artifact %s does not exist", clean)
+		return e
+	}
+	nj := ModelToBackend(models.Clone(j)).(*Job)
+	nj.Artifacts = []models.JobArtifact{}
+	for _, a := range j.Artifacts {
+		if a.Path != clean {
+			nj.Artifacts = append(nj.Artifacts, a)
+		}
+	}
+	nj.artifactsChanged = true
+	if _, err := rt.Update(nj); err != nil {
 		return err
 	}
+	target, _ := j.ArtifactPath(rt, clean)
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		e.Code = http.StatusInternalServerError
+		e.AddError(err)
+		return e
+	}
 	return nil
 }
 
 var jobLockMap = map[string][]string{
 	"get":     []string{"jobs"},
-	"create":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "workflows"},
-	"update":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "workflows"},
-	"patch":   []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "workflows"},
+	"create":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "params", "workflows"},
+	"update":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "params", "workflows"},
+	"patch":   []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "params", "workflows"},
 	"delete":  []string{"machines", "jobs"},
 	"actions": []string{"stages", "jobs", "machines", "tasks", "profiles", "bootenvs", "params", "workflows"},
 }
@@ -0,0 +1,186 @@
+package backend
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobArtifacts(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "workflows", "params", "templates", "preferences")
+	mUuid := uuid.NewRandom()
+	jUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create Task", rt.Create, &models.Task{Name: "task1"}, true},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "fred"}, true},
+		{"Create Job", rt.Create, &models.Job{
+			Uuid:     jUuid,
+			Previous: uuid.NIL,
+			Machine:  mUuid,
+			Task:     "task1",
+			Stage:    "none",
+			State:    "created",
+		}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		if err := dt.SetPrefs(rt, map[string]string{"jobArtifactMaxSize": "10"}); err != nil {
+			t.Errorf("Unexpected error setting prefs: %v", err)
+		}
+	})
+	var j *Job
+	rt.Do(func(d Stores) { j = AsJob(rt.find("jobs", jUuid.String())) })
+	if _, err := j.AddArtifact(rt, "../../big.txt", "", bytes.NewBufferString("01234567890")); err == nil {
+		t.Errorf("Adding an artifact larger than jobArtifactMaxSize should have failed")
+	}
+	res, err := j.AddArtifact(rt, "../../out/result.txt", "", bytes.NewBufferString("passed"))
+	if err != nil {
+		t.Fatalf("Unexpected error adding artifact: %v", err)
+	}
+	if res.Path != "out/result.txt" || res.Size != 6 || res.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("Artifact has unexpected metadata: %#v", res)
+	}
+	fileName, _ := j.ArtifactPath(rt, res.Path)
+	if _, err := os.Stat(fileName); err != nil {
+		t.Errorf("Artifact %s was not stored: %v", res.Path, err)
+	}
+	rt.Do(func(d Stores) {
+		j = AsJob(rt.find("jobs", jUuid.String()))
+		if j.Artifact("out/result.txt") == nil {
+			t.Errorf("Job does not list artifact out/result.txt")
+		}
+		if err := j.RemoveArtifact(rt, "missing.txt"); err == nil {
+			t.Errorf("Removing a missing artifact should have failed")
+		}
+		if err := j.RemoveArtifact(rt, "out/result.txt"); err != nil {
+			t.Errorf("Unexpected error removing artifact: %v", err)
+		}
+		j = AsJob(rt.find("jobs", jUuid.String()))
+		if len(j.Artifacts) != 0 {
+			t.Errorf("Job still lists removed artifacts: %#v", j.Artifacts)
+		}
+	})
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("Artifact %s was not removed", res.Path)
+	}
+	if _, err := j.AddArtifact(rt, "out/result.txt", "text/plain", bytes.NewBufferString("passed")); err != nil {
+		t.Fatalf("Unexpected error adding artifact: %v", err)
+	}
+	rt.Do(func(d Stores) {
+		archived := models.Clone(rt.find("jobs", jUuid.String())).(*models.Job)
+		archived.Archived = true
+		if _, err := rt.Update(archived); err != nil {
+			t.Errorf("Unexpected error archiving job: %v", err)
+		}
+	})
+	if _, err := os.Stat(j.ArtifactRoot(rt)); !os.IsNotExist(err) {
+		t.Errorf("Artifacts were not removed when the job was archived")
+	}
+	if _, err := j.AddArtifact(rt, "late.txt", "", bytes.NewBufferString("late")); err == nil {
+		t.Errorf("Adding an artifact to an archived job should have failed")
+	}
+}
+
+func TestJobOutputs(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "workflows", "params", "templates")
+	mUuid := uuid.NewRandom()
+	goodJob, badJob := uuid.NewRandom(), uuid.NewRandom()
+	tests := []crudTest{
+		{"Create Param", rt.Create, &models.Param{Name: "serial", Schema: map[string]interface{}{"type": "string"}}, true},
+		{"Create Task with bad OutputParams", rt.Create, &models.Task{Name: "task2", OutputParams: []string{"bad/param"}}, false},
+		{"Create Task", rt.Create, &models.Task{Name: "task1", OutputParams: []string{"serial"}}, true},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "fred"}, true},
+		{"Create Job", rt.Create, &models.Job{Uuid: goodJob, Previous: uuid.NIL, Machine: mUuid, Task: "task1", Stage: "none", State: "running"}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	finish := func(id uuid.UUID, outputs map[string]interface{}) *models.Job {
+		var res *models.Job
+		rt.Do(func(d Stores) {
+			j := models.Clone(rt.find("jobs", id.String())).(*models.Job)
+			j.State = "finished"
+			j.Outputs = outputs
+			if _, err := rt.Update(j); err != nil {
+				t.Errorf("Unexpected error finishing job %s: %v", id, err)
+			}
+			res = models.Clone(rt.find("jobs", id.String())).(*models.Job)
+		})
+		return res
+	}
+	if j := finish(goodJob, map[string]interface{}{"serial": "abc123"}); j.State != "finished" {
+		t.Errorf("Job with valid outputs should have finished, not %s", j.State)
+	}
+	rt.Do(func(d Stores) {
+		if v, _ := rt.GetParam(rt.find("machines", mUuid.String()).(models.Paramer), "serial", false); v != "abc123" {
+			t.Errorf("Machine param serial should be abc123, not %v", v)
+		}
+	})
+	tests = []crudTest{
+		{"Create Job", rt.Create, &models.Job{Uuid: badJob, Previous: goodJob, Machine: mUuid, Task: "task1", Stage: "none", State: "running"}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	if j := finish(badJob, map[string]interface{}{"serial": 42}); j.State != "failed" {
+		t.Errorf("Job with invalid outputs should have failed, not %s", j.State)
+	}
+	rt.Do(func(d Stores) {
+		if v, _ := rt.GetParam(rt.find("machines", mUuid.String()).(models.Paramer), "serial", false); v != "abc123" {
+			t.Errorf("Machine param serial should not have changed, but is %v", v)
+		}
+	})
+}
+
+func TestJobLogMaxSize(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "workflows", "params", "templates", "preferences")
+	mUuid := uuid.NewRandom()
+	jUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create Task", rt.Create, &models.Task{Name: "task1"}, true},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "fred"}, true},
+		{"Create Job", rt.Create, &models.Job{Uuid: jUuid, Previous: uuid.NIL, Machine: mUuid, Task: "task1", Stage: "none", State: "created"}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var logPath string
+	rt.Do(func(d Stores) {
+		j := AsJob(rt.find("jobs", jUuid.String()))
+		logPath = j.LogPath(rt)
+		fi, err := os.Stat(logPath)
+		if err != nil {
+			t.Fatalf("Job log was not created: %v", err)
+		}
+		maxSize := fi.Size() + 4
+		if err := dt.SetPrefs(rt, map[string]string{"jobLogMaxSize": strconv.FormatInt(maxSize, 10)}); err != nil {
+			t.Errorf("Unexpected error setting prefs: %v", err)
+		}
+		if err := j.Log(rt, bytes.NewBufferString("abcdefgh")); err != nil {
+			t.Errorf("Unexpected error appending to log: %v", err)
+		}
+		if err := j.Log(rt, bytes.NewBufferString("ijklmnop")); err != nil {
+			t.Errorf("Unexpected error appending to full log: %v", err)
+		}
+	})
+	buf, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read job log: %v", err)
+	}
+	if !bytes.Contains(buf, []byte("abcd\n*** Log truncated")) {
+		t.Errorf("Job log was not truncated correctly: %s", string(buf))
+	}
+	if bytes.Contains(buf, []byte("ijkl")) {
+		t.Errorf("Job log was appended to after it was truncated: %s", string(buf))
+	}
+}
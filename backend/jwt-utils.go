@@ -8,9 +8,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
 )
 
 func randString(n int) string {
@@ -129,23 +132,9 @@ func (m *JwtManager) sign(token *jwt.Token) (string, error) {
 	return encrypt(m.key, jwtString)
 }
 
-// Claim is an individial specifier for something we are allowed access to.
-type Claim struct {
-	Scope    string `json:"scope"`
-	Action   string `json:"action"`
-	Specific string `json:"specific"`
-}
-
-// Match tests to see if this claim allows access for the specified
-// scope, action, and specific item.
-//
-// If the Claim has `*` for any field, it matches all possible values
-// for that field.
-func (c *Claim) Match(scope, action, specific string) bool {
-	return (c.Scope == scope || c.Scope == "*") &&
-		(c.Action == action || c.Action == "*") &&
-		(c.Specific == specific || c.Specific == "*")
-}
+// Claim is an individial specifier for something we are allowed
+// access to.  It lives in models so that Roles can hold them.
+type Claim = models.Claim
 
 //
 // Grantor Claims allow for the token to be validated against
@@ -184,13 +173,50 @@ func (gc *GrantorClaims) Validate(grantor, user, machine string) bool {
 type DrpCustomClaims struct {
 	DrpClaims     []Claim       `json:"drp_claims"`
 	GrantorClaims GrantorClaims `json:"grantor_claims"`
+	// TokenId uniquely identifies the token, so that it can be
+	// revoked through the token registry.  The standard jti claim
+	// already holds the user name.
+	TokenId string `json:"drp_token_id,omitempty"`
+	// SecondFactor is set on tokens issued to a user with TOTP
+	// enabled after the user gave a TOTP code, and on the tokens the
+	// user gets with them.  Tokens of a user with TOTP enabled are
+	// refused without it.
+	SecondFactor bool `json:"drp_second_factor,omitempty"`
 	jwt.StandardClaims
 }
 
 // Match tests all the claims in this Token to find one that matches.
+// Claims with a Filter are skipped, as they need the object to match.
 func (d *DrpCustomClaims) Match(scope, action, specific string) bool {
 	for _, claim := range d.DrpClaims {
-		if claim.Match(scope, action, specific) {
+		if claim.Filter == "" && claim.Match(scope, action, specific) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchObject is Match for obj, which is the object named by scope
+// and specific.  Claims with a Filter match if obj matches the Filter.
+func (d *DrpCustomClaims) MatchObject(scope, action, specific string, obj models.Model) bool {
+	for _, claim := range d.DrpClaims {
+		if !claim.Match(scope, action, specific) {
+			continue
+		}
+		if claim.Filter == "" || (obj != nil && FilterMatch(claim.Filter, obj)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFilters tests whether any claim with a Filter could allow action
+// on some objects in scope.
+func (d *DrpCustomClaims) HasFilters(scope, action string) bool {
+	for _, claim := range d.DrpClaims {
+		if claim.Filter != "" &&
+			(claim.Scope == scope || claim.Scope == "*") &&
+			(claim.Action == action || claim.Action == "*") {
 			return true
 		}
 	}
@@ -228,6 +254,7 @@ func NewClaim(user, grantor string, ttl time.Duration) *DrpCustomClaims {
 	res.ExpiresAt = time.Now().Add(ttl).Unix()
 	res.Issuer = "digitalrebar provision"
 	res.Id = user
+	res.TokenId = uuid.NewRandom().String()
 	res.GrantorClaims.UserId = user
 	res.GrantorClaims.GrantorId = grantor
 	return res
@@ -249,7 +276,126 @@ func (d *DrpCustomClaims) AddSecrets(user, grantor, machine string) *DrpCustomCl
 
 // Add adds a discrete Claim to our custom Token class.
 func (d *DrpCustomClaims) Add(scope, action, specific string) *DrpCustomClaims {
-	d.DrpClaims = append(d.DrpClaims, Claim{scope, action, specific})
+	d.DrpClaims = append(d.DrpClaims, Claim{Scope: scope, Action: action, Specific: specific})
+	return d
+}
+
+// AddFiltered adds a discrete Claim limited to objects matching filter.
+func (d *DrpCustomClaims) AddFiltered(scope, action, specific, filter string) *DrpCustomClaims {
+	d.DrpClaims = append(d.DrpClaims, Claim{Scope: scope, Action: action, Specific: specific, Filter: filter})
+	return d
+}
+
+// AddLimited adds a discrete Claim if limits allow it.  If only
+// Claims in limits with a Filter allow it, it is added once for each
+// of their Filters.  It returns false and adds nothing if limits do not
+// allow it at all.
+func (d *DrpCustomClaims) AddLimited(limits []*Claim, scope, action, specific string) bool {
+	filters := []string{}
+	for _, lc := range limits {
+		if !lc.Match(scope, action, specific) {
+			continue
+		}
+		if lc.Filter == "" {
+			d.Add(scope, action, specific)
+			return true
+		}
+		filters = append(filters, lc.Filter)
+	}
+	for _, filter := range filters {
+		d.AddFiltered(scope, action, specific, filter)
+	}
+	return len(filters) > 0
+}
+
+// Limit returns the Claims that allow only what both claims and this
+// Token allow.  The Filters of both are joined, so objects must match
+// both of them.  Pairs of Claims whose Filters both limit the same
+// Field are left out, since joining them would allow more than either.
+func (d *DrpCustomClaims) Limit(claims []*Claim) []*Claim {
+	res := []*Claim{}
+	for _, uc := range claims {
+		for i := range d.DrpClaims {
+			lc := &d.DrpClaims[i]
+			scope, sok := limitField(uc.Scope, lc.Scope)
+			action, aok := limitField(uc.Action, lc.Action)
+			specific, pok := limitField(uc.Specific, lc.Specific)
+			filter, fok := limitFilter(uc.Filter, lc.Filter)
+			if !(sok && aok && pok && fok) {
+				continue
+			}
+			claim := &Claim{Scope: scope, Action: action, Specific: specific, Filter: filter}
+			dup := false
+			for _, c := range res {
+				if *c == *claim {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				res = append(res, claim)
+			}
+		}
+	}
+	return res
+}
+
+// Covers reports whether this Token allows everything that each of
+// claims allows.
+func (d *DrpCustomClaims) Covers(claims []*Claim) bool {
+	for _, c := range claims {
+		covered := false
+		for _, l := range d.Limit([]*Claim{c}) {
+			if *l == *c {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func limitField(a, b string) (string, bool) {
+	switch {
+	case a == b || b == "*":
+		return a, true
+	case a == "*":
+		return b, true
+	}
+	return "", false
+}
+
+func limitFilter(a, b string) (string, bool) {
+	switch {
+	case a == b || b == "":
+		return a, true
+	case a == "":
+		return b, true
+	}
+	at, err := url.ParseQuery(a)
+	if err != nil {
+		return "", false
+	}
+	bt, err := url.ParseQuery(b)
+	if err != nil {
+		return "", false
+	}
+	for k := range bt {
+		if _, ok := at[k]; ok {
+			return "", false
+		}
+	}
+	return a + "&" + b, true
+}
+
+// AddClaims adds copies of claims to our custom Token class.
+func (d *DrpCustomClaims) AddClaims(claims ...*Claim) *DrpCustomClaims {
+	for _, c := range claims {
+		d.DrpClaims = append(d.DrpClaims, *c)
+	}
 	return d
 }
 
@@ -277,3 +423,25 @@ func (m *JwtManager) get(encTokenString string) (*DrpCustomClaims, error) {
 		return drpCustomClaim, nil
 	}
 }
+
+// getExpired is like get, except that it also returns the claims of a
+// token that expired no more than grace ago.  Everything else about
+// the token must still be valid.
+func (m *JwtManager) getExpired(encTokenString string, grace time.Duration) (*DrpCustomClaims, error) {
+	tokenString, err := decrypt(m.key, encTokenString)
+	if err != nil {
+		return nil, err
+	}
+	claims := &DrpCustomClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, m.getKey)
+	if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors == jwt.ValidationErrorExpired {
+		if claims.ExpiresAt < time.Now().Add(-grace).Unix() {
+			return nil, errors.New("Token expired too long ago")
+		}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -59,4 +59,17 @@ func TestJWTUtils(t *testing.T) {
 	if e == nil {
 		t.Errorf("Failed because we got a token: %v\n", drpClaim)
 	}
+	if _, e = jwtManager.getExpired(s, time.Minute); e != nil {
+		t.Errorf("Failed to get a recently expired token: %v\n", e)
+	}
+
+	old := NewClaim("fred", "fred", time.Hour).Add("*", "m", "a")
+	old.ExpiresAt = time.Now().Add(-2 * time.Hour).Unix()
+	s, e = old.Seal(jwtManager)
+	if e != nil {
+		t.Errorf("Failed to sign token: %v\n", e)
+	}
+	if drpClaim, e = jwtManager.getExpired(s, time.Hour); e == nil {
+		t.Errorf("Failed because we got a token that expired too long ago: %v\n", drpClaim)
+	}
 }
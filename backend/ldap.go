@@ -0,0 +1,256 @@
+package backend
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/ldap.v2"
+)
+
+// ldapConn is the part of an LDAP connection that LdapAuth uses.
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+// ldapConfig is the LDAP configuration from the ldap* preferences.
+type ldapConfig struct {
+	url          *url.URL
+	bindDN       string
+	bindPassword string
+	baseDN       string
+	userFilter   string
+	groupAttr    string
+	startTLS     bool
+	groupRoles   map[string][]string
+	ttl          time.Duration
+}
+
+// ldapConfigFrom returns the LDAP configuration in prefs, or nil if
+// ldapUrl is not set.
+func ldapConfigFrom(prefs map[string]string) (*ldapConfig, error) {
+	if prefs["ldapUrl"] == "" {
+		return nil, nil
+	}
+	u, err := parseLdapUrl(prefs["ldapUrl"])
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ldapConfig{
+		url:          u,
+		bindDN:       prefs["ldapBindDN"],
+		bindPassword: prefs["ldapBindPassword"],
+		baseDN:       prefs["ldapBaseDN"],
+		userFilter:   prefs["ldapUserFilter"],
+		groupAttr:    prefs["ldapGroupAttr"],
+		groupRoles:   map[string][]string{},
+		ttl:          300 * time.Second,
+	}
+	if cfg.userFilter == "" {
+		cfg.userFilter = "(uid=%s)"
+	}
+	if cfg.groupAttr == "" {
+		cfg.groupAttr = "memberOf"
+	}
+	if v := prefs["ldapStartTLS"]; v != "" {
+		cfg.startTLS, _ = strconv.ParseBool(v)
+	}
+	if v := prefs["ldapCacheTTL"]; v != "" {
+		ttl, _ := strconv.Atoi(v)
+		cfg.ttl = time.Duration(ttl) * time.Second
+	}
+	if v := prefs["ldapGroupRoles"]; v != "" {
+		if err := json.Unmarshal([]byte(v), &cfg.groupRoles); err != nil {
+			return nil, fmt.Errorf("ldapGroupRoles: %v", err)
+		}
+	}
+	return cfg, nil
+}
+
+func parseLdapUrl(val string) (*url.URL, error) {
+	u, err := url.Parse(val)
+	if err != nil {
+		return nil, fmt.Errorf("ldapUrl: %v", err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return nil, fmt.Errorf("ldapUrl: scheme must be ldap or ldaps, not %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("ldapUrl: missing host")
+	}
+	return u, nil
+}
+
+func dialLdap(cfg *ldapConfig) (ldapConn, error) {
+	host := cfg.url.Host
+	tlsConfig := &tls.Config{ServerName: cfg.url.Hostname()}
+	if cfg.url.Scheme == "ldaps" {
+		if cfg.url.Port() == "" {
+			host = net.JoinHostPort(host, "636")
+		}
+		return ldap.DialTLS("tcp", host, tlsConfig)
+	}
+	if cfg.url.Port() == "" {
+		host = net.JoinHostPort(host, "389")
+	}
+	conn, err := ldap.Dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.startTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+type ldapCacheEntry struct {
+	sum     [sha256.Size]byte
+	user    *User
+	expires time.Time
+}
+
+// LdapAuth authenticates Users against an LDAP or Active Directory
+// server, as configured by the ldap* preferences.  Users that
+// authenticate are saved as local Users with no password, and with
+// the Roles that their groups are mapped to.  Successful logins are
+// cached for ldapCacheTTL seconds so that every API request does not
+// need to bind to the server.
+type LdapAuth struct {
+	dt    *DataTracker
+	dial  func(*ldapConfig) (ldapConn, error)
+	mux   *sync.Mutex
+	salt  []byte
+	cache map[string]*ldapCacheEntry
+}
+
+func NewLdapAuth(dt *DataTracker) *LdapAuth {
+	salt := make([]byte, 32)
+	rand.Read(salt)
+	return &LdapAuth{
+		dt:    dt,
+		dial:  dialLdap,
+		mux:   &sync.Mutex{},
+		salt:  salt,
+		cache: map[string]*ldapCacheEntry{},
+	}
+}
+
+func (l *LdapAuth) sum(password string) [sha256.Size]byte {
+	return sha256.Sum256(append(append([]byte{}, l.salt...), password...))
+}
+
+func (l *LdapAuth) cached(username, password string) *User {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	ent, ok := l.cache[username]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(ent.expires) {
+		delete(l.cache, username)
+		return nil
+	}
+	sum := l.sum(password)
+	if subtle.ConstantTimeCompare(sum[:], ent.sum[:]) != 1 {
+		return nil
+	}
+	return ent.user
+}
+
+func (l *LdapAuth) remember(cfg *ldapConfig, username, password string, u *User) {
+	if cfg.ttl <= 0 {
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.cache[username] = &ldapCacheEntry{
+		sum:     l.sum(password),
+		user:    u,
+		expires: time.Now().Add(cfg.ttl),
+	}
+}
+
+// Forget drops username from the login cache, so that the next login
+// goes to the LDAP server.
+func (l *LdapAuth) Forget(username string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	delete(l.cache, username)
+}
+
+// lookup binds to the LDAP server as username and returns the Roles
+// that the groups of username are mapped to.
+func (l *LdapAuth) lookup(cfg *ldapConfig, username, password string) ([]string, error) {
+	// Most servers treat a bind with an empty password as an
+	// anonymous bind, which always succeeds.
+	if password == "" {
+		return nil, fmt.Errorf("empty password")
+	}
+	conn, err := l.dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if cfg.bindDN != "" {
+		if err := conn.Bind(cfg.bindDN, cfg.bindPassword); err != nil {
+			return nil, fmt.Errorf("bind as %s failed: %v", cfg.bindDN, err)
+		}
+	}
+	req := ldap.NewSearchRequest(cfg.baseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(cfg.userFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", cfg.groupAttr},
+		nil)
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("search for %s failed: %v", username, err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, fmt.Errorf("search for %s found %d entries", username, len(res.Entries))
+	}
+	entry := res.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, fmt.Errorf("bind as %s failed: %v", entry.DN, err)
+	}
+	roles := mapGroupRoles(cfg.groupRoles, entry.GetAttributeValues(cfg.groupAttr))
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("%s is not in any group that is mapped to a role", username)
+	}
+	return roles, nil
+}
+
+// Authenticate checks username and password against the LDAP server.
+// It returns nil and no error if LDAP is not configured.  rt must
+// be able to lock users and roles, and must not be locked.
+func (l *LdapAuth) Authenticate(rt *RequestTracker, username, password string) (*User, error) {
+	cfg, err := ldapConfigFrom(l.dt.Prefs())
+	if cfg == nil || err != nil {
+		return nil, err
+	}
+	if u := l.cached(username, password); u != nil {
+		return u, nil
+	}
+	roles, err := l.lookup(cfg, username, password)
+	if err != nil {
+		return nil, err
+	}
+	u, err := saveExternalUser(rt, "ldap", username, roles)
+	if err != nil || u == nil {
+		return nil, err
+	}
+	l.remember(cfg, username, password, u)
+	return u, nil
+}
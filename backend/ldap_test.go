@@ -0,0 +1,178 @@
+package backend
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"gopkg.in/ldap.v2"
+)
+
+// ldapStub is an in-process stand-in for an LDAP server.
+type ldapStub struct {
+	down      bool
+	passwords map[string]string
+	entries   map[string]*ldap.Entry
+}
+
+func (s *ldapStub) dial(cfg *ldapConfig) (ldapConn, error) {
+	if s.down {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return s, nil
+}
+
+func (s *ldapStub) Bind(dn, password string) error {
+	if pw, ok := s.passwords[dn]; !ok || pw != password {
+		return fmt.Errorf("invalid credentials for %s", dn)
+	}
+	return nil
+}
+
+func (s *ldapStub) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	res := &ldap.SearchResult{}
+	if e, ok := s.entries[req.Filter]; ok {
+		res.Entries = append(res.Entries, e)
+	}
+	return res, nil
+}
+
+func (s *ldapStub) Close() {}
+
+func (s *ldapStub) add(uid, password string, groups ...string) {
+	dn := fmt.Sprintf("uid=%s,ou=people,dc=example,dc=com", uid)
+	s.passwords[dn] = password
+	s.entries[fmt.Sprintf("(uid=%s)", uid)] = &ldap.Entry{
+		DN: dn,
+		Attributes: []*ldap.EntryAttribute{
+			{Name: "memberOf", Values: groups},
+		},
+	}
+}
+
+func TestLdapAuth(t *testing.T) {
+	dt := mkDT(nil)
+	prefRT := dt.Request(dt.Logger, "preferences", "bootenvs", "stages", "workflows")
+	setPrefs := func(prefs map[string]string) {
+		prefRT.Do(func(d Stores) {
+			if err := dt.SetPrefs(prefRT, prefs); err != nil {
+				t.Fatalf("Unable to set LDAP prefs: %v", err)
+			}
+		})
+	}
+	rt := dt.Request(dt.Logger, "users", "roles")
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(&models.Role{Name: "operator", Claims: []*models.Claim{{Scope: "machines", Action: "*", Specific: "*"}}}); err != nil {
+			t.Fatalf("Unable to create operator role: %v", err)
+		}
+		if _, err := rt.Create(&models.User{Name: "admin"}); err != nil {
+			t.Fatalf("Unable to create local admin: %v", err)
+		}
+	})
+	stub := &ldapStub{passwords: map[string]string{"cn=search,dc=example,dc=com": "searchpw"}, entries: map[string]*ldap.Entry{}}
+	stub.add("fred", "fredpw", "cn=ops,ou=groups,dc=example,dc=com", "cn=other,ou=groups,dc=example,dc=com")
+	stub.add("barney", "barneypw", "cn=other,ou=groups,dc=example,dc=com")
+	stub.add("admin", "adminpw", "cn=ops,ou=groups,dc=example,dc=com")
+	l := NewLdapAuth(dt)
+	l.dial = stub.dial
+
+	if u, err := l.Authenticate(rt, "fred", "fredpw"); u != nil || err != nil {
+		t.Errorf("Unconfigured LDAP should not authenticate anyone: %v, %v", u, err)
+	}
+	setPrefs(map[string]string{
+		"ldapUrl":          "ldaps://ldap.example.com",
+		"ldapBindDN":       "cn=search,dc=example,dc=com",
+		"ldapBindPassword": "searchpw",
+		"ldapBaseDN":       "ou=people,dc=example,dc=com",
+		"ldapGroupRoles":   `{"CN=ops,ou=groups,dc=example,dc=com": ["operator"]}`,
+	})
+
+	u, err := l.Authenticate(rt, "fred", "fredpw")
+	if err != nil || u == nil {
+		t.Fatalf("fred should have authenticated: %v", err)
+	}
+	if len(u.Roles) != 1 || u.Roles[0] != "operator" {
+		t.Errorf("fred should have the operator role, not %v", u.Roles)
+	}
+	rt.Do(func(d Stores) {
+		if obj := rt.Find("users", "fred"); obj == nil {
+			t.Errorf("fred should have been saved as a local user")
+		} else if su := AsUser(obj); su.Meta[AuthSourceMeta] != "ldap" || len(su.PasswordHash) != 0 {
+			t.Errorf("fred should be an LDAP user with no password: %v", su.Meta)
+		}
+	})
+	if u, err := l.Authenticate(rt, "fred", "wrong"); u != nil || err == nil {
+		t.Errorf("fred should not authenticate with the wrong password")
+	}
+	if u, err := l.Authenticate(rt, "fred", ""); u != nil || err == nil {
+		t.Errorf("fred should not authenticate with an empty password")
+	}
+	if u, err := l.Authenticate(rt, "barney", "barneypw"); u != nil || err == nil {
+		t.Errorf("barney is in no mapped group and should not authenticate")
+	}
+	if u, err := l.Authenticate(rt, "wilma", "wilmapw"); u != nil || err == nil {
+		t.Errorf("wilma is not in the directory and should not authenticate")
+	}
+	if u, err := l.Authenticate(rt, "admin", "adminpw"); u != nil || err == nil {
+		t.Errorf("LDAP should not be able to log in as a local user")
+	}
+
+	// Logins are cached, so a down server does not lock fred out.
+	stub.down = true
+	if u, err := l.Authenticate(rt, "fred", "fredpw"); u == nil || err != nil {
+		t.Errorf("fred should have been authenticated from the cache: %v", err)
+	}
+	if u, err := l.Authenticate(rt, "fred", "wrong"); u != nil || err == nil {
+		t.Errorf("The cache should not accept the wrong password")
+	}
+	l.Forget("fred")
+	if u, err := l.Authenticate(rt, "fred", "fredpw"); u != nil || err == nil {
+		t.Errorf("fred should not authenticate with the server down and no cache")
+	}
+
+	// Changing the group mapping changes the Roles on the next login.
+	stub.down = false
+	setPrefs(map[string]string{
+		"ldapGroupRoles": `{"cn=ops,ou=groups,dc=example,dc=com": ["operator"], "cn=other,ou=groups,dc=example,dc=com": ["superuser"]}`,
+		"ldapCacheTTL":   "0",
+	})
+	u, err = l.Authenticate(rt, "fred", "fredpw")
+	if err != nil || u == nil {
+		t.Fatalf("fred should have authenticated: %v", err)
+	}
+	if len(u.Roles) != 2 || u.Roles[0] != "operator" || u.Roles[1] != "superuser" {
+		t.Errorf("fred should have the operator and superuser roles, not %v", u.Roles)
+	}
+	stub.down = true
+	if u, err := l.Authenticate(rt, "fred", "fredpw"); u != nil || err == nil {
+		t.Errorf("fred should not be cached with ldapCacheTTL 0")
+	}
+}
+
+func TestLdapPrefs(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "preferences", "bootenvs", "stages", "workflows")
+	rt.Do(func(d Stores) {
+		for _, bad := range []map[string]string{
+			{"ldapUrl": "http://ldap.example.com"},
+			{"ldapUrl": "ldap://"},
+			{"ldapUserFilter": "(uid=fred)"},
+			{"ldapGroupRoles": "[]"},
+			{"ldapCacheTTL": "forever"},
+			{"ldapStartTLS": "maybe"},
+		} {
+			if err := dt.SetPrefs(rt, bad); err == nil {
+				t.Errorf("Setting %v should have failed", bad)
+			}
+		}
+		good := map[string]string{
+			"ldapUrl":        "ldap://ad.example.com:3268",
+			"ldapUserFilter": "(sAMAccountName=%s)",
+			"ldapStartTLS":   "true",
+			"ldapGroupRoles": `{"CN=Admins,DC=example,DC=com": ["superuser"]}`,
+		}
+		if err := dt.SetPrefs(rt, good); err != nil {
+			t.Errorf("Setting %v failed: %v", good, err)
+		}
+	})
+}
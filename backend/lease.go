@@ -26,7 +26,7 @@ func (obj *Lease) SetReadOnly(b bool) {
 func (obj *Lease) SaveClean() store.KeySaver {
 	mod := *obj.Lease
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (l *Lease) Indexes() map[string]index.Maker {
@@ -0,0 +1,232 @@
+package backend
+
+import (
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// loginCountsMax is how many users or addresses with failed logins
+// are tracked before the ones whose failures have expired are dropped.
+const loginCountsMax = 1024
+
+// A client address that has this many requests for a new machine token
+// refused is locked out of making more for loginLockoutTime seconds,
+// and each Machine can only get a new token once per
+// machineTokenInterval.
+const (
+	machineTokenMaxFailures = 10
+	machineTokenInterval    = 10 * time.Second
+)
+
+type loginCount struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// LoginLimiter counts the failed logins of users and client addresses,
+// and locks them out for a while when there are too many.  It also
+// remembers the last TOTP time step each user logged in with, so that
+// a one-time code cannot be used twice, and rate limits requests for
+// new machine tokens.  Nothing is persisted, so a restart clears every
+// lockout.
+type LoginLimiter struct {
+	mux           *sync.Mutex
+	users         map[string]*loginCount
+	ips           map[string]*loginCount
+	totp          map[string]int64
+	machineIPs    map[string]*loginCount
+	machineTokens map[string]time.Time
+}
+
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{
+		mux:           &sync.Mutex{},
+		users:         map[string]*loginCount{},
+		ips:           map[string]*loginCount{},
+		totp:          map[string]int64{},
+		machineIPs:    map[string]*loginCount{},
+		machineTokens: map[string]time.Time{},
+	}
+}
+
+// lockedFor returns how much longer key is locked out of counts.
+func lockedFor(counts map[string]*loginCount, key string, now time.Time) time.Duration {
+	if ent, ok := counts[key]; ok && now.Before(ent.lockedUntil) {
+		return ent.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail counts a failed login for key.  It returns the number of
+// failures and whether they just caused a lockout.
+func fail(counts map[string]*loginCount, key string, max int, lockout time.Duration, now time.Time) (int, bool) {
+	if len(counts) >= loginCountsMax {
+		for k, ent := range counts {
+			if now.Sub(ent.last) > lockout && now.After(ent.lockedUntil) {
+				delete(counts, k)
+			}
+		}
+	}
+	ent, ok := counts[key]
+	if !ok || now.Sub(ent.last) > lockout {
+		ent = &loginCount{}
+		counts[key] = ent
+	}
+	ent.failures++
+	ent.last = now
+	if max <= 0 || ent.failures < max || now.Before(ent.lockedUntil) {
+		return ent.failures, false
+	}
+	ent.lockedUntil = now.Add(lockout)
+	return ent.failures, true
+}
+
+func (p *DataTracker) loginLockoutTime() time.Duration {
+	if p.pref("loginLockoutTime") == "" {
+		return 300 * time.Second
+	}
+	return time.Duration(p.prefInt("loginLockoutTime")) * time.Second
+}
+
+// LoginLocked returns how much longer logins as user or from ip are
+// locked out, or 0 if they are not.  user is empty for logins, like
+// those with API keys, that are only limited by address.
+func (p *DataTracker) LoginLocked(user, ip string) time.Duration {
+	l := p.logins
+	now := time.Now()
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	var res time.Duration
+	if user != "" {
+		res = lockedFor(l.users, user, now)
+	}
+	if byIP := lockedFor(l.ips, ip, now); byIP > res {
+		res = byIP
+	}
+	return res
+}
+
+// LoginFailed counts a failed login as user from ip.  When that makes
+// either of them reach the loginMaxFailures or loginMaxIpFailures
+// preference, it is locked out for loginLockoutTime seconds and a
+// logins lockout event is published.  Users that do not exist are
+// counted too, so that lockouts do not reveal which ones do.  If user
+// is empty, only ip is counted.
+func (p *DataTracker) LoginFailed(rt *RequestTracker, user, ip string) {
+	l := p.logins
+	now := time.Now()
+	lockout := p.loginLockoutTime()
+	events := []*models.Event{}
+	l.mux.Lock()
+	if user != "" {
+		if n, locked := fail(l.users, user, p.prefInt("loginMaxFailures"), lockout, now); locked {
+			events = append(events, &models.Event{
+				Time:   now,
+				Type:   "logins",
+				Action: "lockout",
+				Key:    user,
+				Object: &models.LoginLockout{User: user, Failures: n, Until: now.Add(lockout)},
+			})
+		}
+	}
+	if n, locked := fail(l.ips, ip, p.prefInt("loginMaxIpFailures"), lockout, now); locked {
+		events = append(events, &models.Event{
+			Time:   now,
+			Type:   "logins",
+			Action: "lockout",
+			Key:    ip,
+			Object: &models.LoginLockout{ClientIP: ip, Failures: n, Until: now.Add(lockout)},
+		})
+	}
+	l.mux.Unlock()
+	for _, e := range events {
+		publishLockout(rt, e)
+	}
+}
+
+func publishLockout(rt *RequestTracker, e *models.Event) {
+	lo := e.Object.(*models.LoginLockout)
+	rt.Auditf("Locking out user %q address %q until %s after %d failed logins", lo.User, lo.ClientIP, lo.Until.Format(time.RFC3339), lo.Failures)
+	if err := rt.PublishEvent(e); err != nil {
+		rt.Warnf("Unable to publish lockout of %s: %v", e.Key, err)
+	}
+}
+
+// LoginSucceeded clears the failed logins of user.  Those of the
+// client address are kept, so that logging in as one user cannot hide
+// guessing the passwords of others.
+func (p *DataTracker) LoginSucceeded(user string) {
+	p.logins.mux.Lock()
+	delete(p.logins.users, user)
+	p.logins.mux.Unlock()
+}
+
+// MachineTokenLocked returns how much longer a request from ip for a
+// new token for machine has to wait, or 0 if it does not.
+func (p *DataTracker) MachineTokenLocked(machine, ip string) time.Duration {
+	l := p.logins
+	now := time.Now()
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	res := lockedFor(l.machineIPs, ip, now)
+	if last, ok := l.machineTokens[machine]; ok {
+		if wait := last.Add(machineTokenInterval).Sub(now); wait > res {
+			res = wait
+		}
+	}
+	return res
+}
+
+// MachineTokenFailed counts a refused request from ip for a new machine
+// token.  When there have been machineTokenMaxFailures of them, ip is
+// locked out for loginLockoutTime seconds and a logins lockout event
+// is published.
+func (p *DataTracker) MachineTokenFailed(rt *RequestTracker, ip string) {
+	l := p.logins
+	now := time.Now()
+	lockout := p.loginLockoutTime()
+	l.mux.Lock()
+	n, locked := fail(l.machineIPs, ip, machineTokenMaxFailures, lockout, now)
+	l.mux.Unlock()
+	if locked {
+		publishLockout(rt, &models.Event{
+			Time:   now,
+			Type:   "logins",
+			Action: "lockout",
+			Key:    ip,
+			Object: &models.LoginLockout{ClientIP: ip, Failures: n, Until: now.Add(lockout)},
+		})
+	}
+}
+
+// MachineTokenIssued records that machine got a new token.
+func (p *DataTracker) MachineTokenIssued(machine string) {
+	l := p.logins
+	now := time.Now()
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if len(l.machineTokens) >= loginCountsMax {
+		for k, last := range l.machineTokens {
+			if now.Sub(last) > machineTokenInterval {
+				delete(l.machineTokens, k)
+			}
+		}
+	}
+	l.machineTokens[machine] = now
+}
+
+// useTotpStep records that user logged in with a code for step.  It
+// returns false if the user already used a code for that step or a
+// later one.
+func (l *LoginLimiter) useTotpStep(user string, step int64) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if last, ok := l.totp[user]; ok && step <= last {
+		return false
+	}
+	l.totp[user] = step
+	return true
+}
@@ -0,0 +1,207 @@
+package backend
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+type lockoutWatcher struct {
+	sync.Mutex
+	events []*models.Event
+}
+
+func (w *lockoutWatcher) Publish(e *models.Event) error {
+	if e.Type == "logins" && e.Action == "lockout" {
+		w.Lock()
+		w.events = append(w.events, e)
+		w.Unlock()
+	}
+	return nil
+}
+
+func (w *lockoutWatcher) Reserve() error { return nil }
+func (w *lockoutWatcher) Release()       {}
+func (w *lockoutWatcher) Unload()        {}
+
+func TestPasswordPolicy(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "workflows", "preferences", "users", "roles")
+	rt.Do(func(d Stores) {
+		if err := dt.SetPrefs(rt, map[string]string{
+			"passwordMinLength":  "8",
+			"passwordMinClasses": "3",
+			"passwordHistory":    "2",
+		}); err != nil {
+			t.Fatalf("Unable to set the password policy: %v", err)
+		}
+		u := &User{}
+		Fill(u)
+		u.Name = "policy-user"
+		if _, err := rt.Create(u); err != nil {
+			t.Fatalf("Unable to create policy-user: %v", err)
+		}
+		tests := []struct {
+			pass string
+			ok   bool
+		}{
+			{"Sh0rt", false},
+			{"alllowercase1", false},
+			{"Passw0rd1", true},
+			{"Passw0rd1", false},
+			{"Passw0rd2", true},
+			{"Passw0rd1", false},
+			{"Passw0rd3", true},
+			{"Passw0rd1", true},
+		}
+		for i, test := range tests {
+			err := u.ChangePassword(rt, test.pass)
+			if test.ok && err != nil {
+				t.Errorf("%d: %s should have been accepted: %v", i, test.pass, err)
+			} else if !test.ok && err == nil {
+				t.Errorf("%d: %s should have been refused", i, test.pass)
+			}
+		}
+		stored := AsUser(rt.find("users", "policy-user"))
+		if !stored.CheckPassword("Passw0rd1") || len(stored.PasswordHistory) != 2 {
+			t.Errorf("Expected the last password and 2 old ones, got %d old ones", len(stored.PasswordHistory))
+		}
+		if len(stored.Sanitize().(*models.User).PasswordHistory) != 0 {
+			t.Errorf("Sanitize did not strip out the password history")
+		}
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	dt := mkDT(nil)
+	w := &lockoutWatcher{}
+	dt.publishers.Add(w)
+	defer dt.publishers.Remove(w)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "workflows", "preferences")
+	rt.Do(func(d Stores) {
+		if err := dt.SetPrefs(rt, map[string]string{
+			"loginMaxFailures":   "3",
+			"loginMaxIpFailures": "5",
+			"loginLockoutTime":   "60",
+		}); err != nil {
+			t.Fatalf("Unable to set the lockout prefs: %v", err)
+		}
+	})
+	rt = dt.Request(dt.Logger)
+	for i := 0; i < 3; i++ {
+		if dt.LoginLocked("bob", "10.0.0.1") > 0 {
+			t.Fatalf("bob should not be locked out after %d failures", i)
+		}
+		dt.LoginFailed(rt, "bob", "10.0.0.1")
+	}
+	if wait := dt.LoginLocked("bob", "10.0.0.2"); wait <= 0 || wait > 60*time.Second {
+		t.Errorf("bob should be locked out for up to a minute, not %v", wait)
+	}
+	if dt.LoginLocked("alice", "10.0.0.1") > 0 {
+		t.Errorf("alice should not be locked out yet")
+	}
+	dt.LoginSucceeded("bob")
+	if dt.LoginLocked("bob", "10.0.0.2") > 0 {
+		t.Errorf("A successful login should clear the failures of bob")
+	}
+	dt.LoginFailed(rt, "alice", "10.0.0.1")
+	dt.LoginFailed(rt, "alice", "10.0.0.1")
+	if dt.LoginLocked("carol", "10.0.0.1") <= 0 {
+		t.Errorf("10.0.0.1 should be locked out after 5 failures")
+	}
+	if dt.LoginLocked("carol", "10.0.0.3") > 0 {
+		t.Errorf("carol should not be locked out from 10.0.0.3")
+	}
+	// Logins without a user, like those with API keys, only count
+	// against the address.
+	for i := 0; i < 5; i++ {
+		dt.LoginFailed(rt, "", "10.0.0.4")
+	}
+	if dt.LoginLocked("", "10.0.0.4") <= 0 {
+		t.Errorf("10.0.0.4 should be locked out after 5 failures")
+	}
+	if dt.LoginLocked("", "10.0.0.5") > 0 {
+		t.Errorf("Failures without a user should not lock out other addresses")
+	}
+	w.Lock()
+	defer w.Unlock()
+	if len(w.events) != 3 {
+		t.Fatalf("Expected 3 lockout events, got %d", len(w.events))
+	}
+	if lo := w.events[0].Object.(*models.LoginLockout); w.events[0].Key != "bob" || lo.User != "bob" || lo.Failures != 3 {
+		t.Errorf("Unexpected user lockout event: %#v", lo)
+	}
+	if lo := w.events[1].Object.(*models.LoginLockout); w.events[1].Key != "10.0.0.1" || lo.ClientIP != "10.0.0.1" || lo.Failures != 5 {
+		t.Errorf("Unexpected address lockout event: %#v", lo)
+	}
+	if lo := w.events[2].Object.(*models.LoginLockout); w.events[2].Key != "10.0.0.4" || lo.User != "" {
+		t.Errorf("Unexpected address lockout event: %#v", lo)
+	}
+}
+
+func TestTotp(t *testing.T) {
+	// The SHA1 test vectors from RFC 6238, truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	for unix, code := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		if got := totpCode(key, unix/totpStep); got != code {
+			t.Errorf("At %d expected %s, got %s", unix, code, got)
+		}
+	}
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111109, 0)
+	if step := totpMatch(secret, "081804", now.Add(totpStep*time.Second)); step != 1111111109/totpStep {
+		t.Errorf("A code from the previous step should match, got step %d", step)
+	}
+	if step := totpMatch(secret, "081804", now.Add(3*totpStep*time.Second)); step != -1 {
+		t.Errorf("An old code should not match, got step %d", step)
+	}
+
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "users", "roles")
+	rt.Do(func(d Stores) {
+		u := &User{}
+		Fill(u)
+		u.Name = "totp-user"
+		if _, err := rt.Create(u); err != nil {
+			t.Fatalf("Unable to create totp-user: %v", err)
+		}
+		enrol, err := u.StartTotp(rt)
+		if err != nil || u.TotpEnabled {
+			t.Fatalf("Unable to start TOTP enrolment: %v", err)
+		}
+		if err := u.ConfirmTotp(rt, "000000x"); err == nil {
+			t.Errorf("A bad code should not confirm enrolment")
+		}
+		key, _ := totpEncoding.DecodeString(enrol.Secret)
+		code := totpCode(key, time.Now().Unix()/totpStep)
+		if err := u.ConfirmTotp(rt, code); err != nil || !u.TotpEnabled {
+			t.Fatalf("Unable to confirm enrolment: %v", err)
+		}
+		if dt.CheckTotp(u, code) {
+			t.Errorf("A code should only be usable once")
+		}
+		if !dt.CheckTotp(u, totpCode(key, time.Now().Unix()/totpStep+1)) {
+			t.Errorf("The code for the next step should be accepted")
+		}
+
+		// Saving a sanitized copy keeps the secret.
+		if _, err := rt.Update(u.Sanitize()); err != nil {
+			t.Fatalf("Unable to update totp-user: %v", err)
+		}
+		stored := AsUser(rt.find("users", "totp-user"))
+		if !stored.TotpEnabled || stored.TotpSecret != enrol.Secret {
+			t.Errorf("Updating the user lost its TOTP secret")
+		}
+		if err := stored.DisableTotp(rt); err != nil || stored.TotpEnabled || stored.TotpSecret != "" {
+			t.Errorf("Unable to disable TOTP: %v", err)
+		}
+	})
+}
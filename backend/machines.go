@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"os"
 	"path"
 	"reflect"
 	"strings"
@@ -45,7 +46,7 @@ func (n *Machine) AllowStageChange() {
 func (obj *Machine) SaveClean() store.KeySaver {
 	mod := *obj.Machine
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (n *Machine) HasTask(s string) bool {
@@ -605,6 +606,7 @@ func (n *Machine) BeforeSave() error {
 	if n.oldWorkflow == "" && n.Workflow != "" {
 		n.oldWorkflow = n.Workflow
 	}
+	n.rt.secureParams(n, n)
 	n.Validate()
 	if !n.Useable() {
 		return n.MakeError(422, ValidationError, n)
@@ -871,6 +873,11 @@ func (n *Machine) resetCurrentTask(oldm *Machine, e *models.Error) {
 
 func (n *Machine) OnChange(oldThing store.KeySaver) error {
 	oldm := AsMachine(oldThing)
+	// The Secret is sanitized out of every Machine the API sends, so
+	// an empty one means to keep it.
+	if n.Secret == "" {
+		n.Secret = oldm.Secret
+	}
 	n.oldBootEnv = oldm.BootEnv
 	n.oldStage = oldm.Stage
 	n.oldWorkflow = oldm.Workflow
@@ -955,7 +962,9 @@ func (n *Machine) AfterDelete() {
 		}
 	}
 	n.rt.dt.macAddrMux.Unlock()
-
+	if err := os.RemoveAll(n.InventoryDir(n.rt)); err != nil {
+		n.rt.Errorf("Failed to remove inventory for %s: %v", n.UUID(), err)
+	}
 }
 
 func AsMachine(o models.Model) *Machine {
@@ -0,0 +1,323 @@
+package backend
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/digitalrebar/provision/models"
+)
+
+const (
+	// How long the discovery document and keys of the issuer are used
+	// before they are fetched again.
+	oidcKeyTTL = time.Hour
+	// How often the keys can be fetched early because a token was
+	// signed by a key we do not have.
+	oidcKeyRefetch = time.Minute
+)
+
+// oidcConfig is the OpenID Connect configuration from the oidc*
+// preferences.
+type oidcConfig struct {
+	issuer        string
+	clientId      string
+	audience      string
+	usernameClaim string
+	groupsClaim   string
+	scopes        []string
+	groupRoles    map[string][]string
+}
+
+// oidcConfigFrom returns the OpenID Connect configuration in prefs,
+// or nil if oidcIssuer is not set.
+func oidcConfigFrom(prefs map[string]string) (*oidcConfig, error) {
+	if prefs["oidcIssuer"] == "" {
+		return nil, nil
+	}
+	if err := checkOidcIssuer(prefs["oidcIssuer"]); err != nil {
+		return nil, err
+	}
+	cfg := &oidcConfig{
+		issuer:        prefs["oidcIssuer"],
+		clientId:      prefs["oidcClientId"],
+		audience:      prefs["oidcAudience"],
+		usernameClaim: prefs["oidcUsernameClaim"],
+		groupsClaim:   prefs["oidcGroupsClaim"],
+		scopes:        strings.Fields(prefs["oidcScopes"]),
+		groupRoles:    map[string][]string{},
+	}
+	if cfg.audience == "" {
+		cfg.audience = cfg.clientId
+	}
+	if cfg.usernameClaim == "" {
+		cfg.usernameClaim = "preferred_username"
+	}
+	if cfg.groupsClaim == "" {
+		cfg.groupsClaim = "groups"
+	}
+	if len(cfg.scopes) == 0 {
+		cfg.scopes = []string{"openid", "profile"}
+	}
+	if v := prefs["oidcGroupRoles"]; v != "" {
+		if err := json.Unmarshal([]byte(v), &cfg.groupRoles); err != nil {
+			return nil, fmt.Errorf("oidcGroupRoles: %v", err)
+		}
+	}
+	return cfg, nil
+}
+
+func checkOidcIssuer(val string) error {
+	u, err := url.Parse(val)
+	if err != nil {
+		return fmt.Errorf("oidcIssuer: %v", err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("oidcIssuer: missing host")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		// Keys fetched over plain http can be replaced by anyone on
+		// the path, so it is only allowed for a provider on this host.
+		if !isLoopback(u.Hostname()) {
+			return fmt.Errorf("oidcIssuer: scheme must be https for %s", u.Hostname())
+		}
+	default:
+		return fmt.Errorf("oidcIssuer: scheme must be https, not %q", u.Scheme)
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// oidcDiscovery is the part of the OpenID Connect discovery document
+// that we use.
+type oidcDiscovery struct {
+	Issuer                      string `json:"issuer"`
+	JwksUri                     string `json:"jwks_uri"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+type oidcJwks struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// OidcAuth authenticates Users with ID or access tokens from an
+// OpenID Connect provider, as configured by the oidc* preferences.
+// The discovery document and signing keys of the provider are cached.
+// Users that authenticate are saved as local Users with no password,
+// and with the Roles that their groups are mapped to.
+type OidcAuth struct {
+	dt        *DataTracker
+	client    *http.Client
+	mux       *sync.Mutex
+	issuer    string
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	fetched   time.Time
+}
+
+func NewOidcAuth(dt *DataTracker) *OidcAuth {
+	return &OidcAuth{
+		dt:     dt,
+		client: &http.Client{Timeout: 10 * time.Second},
+		mux:    &sync.Mutex{},
+	}
+}
+
+func (o *OidcAuth) getJSON(u string, res interface{}) error {
+	resp, err := o.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// refresh fetches the discovery document and keys of the issuer if
+// they are stale.  If early is true, they are fetched even if they
+// are not, unless they were fetched very recently.
+// It must be called with o.mux held.
+func (o *OidcAuth) refresh(cfg *oidcConfig, early bool) error {
+	age := time.Since(o.fetched)
+	if o.issuer == cfg.issuer && o.keys != nil &&
+		age < oidcKeyTTL && (!early || age < oidcKeyRefetch) {
+		return nil
+	}
+	disc := &oidcDiscovery{}
+	if err := o.getJSON(strings.TrimSuffix(cfg.issuer, "/")+"/.well-known/openid-configuration", disc); err != nil {
+		return err
+	}
+	if disc.Issuer != cfg.issuer {
+		return fmt.Errorf("discovery document is for issuer %s, not %s", disc.Issuer, cfg.issuer)
+	}
+	jwks := &oidcJwks{}
+	if err := o.getJSON(disc.JwksUri, jwks); err != nil {
+		return err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, nErr := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.N, "="))
+		e, eErr := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.E, "="))
+		if nErr != nil || eErr != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	o.issuer, o.discovery, o.keys, o.fetched = cfg.issuer, disc, keys, time.Now()
+	return nil
+}
+
+func (o *OidcAuth) findKey(kid string) *rsa.PublicKey {
+	if k, ok := o.keys[kid]; ok {
+		return k
+	}
+	if kid == "" && len(o.keys) == 1 {
+		for _, k := range o.keys {
+			return k
+		}
+	}
+	return nil
+}
+
+// key returns the key the issuer signed with for kid.
+func (o *OidcAuth) key(cfg *oidcConfig, kid string) (*rsa.PublicKey, error) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if err := o.refresh(cfg, false); err != nil {
+		return nil, err
+	}
+	if k := o.findKey(kid); k != nil {
+		return k, nil
+	}
+	// The issuer may have rotated its keys.
+	if err := o.refresh(cfg, true); err != nil {
+		return nil, err
+	}
+	if k := o.findKey(kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("no key %q from issuer %s", kid, cfg.issuer)
+}
+
+// Config returns what clients need to log in through the OpenID
+// Connect provider, or nil if it is not configured.
+func (o *OidcAuth) Config() (*models.OidcConfig, error) {
+	cfg, err := oidcConfigFrom(o.dt.Prefs())
+	if cfg == nil || err != nil {
+		return nil, err
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if err := o.refresh(cfg, false); err != nil {
+		return nil, err
+	}
+	return &models.OidcConfig{
+		Issuer:                      cfg.issuer,
+		ClientId:                    cfg.clientId,
+		UsernameClaim:               cfg.usernameClaim,
+		Scopes:                      cfg.scopes,
+		TokenEndpoint:               o.discovery.TokenEndpoint,
+		DeviceAuthorizationEndpoint: o.discovery.DeviceAuthorizationEndpoint,
+	}, nil
+}
+
+// claimStrings returns the strings in a claim that can be either a
+// string or a list of them.
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		res := []string{}
+		for _, i := range val {
+			if s, ok := i.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// Authenticate checks token, which must be an ID or access token from
+// the issuer for our audience.  It returns nil and no error if OpenID
+// Connect is not configured or token is not a JWT.  rt must be able to
+// lock users and roles, and must not be locked.
+func (o *OidcAuth) Authenticate(rt *RequestTracker, token string) (*User, error) {
+	cfg, err := oidcConfigFrom(o.dt.Prefs())
+	if cfg == nil || err != nil || strings.Count(token, ".") != 2 {
+		return nil, err
+	}
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return o.key(cfg, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if iss, _ := claims["iss"].(string); iss != cfg.issuer {
+		return nil, fmt.Errorf("token is from issuer %q, not %s", iss, cfg.issuer)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("token does not expire")
+	}
+	audOk := false
+	for _, aud := range claimStrings(claims["aud"]) {
+		if aud == cfg.audience {
+			audOk = true
+			break
+		}
+	}
+	if !audOk {
+		return nil, fmt.Errorf("token is not for audience %s", cfg.audience)
+	}
+	username, _ := claims[cfg.usernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("token has no %s claim", cfg.usernameClaim)
+	}
+	roles := mapGroupRoles(cfg.groupRoles, claimStrings(claims[cfg.groupsClaim]))
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("%s is not in any group that is mapped to a role", username)
+	}
+	return saveExternalUser(rt, "oidc", username, roles)
+}
@@ -0,0 +1,224 @@
+package backend
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/digitalrebar/provision/models"
+)
+
+// oidcStub is a minimal OpenID Connect issuer that only serves
+// discovery and keys.
+type oidcStub struct {
+	*httptest.Server
+	mux        *sync.Mutex
+	keys       map[string]*rsa.PrivateKey
+	keyFetches int
+}
+
+func newOidcStub(t *testing.T) *oidcStub {
+	s := &oidcStub{mux: &sync.Mutex{}, keys: map[string]*rsa.PrivateKey{}}
+	s.addKey(t, "k1")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                        s.URL,
+			"jwks_uri":                      s.URL + "/keys",
+			"token_endpoint":                s.URL + "/token",
+			"device_authorization_endpoint": s.URL + "/device",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		s.keyFetches++
+		keys := []map[string]string{}
+		for kid, k := range s.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *oidcStub) addKey(t *testing.T, kid string) {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.keys[kid] = k
+}
+
+func (s *oidcStub) fetches() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.keyFetches
+}
+
+func (s *oidcStub) token(t *testing.T, kid string, claims jwt.MapClaims) string {
+	base := jwt.MapClaims{
+		"iss":                s.URL,
+		"aud":                "drp",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"preferred_username": "fred",
+		"groups":             []string{"ops"},
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(base, k)
+		} else {
+			base[k] = v
+		}
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+	tok.Header["kid"] = kid
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	res, err := tok.SignedString(s.keys[kid])
+	if err != nil {
+		t.Fatalf("Unable to sign token: %v", err)
+	}
+	return res
+}
+
+func TestOidcAuth(t *testing.T) {
+	stub := newOidcStub(t)
+	defer stub.Close()
+	dt := mkDT(nil)
+	prefRT := dt.Request(dt.Logger, "preferences", "bootenvs", "stages", "workflows")
+	rt := dt.Request(dt.Logger, "users", "roles")
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(&models.Role{Name: "operator", Claims: []*models.Claim{{Scope: "machines", Action: "*", Specific: "*"}}}); err != nil {
+			t.Fatalf("Unable to create operator role: %v", err)
+		}
+		if _, err := rt.Create(&models.User{Name: "admin"}); err != nil {
+			t.Fatalf("Unable to create local admin: %v", err)
+		}
+	})
+	o := NewOidcAuth(dt)
+
+	if u, err := o.Authenticate(rt, stub.token(t, "k1", nil)); u != nil || err != nil {
+		t.Errorf("Unconfigured OpenID Connect should not authenticate anyone: %v, %v", u, err)
+	}
+	prefRT.Do(func(d Stores) {
+		if err := dt.SetPrefs(prefRT, map[string]string{
+			"oidcIssuer":     stub.URL,
+			"oidcClientId":   "drp",
+			"oidcGroupRoles": `{"ops": ["operator"]}`,
+		}); err != nil {
+			t.Fatalf("Unable to set OpenID Connect prefs: %v", err)
+		}
+	})
+
+	cfg, err := o.Config()
+	if err != nil || cfg == nil {
+		t.Fatalf("Unable to get OpenID Connect config: %v", err)
+	}
+	if cfg.DeviceAuthorizationEndpoint != stub.URL+"/device" || cfg.UsernameClaim != "preferred_username" {
+		t.Errorf("Unexpected OpenID Connect config: %#v", cfg)
+	}
+
+	u, err := o.Authenticate(rt, stub.token(t, "k1", nil))
+	if err != nil || u == nil {
+		t.Fatalf("fred should have authenticated: %v", err)
+	}
+	if len(u.Roles) != 1 || u.Roles[0] != "operator" || u.Meta[AuthSourceMeta] != "oidc" {
+		t.Errorf("fred should be an OpenID Connect user with the operator role, not %v %v", u.Roles, u.Meta)
+	}
+	if u, err := o.Authenticate(rt, "not-a-jwt"); u != nil || err != nil {
+		t.Errorf("A DRP token should be left alone: %v, %v", u, err)
+	}
+
+	bad := map[string]jwt.MapClaims{
+		"wrong audience":  {"aud": "someone-else"},
+		"audience list":   {"aud": []string{"someone-else", "another"}},
+		"wrong issuer":    {"iss": "https://evil.example.com"},
+		"expired":         {"exp": time.Now().Add(-time.Minute).Unix()},
+		"no expiry":       {"exp": nil},
+		"no username":     {"preferred_username": nil},
+		"no mapped group": {"groups": []string{"other"}},
+		"local user":      {"preferred_username": "admin"},
+		"not yet valid":   {"nbf": time.Now().Add(time.Hour).Unix()},
+	}
+	for name, claims := range bad {
+		if u, err := o.Authenticate(rt, stub.token(t, "k1", claims)); u != nil || err == nil {
+			t.Errorf("Token with %s should not authenticate", name)
+		}
+	}
+	if u, err := o.Authenticate(rt, stub.token(t, "k1", jwt.MapClaims{"aud": []string{"other", "drp"}})); u == nil || err != nil {
+		t.Errorf("Token with drp in an audience list should authenticate: %v", err)
+	}
+
+	// Rotating a key does not break tokens signed with the old one
+	// until the keys are fetched again, and the new one is refused
+	// until then.
+	oldToken := stub.token(t, "k1", nil)
+	stub.addKey(t, "k1")
+	if u, err := o.Authenticate(rt, oldToken); u == nil || err != nil {
+		t.Errorf("Cached keys should still verify the old token: %v", err)
+	}
+	if u, err := o.Authenticate(rt, stub.token(t, "k1", nil)); u != nil || err == nil {
+		t.Errorf("Token signed with a key we do not have should not authenticate")
+	}
+
+	// A new key is fetched once, and then is rate limited.
+	stub.addKey(t, "k2")
+	fetches := stub.fetches()
+	o.fetched = time.Now().Add(-2 * oidcKeyRefetch)
+	if u, err := o.Authenticate(rt, stub.token(t, "k2", nil)); u == nil || err != nil {
+		t.Errorf("Token signed with a rotated key should authenticate: %v", err)
+	}
+	if n := stub.fetches() - fetches; n != 1 {
+		t.Errorf("Keys should have been fetched once, not %d times", n)
+	}
+	stub.addKey(t, "k3")
+	if u, err := o.Authenticate(rt, stub.token(t, "k3", nil)); u != nil || err == nil {
+		t.Errorf("Keys should not be fetched again so soon")
+	}
+}
+
+func TestOidcPrefs(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "preferences", "bootenvs", "stages", "workflows")
+	rt.Do(func(d Stores) {
+		for _, bad := range []map[string]string{
+			{"oidcIssuer": "ldap://idp.example.com"},
+			{"oidcIssuer": "https://"},
+			{"oidcIssuer": "http://idp.example.com"},
+			{"oidcGroupRoles": "[]"},
+		} {
+			if err := dt.SetPrefs(rt, bad); err == nil {
+				t.Errorf("Setting %v should have failed", bad)
+			}
+		}
+		good := map[string]string{
+			"oidcIssuer":     "https://idp.example.com/realms/drp",
+			"oidcClientId":   "drpcli",
+			"oidcAudience":   "dr-provision",
+			"oidcScopes":     "openid profile groups",
+			"oidcGroupRoles": `{"admins": ["superuser"]}`,
+		}
+		if err := dt.SetPrefs(rt, good); err != nil {
+			t.Errorf("Setting %v failed: %v", good, err)
+		}
+	})
+}
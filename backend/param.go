@@ -1,6 +1,10 @@
 package backend
 
 import (
+	"net/http"
+	"reflect"
+	"strings"
+
 	"github.com/digitalrebar/provision/backend/index"
 	"github.com/digitalrebar/provision/models"
 	"github.com/digitalrebar/store"
@@ -23,7 +27,9 @@ type Paramer interface {
 type Param struct {
 	*models.Param
 	validate
-	validator *gojsonschema.Schema
+	validator     *gojsonschema.Schema
+	schemaChanged bool
+	report        *models.ParamReport
 }
 
 func (obj *Param) SetReadOnly(b bool) {
@@ -33,7 +39,7 @@ func (obj *Param) SetReadOnly(b bool) {
 func (obj *Param) SaveClean() store.KeySaver {
 	mod := *obj.Param
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func AsParam(o models.Model) *Param {
@@ -92,11 +98,41 @@ func (p *Param) BeforeSave() error {
 	if !p.Useable() {
 		return p.MakeError(422, ValidationError, p)
 	}
+	if p.schemaChanged {
+		p.report = p.rt.checkParamValues(p)
+		if len(p.report.Invalid) > 0 && !p.ChangeForced() {
+			e := &models.Error{
+				Code:  422,
+				Type:  ValidationError,
+				Model: p.Prefix(),
+				Key:   p.Key(),
+			}
+			e.Errorf("Schema change would leave %d invalid values behind, force the change to make it anyway", len(p.report.Invalid))
+			for _, v := range p.report.Invalid {
+				e.Errorf("%s:%s: %s", v.Model, v.Key, strings.Join(v.Errors, "; "))
+			}
+			p.report = nil
+			return e
+		}
+	}
+	return nil
+}
+
+func (p *Param) OnChange(oldThing store.KeySaver) error {
+	p.schemaChanged = !reflect.DeepEqual(AsParam(oldThing).Schema, p.Schema)
 	return nil
-	// Arguably, we should also detect when an attempted schema update happens
-	// and verify that it does not break validation, or at least report on what
-	// previously-valid values would become invalid.
-	// However, I don't feel like writing that code for now, so ignore the problem.
+}
+
+func (p *Param) AfterSave() {
+	if p.report != nil && len(p.report.Invalid) > 0 {
+		p.rt.Warnf("Schema change for Param %s left %d invalid values behind", p.Name, len(p.report.Invalid))
+		for _, v := range p.report.Invalid {
+			p.rt.Warnf("Param %s: %s:%s: %v", p.Name, v.Model, v.Key, v.Errors)
+		}
+		p.rt.Publish("params", "invalid", p.Name, p.report)
+	}
+	p.schemaChanged = false
+	p.report = nil
 }
 
 func (p *Param) OnLoad() error {
@@ -129,11 +165,125 @@ func (p *Param) ValidateValue(val interface{}) error {
 	return e
 }
 
+// validateParamValues checks the values in params against the Params
+// that define them.  Values of secure params are checked before they
+// are encrypted, so they are skipped here.
+func (rt *RequestTracker) validateParamValues(params map[string]interface{}, e models.ErrorAdder) {
+	for k, v := range params {
+		if _, ok := models.AsSecureData(v); ok {
+			continue
+		}
+		if pobj := rt.find("params", k); pobj != nil {
+			if err := AsParam(pobj).ValidateValue(v); err != nil {
+				e.Errorf("Key '%s': invalid val '%s': %v", k, v, err)
+			}
+		}
+	}
+}
+
+// paramHolders are the prefixes of the objects that can hold param
+// values.
+var paramHolders = []string{"machines", "profiles", "plugins", "stages", "workflows", "bootenvs"}
+
+// validateParamWrites checks the values in params that are new or
+// differ from the ones in old against the Params that define them.
+// Values that are already stored are left alone, so that a Schema
+// change does not keep unrelated changes to an object from being
+// saved.  Only the server makes the encrypted values of secure params,
+// so any that are written must be the ones that are already stored.
+func (rt *RequestTracker) validateParamWrites(obj models.Model, old, params map[string]interface{}) error {
+	e := &models.Error{
+		Code:  http.StatusUnprocessableEntity,
+		Type:  ValidationError,
+		Model: obj.Prefix(),
+		Key:   obj.Key(),
+	}
+	for k, v := range params {
+		if s, ok := v.(string); ok && s == models.RedactedValue {
+			continue
+		}
+		if enc, ok := models.AsSecureData(v); ok {
+			if oenc, ok := models.AsSecureData(old[k]); !ok || oenc != enc {
+				e.Errorf("Key '%s': values of the form {\"Secure\": ...} are reserved for stored secure params", k)
+			}
+			continue
+		}
+		if ov, ok := old[k]; ok && reflect.DeepEqual(ov, v) {
+			continue
+		}
+		if pobj := rt.find("params", k); pobj != nil {
+			if err := AsParam(pobj).ValidateValue(v); err != nil {
+				e.Errorf("Key '%s': invalid val '%v': %v", k, v, err)
+			}
+		}
+	}
+	return e.HasError()
+}
+
+// checkParamValues returns the values of p stored on other objects
+// that do not match the Schema of p.  p must be valid, and the
+// paramHolders must be locked.
+func (rt *RequestTracker) checkParamValues(p *Param) *models.ParamReport {
+	res := &models.ParamReport{Param: p.Name, Invalid: []models.InvalidParamValue{}}
+	for _, prefix := range paramHolders {
+		s := rt.stores(prefix)
+		if s == nil {
+			continue
+		}
+		for _, obj := range s.Items() {
+			v, ok := obj.(models.Paramer).GetParams()[p.Name]
+			if !ok {
+				continue
+			}
+			_, secure := models.AsSecureData(v)
+			val, err := rt.dt.DecryptParam(v)
+			if err == nil {
+				err = p.ValidateValue(val)
+			}
+			if err == nil {
+				continue
+			}
+			iv := models.InvalidParamValue{Model: prefix, Key: obj.Key(), Value: v}
+			if p.Secure || secure {
+				iv.Value = models.RedactedValue
+			}
+			if me, ok := err.(*models.Error); ok {
+				iv.Errors = me.Messages
+			} else {
+				iv.Errors = []string{err.Error()}
+			}
+			res.Invalid = append(res.Invalid, iv)
+		}
+	}
+	return res
+}
+
+// CheckParam reports which stored values of the Param named by param
+// would no longer be valid if the Param were changed to param.
+// Nothing is saved.
+func (p *DataTracker) CheckParam(rt *RequestTracker, param *models.Param) (*models.ParamReport, error) {
+	var res *models.ParamReport
+	var err error
+	rt.Do(func(d Stores) {
+		ref := &Param{Param: models.Clone(param).(*models.Param)}
+		ref.Fill()
+		ref.setRT(rt)
+		defer ref.clearRT()
+		ref.Validate()
+		if !ref.Useable() {
+			err = ref.MakeError(422, ValidationError, ref)
+			return
+		}
+		res = rt.checkParamValues(ref)
+	})
+	return res, err
+}
+
 var paramLockMap = map[string][]string{
 	"get":     []string{"params"},
 	"create":  []string{"params", "profiles"},
-	"update":  []string{"params", "profiles"},
-	"patch":   []string{"params", "profiles"},
+	"update":  []string{"params", "profiles", "machines", "plugins", "stages", "workflows", "bootenvs"},
+	"patch":   []string{"params", "profiles", "machines", "plugins", "stages", "workflows", "bootenvs"},
 	"delete":  []string{"params", "profiles"},
 	"actions": []string{"params", "profiles"},
 }
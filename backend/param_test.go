@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
 )
 
 func TestParamsCrud(t *testing.T) {
@@ -41,3 +42,170 @@ func TestParamsCrud(t *testing.T) {
 		}
 	})
 }
+
+func TestExplainParams(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "machines", "tasks", "profiles", "params", "workflows", "templates", "preferences")
+	mUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create kernel-args param", rt.Create, &models.Param{Name: "kernel-args", Schema: map[string]interface{}{"type": "string", "default": "quiet"}}, true},
+		{"Create unused param", rt.Create, &models.Param{Name: "unused", Schema: map[string]interface{}{"type": "string", "default": "unused"}}, true},
+		{"Update global profile", rt.Update, &models.Profile{Name: "global", Params: map[string]interface{}{"kernel-args": "console=ttyS0"}}, true},
+		{"Create stage profile", rt.Create, &models.Profile{Name: "stage-prof", Params: map[string]interface{}{"kernel-args": "console=ttyS1", "stage-only": true}}, true},
+		{"Create machine profile", rt.Create, &models.Profile{Name: "machine-prof", Params: map[string]interface{}{"kernel-args": "console=tty0"}}, true},
+		{"Create stage", rt.Create, &models.Stage{Name: "explain", Profiles: []string{"stage-prof"}}, true},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "explain", Stage: "explain", Profiles: []string{"machine-prof"}}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", mUuid.String()))
+		res := rt.ExplainParams(m, true)
+		ka := res["kernel-args"]
+		if ka == nil || ka.Source != "profiles:machine-prof" || ka.Value != "console=tty0" {
+			t.Fatalf("Unexpected kernel-args: %#v", ka)
+		}
+		expect := []models.ParamSource{
+			{Source: "profiles:stage-prof", Value: "console=ttyS1"},
+			{Source: "profiles:global", Value: "console=ttyS0"},
+			{Source: "params:kernel-args", Value: "quiet"},
+		}
+		if len(ka.Shadowed) != len(expect) {
+			t.Fatalf("Expected %d shadowed values, not %#v", len(expect), ka.Shadowed)
+		}
+		for i := range expect {
+			if ka.Shadowed[i] != expect[i] {
+				t.Errorf("Shadowed value %d: expected %#v, not %#v", i, expect[i], ka.Shadowed[i])
+			}
+		}
+		if so := res["stage-only"]; so == nil || so.Source != "profiles:stage-prof" || len(so.Shadowed) != 0 {
+			t.Errorf("Unexpected stage-only: %#v", so)
+		}
+		if unused, ok := res["unused"]; ok {
+			t.Errorf("Params the machine does not have should not be explained: %#v", unused)
+		}
+		if own := rt.ExplainParams(m, false); len(own) != 0 {
+			t.Errorf("Machine has no params of its own, not %#v", own)
+		}
+	})
+}
+
+func TestObjectParams(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "machines", "tasks", "profiles", "params", "workflows", "templates", "preferences")
+	mUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create kernel-args param", rt.Create, &models.Param{Name: "kernel-args", Schema: map[string]interface{}{"type": "string"}}, true},
+		{"Create BootEnv with bad param", rt.Create, &models.BootEnv{Name: "params", Params: map[string]interface{}{"kernel-args": 1}}, false},
+		{"Create BootEnv", rt.Create, &models.BootEnv{Name: "params", Params: map[string]interface{}{"kernel-args": "console=ttyS2", "env-only": true}}, true},
+		{"Create stage profile", rt.Create, &models.Profile{Name: "stage-prof", Params: map[string]interface{}{"kernel-args": "console=ttyS1"}}, true},
+		{"Create Stage with bad param", rt.Create, &models.Stage{Name: "params", BootEnv: "params", Params: map[string]interface{}{"kernel-args": 1}}, false},
+		{"Create Stage", rt.Create, &models.Stage{Name: "params", BootEnv: "params", Profiles: []string{"stage-prof"}, Params: map[string]interface{}{"kernel-args": "console=ttyS0"}}, true},
+		{"Create Workflow with bad param", rt.Create, &models.Workflow{Name: "params", Stages: []string{"params"}, Params: map[string]interface{}{"kernel-args": 1}}, false},
+		{"Create Workflow", rt.Create, &models.Workflow{Name: "params", Stages: []string{"params"}, Params: map[string]interface{}{"kernel-args": "console=ttyS3", "workflow-only": "yes"}}, true},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "params", Workflow: "params"}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", mUuid.String()))
+		if v, ok := rt.GetParam(m, "kernel-args", true); !ok || v != "console=ttyS0" {
+			t.Errorf("Stage param should win, not %v", v)
+		}
+		if v, ok := rt.GetParam(m, "workflow-only", true); !ok || v != "yes" {
+			t.Errorf("Missing workflow param: %v", v)
+		}
+		if v, ok := rt.GetParam(m, "env-only", true); !ok || v != true {
+			t.Errorf("Missing bootenv param: %v", v)
+		}
+		ka := rt.ExplainParams(m, true)["kernel-args"]
+		expect := []string{"profiles:stage-prof", "workflows:params", "bootenvs:params"}
+		if ka == nil || ka.Source != "stages:params" || len(ka.Shadowed) != len(expect) {
+			t.Fatalf("Unexpected kernel-args: %#v", ka)
+		}
+		for i := range expect {
+			if ka.Shadowed[i].Source != expect[i] {
+				t.Errorf("Shadowed value %d: expected %s, not %s", i, expect[i], ka.Shadowed[i].Source)
+			}
+		}
+		s := AsStage(rt.find("stages", "params"))
+		if v, ok := rt.GetParam(s, "kernel-args", true); !ok || v != "console=ttyS0" {
+			t.Errorf("Stage should see its own param, not %v", v)
+		}
+	})
+}
+
+func TestParamSchemaChange(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "machines", "tasks", "profiles", "params", "workflows", "templates", "preferences", "plugins")
+	mUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create count param", rt.Create, &models.Param{Name: "count", Schema: map[string]interface{}{"type": "integer"}}, true},
+		{"Create Machine with bad param", rt.Create, &models.Machine{Uuid: mUuid, Name: "count", Params: map[string]interface{}{"count": "one"}}, false},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "count", Params: map[string]interface{}{"count": 1}}, true},
+		{"Create Profile", rt.Create, &models.Profile{Name: "count", Params: map[string]interface{}{"count": 2}}, true},
+		{"Create other Profile", rt.Create, &models.Profile{Name: "other", Params: map[string]interface{}{"other": 2}}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	changed := &models.Param{Name: "count", Schema: map[string]interface{}{"type": "string"}}
+	report, err := dt.CheckParam(rt, changed)
+	if err != nil {
+		t.Fatalf("Unexpected error checking param: %v", err)
+	}
+	if report.Param != "count" || len(report.Invalid) != 2 {
+		t.Fatalf("Expected 2 invalid values, not %#v", report)
+	}
+	for _, iv := range report.Invalid {
+		switch {
+		case iv.Model == "machines" && iv.Key == mUuid.String():
+		case iv.Model == "profiles" && iv.Key == "count":
+		default:
+			t.Errorf("Unexpected invalid value: %#v", iv)
+		}
+		if len(iv.Errors) == 0 {
+			t.Errorf("Invalid value %s:%s has no errors", iv.Model, iv.Key)
+		}
+	}
+	if _, err := dt.CheckParam(rt, &models.Param{Name: "count", Schema: map[string]interface{}{"type": "bogus"}}); err == nil {
+		t.Errorf("Checking an invalid Param should have failed")
+	}
+	rt.Do(func(d Stores) {
+		if AsParam(rt.find("params", "count")).Schema.(map[string]interface{})["type"] != "integer" {
+			t.Errorf("Checking a Param should not change it")
+		}
+	})
+	_, err = rt.Update(changed)
+	if err == nil {
+		t.Fatalf("Changing a Schema that leaves invalid values should have failed")
+	}
+	if me, ok := err.(*models.Error); !ok || me.Code != 422 || len(me.Messages) != 3 {
+		t.Errorf("Expected a 422 listing the 2 invalid values, not %v", err)
+	}
+	rt.Do(func(d Stores) {
+		if AsParam(rt.find("params", "count")).Schema.(map[string]interface{})["type"] != "integer" {
+			t.Errorf("A refused Schema change should not change the Param")
+		}
+	})
+	changed.ForceChange()
+	tests = []crudTest{
+		{"Force count param Schema change", rt.Update, changed, true},
+		{"Update Profile with a stored invalid value", rt.Update, &models.Profile{Name: "count", Description: "still 2", Params: map[string]interface{}{"count": 2}}, true},
+		{"Update Profile with a new invalid value", rt.Update, &models.Profile{Name: "count", Params: map[string]interface{}{"count": 3}}, false},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", mUuid.String()))
+		if err := rt.SetParam(m, "count", 4); err == nil {
+			t.Errorf("Setting an invalid value should have failed")
+		}
+		if err := rt.SetParam(m, "count", "four"); err != nil {
+			t.Errorf("Unexpected error setting a valid value: %v", err)
+		}
+	})
+}
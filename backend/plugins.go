@@ -24,7 +24,7 @@ func (obj *Plugin) SetReadOnly(b bool) {
 func (obj *Plugin) SaveClean() store.KeySaver {
 	mod := *obj.Plugin
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (n *Plugin) Indexes() map[string]index.Maker {
@@ -94,6 +94,7 @@ func (n *Plugin) Validate() {
 }
 
 func (n *Plugin) BeforeSave() error {
+	n.rt.secureParams(n, n)
 	n.Validate()
 	if !n.Useable() {
 		return n.MakeError(422, ValidationError, n)
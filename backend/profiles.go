@@ -26,7 +26,7 @@ func (obj *Profile) SetReadOnly(b bool) {
 func (obj *Profile) SaveClean() store.KeySaver {
 	mod := *obj.Profile
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (p *Profile) Indexes() map[string]index.Maker {
@@ -100,19 +100,12 @@ func (p *Profile) Validate() {
 	p.Profile.Validate()
 	p.AddError(index.CheckUnique(p, p.rt.stores("profiles").Items()))
 	p.SetValid()
-	params := p.rt.stores("params")
-	for k, v := range p.Params {
-		if pIdx := params.Find(k); pIdx != nil {
-			param := AsParam(pIdx)
-			if err := param.ValidateValue(v); err != nil {
-				p.Errorf("Key '%s': invalid val '%s': %v", k, v, err)
-			}
-		}
-	}
+	p.rt.validateParamValues(p.Params, p)
 	p.SetAvailable()
 }
 
 func (p *Profile) BeforeSave() error {
+	p.rt.secureParams(p, p)
 	p.Validate()
 	if !p.Useable() {
 		return p.MakeError(422, ValidationError, p)
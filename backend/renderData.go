@@ -29,8 +29,8 @@ type ReadSizer interface {
 }
 
 type renderer struct {
-	path, name string
-	write      func(net.IP) (io.Reader, error)
+	path, name, interpreter string
+	write                   func(net.IP) (io.Reader, error)
 }
 
 func (r renderer) register(fs *FileSystem) {
@@ -373,6 +373,11 @@ type RenderData struct {
 	target            renderable
 	tmplKey, tmplPath string
 	remoteIP          net.IP
+	// preview is set when rendering for RenderPreview.
+	preview bool
+	// redact is set when the values of secure params must not be
+	// rendered.
+	redact bool
 }
 
 func (r *RenderData) fetchRepos(test func(*Repo) bool) (res []*Repo) {
@@ -501,7 +506,47 @@ func (r *RenderData) ApiURL() string {
 	return r.rt.ApiURL(r.remoteIP)
 }
 
+// MachineClaim returns the claims that the machine agent running on m
+// needs to do its job, valid for ttl.
+func (p *DataTracker) MachineClaim(m *Machine, ttl time.Duration) *DrpCustomClaims {
+	grantorSecret := ""
+	if ss := p.pref("systemGrantorSecret"); ss != "" {
+		grantorSecret = ss
+	}
+	return NewClaim(m.Key(), "system", ttl).
+		Add("machines", "*", m.Key()).
+		Add("stages", "get", "*").
+		Add("jobs", "create", m.Key()).
+		Add("jobs", "get", m.Key()).
+		Add("jobs", "patch", m.Key()).
+		Add("jobs", "update", m.Key()).
+		Add("jobs", "actions", m.Key()).
+		Add("jobs", "log", m.Key()).
+		Add("jobs", "artifacts", m.Key()).
+		Add("tasks", "get", "*").
+		Add("info", "get", "*").
+		Add("events", "post", "*").
+		Add("reservations", "create", "*").
+		Add("reservations", "*", models.Hexaddr(m.Address)).
+		AddMachine(m.Key()).
+		AddSecrets("", grantorSecret, m.Secret)
+}
+
+// KnownTokenTTL returns how long tokens for known machines are valid
+// for, according to the knownTokenTimeout preference.
+func (p *DataTracker) KnownTokenTTL() time.Duration {
+	ttl := time.Hour
+	if sttl := p.pref("knownTokenTimeout"); sttl != "" {
+		mttl, _ := strconv.Atoi(sttl)
+		ttl = time.Second * time.Duration(mttl)
+	}
+	return ttl
+}
+
 func (r *RenderData) GenerateToken() string {
+	if r.preview {
+		return previewToken
+	}
 	var t string
 
 	grantor := "system"
@@ -522,28 +567,7 @@ func (r *RenderData) GenerateToken() string {
 			AddSecrets("", grantorSecret, "").
 			Seal(r.rt.dt.tokenManager)
 	} else {
-		ttl := time.Hour
-		if sttl := r.rt.dt.pref("knownTokenTimeout"); sttl != "" {
-			mttl, _ := strconv.Atoi(sttl)
-			ttl = time.Second * time.Duration(mttl)
-		}
-		t, _ = NewClaim(r.Machine.Key(), grantor, ttl).
-			Add("machines", "*", r.Machine.Key()).
-			Add("stages", "get", "*").
-			Add("jobs", "create", r.Machine.Key()).
-			Add("jobs", "get", r.Machine.Key()).
-			Add("jobs", "patch", r.Machine.Key()).
-			Add("jobs", "update", r.Machine.Key()).
-			Add("jobs", "actions", r.Machine.Key()).
-			Add("jobs", "log", r.Machine.Key()).
-			Add("tasks", "get", "*").
-			Add("info", "get", "*").
-			Add("events", "post", "*").
-			Add("reservations", "create", "*").
-			Add("reservations", "*", models.Hexaddr(r.Machine.Address)).
-			AddMachine(r.Machine.Key()).
-			AddSecrets("", grantorSecret, r.Machine.Secret).
-			Seal(r.rt.dt.tokenManager)
+		t, _ = r.rt.dt.MachineClaim(r.Machine.Machine, r.rt.dt.KnownTokenTTL()).Seal(r.rt.dt.tokenManager)
 	}
 	return t
 }
@@ -553,31 +577,12 @@ func (r *RenderData) GenerateInfiniteToken() string {
 		// Don't allow infinite tokens.
 		return ""
 	}
-
-	grantor := "system"
-	grantorSecret := ""
-	if ss := r.rt.dt.pref("systemGrantorSecret"); ss != "" {
-		grantorSecret = ss
+	if r.preview {
+		return previewToken
 	}
 
 	ttl := time.Hour * 24 * 7 * 52 * 3
-	t, _ := NewClaim(r.Machine.Key(), grantor, ttl).
-		Add("machines", "*", r.Machine.Key()).
-		Add("stages", "get", "*").
-		Add("jobs", "create", r.Machine.Key()).
-		Add("jobs", "get", r.Machine.Key()).
-		Add("jobs", "patch", r.Machine.Key()).
-		Add("jobs", "update", r.Machine.Key()).
-		Add("jobs", "actions", r.Machine.Key()).
-		Add("jobs", "log", r.Machine.Key()).
-		Add("tasks", "get", "*").
-		Add("info", "get", "*").
-		Add("events", "post", "*").
-		Add("reservations", "create", "*").
-		Add("reservations", "*", models.Hexaddr(r.Machine.Address)).
-		AddMachine(r.Machine.Key()).
-		AddSecrets("", grantorSecret, r.Machine.Secret).
-		Seal(r.rt.dt.tokenManager)
+	t, _ := r.rt.dt.MachineClaim(r.Machine.Machine, ttl).Seal(r.rt.dt.tokenManager)
 	return t
 }
 
@@ -597,6 +602,10 @@ func (r *RenderData) GenerateProfileToken(profile string, duration int) string {
 		return "InvalidTokenNotAllowedNoProfile"
 	}
 
+	if r.preview {
+		return previewToken
+	}
+
 	grantor := "system"
 	grantorSecret := ""
 	if ss := r.rt.dt.pref("systemGrantorSecret"); ss != "" {
@@ -656,18 +665,32 @@ func (r *RenderData) ParseUrl(segment, rawUrl string) (string, error) {
 	return "", fmt.Errorf("No idea how to get URL part %s from %s", segment, rawUrl)
 }
 
+// paramValue returns the value of a param to render, which is the
+// plain value of a secure param unless r is redacting them.
+func (r *RenderData) paramValue(v interface{}) (interface{}, error) {
+	if r.redact {
+		return r.rt.dt.RedactParam(v, false), nil
+	}
+	return r.rt.dt.DecryptParam(v)
+}
+
 // Param is a helper function for extracting a parameter from Machine.Params
 func (r *RenderData) Param(key string) (interface{}, error) {
 	if r.Machine != nil {
 		v, ok := r.rt.GetParam(r.Machine, key, true)
 		if ok {
-			return v, nil
+			return r.paramValue(v)
+		}
+	} else if r.Env != nil {
+		// Without a Machine, the BootEnv still provides its own Params.
+		if v, ok := r.Env.GetParams()[key]; ok {
+			return r.paramValue(v)
 		}
 	}
 	if o := r.rt.find("profiles", r.rt.dt.GlobalProfileName); o != nil {
 		p := AsProfile(o)
 		if v, ok := r.rt.GetParam(p, key, true); ok {
-			return v, nil
+			return r.paramValue(v)
 		}
 	}
 	return nil, fmt.Errorf("No such machine parameter %s", key)
@@ -743,7 +766,9 @@ func (r *RenderData) addRenderer(e models.ErrorAdder, ti *models.TemplateInfo, r
 			tmplPath = path.Clean("/" + buf.String())
 		}
 	}
-	return append(rts, newRenderedTemplate(r, ti.Id(), tmplPath))
+	rt := newRenderedTemplate(r, ti.Id(), tmplPath)
+	rt.interpreter = ti.Interpreter
+	return append(rts, rt)
 }
 
 func (r *RenderData) makeRenderers(e models.ErrorAdder) renderers {
@@ -0,0 +1,170 @@
+package backend
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"text/template"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// previewToken is what the token helpers render to during a preview,
+// so that previews never hand out working tokens.
+const previewToken = "PreviewTokenNotGenerated"
+
+// previewTemplate lets a single Template be rendered on its own
+// against the shared template namespace.
+type previewTemplate struct {
+	*Template
+	root *template.Template
+}
+
+func (p *previewTemplate) renderInfo() ([]models.TemplateInfo, []string) {
+	return []models.TemplateInfo{{Name: p.ID, ID: p.ID}}, nil
+}
+
+func (p *previewTemplate) templates() *template.Template {
+	return p.root
+}
+
+// previewOne renders a single TemplateInfo for a preview.
+func (r *RenderData) previewOne(ti *models.TemplateInfo) models.RenderedTemplate {
+	res := models.RenderedTemplate{Name: ti.Id(), Interpreter: ti.Interpreter}
+	if ti.PathTemplate() != nil {
+		buf := &bytes.Buffer{}
+		if err := ti.PathTemplate().Execute(buf, r); err != nil {
+			res.Error = "Error rendering path " + ti.Path + ": " + err.Error()
+			return res
+		}
+		if r.target.Prefix() == "tasks" {
+			res.Path = path.Clean(buf.String())
+		} else {
+			res.Path = path.Clean("/" + buf.String())
+		}
+	}
+	r.tmplKey, r.tmplPath = res.Name, res.Path
+	tmpl := r.target.templates().Lookup(res.Name)
+	if tmpl == nil {
+		res.Error = "Missing template: " + res.Name
+		return res
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, r); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Content = buf.String()
+	return res
+}
+
+// RenderPreview renders the templates selected by req the way they
+// would be rendered for the Machine in req, without registering them
+// with the file server, running a Job, or saving anything.  The
+// Machine and the Params in req are combined on a copy of the
+// Machine, and the token helpers render to a placeholder instead of a
+// real token.  Unless decrypt is set, secure params render as
+// models.RedactedValue.  Problems that keep individual templates from
+// rendering, including missing required params, are reported in the
+// returned RenderResult instead of as an error.
+//
+// rt must have the locks needed to read templates, tasks, stages,
+// bootenvs, machines, and profiles.
+func (p *DataTracker) RenderPreview(rt *RequestTracker, req *models.RenderRequest, decrypt bool) (*models.RenderResult, error) {
+	e := &models.Error{Code: http.StatusBadRequest, Type: "RENDER", Model: "templates"}
+	set := 0
+	for _, name := range []string{req.Template, req.Task, req.BootEnv, req.Stage} {
+		if name != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		e.Errorf("Exactly one of Template, Task, BootEnv, or Stage must be set")
+		return nil, e
+	}
+	res := &models.RenderResult{Templates: []models.RenderedTemplate{}, Errors: []string{}}
+	rt.Do(func(d Stores) {
+		m := &Machine{}
+		if len(req.Machine) > 0 {
+			obj := rt.find("machines", req.Machine.String())
+			if obj == nil {
+				e.Code = http.StatusNotFound
+				e.Errorf("Machine %s does not exist", req.Machine)
+				return
+			}
+			m.Machine = models.Clone(AsMachine(obj).Machine).(*models.Machine)
+		} else {
+			m.Machine = &models.Machine{Uuid: uuid.NIL, Name: "preview"}
+			m.Fill()
+		}
+		if len(req.Params) > 0 {
+			params := m.GetParams()
+			for k, v := range req.Params {
+				params[k] = v
+			}
+			m.SetParams(params)
+		}
+		var target renderable
+		find := func(prefix, key string) models.Model {
+			obj := rt.find(prefix, key)
+			if obj == nil {
+				e.Code = http.StatusNotFound
+				e.Model = prefix
+				e.Key = key
+				e.Errorf("Not Found")
+			}
+			return obj
+		}
+		switch {
+		case req.Template != "":
+			if obj := find("templates", req.Template); obj != nil {
+				p.tmplMux.Lock()
+				target = &previewTemplate{Template: AsTemplate(obj), root: p.rootTemplate}
+				p.tmplMux.Unlock()
+			}
+		case req.Task != "":
+			if obj := find("tasks", req.Task); obj != nil {
+				target = AsTask(obj)
+			}
+		case req.BootEnv != "":
+			if obj := find("bootenvs", req.BootEnv); obj != nil {
+				target = AsBootEnv(obj)
+			}
+		case req.Stage != "":
+			if obj := find("stages", req.Stage); obj != nil {
+				target = AsStage(obj)
+			}
+		}
+		if target == nil {
+			return
+		}
+		if target.templates() == nil {
+			e.Code = http.StatusUnprocessableEntity
+			e.Errorf("%s %s has no usable templates", target.Prefix(), target.Key())
+			return
+		}
+		rd := newRenderData(rt, m, target)
+		rd.preview = true
+		rd.redact = !decrypt
+		rd.remoteIP = m.Address
+		errs := &models.Error{}
+		toRender := rd.validateRequiredParams(errs)
+		res.Errors = append(res.Errors, errs.Messages...)
+		for i := range toRender {
+			ti := &toRender[i]
+			if target.Prefix() == "bootenvs" && (ti.Name == "ipxe-mac" || ti.Name == "pxelinux-mac") {
+				for _, mac := range m.HardwareAddrs {
+					rd.Machine.currMac = mac
+					res.Templates = append(res.Templates, rd.previewOne(ti))
+				}
+				continue
+			}
+			res.Templates = append(res.Templates, rd.previewOne(ti))
+		}
+	})
+	if e.ContainsError() {
+		return nil, e
+	}
+	return res, nil
+}
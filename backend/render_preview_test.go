@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestRenderPreview(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "machines", "tasks", "profiles", "params", "workflows", "templates", "preferences")
+	mUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create preview template", rt.Create, &models.Template{ID: "preview", Contents: `name={{.Machine.Name}} foo={{.Param "foo"}}`}, true},
+		{"Create preview task", rt.Create, &models.Task{
+			Name:           "preview",
+			RequiredParams: []string{"foo"},
+			Templates: []models.TemplateInfo{
+				{Name: "token", Path: "/tmp/token", Contents: `{{.GenerateToken}}`},
+				{Name: "foo", Contents: `{{.Param "foo"}}`},
+			},
+		}, true},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "preview", Params: map[string]interface{}{"foo": "bar"}}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	if _, err := dt.RenderPreview(rt, &models.RenderRequest{Template: "preview", Task: "preview"}, true); err == nil {
+		t.Errorf("Rendering both a template and a task should have failed")
+	}
+	if _, err := dt.RenderPreview(rt, &models.RenderRequest{Task: "missing"}, true); err == nil {
+		t.Errorf("Rendering a missing task should have failed")
+	}
+	if _, err := dt.RenderPreview(rt, &models.RenderRequest{Task: "preview", Machine: uuid.NewRandom()}, true); err == nil {
+		t.Errorf("Rendering for a missing machine should have failed")
+	}
+	res, err := dt.RenderPreview(rt, &models.RenderRequest{Template: "preview", Machine: mUuid}, true)
+	if err != nil || len(res.Templates) != 1 || res.Templates[0].Content != "name=preview foo=bar" {
+		t.Errorf("Unexpected template preview: %#v, %v", res, err)
+	}
+	res, err = dt.RenderPreview(rt, &models.RenderRequest{Task: "preview"}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error rendering task: %v", err)
+	}
+	if len(res.Errors) != 1 {
+		t.Errorf("Expected a missing required param error, not %v", res.Errors)
+	}
+	res, err = dt.RenderPreview(rt, &models.RenderRequest{Task: "preview", Machine: mUuid, Params: map[string]interface{}{"foo": "baz"}}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error rendering task: %v", err)
+	}
+	if len(res.Errors) != 0 || len(res.Templates) != 2 {
+		t.Fatalf("Unexpected task preview: %#v", res)
+	}
+	if res.Templates[0].Path != "/tmp/token" || res.Templates[0].Content != previewToken {
+		t.Errorf("Token was not replaced in the preview: %#v", res.Templates[0])
+	}
+	if res.Templates[1].Content != "baz" {
+		t.Errorf("Params in the request were not used: %#v", res.Templates[1])
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", mUuid.String()))
+		if v, _ := rt.GetParam(m, "foo", false); v != "bar" {
+			t.Errorf("Rendering a preview changed the machine: foo=%v", v)
+		}
+	})
+}
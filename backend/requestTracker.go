@@ -23,6 +23,10 @@ type RequestTracker struct {
 	locks     []string
 	d         Stores
 	toPublish []func()
+	// Who the changes are audited as.  See AuditAs.
+	auditUser, auditToken, auditFrom string
+	// The claims of whoever is making the changes.  See LimitTo.
+	caller *DrpCustomClaims
 }
 
 func (rt *RequestTracker) unlocker(u func()) {
@@ -40,6 +44,20 @@ func (p *DataTracker) Request(l logger.Logger, locks ...string) *RequestTracker
 	return &RequestTracker{Mutex: &sync.Mutex{}, dt: p, Logger: l, locks: locks, toPublish: []func(){}}
 }
 
+// LimitTo makes rt refuse to give Users Roles, or Roles Claims, that
+// allow anything caller is not allowed to do, and to change anything
+// but the State of a BulkOperation that has been created.  A
+// RequestTracker without a caller can do all of these.
+func (rt *RequestTracker) LimitTo(caller *DrpCustomClaims) *RequestTracker {
+	rt.caller = caller
+	return rt
+}
+
+// canGrant reports whether rt is allowed to give out claims.
+func (rt *RequestTracker) canGrant(claims []*Claim) bool {
+	return rt.caller == nil || rt.caller.Covers(claims)
+}
+
 func (rt *RequestTracker) PublishEvent(e *models.Event) error {
 	rt.Lock()
 	defer rt.Unlock()
@@ -59,17 +77,20 @@ func (rt *RequestTracker) Publish(prefix, action, key string, ref interface{}) e
 	if rt.dt.publishers == nil {
 		return nil
 	}
-	if rt.d == nil {
-		return rt.dt.publishers.publish(prefix, action, key, ref)
-
-	}
+	// Events go to everyone who can watch them, so they never carry
+	// anything that Sanitize would remove.
 	var toSend interface{}
 	switch m := ref.(type) {
+	case interface{ Sanitize() models.Model }:
+		toSend = m.Sanitize()
 	case models.Model:
 		toSend = models.Clone(m)
 	default:
 		toSend = ref
 	}
+	if rt.d == nil {
+		return rt.dt.publishers.publish(prefix, action, key, toSend)
+	}
 	rt.toPublish = append(rt.toPublish, func() { rt.dt.publishers.publish(prefix, action, key, toSend) })
 	return nil
 }
@@ -191,17 +212,26 @@ func (rt *RequestTracker) Create(obj models.Model) (saved bool, err error) {
 			Code:     http.StatusConflict,
 		}
 	}
+	if pm, ok := ref.(models.Paramer); ok {
+		if err := rt.validateParamWrites(ref, nil, pm.GetParams()); err != nil {
+			return false, err
+		}
+	}
 	ref.(validator).setRT(rt)
 	checker, checkOK := ref.(models.Validator)
 	if checkOK {
 		checker.ClearValidation()
 	}
+	restore := rt.nextVersion(ref)
 	saved, err = store.Create(backend, ref)
 	if saved {
 		ref.(validator).clearRT()
 		idx.Add(ref)
 
 		rt.Publish(prefix, "create", key, ref)
+		rt.auditChange("create", prefix, key, nil, ref)
+	} else {
+		restore()
 	}
 
 	return saved, err
@@ -223,6 +253,7 @@ func (rt *RequestTracker) Remove(obj models.Model) (removed bool, err error) {
 	if removed {
 		idx.Remove(item)
 		rt.Publish(prefix, "delete", key, item)
+		rt.auditChange("delete", prefix, key, item, nil)
 	}
 	return removed, err
 }
@@ -274,6 +305,11 @@ func (rt *RequestTracker) Patch(obj models.Model, key string, patch jsonpatch2.P
 	if ms, ok := toSave.(models.Filler); ok {
 		ms.Fill()
 	}
+	if pm, ok := toSave.(models.Paramer); ok {
+		if err := rt.validateParamWrites(toSave, ref.(models.Paramer).GetParams(), pm.GetParams()); err != nil {
+			return nil, err
+		}
+	}
 	toSave.(validator).setRT(rt)
 	checker, checkOK := toSave.(models.Validator)
 	if checkOK {
@@ -290,11 +326,15 @@ func (rt *RequestTracker) Patch(obj models.Model, key string, patch jsonpatch2.P
 			}
 		}
 	}
+	restore := rt.nextVersion(toSave)
 	saved, err := store.Update(backend, toSave)
 	toSave.(validator).clearRT()
 	if saved {
 		idx.Add(toSave)
 		rt.Publish(prefix, "update", key, toSave)
+		rt.auditChange("patch", prefix, key, target, toSave)
+	} else {
+		restore()
 	}
 	return toSave, err
 }
@@ -313,22 +353,31 @@ func (rt *RequestTracker) Update(obj models.Model) (saved bool, err error) {
 	if ms, ok := ref.(models.Filler); ok {
 		ms.Fill()
 	}
+	if pm, ok := ref.(models.Paramer); ok {
+		if err := rt.validateParamWrites(ref, target.(models.Paramer).GetParams(), pm.GetParams()); err != nil {
+			return false, err
+		}
+	}
 	ref.(validator).setRT(rt)
 	checker, checkOK := ref.(models.Validator)
 	if checkOK {
 		checker.ClearValidation()
 	}
+	restore := rt.nextVersion(ref)
 	saved, err = store.Update(backend, ref)
 	ref.(validator).clearRT()
 	if saved {
 		idx.Add(ref)
 		rt.Publish(prefix, "update", key, ref)
+		rt.auditChange("update", prefix, key, target, ref)
+	} else {
+		restore()
 	}
 	return saved, err
 }
 
 func (rt *RequestTracker) Save(obj models.Model) (saved bool, err error) {
-	_, prefix, key, idx, backend, ref, _ := rt.spkibrt(obj)
+	_, prefix, key, idx, backend, ref, old := rt.spkibrt(obj)
 	if ms, ok := ref.(models.Filler); ok {
 		ms.Fill()
 	}
@@ -337,49 +386,76 @@ func (rt *RequestTracker) Save(obj models.Model) (saved bool, err error) {
 	if checkOK {
 		checker.ClearValidation()
 	}
+	restore := rt.nextVersion(ref)
 	saved, err = store.Save(backend, ref)
 	ref.(validator).clearRT()
 	if saved {
 		idx.Add(ref)
 		rt.Publish(prefix, "save", key, ref)
+		rt.auditChange("save", prefix, key, old, ref)
+	} else {
+		restore()
 	}
 	return saved, err
 }
 
-func (rt *RequestTracker) GetParams(obj models.Paramer, aggregate bool) map[string]interface{} {
-	res := obj.GetParams()
-	if !aggregate {
-		return res
-	}
-	subObjs := []models.Paramer{}
+// paramSources returns obj followed by the objects it inherits params
+// from, in the order their params take precedence.  For a Machine that
+// is its Profiles, its Stage and the Profiles of the Stage, its
+// Workflow, its BootEnv, and then the global Profile.
+func (rt *RequestTracker) paramSources(obj models.Paramer) []models.Paramer {
+	res := []models.Paramer{obj}
 	var profiles []string
-	var stage string
+	var stage, workflow, bootenv string
 	switch ref := obj.(type) {
 	case *rMachine:
-		profiles, stage = ref.Profiles, ref.Stage
+		profiles, stage, workflow, bootenv = ref.Profiles, ref.Stage, ref.Workflow, ref.BootEnv
 	case *models.Machine:
-		profiles, stage = ref.Profiles, ref.Stage
+		profiles, stage, workflow, bootenv = ref.Profiles, ref.Stage, ref.Workflow, ref.BootEnv
 	case *Machine:
-		profiles, stage = ref.Profiles, ref.Stage
+		profiles, stage, workflow, bootenv = ref.Profiles, ref.Stage, ref.Workflow, ref.BootEnv
+	case *models.Stage:
+		profiles = ref.Profiles
+	case *Stage:
+		profiles = ref.Profiles
 	}
 	for _, pn := range profiles {
 		if pobj := rt.Find("profiles", pn); pobj != nil {
-			subObjs = append(subObjs, pobj.(models.Paramer))
+			res = append(res, pobj.(models.Paramer))
 		}
 	}
 	if stage != "" {
 		if sobj := rt.Find("stages", stage); sobj != nil {
+			res = append(res, sobj.(models.Paramer))
 			for _, pn := range AsStage(sobj).Profiles {
 				if pobj := rt.Find("profiles", pn); pobj != nil {
-					subObjs = append(subObjs, pobj.(models.Paramer))
+					res = append(res, pobj.(models.Paramer))
 				}
 			}
 		}
 	}
+	if workflow != "" {
+		if wobj := rt.Find("workflows", workflow); wobj != nil {
+			res = append(res, wobj.(models.Paramer))
+		}
+	}
+	if bootenv != "" {
+		if bobj := rt.Find("bootenvs", bootenv); bobj != nil {
+			res = append(res, bobj.(models.Paramer))
+		}
+	}
 	if pobj := rt.Find("profiles", rt.dt.GlobalProfileName); pobj != nil {
-		subObjs = append(subObjs, pobj.(models.Paramer))
+		res = append(res, pobj.(models.Paramer))
+	}
+	return res
+}
+
+func (rt *RequestTracker) GetParams(obj models.Paramer, aggregate bool) map[string]interface{} {
+	res := obj.GetParams()
+	if !aggregate {
+		return res
 	}
-	for _, sub := range subObjs {
+	for _, sub := range rt.paramSources(obj)[1:] {
 		subp := sub.GetParams()
 		for k, v := range subp {
 			if _, ok := res[k]; !ok {
@@ -390,7 +466,56 @@ func (rt *RequestTracker) GetParams(obj models.Paramer, aggregate bool) map[stri
 	return res
 }
 
+// ExplainParams returns, for each param GetParams would return for
+// obj, the value it has, the object that value came from, and the
+// values it overrides.  If aggregate is true, the default value of
+// the Param for each of them is included as the last value it
+// overrides.  Params that only have a default are not included.
+func (rt *RequestTracker) ExplainParams(obj models.Paramer, aggregate bool) map[string]*models.ExplainedParam {
+	res := map[string]*models.ExplainedParam{}
+	add := func(source, key string, val interface{}) {
+		ps := models.ParamSource{Source: source, Value: val}
+		if ep, ok := res[key]; ok {
+			ep.Shadowed = append(ep.Shadowed, ps)
+		} else {
+			res[key] = &models.ExplainedParam{ParamSource: ps, Shadowed: []models.ParamSource{}}
+		}
+	}
+	sources := []models.Paramer{obj}
+	if aggregate {
+		sources = rt.paramSources(obj)
+	}
+	seen := map[string]bool{}
+	for _, src := range sources {
+		source := src.Prefix() + ":" + src.Key()
+		// A profile can be reached more than once, but it can only
+		// provide a value once.
+		if seen[source] {
+			continue
+		}
+		seen[source] = true
+		for k, v := range src.GetParams() {
+			add(source, k, v)
+		}
+	}
+	if params := rt.d("params"); aggregate && params != nil {
+		for k := range res {
+			if item := params.Find(k); item != nil {
+				if v, ok := AsParam(item).DefaultValue(); ok {
+					add("params:"+k, k, v)
+				}
+			}
+		}
+	}
+	return res
+}
+
 func (rt *RequestTracker) SetParams(obj models.Paramer, values map[string]interface{}) error {
+	old := obj.GetParams()
+	values = keepRedacted(values, old)
+	if err := rt.validateParamWrites(obj, old, values); err != nil {
+		return err
+	}
 	obj.SetParams(values)
 	e := &models.Error{Code: 422, Type: ValidationError, Model: obj.Prefix(), Key: obj.Key()}
 	_, e2 := rt.Save(obj)
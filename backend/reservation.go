@@ -25,7 +25,7 @@ func (obj *Reservation) SetReadOnly(b bool) {
 func (obj *Reservation) SaveClean() store.KeySaver {
 	mod := *obj.Reservation
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (l *Reservation) Indexes() map[string]index.Maker {
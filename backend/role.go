@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/store"
+)
+
+// Role is a named set of Claims that can be assigned to Users.
+// swagger:model
+type Role struct {
+	*models.Role
+	validate
+}
+
+func (obj *Role) SetReadOnly(b bool) {
+	obj.ReadOnly = b
+}
+
+func (obj *Role) SaveClean() store.KeySaver {
+	mod := *obj.Role
+	mod.ClearValidation()
+	return keepVersion(toBackend(&mod, obj.rt), obj)
+}
+
+func (r *Role) Indexes() map[string]index.Maker {
+	fix := AsRole
+	res := index.MakeBaseIndexes(r)
+	res["Name"] = index.Make(
+		true,
+		"string",
+		func(i, j models.Model) bool { return fix(i).Name < fix(j).Name },
+		func(ref models.Model) (gte, gt index.Test) {
+			refName := fix(ref).Name
+			return func(s models.Model) bool {
+					return fix(s).Name >= refName
+				},
+				func(s models.Model) bool {
+					return fix(s).Name > refName
+				}
+		},
+		func(s string) (models.Model, error) {
+			role := fix(r.New())
+			role.Name = s
+			return role, nil
+		})
+	return res
+}
+
+func (r *Role) New() store.KeySaver {
+	res := &Role{Role: &models.Role{}}
+	if r.Role != nil && r.ChangeForced() {
+		res.ForceChange()
+	}
+	res.rt = r.rt
+	return res
+}
+
+func AsRole(o models.Model) *Role {
+	return o.(*Role)
+}
+
+func AsRoles(o []models.Model) []*Role {
+	res := make([]*Role, len(o))
+	for i := range o {
+		res[i] = AsRole(o[i])
+	}
+	return res
+}
+
+func (r *Role) Validate() {
+	r.Role.Validate()
+	r.AddError(index.CheckUnique(r, r.rt.stores("roles").Items()))
+	r.SetValid()
+	r.SetAvailable()
+}
+
+// checkClaims refuses Claims that allow more than whoever is making
+// the change.  Claims in old are already given, so they are not
+// checked again.
+func (r *Role) checkClaims(old []*Claim) error {
+	e := &models.Error{Code: http.StatusForbidden, Type: ValidationError, Model: r.Prefix(), Key: r.Key()}
+	for _, c := range r.Claims {
+		given := false
+		for _, o := range old {
+			if c != nil && o != nil && *c == *o {
+				given = true
+				break
+			}
+		}
+		if !given && c != nil && !r.rt.canGrant([]*Claim{c}) {
+			e.Errorf("Not allowed to give Claim %s %s %s, it allows more than the caller", c.Scope, c.Action, c.Specific)
+		}
+	}
+	return e.HasError()
+}
+
+func (r *Role) OnCreate() error {
+	return r.checkClaims(nil)
+}
+
+func (r *Role) OnChange(oldThing store.KeySaver) error {
+	return r.checkClaims(AsRole(oldThing).Claims)
+}
+
+func (r *Role) BeforeSave() error {
+	r.Validate()
+	if !r.Useable() {
+		return r.MakeError(422, ValidationError, r)
+	}
+	return nil
+}
+
+func (r *Role) OnLoad() error {
+	defer func() { r.rt = nil }()
+	r.Fill()
+	return r.BeforeSave()
+}
+
+func (r *Role) BeforeDelete() error {
+	e := &models.Error{Code: 422, Type: ValidationError, Model: r.Prefix(), Key: r.Key()}
+	for _, i := range r.rt.stores("users").Items() {
+		u := AsUser(i)
+		if u.HasRole(r.Name) {
+			e.Errorf("User %s is using role %s", u.Name, r.Name)
+		}
+	}
+	return e.HasError()
+}
+
+var roleLockMap = map[string][]string{
+	"get":     []string{"roles"},
+	"create":  []string{"roles"},
+	"update":  []string{"roles"},
+	"patch":   []string{"roles"},
+	"delete":  []string{"roles", "users"},
+	"actions": []string{"roles", "profiles", "params"},
+}
+
+func (r *Role) Locks(action string) []string {
+	return roleLockMap[action]
+}
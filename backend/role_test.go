@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+func TestRoleCrud(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "roles", "users")
+	readOnly := []*models.Claim{
+		{Scope: "*", Action: "get", Specific: "*"},
+		{Scope: "*", Action: "list", Specific: "*"},
+	}
+	tests := []crudTest{
+		{"Create empty role", rt.Create, &models.Role{}, false},
+		{"Create with bad role /", rt.Create, &models.Role{Name: "greg/asdg"}, false},
+		{"Create role with partial claim", rt.Create, &models.Role{Name: "partial", Claims: []*models.Claim{{Scope: "machines"}}}, false},
+		{"Create read only role", rt.Create, &models.Role{Name: "readonly", Claims: readOnly}, true},
+		{"Create Duplicate Role", rt.Create, &models.Role{Name: "readonly"}, false},
+		{"Create user with missing role", rt.Create, &models.User{Name: "barney", Roles: []string{"missing"}}, true},
+		{"Create user with read only role", rt.Create, &models.User{Name: "fred", Roles: []string{"readonly"}}, true},
+		{"Delete Role in use", rt.Remove, &models.Role{Name: "readonly"}, false},
+		{"Delete User", rt.Remove, &models.User{Name: "fred"}, true},
+		{"Delete Role", rt.Remove, &models.Role{Name: "readonly"}, true},
+		{"Delete Nonexistent Role", rt.Remove, &models.Role{Name: "readonly"}, false},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		if u := AsUser(rt.find("users", "barney")); u.Available {
+			t.Errorf("User with a missing role should not be available")
+		}
+	})
+}
+
+func claimsMatch(claims []*Claim, scope, action, specific string) bool {
+	return NewClaim("test", "test", 30).AddClaims(claims...).Match(scope, action, specific)
+}
+
+func TestUserRoleClaims(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "roles", "users")
+	rt.Do(func(d Stores) {
+		role := &models.Role{
+			Name:   "machine-reader",
+			Claims: []*models.Claim{{Scope: "machines", Action: "get", Specific: "*"}},
+		}
+		if _, err := rt.Create(role); err != nil {
+			t.Errorf("Unable to create role: %v", err)
+			return
+		}
+		def := &models.User{Name: "default"}
+		if _, err := rt.Create(def); err != nil {
+			t.Errorf("Unable to create default user: %v", err)
+			return
+		}
+		du := AsUser(rt.find("users", "default"))
+		if du.Roles == nil || len(du.Roles) != 0 || len(du.Claims(rt)) != 0 {
+			t.Errorf("User created without Roles should have no roles, not %v", du.Roles)
+		}
+		legacy := &User{User: &models.User{Name: "legacy"}, rt: rt}
+		if err := legacy.OnLoad(); err != nil {
+			t.Errorf("Unable to load legacy user: %v", err)
+			return
+		}
+		if !legacy.HasRole("superuser") {
+			t.Errorf("User stored without Roles should be loaded with the superuser role, not %v", legacy.Roles)
+		}
+		if !claimsMatch(legacy.Claims(rt), "users", "delete", "rocketskates") {
+			t.Errorf("Superuser claims should allow deleting users")
+		}
+		reader := &models.User{Name: "reader", Roles: []string{"machine-reader"}}
+		if _, err := rt.Create(reader); err != nil {
+			t.Errorf("Unable to create reader user: %v", err)
+			return
+		}
+		ru := AsUser(rt.find("users", "reader"))
+		claims := ru.Claims(rt)
+		if !claimsMatch(claims, "machines", "get", "fred") {
+			t.Errorf("Reader claims should allow getting machines")
+		}
+		if claimsMatch(claims, "machines", "delete", "fred") {
+			t.Errorf("Reader claims should not allow deleting machines")
+		}
+		if claimsMatch(claims, "users", "get", "reader") {
+			t.Errorf("Reader claims should not allow getting users")
+		}
+		none := &models.User{Name: "none", Roles: []string{}}
+		if _, err := rt.Create(none); err != nil {
+			t.Errorf("Unable to create user with no roles: %v", err)
+			return
+		}
+		if c := AsUser(rt.find("users", "none")).Claims(rt); len(c) != 0 {
+			t.Errorf("User with no roles should have no claims, not %v", c)
+		}
+	})
+}
+
+func TestRoleEscalation(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "roles", "users")
+	editor := []*models.Claim{
+		{Scope: "users", Action: "update", Specific: "fred"},
+		{Scope: "roles", Action: "update", Specific: "editor"},
+	}
+	everything := []*models.Claim{{Scope: "*", Action: "*", Specific: "*"}}
+	tests := []crudTest{
+		{"Create editor role", rt.Create, &models.Role{Name: "editor", Claims: editor}, true},
+		{"Create everything role", rt.Create, &models.Role{Name: "everything", Claims: everything}, true},
+		{"Create fred", rt.Create, &models.User{Name: "fred", Roles: []string{"editor"}}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	// fred can only hand out what fred is allowed to do.
+	fred := NewClaim("fred", "fred", 30).AddClaims(editor...)
+	frt := dt.Request(dt.Logger, "roles", "users").LimitTo(fred)
+	narrowed := append([]*models.Claim{}, editor...)
+	narrowed = append(narrowed, &models.Claim{Scope: "users", Action: "update", Specific: "fred", Filter: "Meta.color=blue"})
+	widened := append([]*models.Claim{}, editor...)
+	widened = append(widened, everything...)
+	tests = []crudTest{
+		{"Give fred the everything role", frt.Update, &models.User{Name: "fred", Roles: []string{"editor", "everything"}}, false},
+		{"Keep the roles fred has", frt.Update, &models.User{Name: "fred", Description: "changed", Roles: []string{"editor"}}, true},
+		{"Create a user with the everything role", frt.Create, &models.User{Name: "barney", Roles: []string{"everything"}}, false},
+		{"Add everything to the editor role", frt.Update, &models.Role{Name: "editor", Claims: widened}, false},
+		{"Add a narrower claim to the editor role", frt.Update, &models.Role{Name: "editor", Claims: narrowed}, true},
+		{"Create a role with everything", frt.Create, &models.Role{Name: "escalate", Claims: everything}, false},
+	}
+	for _, test := range tests {
+		test.Test(t, frt)
+	}
+	rt.Do(func(d Stores) {
+		if u := AsUser(rt.find("users", "fred")); u.HasRole("everything") {
+			t.Errorf("fred should not have been given the everything role")
+		}
+		if r := AsRole(rt.find("roles", "editor")); len(r.Claims) != 3 {
+			t.Errorf("Expected the editor role to have 3 claims, not %v", r.Claims)
+		}
+	})
+}
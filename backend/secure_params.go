@@ -0,0 +1,147 @@
+package backend
+
+import (
+	"encoding/json"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+func (p *DataTracker) secureKey() []byte {
+	return []byte(p.pref("secureParamSecret"))
+}
+
+// secureParams encrypts the plain values of secure params on obj, and
+// puts back the stored values of secure params that were sent back
+// redacted.  It must be called with params locked.
+func (rt *RequestTracker) secureParams(obj models.Paramer, e models.ErrorAdder) {
+	key := rt.dt.secureKey()
+	if len(key) == 0 {
+		// Prefs are not loaded until all the objects are, so there is
+		// nothing to do while the data is being loaded.
+		return
+	}
+	old := map[string]interface{}{}
+	if o := rt.find(obj.Prefix(), obj.Key()); o != nil && o != models.Model(obj) {
+		old = o.(models.Paramer).GetParams()
+	}
+	params := obj.GetParams()
+	changed := false
+	for k, v := range params {
+		if _, ok := models.AsSecureData(v); ok {
+			continue
+		}
+		pobj := rt.find("params", k)
+		if pobj == nil || !AsParam(pobj).Secure {
+			continue
+		}
+		if s, ok := v.(string); ok && s == models.RedactedValue {
+			ov, ok := old[k]
+			if !ok {
+				e.Errorf("Key '%s': no stored value to keep", k)
+				continue
+			}
+			if _, ok := models.AsSecureData(ov); ok {
+				params[k] = ov
+				changed = true
+				continue
+			}
+			v = ov
+		}
+		if err := AsParam(pobj).ValidateValue(v); err != nil {
+			e.Errorf("Key '%s': invalid val: %v", k, err)
+			continue
+		}
+		buf, err := json.Marshal(v)
+		if err != nil {
+			e.Errorf("Key '%s': %v", k, err)
+			continue
+		}
+		enc, err := encrypt(key, string(buf))
+		if err != nil {
+			e.Errorf("Key '%s': failed to encrypt: %v", k, err)
+			continue
+		}
+		params[k] = &models.SecureData{Secure: enc}
+		changed = true
+	}
+	if changed {
+		obj.SetParams(params)
+	}
+}
+
+// keepRedacted returns a copy of values in which the values of secure
+// params that were sent back redacted are replaced by the ones in
+// current.
+func keepRedacted(values, current map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range values {
+		if s, ok := v.(string); ok && s == models.RedactedValue {
+			if cv, ok := current[k]; ok {
+				if _, ok := models.AsSecureData(cv); ok {
+					v = cv
+				}
+			}
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// DecryptParam returns the plain value of v if v is the stored value
+// of a secure param, and v otherwise.
+func (p *DataTracker) DecryptParam(v interface{}) (interface{}, error) {
+	enc, ok := models.AsSecureData(v)
+	if !ok {
+		return v, nil
+	}
+	buf, err := decrypt(p.secureKey(), enc)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	return res, json.Unmarshal([]byte(buf), &res)
+}
+
+// RedactParams returns a copy of params with the values of secure
+// params replaced by models.RedactedValue, or by their plain values if
+// decrypt is true.
+func (p *DataTracker) RedactParams(params map[string]interface{}, decrypt bool) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range params {
+		res[k] = p.RedactParam(v, decrypt)
+	}
+	return res
+}
+
+// RedactParam redacts or decrypts a single param value the way
+// RedactParams does.
+func (p *DataTracker) RedactParam(v interface{}, decrypt bool) interface{} {
+	if _, ok := models.AsSecureData(v); !ok {
+		return v
+	}
+	if decrypt {
+		if plain, err := p.DecryptParam(v); err == nil {
+			return plain
+		}
+	}
+	return models.RedactedValue
+}
+
+// RedactModel returns m with the values of its secure params redacted
+// or decrypted the way RedactParams does.  If m has any, a copy of m
+// is returned instead of m itself.
+func (p *DataTracker) RedactModel(m models.Model, decrypt bool) models.Model {
+	pm, ok := m.(models.Paramer)
+	if !ok {
+		return m
+	}
+	params := pm.GetParams()
+	for _, v := range params {
+		if _, ok := models.AsSecureData(v); ok {
+			res := models.Clone(m).(models.Paramer)
+			res.SetParams(p.RedactParams(params, decrypt))
+			return res
+		}
+	}
+	return m
+}
@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestSecureParams(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "machines", "tasks", "profiles", "params", "workflows", "templates", "preferences", "plugins")
+	mUuid := uuid.NewRandom()
+	tests := []crudTest{
+		{"Create secure param", rt.Create, &models.Param{Name: "bmc-password", Secure: true, Schema: map[string]interface{}{"type": "string"}}, true},
+		{"Create secure template", rt.Create, &models.Template{ID: "secure", Contents: `{{.Param "bmc-password"}}`}, true},
+		{"Create Machine with bad secure param", rt.Create, &models.Machine{Uuid: mUuid, Name: "secure", Params: map[string]interface{}{"bmc-password": 1}}, false},
+		{"Create Machine", rt.Create, &models.Machine{Uuid: mUuid, Name: "secure", Params: map[string]interface{}{"bmc-password": "hunter2", "other": "plain"}}, true},
+		{"Create Profile", rt.Create, &models.Profile{Name: "secure", Params: map[string]interface{}{"bmc-password": "swordfish"}}, true},
+		{"Create Profile with forged secure data", rt.Create, &models.Profile{Name: "forged", Params: map[string]interface{}{"bmc-password": map[string]interface{}{"Secure": "junk"}}}, false},
+		{"Create Plugin", rt.Create, &models.Plugin{Name: "secure", Provider: "none", Params: map[string]interface{}{"bmc-password": "letmein"}}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var stored interface{}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", mUuid.String()))
+		stored = m.Params["bmc-password"]
+		if _, ok := models.AsSecureData(stored); !ok {
+			t.Errorf("Secure param was not encrypted: %#v", stored)
+		}
+		buf, _ := json.Marshal(m)
+		if strings.Contains(string(buf), "hunter2") {
+			t.Errorf("Secure param was stored in plain text: %s", string(buf))
+		}
+		if m.Params["other"] != "plain" {
+			t.Errorf("Other params should not be touched: %#v", m.Params["other"])
+		}
+		redacted := dt.RedactModel(m, false).(models.Paramer).GetParams()
+		if redacted["bmc-password"] != models.RedactedValue || redacted["other"] != "plain" {
+			t.Errorf("Unexpected redacted params: %#v", redacted)
+		}
+		if _, ok := models.AsSecureData(m.Params["bmc-password"]); !ok {
+			t.Errorf("Redacting params changed the stored machine")
+		}
+		decrypted := dt.RedactModel(m, true).(models.Paramer).GetParams()
+		if decrypted["bmc-password"] != "hunter2" {
+			t.Errorf("Unexpected decrypted params: %#v", decrypted)
+		}
+		p := AsProfile(rt.find("profiles", "secure"))
+		if v, _ := dt.DecryptParam(p.Params["bmc-password"]); v != "swordfish" {
+			t.Errorf("Profile param did not decrypt properly: %v", v)
+		}
+		pl := AsPlugin(rt.find("plugins", "secure"))
+		if v, _ := dt.DecryptParam(pl.Params["bmc-password"]); v != "letmein" || pl.Params["bmc-password"] == "letmein" {
+			t.Errorf("Plugin param was not encrypted: %#v", pl.Params["bmc-password"])
+		}
+		if err := rt.SetParams(m, map[string]interface{}{"bmc-password": map[string]interface{}{"Secure": "junk"}}); err == nil {
+			t.Errorf("Setting a forged encrypted value should have failed")
+		}
+		if err := rt.SetParams(m, map[string]interface{}{"bmc-password": models.RedactedValue}); err != nil {
+			t.Errorf("Unexpected error setting params: %v", err)
+		}
+		if v, _ := dt.DecryptParam(m.Params["bmc-password"]); v != "hunter2" {
+			t.Errorf("Sending a redacted value back should keep the stored one, not %v", v)
+		}
+	})
+	res, err := dt.RenderPreview(rt, &models.RenderRequest{Template: "secure", Machine: mUuid}, true)
+	if err != nil || len(res.Templates) != 1 || res.Templates[0].Content != "hunter2" {
+		t.Errorf("Secure param was not decrypted for templates: %#v, %v", res, err)
+	}
+	res, err = dt.RenderPreview(rt, &models.RenderRequest{Template: "secure", Machine: mUuid}, false)
+	if err != nil || len(res.Templates) != 1 || res.Templates[0].Content != models.RedactedValue {
+		t.Errorf("Secure param was not redacted in a preview without getSecure: %#v, %v", res, err)
+	}
+	if err := dt.SetPrefs(rt, map[string]string{"secureParamSecret": "0123456789abcdef0123456789abcdef"}); err == nil {
+		t.Errorf("Changing secureParamSecret should have failed")
+	}
+	buf, err := dt.Backup(false)
+	if err != nil || strings.Contains(string(buf), "hunter2") || !strings.Contains(string(buf), `"Secure"`) {
+		t.Errorf("Backup did not keep secure params encrypted: %v", err)
+	}
+	buf, err = dt.Backup(true)
+	if err != nil || !strings.Contains(string(buf), "hunter2") {
+		t.Errorf("Backup did not decrypt secure params: %v", err)
+	}
+}
@@ -29,7 +29,7 @@ func (obj *Stage) SetReadOnly(b bool) {
 func (obj *Stage) SaveClean() store.KeySaver {
 	mod := *obj.Stage
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (s *Stage) HasTask(ts string) bool {
@@ -152,6 +152,7 @@ func (s *Stage) Validate() {
 	s.RunnerWait = true
 	// We are syntactically valid, although we may not be useable.
 	s.renderers = renderers{}
+	s.rt.validateParamValues(s.Params, s)
 	// First, the stuff that must be correct in order for
 	for _, taskName := range s.Tasks {
 		if s.rt.find("tasks", taskName) == nil {
@@ -251,6 +252,7 @@ func (s *Stage) BeforeSave() error {
 	if s.Templates == nil {
 		s.Templates = []models.TemplateInfo{}
 	}
+	s.rt.secureParams(s, s)
 	s.Validate()
 	if !s.Validated {
 		return s.MakeError(422, ValidationError, s)
@@ -318,10 +320,10 @@ func (s *Stage) AfterSave() {
 }
 
 var stageLockMap = map[string][]string{
-	"get":     []string{"stages"},
-	"create":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
-	"update":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
-	"patch":   []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
+	"get":     []string{"stages", "profiles", "params"},
+	"create":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
+	"update":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
+	"patch":   []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
 	"delete":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
 	"actions": []string{"stages", "profiles", "params"},
 }
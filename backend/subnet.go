@@ -146,7 +146,7 @@ func (obj *Subnet) SetReadOnly(b bool) {
 func (obj *Subnet) SaveClean() store.KeySaver {
 	mod := *obj.Subnet
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (s *Subnet) Indexes() map[string]index.Maker {
@@ -26,7 +26,7 @@ func (obj *Task) SetReadOnly(b bool) {
 func (obj *Task) SaveClean() store.KeySaver {
 	mod := *obj.Task
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func AsTask(o models.Model) *Task {
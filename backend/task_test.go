@@ -28,6 +28,10 @@ func TestTaskCrud(t *testing.T) {
 		{"Create Task with invalid models.TemplateInfo (missing ID)", rt.Create, &models.Task{Name: "test 3", Templates: []models.TemplateInfo{{Name: "test 3", Path: "{{ .Env.Name }}"}}}, false},
 		{"Create Task with invalid models.TemplateInfo (invalid ID)", rt.Create, &models.Task{Name: "test 3", Templates: []models.TemplateInfo{{Name: "test 3", Path: "{{ .Env.Name }}", ID: "okp"}}}, false},
 		{"Create Task with invalid models.TemplateInfo (invalid Path)", rt.Create, &models.Task{Name: "test 3", Templates: []models.TemplateInfo{{Name: "test 3", Path: "{{ .Env.Name }", ID: "ok"}}}, false},
+		{"Create Task with invalid models.TemplateInfo (unknown Interpreter)", rt.Create, &models.Task{Name: "test 3", Templates: []models.TemplateInfo{{Name: "test 3", ID: "ok", Interpreter: "perl"}}}, false},
+		{"Create Task with invalid models.TemplateInfo (download with Path)", rt.Create, &models.Task{Name: "test 3", Templates: []models.TemplateInfo{{Name: "test 3", Path: "{{ .Env.Name }}", ID: "ok", Interpreter: "download"}}}, false},
+		{"Create Task with invalid models.TemplateInfo (render without Path)", rt.Create, &models.Task{Name: "test 3", Templates: []models.TemplateInfo{{Name: "test 3", ID: "ok", Interpreter: "render"}}}, false},
+		{"Create Task with invalid Sandbox", rt.Create, &models.Task{Name: "test 3", Sandbox: &models.TaskSandbox{MemoryMB: -1, Env: []string{"BAD=NAME"}}}, false},
 		{"Create Task with valid models.TemplateInfo (not available}", rt.Create, &models.Task{Name: "test 3", Templates: []models.TemplateInfo{{Name: "unavailable", Path: "{{ .Env.Name }}", ID: "ok"}}}, true},
 		{"Create Task with valid models.TemplateInfo (available)", rt.Create, &models.Task{Name: "available", Templates: []models.TemplateInfo{{Name: "ipxe", Path: "{{ .Env.Name }}", ID: "ok"}}}, true},
 	}
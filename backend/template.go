@@ -27,7 +27,7 @@ func (obj *Template) SetReadOnly(b bool) {
 func (obj *Template) SaveClean() store.KeySaver {
 	mod := *obj.Template
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (p *Template) Indexes() map[string]index.Maker {
@@ -107,7 +107,7 @@ func (t *Template) Validate() {
 	t.rt.dt.tmplMux.Lock()
 	root := t.rt.dt.rootTemplate
 	if root == nil {
-		root = template.New("")
+		root = models.NewTemplate("")
 	} else {
 		root, err = root.Clone()
 	}
@@ -176,7 +176,7 @@ func (t *Template) BeforeDelete() error {
 		}
 		fmt.Fprintf(buf, `{{define "%s"}}%s{{end}}\n`, tmpl.ID, tmpl.Contents)
 	}
-	root, err := template.New("").Parse(buf.String())
+	root, err := models.NewTemplate("").Parse(buf.String())
 	if err != nil {
 		e.Errorf("Template %s still required: %v", t.ID, err)
 		return e
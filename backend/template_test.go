@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/digitalrebar/provision/models"
@@ -47,3 +48,22 @@ func TestTemplateCrud(t *testing.T) {
 		}
 	})
 }
+
+func TestTemplateFuncs(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "templates", "bootenvs", "tasks", "machines")
+	crudTest{"Create Template with unknown function", rt.Create, &models.Template{ID: "bad", Contents: `{{ notAFunction "a" }}`}, false}.Test(t, rt)
+	crudTest{"Create Template using functions", rt.Create, &models.Template{ID: "funcs",
+		Contents: `{{ "" | default "fred" | upper }} {{ cidrHost 10 "192.168.124.0/24" }} {{ cidrNetmask "192.168.124.0/24" }} {{ join "," (list "a" "b") }} {{ sha512crypt "Hello world!" "saltstring" }}`}, true}.Test(t, rt)
+	buf := &bytes.Buffer{}
+	dt.tmplMux.Lock()
+	err := dt.rootTemplate.ExecuteTemplate(buf, "funcs", nil)
+	dt.tmplMux.Unlock()
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	expect := "FRED 192.168.124.10 255.255.255.0 a,b $6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+	if buf.String() != expect {
+		t.Errorf("Expected %q, not %q", expect, buf.String())
+	}
+}
@@ -0,0 +1,221 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// TokenRegistry remembers the tokens that were issued while the
+// tokenRegistry preference was on, so that they can be listed and
+// revoked one at a time.  Each record is kept in its own file until
+// the token expires, and revoked tokens are refused by GetToken until
+// then.  Records are kept in the log root, next to the job logs.
+type TokenRegistry struct {
+	dir     string
+	mux     *sync.Mutex
+	records map[string]*models.TokenRecord
+}
+
+func tokenNotFound(id string) error {
+	return &models.Error{
+		Code:     http.StatusNotFound,
+		Type:     "GET",
+		Model:    "tokens",
+		Key:      id,
+		Messages: []string{fmt.Sprintf("Token %s not found", id)},
+	}
+}
+
+// NewTokenRegistry loads the records in dir, dropping the ones for
+// tokens that have expired.
+func NewTokenRegistry(dir string) *TokenRegistry {
+	r := &TokenRegistry{
+		dir:     dir,
+		mux:     &sync.Mutex{},
+		records: map[string]*models.TokenRecord{},
+	}
+	ents, _ := ioutil.ReadDir(dir)
+	for _, ent := range ents {
+		if !ent.Mode().IsRegular() || !strings.HasSuffix(ent.Name(), ".json") {
+			continue
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(dir, ent.Name()))
+		if err != nil {
+			continue
+		}
+		rec := &models.TokenRecord{}
+		if json.Unmarshal(buf, rec) != nil || rec.Id+".json" != ent.Name() {
+			continue
+		}
+		r.records[rec.Id] = rec
+	}
+	r.prune(time.Now())
+	return r
+}
+
+func (r *TokenRegistry) path(id string) string {
+	return filepath.Join(r.dir, id+".json")
+}
+
+// save must be called with r.mux held.
+func (r *TokenRegistry) save(rec *models.TokenRecord) error {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return err
+	}
+	tmp := r.path(rec.Id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path(rec.Id))
+}
+
+// prune drops the records of tokens that have expired.  It must be
+// called with r.mux held.
+func (r *TokenRegistry) prune(now time.Time) {
+	for id, rec := range r.records {
+		if now.After(rec.ExpiresAt) {
+			os.Remove(r.path(id))
+			delete(r.records, id)
+		}
+	}
+}
+
+func tokenRecord(claims *DrpCustomClaims, issuedTo string) *models.TokenRecord {
+	rec := &models.TokenRecord{
+		Id:        claims.TokenId,
+		User:      claims.UserId(),
+		Grantor:   claims.GrantorId(),
+		Machine:   claims.MachineUuid(),
+		Claims:    make([]*models.Claim, len(claims.DrpClaims)),
+		IssuedAt:  time.Unix(claims.IssuedAt, 0),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		IssuedTo:  issuedTo,
+	}
+	for i := range claims.DrpClaims {
+		c := claims.DrpClaims[i]
+		rec.Claims[i] = &c
+	}
+	return rec
+}
+
+// Record remembers claims, which were issued to the client at
+// issuedTo.
+func (r *TokenRegistry) Record(claims *DrpCustomClaims, issuedTo string) error {
+	if claims.TokenId == "" {
+		return fmt.Errorf("token has no ID")
+	}
+	rec := tokenRecord(claims, issuedTo)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.prune(time.Now())
+	if err := r.save(rec); err != nil {
+		return err
+	}
+	r.records[rec.Id] = rec
+	return nil
+}
+
+// List returns copies of the records of the unexpired tokens for
+// user, or of all of them if user is empty, oldest first.
+func (r *TokenRegistry) List(user string) []*models.TokenRecord {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.prune(time.Now())
+	res := []*models.TokenRecord{}
+	for _, rec := range r.records {
+		if user == "" || rec.User == user {
+			c := *rec
+			res = append(res, &c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].IssuedAt.Equal(res[j].IssuedAt) {
+			return res[i].IssuedAt.Before(res[j].IssuedAt)
+		}
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
+
+// Get returns a copy of the record of the token with id.
+func (r *TokenRegistry) Get(id string) (*models.TokenRecord, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	rec, ok := r.records[id]
+	if !ok || time.Now().After(rec.ExpiresAt) {
+		return nil, tokenNotFound(id)
+	}
+	c := *rec
+	return &c, nil
+}
+
+// Describe returns the record of the token with claims, or what is
+// known about it from claims if it was not recorded.
+func (r *TokenRegistry) Describe(claims *DrpCustomClaims) *models.TokenRecord {
+	if rec, err := r.Get(claims.TokenId); err == nil {
+		return rec
+	}
+	return tokenRecord(claims, "")
+}
+
+// Revoke marks the token with id as revoked by user, so that GetToken
+// refuses it from now on.
+func (r *TokenRegistry) Revoke(id, by string) (*models.TokenRecord, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	rec, ok := r.records[id]
+	if !ok || time.Now().After(rec.ExpiresAt) {
+		return nil, tokenNotFound(id)
+	}
+	if !rec.Revoked {
+		c := *rec
+		c.Revoked, c.RevokedAt, c.RevokedBy = true, time.Now(), by
+		if err := r.save(&c); err != nil {
+			return nil, err
+		}
+		rec = &c
+		r.records[id] = rec
+	}
+	c := *rec
+	return &c, nil
+}
+
+// Revoked tests whether the token with id was revoked.
+func (r *TokenRegistry) Revoked(id string) bool {
+	if id == "" {
+		return false
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	rec, ok := r.records[id]
+	return ok && rec.Revoked
+}
+
+// Tokens returns the token registry.
+func (p *DataTracker) Tokens() *TokenRegistry {
+	return p.tokens
+}
+
+// RecordToken adds claims to the token registry if the tokenRegistry
+// preference is on.
+func (p *DataTracker) RecordToken(claims *DrpCustomClaims, issuedTo string) error {
+	if on, _ := strconv.ParseBool(p.pref("tokenRegistry")); !on {
+		return nil
+	}
+	return p.tokens.Record(claims, issuedTo)
+}
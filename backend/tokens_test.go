@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenRegistry(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "preferences", "bootenvs", "stages", "workflows")
+	issue := func(user string, ttl time.Duration) (*DrpCustomClaims, string) {
+		claims := NewClaim(user, user, ttl).Add("machines", "get", "*")
+		tok, err := dt.SealClaims(claims)
+		if err != nil {
+			t.Fatalf("Unable to seal token for %s: %v", user, err)
+		}
+		if err := dt.RecordToken(claims, "192.168.124.10"); err != nil {
+			t.Fatalf("Unable to record token for %s: %v", user, err)
+		}
+		return claims, tok
+	}
+
+	issue("registry-off", time.Hour)
+	if l := dt.Tokens().List("registry-off"); len(l) != 0 {
+		t.Errorf("Tokens should not be recorded with tokenRegistry off, got %d", len(l))
+	}
+	rt.Do(func(d Stores) {
+		if err := dt.SetPrefs(rt, map[string]string{"tokenRegistry": "true"}); err != nil {
+			t.Fatalf("Unable to turn on tokenRegistry: %v", err)
+		}
+	})
+
+	ci, ciTok := issue("registry-ci", time.Hour)
+	_, opTok := issue("registry-op", time.Hour)
+	issue("registry-ci", -time.Second)
+	l := dt.Tokens().List("registry-ci")
+	if len(l) != 1 || l[0].Id != ci.TokenId {
+		t.Fatalf("Expected only the unexpired token of registry-ci, got %v", l)
+	}
+	if l[0].IssuedTo != "192.168.124.10" || len(l[0].Claims) != 1 || l[0].Claims[0].Scope != "machines" {
+		t.Errorf("Token record is missing details: %#v", l[0])
+	}
+
+	rec, err := dt.Tokens().Revoke(ci.TokenId, "rocketskates")
+	if err != nil || !rec.Revoked || rec.RevokedBy != "rocketskates" {
+		t.Fatalf("Unable to revoke token: %v %#v", err, rec)
+	}
+	if _, err := dt.GetToken(ciTok); err == nil {
+		t.Errorf("A revoked token should be refused")
+	}
+	if _, err := dt.GetToken(opTok); err != nil {
+		t.Errorf("Other tokens should still work: %v", err)
+	}
+	if _, err := dt.Tokens().Revoke("no-such-token", "rocketskates"); err == nil {
+		t.Errorf("Revoking an unknown token should fail")
+	}
+
+	// Revocations survive a restart.
+	reloaded := NewTokenRegistry(filepath.Join(tmpDir, "tokens"))
+	if !reloaded.Revoked(ci.TokenId) {
+		t.Errorf("Revocation should have been reloaded")
+	}
+	if l := reloaded.List("registry-op"); len(l) != 1 || l[0].Revoked {
+		t.Errorf("Expected one unrevoked token for registry-op, got %v", l)
+	}
+
+	unrecorded := NewClaim("registry-anon", "registry-anon", time.Hour)
+	if rec := dt.Tokens().Describe(unrecorded); rec.Id != unrecorded.TokenId || rec.User != "registry-anon" {
+		t.Errorf("Describe should fall back to the claims: %#v", rec)
+	}
+}
@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// TOTP codes follow RFC 6238 with the parameters that authenticator
+// apps assume: HMAC-SHA1, 30 second steps, and 6 digits.  A code for
+// the step before or after the current one is accepted as well, to
+// allow for clock skew.
+const (
+	totpStep   = 30
+	totpDigits = 6
+	totpSkew   = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode returns the one-time code for key at time step step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	h := hmac.New(sha1.New, key)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+	off := sum[len(sum)-1] & 0xf
+	val := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, val%1000000)
+}
+
+// totpMatch returns the time step near now that code is valid for
+// with secret, or -1 if there is none.
+func totpMatch(secret, code string, now time.Time) int64 {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.Replace(secret, " ", "", -1)))
+	if err != nil || len(key) == 0 || len(code) != totpDigits {
+		return -1
+	}
+	step := now.Unix() / totpStep
+	for i := step - totpSkew; i <= step+totpSkew; i++ {
+		if hmac.Equal([]byte(totpCode(key, i)), []byte(code)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckTotp tests code against the TOTP secret of user.  Each code
+// can only be used once.
+func (p *DataTracker) CheckTotp(user *User, code string) bool {
+	step := totpMatch(user.TotpSecret, code, time.Now())
+	return step >= 0 && p.logins.useTotpStep(user.Name, step)
+}
+
+// StartTotp gives the user a new TOTP secret.  TOTP stays disabled
+// until the user confirms it with ConfirmTotp, and any TOTP the user
+// already had is disabled.
+func (u *User) StartTotp(rt *RequestTracker) (*models.UserTotp, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	u.TotpSecret = totpEncoding.EncodeToString(key)
+	u.TotpEnabled = false
+	if _, err := rt.Save(u); err != nil {
+		return nil, err
+	}
+	vals := url.Values{}
+	vals.Set("secret", u.TotpSecret)
+	vals.Set("issuer", "dr-provision")
+	return &models.UserTotp{
+		Secret: u.TotpSecret,
+		Url:    "otpauth://totp/dr-provision:" + url.PathEscape(u.Name) + "?" + vals.Encode(),
+	}, nil
+}
+
+// ConfirmTotp enables TOTP for the user if code is valid for the
+// secret that StartTotp made.
+func (u *User) ConfirmTotp(rt *RequestTracker, code string) error {
+	if u.TotpSecret == "" {
+		return fmt.Errorf("TOTP enrolment has not been started for %s", u.Name)
+	}
+	if !rt.dt.CheckTotp(u, code) {
+		return fmt.Errorf("Invalid TOTP code for %s", u.Name)
+	}
+	u.TotpEnabled = true
+	_, err := rt.Save(u)
+	return err
+}
+
+// DisableTotp disables TOTP for the user and forgets its secret.
+func (u *User) DisableTotp(rt *RequestTracker) error {
+	u.TotpSecret = ""
+	u.TotpEnabled = false
+	_, err := rt.Save(u)
+	return err
+}
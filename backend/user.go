@@ -1,6 +1,14 @@
 package backend
 
 import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/digitalrebar/provision/backend/index"
 	"github.com/digitalrebar/provision/models"
 	"github.com/digitalrebar/store"
@@ -21,7 +29,7 @@ func (obj *User) SetReadOnly(b bool) {
 func (obj *User) SaveClean() store.KeySaver {
 	mod := *obj.User
 	mod.ClearValidation()
-	return toBackend(&mod, obj.rt)
+	return keepVersion(toBackend(&mod, obj.rt), obj)
 }
 
 func (p *User) Indexes() map[string]index.Maker {
@@ -69,11 +77,70 @@ func AsUsers(o []models.Model) []*User {
 	return res
 }
 
-func (u *User) ChangePassword(rt *RequestTracker, newPass string) error {
+// passwordClasses returns how many of lower case letters, upper
+// case letters, digits, and other characters pass has.
+func passwordClasses(pass string) int {
+	var lower, upper, digit, other int
+	for _, r := range pass {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// CheckPasswordPolicy tests newPass against the passwordMinLength,
+// passwordMinClasses, and passwordHistory preferences.  A password
+// that was used recently cannot be reused, and neither can the
+// current one.
+func (u *User) CheckPasswordPolicy(rt *RequestTracker, newPass string) error {
+	err := &models.Error{
+		Model: u.Prefix(),
+		Key:   u.Key(),
+		Type:  ValidationError,
+		Code:  http.StatusBadRequest,
+	}
+	if min := rt.dt.prefInt("passwordMinLength"); utf8.RuneCountInString(newPass) < min {
+		err.Errorf("Password must be at least %d characters long", min)
+	}
+	if min := rt.dt.prefInt("passwordMinClasses"); passwordClasses(newPass) < min {
+		err.Errorf("Password must have at least %d of lower case letters, upper case letters, digits, and other characters", min)
+	}
+	if keep := rt.dt.prefInt("passwordHistory"); keep > 0 {
+		old := append([][]byte{u.PasswordHash}, u.PasswordHistory...)
+		if len(old) > keep {
+			old = old[:keep]
+		}
+		for _, hash := range old {
+			if len(hash) != 0 && sc.CompareHashAndPassword(hash, []byte(newPass)) == nil {
+				err.Errorf("Password must not be one of the last %d passwords", keep)
+				break
+			}
+		}
+	}
+	return err.HasError()
+}
+
+// setPassword changes the password of the user without checking it
+// against the password policy.
+func (u *User) setPassword(rt *RequestTracker, newPass string) error {
 	ph, err := sc.GenerateFromPassword([]byte(newPass), sc.DefaultParams)
 	if err != nil {
 		return err
 	}
+	if keep := rt.dt.prefInt("passwordHistory"); keep > 0 && len(u.PasswordHash) != 0 {
+		u.PasswordHistory = append([][]byte{u.PasswordHash}, u.PasswordHistory...)
+		if len(u.PasswordHistory) > keep {
+			u.PasswordHistory = u.PasswordHistory[:keep]
+		}
+	}
 	u.PasswordHash = ph
 	_, err = rt.Save(u)
 	// When a user changes their password, invalidate any previous cached auth tokens.
@@ -81,17 +148,109 @@ func (u *User) ChangePassword(rt *RequestTracker, newPass string) error {
 	return err
 }
 
+// ChangePassword changes the password of the user if it meets the
+// password policy.
+func (u *User) ChangePassword(rt *RequestTracker, newPass string) error {
+	if err := u.CheckPasswordPolicy(rt, newPass); err != nil {
+		return err
+	}
+	return u.setPassword(rt, newPass)
+}
+
+// HasRole returns true if role is one of the Roles of the user.
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims returns the Claims of all the Roles of the user.  Roles that
+// do not exist are skipped.  It must be called with roles locked.
+func (u *User) Claims(rt *RequestTracker) []*Claim {
+	res := []*Claim{}
+	for _, name := range u.Roles {
+		if r := rt.find("roles", name); r != nil {
+			res = append(res, AsRole(r).Claims...)
+		}
+	}
+	return res
+}
+
+// checkRoles refuses Roles that would give the User claims that
+// whoever is making the change does not have.  Roles in old are
+// already given, so they are not checked again.  It must be called
+// with roles locked.
+func (u *User) checkRoles(old []string) error {
+	e := &models.Error{Code: http.StatusForbidden, Type: ValidationError, Model: u.Prefix(), Key: u.Key()}
+	for _, name := range u.Roles {
+		given := false
+		for _, o := range old {
+			if o == name {
+				given = true
+				break
+			}
+		}
+		if given {
+			continue
+		}
+		if r := u.rt.find("roles", name); r != nil && !u.rt.canGrant(AsRole(r).Claims) {
+			e.Errorf("Not allowed to give Role %s, it allows more than the caller", name)
+		}
+	}
+	return e.HasError()
+}
+
 func (u *User) Validate() {
 	u.User.Validate()
 	u.AddError(index.CheckUnique(u, u.rt.stores("users").Items()))
-	u.SetValid()
+	for _, k := range u.ApiKeys {
+		if k != nil && len(k.KeyHash) == 0 {
+			u.Errorf("ApiKey %s has no key, create it through the apikeys API", k.Name)
+		}
+	}
+	if u.TotpEnabled && u.TotpSecret == "" {
+		u.Errorf("TOTP cannot be enabled without a secret, enrol through the totp API")
+	}
+	if !u.SetValid() {
+		return
+	}
+	for _, r := range u.Roles {
+		if u.rt.find("roles", r) == nil {
+			u.Errorf("Role %s does not exist", r)
+		}
+	}
 	u.SetAvailable()
 }
 
+// keepSecrets copies the password history and the TOTP secret of the
+// stored version of the User when they are missing, since they are
+// removed from everything the API returns.  The TOTP secret is only
+// kept while TOTP stays enabled, so that disabling it forgets it.
+func (u *User) keepSecrets() {
+	obj := u.rt.find("users", u.Name)
+	if obj == nil {
+		return
+	}
+	stored := AsUser(obj)
+	if len(u.PasswordHistory) == 0 {
+		u.PasswordHistory = stored.PasswordHistory
+	}
+	if u.TotpSecret == "" && u.TotpEnabled && stored.TotpEnabled {
+		u.TotpSecret = stored.TotpSecret
+	}
+}
+
 func (u *User) BeforeSave() error {
 	if u.Secret == "" {
 		u.Secret = randString(16)
 	}
+	if u.Roles == nil {
+		u.Roles = []string{}
+	}
+	u.keepSecrets()
 	u.Validate()
 	if !u.Useable() {
 		return u.MakeError(422, ValidationError, u)
@@ -108,6 +267,13 @@ func (u *User) OnLoad() error {
 	if u.Secret == "" {
 		mustSave = true
 	}
+	// Users saved before Roles existed could do everything, so they
+	// keep doing so.  Users saved since always have Roles, even if
+	// it is empty.
+	if u.Roles == nil {
+		u.Roles = []string{"superuser"}
+		mustSave = true
+	}
 	err := u.BeforeSave()
 	if err == nil && mustSave {
 		v := u.SaveValidation()
@@ -119,10 +285,10 @@ func (u *User) OnLoad() error {
 }
 
 var userLockMap = map[string][]string{
-	"get":     []string{"users"},
-	"create":  []string{"users"},
-	"update":  []string{"users"},
-	"patch":   []string{"users"},
+	"get":     []string{"users", "roles"},
+	"create":  []string{"users", "roles"},
+	"update":  []string{"users", "roles"},
+	"patch":   []string{"users", "roles"},
 	"delete":  []string{"users"},
 	"actions": []string{"users", "profiles", "params"},
 }
@@ -130,3 +296,66 @@ var userLockMap = map[string][]string{
 func (u *User) Locks(action string) []string {
 	return userLockMap[action]
 }
+
+// AuthSourceMeta is the Meta key that marks Users that were created
+// by an external authentication source, like LDAP or OpenID Connect.
+const AuthSourceMeta = "auth-source"
+
+// mapGroupRoles returns the Roles that mapping gives to groups.
+// Group names are compared without regard to case.
+func mapGroupRoles(mapping map[string][]string, groups []string) []string {
+	seen := map[string]struct{}{}
+	res := []string{}
+	for _, group := range groups {
+		for name, roles := range mapping {
+			if !strings.EqualFold(name, group) {
+				continue
+			}
+			for _, role := range roles {
+				if _, ok := seen[role]; !ok {
+					seen[role] = struct{}{}
+					res = append(res, role)
+				}
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// saveExternalUser creates or updates the User for username that was
+// authenticated by source, and gives it roles.  Users that were not
+// created by source cannot log in through it, so that an external
+// account cannot take over a local admin.  rt must be able to lock
+// users and roles, and must not be locked.
+func saveExternalUser(rt *RequestTracker, source, username string, roles []string) (res *User, err error) {
+	rt.Do(func(d Stores) {
+		if obj := rt.Find("users", username); obj != nil {
+			u := AsUser(obj)
+			if u.Meta[AuthSourceMeta] != source {
+				err = fmt.Errorf("%s is not a %s user", username, source)
+				return
+			}
+			if !reflect.DeepEqual(u.Roles, roles) {
+				u.Roles = roles
+				if _, err = rt.Update(u); err != nil {
+					return
+				}
+			}
+			res = u
+			return
+		}
+		u := &models.User{
+			Name:  username,
+			Roles: roles,
+			Meta:  models.Meta{AuthSourceMeta: source},
+		}
+		if _, err = rt.Create(u); err != nil {
+			return
+		}
+		if obj := rt.Find("users", username); obj != nil {
+			res = AsUser(obj)
+		}
+	})
+	return
+}
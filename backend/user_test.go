@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/digitalrebar/provision/models"
+	sc "github.com/elithrar/simple-scrypt"
 )
 
 func TestUserCrud(t *testing.T) {
@@ -82,3 +83,45 @@ func TestUserPassword(t *testing.T) {
 		}
 	})
 }
+
+func TestUserPasswordHashFixed(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "users", "roles")
+	forged, err := sc.GenerateFromPassword([]byte("forged"), sc.DefaultParams)
+	if err != nil {
+		t.Fatalf("Unable to hash forged password: %v", err)
+	}
+	tests := []crudTest{
+		{"Create user with PasswordHash", rt.Create, &models.User{Name: "forger", PasswordHash: forged}, false},
+		{"Create user without PasswordHash", rt.Create, &models.User{Name: "honest"}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var changed *models.User
+	rt.Do(func(d Stores) {
+		u := AsUser(rt.Find("users", "honest"))
+		if err := u.ChangePassword(rt, "password"); err != nil {
+			t.Errorf("Unable to set password: %v", err)
+		}
+		changed = models.Clone(u.User).(*models.User)
+	})
+	changed.PasswordHash = forged
+	changed.PasswordHistory = nil
+	changed.Description = "changed"
+	tests = []crudTest{
+		{"Update user with PasswordHash", rt.Update, changed, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		u := AsUser(rt.Find("users", "honest"))
+		if u.Description != "changed" {
+			t.Errorf("Update did not change Description")
+		}
+		if u.CheckPassword("forged") || !u.CheckPassword("password") {
+			t.Errorf("Update should not have changed the password")
+		}
+	})
+}
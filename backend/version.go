@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/store"
+)
+
+// Every object has a resource version that increases each time it is
+// saved through a RequestTracker.  The version is saved with the
+// object, so it survives restarts.  Versions come from a clock that
+// starts at the time the DataTracker was created, in nanoseconds, or
+// just past the newest saved version if that is later.  Objects that
+// have never been saved with a version have the version their Store
+// was loaded at.
+
+type versionClock struct {
+	mux  *sync.Mutex
+	last uint64
+}
+
+func newVersionClock() *versionClock {
+	return &versionClock{mux: &sync.Mutex{}, last: uint64(time.Now().UnixNano())}
+}
+
+func (v *versionClock) next() uint64 {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.last++
+	return v.last
+}
+
+// seen makes sure the clock never hands out version again.
+func (v *versionClock) seen(version uint64) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	if version > v.last {
+		v.last = version
+	}
+}
+
+type versioner interface {
+	resourceVersion() uint64
+	setResourceVersion(uint64)
+}
+
+func (v *validate) resourceVersion() uint64 {
+	return v.ResourceVersion
+}
+
+func (v *validate) setResourceVersion(version uint64) {
+	v.ResourceVersion = version
+}
+
+// nextVersion gives ref the next resource version.  If ref is not
+// saved, the caller must call the returned func to put the old
+// version back.
+func (rt *RequestTracker) nextVersion(ref store.KeySaver) func() {
+	v := ref.(versioner)
+	old := v.resourceVersion()
+	v.setResourceVersion(rt.dt.versions.next())
+	return func() { v.setResourceVersion(old) }
+}
+
+// keepVersion copies the resource version of obj to res, the clean
+// copy of obj that SaveClean returns, so that it is saved with it.
+func keepVersion(res store.KeySaver, obj versioner) store.KeySaver {
+	res.(versioner).setResourceVersion(obj.resourceVersion())
+	return res
+}
+
+func (s *Store) version(key string) uint64 {
+	if obj := s.Find(key); obj != nil {
+		if v := obj.(versioner).resourceVersion(); v != 0 {
+			return v
+		}
+	}
+	return s.loadedAt
+}
+
+// Version returns the resource version of the object of type prefix
+// with key.  rt must have prefix locked.
+func (rt *RequestTracker) Version(prefix, key string) uint64 {
+	return rt.d(prefix).version(key)
+}
+
+// ETag returns version as an HTTP entity tag.
+func ETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
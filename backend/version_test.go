@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/store"
+)
+
+func TestResourceVersions(t *testing.T) {
+	bs, _ := store.Open("memory:///")
+	dt := mkDT(bs)
+	rt := dt.Request(dt.Logger, "stages", "profiles", "machines", "tasks", "params")
+	var loaded, created, saved uint64
+	rt.Do(func(d Stores) {
+		loaded = rt.Version("profiles", "version-test")
+		if _, err := rt.Create(&models.Profile{Name: "version-test"}); err != nil {
+			t.Fatalf("Unable to create version-test: %v", err)
+		}
+		created = rt.Version("profiles", "version-test")
+		if created <= loaded {
+			t.Errorf("Creating should give a newer version than %d, got %d", loaded, created)
+		}
+		p := AsProfile(rt.Find("profiles", "version-test"))
+		p.Description = "changed"
+		if _, err := rt.Save(p); err != nil {
+			t.Fatalf("Unable to save version-test: %v", err)
+		}
+		saved = rt.Version("profiles", "version-test")
+		if saved <= created {
+			t.Errorf("Saving should give a newer version than %d, got %d", created, saved)
+		}
+		if ETag(saved) == ETag(created) {
+			t.Errorf("Different versions should have different ETags")
+		}
+	})
+	// Versions are saved with the objects, and a DataTracker that
+	// loads them never hands out an older one.
+	later := mkDT(bs)
+	lrt := later.Request(later.Logger, "profiles")
+	lrt.Do(func(d Stores) {
+		if v := lrt.Version("profiles", "version-test"); v != saved {
+			t.Errorf("version-test should still have version %d after a reload, got %d", saved, v)
+		}
+		if v := lrt.Version("profiles", "version-missing"); v <= saved {
+			t.Errorf("Versions should keep increasing across loads, got %d after %d", v, saved)
+		}
+	})
+	rt.Do(func(d Stores) {
+		if _, err := rt.Remove(rt.Find("profiles", "version-test")); err != nil {
+			t.Fatalf("Unable to remove version-test: %v", err)
+		}
+		if v := rt.Version("profiles", "version-test"); v != loaded {
+			t.Errorf("A removed profile should not keep its version, got %d", v)
+		}
+	})
+}
@@ -18,7 +18,7 @@ func (w *Workflow) SetReadOnly(b bool) {
 func (w *Workflow) SaveClean() store.KeySaver {
 	mod := *w.Workflow
 	mod.ClearValidation()
-	return toBackend(&mod, w.rt)
+	return keepVersion(toBackend(&mod, w.rt), w)
 }
 
 func AsWorkflow(o models.Model) *Workflow {
@@ -75,6 +75,7 @@ func (w *Workflow) Validate() {
 	if !w.SetValid() {
 		return
 	}
+	w.rt.validateParamValues(w.Params, w)
 	for _, stageName := range w.Stages {
 		if stage := w.rt.find("stages", stageName); stage == nil {
 			w.Errorf("Stage %s does not exist", stageName)
@@ -87,6 +88,7 @@ func (w *Workflow) Validate() {
 
 func (w *Workflow) BeforeSave() error {
 	w.Fill()
+	w.rt.secureParams(w, w)
 	w.Validate()
 	if !w.Validated {
 		return w.MakeError(422, ValidationError, w)
@@ -101,10 +103,10 @@ func (w *Workflow) OnLoad() error {
 }
 
 var workflowLockMap = map[string][]string{
-	"get":     []string{"workflows"},
-	"create":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
-	"update":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
-	"patch":   []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
+	"get":     []string{"workflows", "profiles", "params"},
+	"create":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
+	"update":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
+	"patch":   []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "params", "workflows"},
 	"delete":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
 	"actions": []string{"workflows", "stages", "profiles", "params"},
 }
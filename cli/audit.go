@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addRegistrar(registerAudit)
+}
+
+func registerAudit(app *cobra.Command) {
+	tree := addAuditCommands()
+	app.AddCommand(tree)
+}
+
+func addAuditCommands() (res *cobra.Command) {
+	res = &cobra.Command{
+		Use:   "audit",
+		Short: "Access the audit log of the changes made through the API",
+	}
+
+	auditLimit, auditOffset := -1, -1
+	list := &cobra.Command{
+		Use:   "list [filters...]",
+		Short: "List the audit log",
+		Long: `This will list the whole audit log, oldest first, by default.
+You can narrow down the entries returned with the same index filters
+as the list commands of the other objects take.  The indexes are Time,
+User, TokenId, ClientIP, Action, Model, ObjectKey, and Command.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) > 0 && strings.Contains(args[0], "=") {
+				for _, a := range args {
+					if !strings.Contains(a, "=") {
+						return fmt.Errorf("Filter argument requires an '=' separator: %s", a)
+					}
+				}
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			req := session.Req().List("audit")
+			if len(args) > 0 && strings.Contains(args[0], "=") {
+				if auditLimit != -1 {
+					args = append(args, fmt.Sprintf("limit=%d", auditLimit))
+				}
+				if auditOffset != -1 {
+					args = append(args, fmt.Sprintf("offset=%d", auditOffset))
+				}
+				pargs := []string{}
+				for _, arg := range args {
+					pargs = append(pargs, strings.SplitN(arg, "=", 2)...)
+				}
+				req.Params(pargs...)
+			} else {
+				if auditLimit != -1 {
+					args = append(args, "limit", fmt.Sprintf("%d", auditLimit))
+				}
+				if auditOffset != -1 {
+					args = append(args, "offset", fmt.Sprintf("%d", auditOffset))
+				}
+				if len(args) > 0 {
+					req = session.Req().Filter("audit", args...)
+				}
+			}
+			entries := []*models.AuditEntry{}
+			if err := req.Do(&entries); err != nil {
+				return generateError(err, "Error listing the audit log")
+			}
+			return prettyPrint(entries)
+		},
+	}
+	list.Flags().IntVar(&auditLimit, "limit", -1, "Maximum number of entries to return")
+	list.Flags().IntVar(&auditOffset, "offset", -1, "Number of entries to skip before starting to return data")
+	res.AddCommand(list)
+	return res
+}
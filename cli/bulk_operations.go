@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addRegistrar(registerBulkOperation)
+}
+
+func registerBulkOperation(app *cobra.Command) {
+	op := &ops{
+		name:       "bulk_operations",
+		singleName: "bulk_operation",
+		example:    func() models.Model { return &models.BulkOperation{} },
+	}
+	for _, action := range []struct{ name, short string }{
+		{"pause", "Stop the bulk operation from starting on more machines"},
+		{"resume", "Resume a paused bulk operation"},
+		{"abort", "Abort the bulk operation and skip all unfinished machines"},
+	} {
+		action := action
+		op.addCommand(&cobra.Command{
+			Use:   fmt.Sprintf("%s [id]", action.name),
+			Short: action.short,
+			Args: func(c *cobra.Command, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("%v requires 1 argument", c.UseLine())
+				}
+				return nil
+			},
+			RunE: func(c *cobra.Command, args []string) error {
+				res := &models.BulkOperation{}
+				if err := session.Req().Post(nil).UrlFor(op.name, args[0], action.name).Do(res); err != nil {
+					return generateError(err, "Failed to %s %v: %v", action.name, op.singleName, args[0])
+				}
+				return prettyPrint(res)
+			},
+		})
+	}
+	op.command(app)
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"strconv"
 
 	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
 	"github.com/spf13/cobra"
 )
 
@@ -74,7 +77,9 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 			return prettyPrint(res)
 		},
 	})
-	op.addCommand(&cobra.Command{
+	var follow bool
+	var offset int64
+	logCmd := &cobra.Command{
 		Use:   "log [id] [- or string]",
 		Short: "Gets the log or appends to the log if a second argument or stream is given",
 		Args: func(c *cobra.Command, args []string) error {
@@ -89,11 +94,27 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 		RunE: func(c *cobra.Command, args []string) error {
 			uuid := args[0]
 			if len(args) == 1 {
-				if err := session.Req().UrlFor("jobs", uuid, "log").Do(os.Stdout); err != nil {
+				var err error
+				if follow {
+					j := &models.Job{}
+					if err = session.FillModel(j, uuid); err == nil {
+						err = session.FollowJobLog(j, offset, os.Stdout)
+					}
+				} else {
+					req := session.Req().UrlFor("jobs", uuid, "log")
+					if offset != 0 {
+						req.Params("offset", strconv.FormatInt(offset, 10))
+					}
+					err = req.Do(os.Stdout)
+				}
+				if err != nil {
 					return generateError(err, "Error getting log")
 				}
 				return nil
 			}
+			if follow || offset != 0 {
+				return fmt.Errorf("%v: --follow and --offset cannot be used when appending to the log", c.UseLine())
+			}
 			var src io.Reader
 			if args[1] == "-" {
 				src = os.Stdin
@@ -105,6 +126,111 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 			}
 			return nil
 		},
+	}
+	logCmd.Flags().BoolVar(&follow, "follow", false, "Keep printing the log as it is appended to until the job is finished or failed")
+	logCmd.Flags().Int64Var(&offset, "offset", 0, "The byte offset in the log to start printing at")
+	op.addCommand(logCmd)
+	artifacts := &cobra.Command{
+		Use:   "artifacts",
+		Short: "Access the artifacts uploaded for a job",
+	}
+	artifacts.AddCommand(&cobra.Command{
+		Use:   "list [id]",
+		Short: "List the artifacts for a job",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			res, err := session.JobArtifacts(&models.Job{Uuid: uuid.Parse(args[0])})
+			if err != nil {
+				return generateError(err, "Error listing artifacts")
+			}
+			return prettyPrint(res)
+		},
+	})
+	artifacts.AddCommand(&cobra.Command{
+		Use:     "download [id] [artifact] to [dest]",
+		Aliases: []string{"show", "get"},
+		Short:   "Download the [artifact] for a job to [dest]",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) == 2 || len(args) == 4 {
+				return nil
+			}
+			return fmt.Errorf("%v requires 2 or 3 arguments", c.UseLine())
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			dest := os.Stdout
+			if len(args) == 4 && args[3] != "-" {
+				var err error
+				dest, err = os.Create(args[3])
+				if err != nil {
+					return fmt.Errorf("Error opening dest file %s: %v", args[3], err)
+				}
+				defer dest.Close()
+			}
+			if err := session.JobArtifact(&models.Job{Uuid: uuid.Parse(args[0])}, args[1], dest); err != nil {
+				return generateError(err, "Failed to fetch artifact %s", args[1])
+			}
+			return nil
+		},
+	})
+	artifacts.AddCommand(&cobra.Command{
+		Use:   "upload [id] [src] as [artifact]",
+		Short: "Upload [src] as the [artifact] for a job",
+		Long: `
+If [artifact] is not given, the base name of [src] will be used.
+As a useful shortcut, '-' can be passed as [src] to read the artifact
+from stdin.  In that case, [artifact] must be given.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) == 2 || len(args) == 4 {
+				return nil
+			}
+			return fmt.Errorf("%v requires 2 or 3 arguments", c.UseLine())
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			item := args[1]
+			dest := path.Base(item)
+			if len(args) == 4 {
+				dest = args[3]
+			} else if item == "-" {
+				return fmt.Errorf("%v requires an artifact name when reading from stdin", c.UseLine())
+			}
+			var src io.Reader = os.Stdin
+			if item != "-" {
+				fi, err := os.Open(item)
+				if err != nil {
+					return fmt.Errorf("Error opening src file %s: %v", item, err)
+				}
+				defer fi.Close()
+				src = fi
+			}
+			res, err := session.UploadJobArtifact(&models.Job{Uuid: uuid.Parse(args[0])}, dest, "", src)
+			if err != nil {
+				return generateError(err, "Failed to upload artifact %s", dest)
+			}
+			return prettyPrint(res)
+		},
+	})
+	artifacts.AddCommand(&cobra.Command{
+		Use:   "destroy [id] [artifact]",
+		Short: "Delete the [artifact] for a job",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("%v requires 2 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := session.DeleteJobArtifact(&models.Job{Uuid: uuid.Parse(args[0])}, args[1]); err != nil {
+				return generateError(err, "Failed to delete artifact %s", args[1])
+			}
+			fmt.Printf("Deleted %s", args[1])
+			return nil
+		},
 	})
+	op.addCommand(artifacts)
 	op.command(app)
 }
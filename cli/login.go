@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/digitalrebar/provision/api"
+	"github.com/digitalrebar/provision/models"
+	"github.com/spf13/cobra"
+)
+
+func loginCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "login",
+		Short: "Log in through the OpenID Connect provider that dr-provision trusts",
+		Long: `Log in with the OAuth2 device flow of the OpenID Connect provider
+that dr-provision is configured to trust.  The resulting token is cached
+for the user you logged in as, so later commands only need --username.`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			c.SilenceUsage = true
+			anon, err := api.TokenSession(endpoint, "")
+			if err != nil {
+				return fmt.Errorf("Error creating session: %v", err)
+			}
+			defer anon.Close()
+			cfg, err := anon.OidcConfig()
+			if err != nil {
+				return fmt.Errorf("Error getting OpenID Connect configuration: %v", err)
+			}
+			idToken, err := api.OidcDeviceLogin(cfg, func(uri, code string) {
+				fmt.Fprintf(os.Stderr, "Visit %s and enter the code %s\n", uri, code)
+			})
+			if err != nil {
+				return err
+			}
+			name, err := api.OidcUsername(cfg, idToken)
+			if err != nil {
+				return err
+			}
+			s, err := api.TokenSession(endpoint, idToken)
+			if err != nil {
+				return fmt.Errorf("Error creating session: %v", err)
+			}
+			defer s.Close()
+			tok := &models.UserToken{}
+			if err := s.Req().UrlFor("users", name, "token").Params("ttl", "7200").Do(&tok); err != nil {
+				return fmt.Errorf("Error getting token for %s: %v", name, err)
+			}
+			tFile := tokenFile(name)
+			if tFile == "" {
+				return fmt.Errorf("Nowhere to cache the token: set RS_TOKEN_CACHE or HOME")
+			}
+			if err := ioutil.WriteFile(tFile, []byte(tok.Token), 0600); err != nil {
+				return err
+			}
+			fmt.Printf("Logged in as %s\n", name)
+			return nil
+		},
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/digitalrebar/provision/api"
 	"github.com/digitalrebar/provision/models"
 	"github.com/spf13/cobra"
 )
@@ -128,6 +129,8 @@ pass in more than one task.`,
 	op.addCommand(tasks)
 	var exitOnFailure = false
 	var oneShot = false
+	var daemon = false
+	var healthSocket = ""
 	processJobs := &cobra.Command{
 		Use:   "processjobs [id]",
 		Short: "For the given machine, process pending jobs until done.",
@@ -136,6 +139,14 @@ For the provided machine, identified by UUID, process the task list on
 that machine until an error occurs or all jobs are complete.  Upon
 completion, optionally wait for additional jobs as specified by
 the stage runner wait flag.
+
+With --daemon, keep running as a long-lived service: reconnect to
+dr-provision with backoff when it goes away, exchange its token for
+a new one when it expires, and queue job logs and state updates
+until they can be sent.  An expired token can only be exchanged for
+knownTokenTimeout seconds after it expires, so agents that may be cut
+off from dr-provision for longer than that should authenticate with a
+client certificate by setting RS_CLIENT_CERT and RS_CLIENT_KEY.
 `,
 		Args: func(c *cobra.Command, args []string) error {
 			if len(args) != 1 {
@@ -153,6 +164,14 @@ the stage runner wait flag.
 			if err != nil {
 				return err
 			}
+			if daemon {
+				if oneShot {
+					return fmt.Errorf("--oneshot and --daemon cannot be used together")
+				}
+				agent = agent.Daemon(healthSocket)
+			} else if healthSocket != "" {
+				return fmt.Errorf("--health-socket requires --daemon")
+			}
 			if oneShot {
 				agent = agent.Timeout(time.Second)
 			}
@@ -161,6 +180,120 @@ the stage runner wait flag.
 	}
 	processJobs.Flags().BoolVar(&exitOnFailure, "exit-on-failure", false, "Exit on failure of a task")
 	processJobs.Flags().BoolVar(&oneShot, "oneshot", false, "Do not wait for additional tasks to appear")
+	processJobs.Flags().BoolVar(&daemon, "daemon", false, "Run as a long-lived service that survives dr-provision restarts")
+	processJobs.Flags().StringVar(&healthSocket, "health-socket", "", "Unix socket to report agent health on when running with --daemon")
 	op.addCommand(processJobs)
+	inventory := &cobra.Command{
+		Use:   "inventory",
+		Short: "Access hardware inventory for machines",
+	}
+	inventory.AddCommand(&cobra.Command{
+		Use:   "collect [id]",
+		Short: "Collect the hardware inventory of this system and upload it for [id]",
+		Long: `Gathers the CPUs, memory, NICs, disks, PCI devices, and DMI data of the
+system drpcli is running on, and uploads them as the newest inventory
+snapshot for machine [id].  The hardware that changed since the
+previous snapshot is printed.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			inv, err := api.CollectInventory()
+			if err != nil {
+				return generateError(err, "Failed to collect inventory")
+			}
+			res, err := session.PostInventory(m.Key(), inv)
+			if err != nil {
+				return generateError(err, "Failed to upload inventory for %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	inventory.AddCommand(&cobra.Command{
+		Use:   "list [id]",
+		Short: "List the inventory snapshots stored for [id]",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res, err := session.InventoryHistory(m.Key())
+			if err != nil {
+				return generateError(err, "Failed to list inventory for %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	inventory.AddCommand(&cobra.Command{
+		Use:   "show [id] [snapshot]",
+		Short: "Show an inventory snapshot for [id]",
+		Long:  `Shows inventory [snapshot] for machine [id], or the most recent one if [snapshot] is omitted.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				return fmt.Errorf("%v requires 1 or 2 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			snapshot := "latest"
+			if len(args) == 2 {
+				snapshot = args[1]
+			}
+			res, err := session.GetInventory(m.Key(), snapshot)
+			if err != nil {
+				return generateError(err, "Failed to fetch inventory %v for %v: %v", snapshot, op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	inventory.AddCommand(&cobra.Command{
+		Use:   "diff [id] [from] [to]",
+		Short: "Show the hardware that changed between two inventory snapshots for [id]",
+		Long: `Compares inventory snapshot [from] with snapshot [to] for machine [id].
+If [to] is omitted, the most recent snapshot is used.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) < 2 || len(args) > 3 {
+				return fmt.Errorf("%v requires 2 or 3 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			to := "latest"
+			if len(args) == 3 {
+				to = args[2]
+			}
+			fromInv, err := session.GetInventory(m.Key(), args[1])
+			if err != nil {
+				return generateError(err, "Failed to fetch inventory %v for %v: %v", args[1], op.singleName, args[0])
+			}
+			toInv, err := session.GetInventory(m.Key(), to)
+			if err != nil {
+				return generateError(err, "Failed to fetch inventory %v for %v: %v", to, op.singleName, args[0])
+			}
+			return prettyPrint(toInv.Diff(fromInv))
+		},
+	})
+	op.addCommand(inventory)
 	op.command(app)
 }
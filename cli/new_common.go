@@ -275,11 +275,19 @@ empty object of that type.  For User, BootEnv, Machine, and Profile, it will be
 					if err != nil {
 						return generateError(err, "Failed to generate changed %s:%s object", o.name, args[0])
 					}
-					if res, err := session.PatchToFull(refObj, toPut, ref != ""); err != nil {
+					req := session.Req()
+					if ref != "" {
+						req = req.ParanoidPatch()
+					}
+					req = req.PatchTo(refObj, toPut)
+					if force {
+						req.Params("force", "true")
+					}
+					res := models.Clone(refObj)
+					if err := req.Do(&res); err != nil {
 						return generateError(err, "Unable to update %v", args[0])
-					} else {
-						return prettyPrint(res)
 					}
+					return prettyPrint(res)
 				},
 			})
 		}
@@ -409,6 +417,27 @@ func (o *ops) params() {
 		},
 	}
 	getParams.Flags().BoolVar(&aggregate, "aggregate", false, "Should machine return aggregated view")
+	getParams.AddCommand(&cobra.Command{
+		Use:   "explain [id]",
+		Short: fmt.Sprintf("Explain where the aggregated parameters of the %s come from", o.singleName),
+		Long: fmt.Sprintf(`Shows the value of every parameter on the aggregated view of the %s,
+along with the object it came from and the values from lower down that
+it overrides.`, o.singleName),
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			res := map[string]*models.ExplainedParam{}
+			req := session.Req().UrlFor(o.name, args[0], "params").Params("aggregate", "true", "explain", "true")
+			if err := req.Do(&res); err != nil {
+				return generateError(err, "Failed to fetch params %v: %v", o.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
 	o.addCommand(getParams)
 	getParam := &cobra.Command{
 		Use:   "get [id] param [key]",
@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"fmt"
+
 	"github.com/digitalrebar/provision/models"
 	"github.com/spf13/cobra"
 )
@@ -15,5 +17,30 @@ func registerParam(app *cobra.Command) {
 		singleName: "param",
 		example:    func() models.Model { return &models.Param{} },
 	}
+	op.addCommand(&cobra.Command{
+		Use:   "check [json]",
+		Short: "Check which stored values a changed param would make invalid",
+		Long: `Reports the values of the param passed in [json] that are stored on
+machines, profiles, plugins, stages, workflows, and bootenvs, and that
+would not match its schema if the param were updated to [json].
+Nothing is changed on the server.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			param := &models.Param{}
+			if err := into(args[0], param); err != nil {
+				return fmt.Errorf("Invalid param: %v", err)
+			}
+			res, err := session.CheckParam(param)
+			if err != nil {
+				return generateError(err, "Failed to check param %v", param.Name)
+			}
+			return prettyPrint(res)
+		},
+	})
 	op.command(app)
 }
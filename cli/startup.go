@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -23,6 +24,8 @@ var (
 	default_endpoint = "https://127.0.0.1:8092"
 	token            = ""
 	default_token    = ""
+	apiKey           = ""
+	default_apiKey   = ""
 	username         = "rocketskates"
 	default_username = "rocketskates"
 	password         = "r0cketsk8ts"
@@ -42,42 +45,65 @@ func addRegistrar(rs registerSection) {
 	registrations = append(registrations, rs)
 }
 
+// tokenFile returns the file the token of user is cached in, or ""
+// if there is nowhere to cache tokens.
+func tokenFile(user string) string {
+	home := os.ExpandEnv("${HOME}")
+	tPath := os.ExpandEnv("${RS_TOKEN_CACHE}")
+	if tPath == "" && home != "" {
+		tPath = path.Join(home, ".cache", "drpcli", "tokens")
+	}
+	if tPath == "" {
+		return ""
+	}
+	if err := os.MkdirAll(tPath, 0700); err != nil {
+		return ""
+	}
+	return path.Join(tPath, "."+user+".token")
+}
+
 var ppr = func(c *cobra.Command, a []string) error {
 	c.SilenceUsage = true
 	if session == nil {
 		var err error
-		if token != "" {
+		if apiKey != "" {
+			session, err = api.ApiKeySession(endpoint, apiKey)
+		} else if token != "" {
 			session, err = api.TokenSession(endpoint, token)
-		} else {
-			home := os.ExpandEnv("${HOME}")
-			tPath := os.ExpandEnv("${RS_TOKEN_CACHE}")
-			if tPath == "" && home != "" {
-				tPath = path.Join(home, ".cache", "drpcli", "tokens")
+		} else if certFile := os.Getenv("RS_CLIENT_CERT"); certFile != "" {
+			keyFile := os.Getenv("RS_CLIENT_KEY")
+			if keyFile == "" {
+				keyFile = certFile
 			}
-			tokenFile := path.Join(tPath, "."+username+".token")
-			if tPath != "" {
-				if err := os.MkdirAll(tPath, 0700); err == nil {
-					if tokenStr, err := ioutil.ReadFile(tokenFile); err == nil {
-						session, err = api.TokenSession(endpoint, string(tokenStr))
-						if err == nil {
-							if _, err := session.Info(); err == nil {
-								session.Trace(trace)
-								session.TraceToken(traceToken)
-								return nil
-							}
+			var cert tls.Certificate
+			if cert, err = tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+				session, err = api.CertSession(endpoint, cert)
+			}
+		} else {
+			tFile := tokenFile(username)
+			if tFile != "" {
+				if tokenStr, err := ioutil.ReadFile(tFile); err == nil {
+					session, err = api.TokenSession(endpoint, string(tokenStr))
+					if err == nil {
+						if _, err := session.Info(); err == nil {
+							session.Trace(trace)
+							session.TraceToken(traceToken)
+							return nil
 						}
 					}
 				}
 			}
-			session, err = api.UserSession(endpoint, username, password)
-			if tPath != "" && err == nil {
-				if err := os.MkdirAll(tPath, 700); err == nil {
-					tok := &models.UserToken{}
-					if err := session.
-						Req().UrlFor("users", username, "token").
-						Params("ttl", "7200").Do(&tok); err == nil {
-						ioutil.WriteFile(tokenFile, []byte(tok.Token), 0600)
-					}
+			if code := os.Getenv("RS_TOTP"); code != "" {
+				session, err = api.TotpSession(endpoint, username, password, code)
+			} else {
+				session, err = api.UserSession(endpoint, username, password)
+			}
+			if tFile != "" && err == nil {
+				tok := &models.UserToken{}
+				if err := session.
+					Req().UrlFor("users", username, "token").
+					Params("ttl", "7200").Do(&tok); err == nil {
+					ioutil.WriteFile(tFile, []byte(tok.Token), 0600)
 				}
 			}
 		}
@@ -101,6 +127,9 @@ func NewApp() *cobra.Command {
 	if tk := os.Getenv("RS_TOKEN"); tk != "" {
 		default_token = tk
 	}
+	if ak := os.Getenv("RS_API_KEY"); ak != "" {
+		default_apiKey = ak
+	}
 	if kv := os.Getenv("RS_KEY"); kv != "" {
 		key := strings.SplitN(kv, ":", 2)
 		if len(key) < 2 {
@@ -124,6 +153,9 @@ func NewApp() *cobra.Command {
 	app.PersistentFlags().StringVarP(&token,
 		"token", "T", default_token,
 		"token of the Digital Rebar Provision access")
+	app.PersistentFlags().StringVarP(&apiKey,
+		"apikey", "K", default_apiKey,
+		"API key of the Digital Rebar Provision access")
 	app.PersistentFlags().BoolVarP(&debug,
 		"debug", "d", false,
 		"Whether the CLI should run in debug mode")
@@ -182,6 +214,7 @@ func NewApp() *cobra.Command {
 		},
 	})
 
+	app.AddCommand(loginCommand())
 	app.AddCommand(&cobra.Command{
 		Use:   "gohai",
 		Short: "Get basic system information as a JSON blob",
@@ -34,5 +34,63 @@ func registerTemplate(app *cobra.Command) {
 			return prettyPrint(tmpl)
 		},
 	})
+	var renderTask, renderBootEnv, renderStage, renderMachine, renderParams string
+	render := &cobra.Command{
+		Use:   "render [id]",
+		Short: "Preview what template [id] renders to",
+		Long: `Renders template [id], or the templates of the task, bootenv, or stage
+passed with --task, --bootenv, or --stage, the way they would be
+rendered for the machine passed with --machine.  --params takes a JSON
+or YAML object of params that are used in place of the params of the
+machine, or by themselves if no machine is passed.
+
+Nothing is changed on the server, and tokens are not generated.
+Templates that fail to render and missing required params are
+reported in the result.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("%v requires at most 1 argument", c.UseLine())
+			}
+			set := len(args)
+			for _, name := range []string{renderTask, renderBootEnv, renderStage} {
+				if name != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				return fmt.Errorf("%v requires exactly one of [id], --task, --bootenv, or --stage", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			req := &models.RenderRequest{Task: renderTask, BootEnv: renderBootEnv, Stage: renderStage}
+			if len(args) == 1 {
+				req.Template = args[0]
+			}
+			if renderMachine != "" {
+				m := &models.Machine{}
+				if err := session.FillModel(m, renderMachine); err != nil {
+					return generateError(err, "Failed to fetch machine %v", renderMachine)
+				}
+				req.Machine = m.Uuid
+			}
+			if renderParams != "" {
+				if err := into(renderParams, &req.Params); err != nil {
+					return fmt.Errorf("Invalid params: %v", err)
+				}
+			}
+			res, err := session.Render(req)
+			if err != nil {
+				return generateError(err, "Failed to render")
+			}
+			return prettyPrint(res)
+		},
+	}
+	render.Flags().StringVar(&renderTask, "task", "", "Render the templates of this task")
+	render.Flags().StringVar(&renderBootEnv, "bootenv", "", "Render the templates of this bootenv")
+	render.Flags().StringVar(&renderStage, "stage", "", "Render the templates of this stage")
+	render.Flags().StringVar(&renderMachine, "machine", "", "The machine to render for")
+	render.Flags().StringVar(&renderParams, "params", "", "JSON or YAML object of params to render with")
+	op.addCommand(render)
 	op.command(app)
 }
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addRegistrar(registerToken)
+}
+
+func registerToken(app *cobra.Command) {
+	tree := addTokenCommands()
+	app.AddCommand(tree)
+}
+
+func addTokenCommands() (res *cobra.Command) {
+	res = &cobra.Command{
+		Use:   "tokens",
+		Short: "List, inspect, and revoke tokens in the token registry",
+	}
+
+	commands := []*cobra.Command{}
+	listUser := ""
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the unexpired tokens in the token registry",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			tokens := []*models.TokenRecord{}
+			req := session.Req().UrlFor("tokens")
+			if listUser != "" {
+				req = req.Params("user", listUser)
+			}
+			if err := req.Do(&tokens); err != nil {
+				return generateError(err, "Error listing tokens")
+			}
+			return prettyPrint(tokens)
+		},
+	}
+	list.Flags().StringVar(&listUser, "user", "", "Only list the tokens of this user")
+	commands = append(commands, list)
+	commands = append(commands, &cobra.Command{
+		Use:   "show [id]",
+		Short: "Show a token in the token registry, or the token in use with an id of current",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			token := &models.TokenRecord{}
+			if err := session.Req().UrlFor("tokens", args[0]).Do(token); err != nil {
+				return generateError(err, "Error getting token")
+			}
+			return prettyPrint(token)
+		},
+	})
+	commands = append(commands, &cobra.Command{
+		Use:   "revoke [id]",
+		Short: "Revoke a token in the token registry",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			token := &models.TokenRecord{}
+			if err := session.Req().Del().UrlFor("tokens", args[0]).Do(token); err != nil {
+				return generateError(err, "Error revoking token")
+			}
+			return prettyPrint(token)
+		},
+	})
+	res.AddCommand(commands...)
+	return res
+}
@@ -36,6 +36,106 @@ func registerUser(app *cobra.Command) {
 			return prettyPrint(res)
 		},
 	})
+	op.addCommand(&cobra.Command{
+		Use:   "addkey [id] [- | JSON or YAML ApiKey | name]",
+		Short: "Create an API key for this id",
+		Long: `Create an API key for this id.  The key to use in an Authorization
+header of the form "Key <key>" is only shown once, so save it.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("%v needs 2 args", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			key := &models.ApiKey{}
+			if err := into(args[1], key); err != nil || key.Name == "" {
+				key = &models.ApiKey{Name: args[1]}
+			}
+			res := &models.UserApiKey{}
+			if err := session.Req().Post(key).UrlFor("users", args[0], "apikeys").Do(res); err != nil {
+				return generateError(err, "Error: createUserApiKey: %v", err)
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "removekey [id] [key]",
+		Short: "Remove an API key from this id",
+		Long:  "Remove an API key from this id",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("%v needs 2 args", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			res := &models.User{}
+			if err := session.Req().Del().UrlFor("users", args[0], "apikeys", args[1]).Do(res); err != nil {
+				return generateError(err, "Error: deleteUserApiKey: %v", err)
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "starttotp [id]",
+		Short: "Start TOTP enrolment for this id",
+		Long: `Start TOTP enrolment for this id.  This prints a new TOTP secret for
+an authenticator app, which has to be confirmed with confirmtotp.
+Any TOTP the user already had is disabled.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v needs 1 arg", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			res := &models.UserTotp{}
+			if err := session.Req().Post(nil).UrlFor("users", args[0], "totp").Do(res); err != nil {
+				return generateError(err, "Error: startUserTotp: %v", err)
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "confirmtotp [id] [code]",
+		Short: "Confirm TOTP enrolment for this id with a one-time code",
+		Long: `Confirm TOTP enrolment for this id with a one-time code.  After that,
+logging in as the user needs a code as well as the password, which
+drpcli reads from the RS_TOTP environment variable.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("%v needs 2 args", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			code := &models.UserTotpCode{Code: args[1]}
+			res := &models.User{}
+			if err := session.Req().Put(code).UrlFor("users", args[0], "totp").Do(res); err != nil {
+				return generateError(err, "Error: confirmUserTotp: %v", err)
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "disabletotp [id]",
+		Short: "Disable TOTP for this id",
+		Long:  "Disable TOTP for this id",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v needs 1 arg", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			res := &models.User{}
+			if err := session.Req().Del().UrlFor("users", args[0], "totp").Do(res); err != nil {
+				return generateError(err, "Error: deleteUserTotp: %v", err)
+			}
+			return prettyPrint(res)
+		},
+	})
 	tokenArgs := []string{}
 	op.addCommand(&cobra.Command{
 		Use:   "token [id] [ttl [ttl]] [scope [scope]] [action [action]] [specific [specific]]",
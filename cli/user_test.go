@@ -9,7 +9,8 @@ func TestUserCli(t *testing.T) {
 
 	var userCreateInputString string = `{
   "Name": "john",
-  "PasswordHash": null
+  "PasswordHash": null,
+  "Roles": ["superuser"]
 }
 `
 	var userCreateFredInputString string = `fred`
@@ -172,6 +172,7 @@ func (f *Frontend) makeActionEndpoints(cmdSet string, obj models.Model, idKey st
 			}
 
 			rt.Publish(cmdSet, cmd, id, ma)
+			rt.AuditAction(cmdSet, id, cmd)
 			retval, runErr := f.pc.Actions.Run(rt, cmdSet, ma)
 			if runErr != nil {
 				be, ok := runErr.(*models.Error)
@@ -186,6 +187,13 @@ func (f *Frontend) makeActionEndpoints(cmdSet string, obj models.Model, idKey st
 		}
 }
 
+func decryptActionParam(f *Frontend, obj interface{}) interface{} {
+	if plain, err := f.dt.DecryptParam(obj); err == nil {
+		return plain
+	}
+	return obj
+}
+
 func validateActionParameters(f *Frontend,
 	rt *backend.RequestTracker,
 	ma *models.Action,
@@ -215,6 +223,9 @@ func validateActionParameters(f *Frontend,
 
 			// GREG: Default?
 
+			// Plugins get the plain values of secure params.
+			obj = decryptActionParam(f, obj)
+
 			// Put into place
 			if obj != nil {
 				val[param] = obj
@@ -248,6 +259,7 @@ func validateActionParameters(f *Frontend,
 					}
 				}
 			}
+			obj = decryptActionParam(f, obj)
 
 			// Put into place
 			if obj != nil {
@@ -0,0 +1,195 @@
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditEntriesResponse returned on a successful GET of the audit log
+// swagger:response
+type AuditEntriesResponse struct {
+	// in: body
+	Body []*models.AuditEntry
+}
+
+// AuditListPathParameter used to limit lists of AuditEntry by path options
+// swagger:parameters listAudit
+type AuditListPathParameter struct {
+	// in: query
+	Offest int `json:"offset"`
+	// in: query
+	Limit int `json:"limit"`
+	// in: query
+	Time string
+	// in: query
+	User string
+	// in: query
+	TokenId string
+	// in: query
+	ClientIP string
+	// in: query
+	Action string
+	// in: query
+	Model string
+	// in: query
+	ObjectKey string
+	// in: query
+	Command string
+}
+
+func (f *Frontend) InitAuditApi() {
+	// swagger:route GET /audit Audit listAudit
+	//
+	// Lists the audit log filtered by some parameters.
+	//
+	// This will show all the changes made through the API by default,
+	// oldest first.  The log is read one entry at a time, so use
+	// Offset and Limit to page through a big one.
+	//
+	// You may specify:
+	//    Offset = integer, 0-based inclusive starting point in filter data.
+	//    Limit = integer, number of items to return
+	//    Reverse = list the newest entries first
+	//
+	// Functional Indexs:
+	//    Time = datetime
+	//    User = string
+	//    TokenId = string
+	//    ClientIP = string
+	//    Action = string
+	//    Model = string
+	//    ObjectKey = string
+	//    Command = string
+	//
+	// Functions:
+	//    Eq(value) = Return items that are equal to value
+	//    Lt(value) = Return items that are less than value
+	//    Lte(value) = Return items that less than or equal to value
+	//    Gt(value) = Return items that are greater than value
+	//    Gte(value) = Return items that greater than or equal to value
+	//    Between(lower,upper) = Return items that are inclusively between lower and upper
+	//    Except(lower,upper) = Return items that are not inclusively between lower and upper
+	//
+	// Example:
+	//    Model=machines&Action=delete - returns the deleted machines
+	//    Time=Gte(2018-01-01T00:00:00Z)&User=fred - returns what fred changed since 2018
+	//
+	// Responses:
+	//    200: AuditEntriesResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	//    406: ErrorResponse
+	f.ApiGroup.GET("/audit",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "audit", "list", "") {
+				return
+			}
+			res := &models.Error{
+				Code:  http.StatusNotAcceptable,
+				Type:  c.Request.Method,
+				Model: "audit",
+			}
+			params := c.Request.URL.Query()
+			if _, ok := params["sort"]; ok {
+				res.Errorf("The audit log can only be listed in the order it was written")
+				c.JSON(res.Code, res)
+				return
+			}
+			_, reverse := params["reverse"]
+			offset, limit, err := auditWindow(params)
+			if err != nil {
+				res.AddError(err)
+				c.JSON(res.Code, res)
+				return
+			}
+			terms := url.Values{}
+			for k, vs := range params {
+				if k != "offset" && k != "limit" && k != "reverse" {
+					terms[k] = vs
+				}
+			}
+			ref := &backend.AuditEntry{}
+			filters, err := f.processFilters(f.rt(c), nil, ref, terms)
+			if err != nil {
+				res.AddError(err)
+				c.JSON(res.Code, res)
+				return
+			}
+			// The log is scanned one entry at a time, and only the
+			// entries that can end up in the response are kept.
+			total, matched := 0, 0
+			arr := []*models.AuditEntry{}
+			var filterErr error
+			err = f.dt.Audit().Scan(func(entry *models.AuditEntry) error {
+				total++
+				idx, err := index.All(filters...)(index.Create([]models.Model{&backend.AuditEntry{AuditEntry: entry}}))
+				if err != nil {
+					filterErr = err
+					return err
+				}
+				if idx.Count() == 0 {
+					return nil
+				}
+				matched++
+				if reverse {
+					arr = append(arr, entry)
+					if limit >= 0 && len(arr) > offset+limit {
+						arr = arr[1:]
+					}
+				} else if matched > offset && (limit < 0 || len(arr) < limit) {
+					arr = append(arr, entry)
+				}
+				return nil
+			})
+			if filterErr != nil {
+				res.AddError(filterErr)
+				c.JSON(res.Code, res)
+				return
+			} else if err != nil {
+				res.Code = http.StatusInternalServerError
+				res.AddError(err)
+				c.JSON(res.Code, res)
+				return
+			}
+			if reverse {
+				for i, j := 0, len(arr)-1; i < j; i, j = i+1, j-1 {
+					arr[i], arr[j] = arr[j], arr[i]
+				}
+				if offset >= len(arr) {
+					arr = []*models.AuditEntry{}
+				} else {
+					arr = arr[offset:]
+				}
+				if limit >= 0 && len(arr) > limit {
+					arr = arr[:limit]
+				}
+			}
+			c.Header("X-DRP-LIST-TOTAL-COUNT", fmt.Sprintf("%d", total))
+			c.Header("X-DRP-LIST-COUNT", fmt.Sprintf("%d", len(arr)))
+			c.JSON(http.StatusOK, arr)
+		})
+}
+
+// auditWindow returns the offset and limit of a list of the audit log.
+// A limit of -1 means there is none.
+func auditWindow(params url.Values) (offset, limit int, err error) {
+	limit = -1
+	if vs, ok := params["offset"]; ok {
+		if offset, err = strconv.Atoi(vs[0]); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("Offset not valid: %s", vs[0])
+		}
+	}
+	if vs, ok := params["limit"]; ok {
+		if limit, err = strconv.Atoi(vs[0]); err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("Limit not valid: %s", vs[0])
+		}
+	}
+	return offset, limit, nil
+}
@@ -30,7 +30,7 @@ type BootEnvBodyParameter struct {
 }
 
 // BootEnvPatchBodyParameter used to patch a BootEnv
-// swagger:parameters patchBootEnv
+// swagger:parameters patchBootEnv patchBootEnvParams
 type BootEnvPatchBodyParameter struct {
 	// in: body
 	// required: true
@@ -38,13 +38,54 @@ type BootEnvPatchBodyParameter struct {
 }
 
 // BootEnvPathParameter used to name a BootEnv in the path
-// swagger:parameters putBootEnvs getBootEnv putBootEnv patchBootEnv deleteBootEnv headBootEnv
+// swagger:parameters putBootEnvs getBootEnv putBootEnv patchBootEnv deleteBootEnv headBootEnv getBootEnvParams patchBootEnvParams postBootEnvParams
 type BootEnvPathParameter struct {
 	// in: path
 	// required: true
 	Name string `json:"name"`
 }
 
+// BootEnvParamsResponse return on a successful GET of all BootEnv's Params
+// swagger:response
+type BootEnvParamsResponse struct {
+	// in: body
+	Body map[string]interface{}
+}
+
+// BootEnvParamResponse return on a successful GET of a single Param for a BootEnv
+// swagger:response
+type BootEnvParamResponse struct {
+	// in: body
+	Body interface{}
+}
+
+// BootEnvParamsPathParameter used to get or set a single Parameter in a BootEnv
+// swagger:parameters getBootEnvParam postBootEnvParam deleteBootEnvParam
+type BootEnvParamsPathParameter struct {
+	// in: path
+	// required: true
+	Name string `json:"name"`
+	// in: path
+	// required: true
+	Key string `json:"key"`
+}
+
+// BootEnvParamsBodyParameter used to set BootEnv Params
+// swagger:parameters postBootEnvParams
+type BootEnvParamsBodyParameter struct {
+	// in: body
+	// required: true
+	Body map[string]interface{}
+}
+
+// BootEnvParamBodyParameter used to set BootEnv Param
+// swagger:parameters postBootEnvParam
+type BootEnvParamBodyParameter struct {
+	// in: body
+	// required: true
+	Body interface{}
+}
+
 // BootEnvListPathParameter used to limit lists of BootEnv by path options
 // swagger:parameters listBootEnvs listStatsBootEnvs
 type BootEnvListPathParameter struct {
@@ -249,6 +290,7 @@ func (f *Frontend) InitBootEnvApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/bootenvs/:name",
 		func(c *gin.Context) {
@@ -268,6 +310,7 @@ func (f *Frontend) InitBootEnvApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/bootenvs/:name",
 		func(c *gin.Context) {
@@ -286,12 +329,94 @@ func (f *Frontend) InitBootEnvApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/bootenvs/:name",
 		func(c *gin.Context) {
 			f.Remove(c, &backend.BootEnv{}, c.Param(`name`))
 		})
 
+	pGetAll, pGetOne, pPatch, pSetThem, pSetOne, pDeleteOne := f.makeParamEndpoints(&backend.BootEnv{}, "name")
+
+	// swagger:route GET /bootenvs/{name}/params BootEnvs getBootEnvParams
+	//
+	// List bootenv params BootEnv
+	//
+	// List BootEnv parms for a BootEnv specified by {name}
+	//
+	//     Responses:
+	//       200: BootEnvParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/bootenvs/:name/params", pGetAll)
+
+	// swagger:route GET /bootenvs/{name}/params/{key} BootEnvs getBootEnvParam
+	//
+	// Get a single bootenv parameter
+	//
+	// Get a single parameter {key} for a BootEnv specified by {name}
+	//
+	//     Responses:
+	//       200: BootEnvParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/bootenvs/:name/params/*key", pGetOne)
+
+	// swagger:route DELETE /bootenvs/{name}/params/{key} BootEnvs deleteBootEnvParam
+	//
+	// Delete a single bootenv parameter
+	//
+	// Delete a single parameter {key} for a BootEnv specified by {name}
+	//
+	//     Responses:
+	//       200: BootEnvParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.DELETE("/bootenvs/:name/params/*key", pDeleteOne)
+
+	// swagger:route PATCH /bootenvs/{name}/params BootEnvs patchBootEnvParams
+	//
+	// Update params for BootEnv {name} with the passed-in patch
+	//
+	//     Responses:
+	//       200: BootEnvParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.PATCH("/bootenvs/:name/params", pPatch)
+
+	// swagger:route POST /bootenvs/{name}/params BootEnvs postBootEnvParams
+	//
+	// Sets parameters for a bootenv specified by {name}
+	//
+	//     Responses:
+	//       200: BootEnvParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.POST("/bootenvs/:name/params", pSetThem)
+
+	// swagger:route POST /bootenvs/{name}/params/{key} BootEnvs postBootEnvParam
+	//
+	// Set as single Parameter {key} for a bootenv specified by {name}
+	//
+	//     Responses:
+	//       200: BootEnvParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.POST("/bootenvs/:name/params/*key", pSetOne)
+
 	b := &backend.BootEnv{}
 	pActions, pAction, pRun := f.makeActionEndpoints(b.Prefix(), b, "name")
 
@@ -0,0 +1,424 @@
+package frontend
+
+import (
+	"net/http"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/gin-gonic/gin"
+	"github.com/pborman/uuid"
+)
+
+// BulkOperationResponse return on a successful GET, PUT, PATCH or POST of a single BulkOperation
+// swagger:response
+type BulkOperationResponse struct {
+	// in: body
+	Body *models.BulkOperation
+}
+
+// BulkOperationsResponse return on a successful GET of all BulkOperations
+// swagger:response
+type BulkOperationsResponse struct {
+	// in: body
+	Body []*models.BulkOperation
+}
+
+// BulkOperationBodyParameter used to inject a BulkOperation
+// swagger:parameters createBulkOperation putBulkOperation
+type BulkOperationBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.BulkOperation
+}
+
+// BulkOperationPatchBodyParameter used to patch a BulkOperation
+// swagger:parameters patchBulkOperation
+type BulkOperationPatchBodyParameter struct {
+	// in: body
+	// required: true
+	Body jsonpatch2.Patch
+}
+
+// BulkOperationPathParameter used to find a BulkOperation in the path
+// swagger:parameters getBulkOperation putBulkOperation patchBulkOperation deleteBulkOperation headBulkOperation pauseBulkOperation resumeBulkOperation abortBulkOperation
+type BulkOperationPathParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+}
+
+// BulkOperationListPathParameter used to limit lists of BulkOperation by path options
+// swagger:parameters listBulkOperations listStatsBulkOperations
+type BulkOperationListPathParameter struct {
+	// in: query
+	Offest int `json:"offset"`
+	// in: query
+	Limit int `json:"limit"`
+	// in: query
+	Available string
+	// in: query
+	Valid string
+	// in: query
+	ReadOnly string
+	// in: query
+	Uuid string
+	// in: query
+	State string
+	// in: query
+	Workflow string
+	// in: query
+	Stage string
+}
+
+func (f *Frontend) bulkOperationState(c *gin.Context, from []string, to string) {
+	id := c.Param(`uuid`)
+	op := &backend.BulkOperation{}
+	backend.Fill(op)
+	if !f.assureAuth(c, op.Prefix(), "update", id) {
+		return
+	}
+	var res models.Model
+	var err error
+	rt := f.rt(c, op.Locks("update")...)
+	rt.Do(func(d backend.Stores) {
+		found := rt.Find(op.Prefix(), id)
+		if found == nil {
+			err = &models.Error{
+				Code:     http.StatusNotFound,
+				Type:     c.Request.Method,
+				Model:    op.Prefix(),
+				Key:      id,
+				Messages: []string{"Not Found"},
+			}
+			return
+		}
+		target := models.Clone(found).(*models.BulkOperation)
+		allowed := false
+		for _, state := range from {
+			allowed = allowed || target.State == state
+		}
+		if !allowed {
+			e := &models.Error{
+				Code:  http.StatusUnprocessableEntity,
+				Type:  c.Request.Method,
+				Model: op.Prefix(),
+				Key:   id,
+			}
+			e.Errorf("Cannot move BulkOperation from %s to %s", target.State, to)
+			err = e
+			return
+		}
+		target.State = to
+		if _, err = rt.Update(target); err == nil {
+			res = models.Clone(rt.Find(op.Prefix(), id))
+		}
+	})
+	if err != nil {
+		jsonError(c, err, http.StatusBadRequest, op.Prefix())
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (f *Frontend) InitBulkOperationApi() {
+	// swagger:route GET /bulk_operations BulkOperations listBulkOperations
+	//
+	// Lists BulkOperations filtered by some parameters.
+	//
+	// This will show all BulkOperations by default.
+	//
+	// You may specify:
+	//    Offset = integer, 0-based inclusive starting point in filter data.
+	//    Limit = integer, number of items to return
+	//
+	// Functional Indexs:
+	//    Uuid = string
+	//    State = string
+	//    Workflow = string
+	//    Stage = string
+	//    Available = boolean
+	//
+	// Functions:
+	//    Eq(value) = Return items that are equal to value
+	//    Lt(value) = Return items that are less than value
+	//    Lte(value) = Return items that less than or equal to value
+	//    Gt(value) = Return items that are greater than value
+	//    Gte(value) = Return items that greater than or equal to value
+	//    Between(lower,upper) = Return items that are inclusively between lower and upper
+	//    Except(lower,upper) = Return items that are not inclusively between lower and upper
+	//
+	// Example:
+	//    State=running - returns items that are running
+	//    State=running&Workflow=reimage - returns running items that move machines to the reimage workflow
+	//
+	// Responses:
+	//    200: BulkOperationsResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	//    406: ErrorResponse
+	f.ApiGroup.GET("/bulk_operations",
+		func(c *gin.Context) {
+			f.List(c, &backend.BulkOperation{})
+		})
+
+	// swagger:route HEAD /bulk_operations BulkOperations listStatsBulkOperations
+	//
+	// Stats of the List BulkOperations filtered by some parameters.
+	//
+	// This will return headers with the stats of the list.
+	//
+	// You may specify:
+	//    Offset = integer, 0-based inclusive starting point in filter data.
+	//    Limit = integer, number of items to return
+	//
+	// Functional Indexs:
+	//    Uuid = string
+	//    State = string
+	//    Workflow = string
+	//    Stage = string
+	//    Available = boolean
+	//
+	// Functions:
+	//    Eq(value) = Return items that are equal to value
+	//    Lt(value) = Return items that are less than value
+	//    Lte(value) = Return items that less than or equal to value
+	//    Gt(value) = Return items that are greater than value
+	//    Gte(value) = Return items that greater than or equal to value
+	//    Between(lower,upper) = Return items that are inclusively between lower and upper
+	//    Except(lower,upper) = Return items that are not inclusively between lower and upper
+	//
+	// Example:
+	//    State=running - returns items that are running
+	//    State=running&Workflow=reimage - returns running items that move machines to the reimage workflow
+	//
+	// Responses:
+	//    200: NoContentResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	//    406: ErrorResponse
+	f.ApiGroup.HEAD("/bulk_operations",
+		func(c *gin.Context) {
+			f.ListStats(c, &backend.BulkOperation{})
+		})
+
+	// swagger:route POST /bulk_operations BulkOperations createBulkOperation
+	//
+	// Create a BulkOperation
+	//
+	// Create a BulkOperation from the provided object.  The Filter is
+	// evaluated against the machines using the same syntax as the
+	// machine list API, and the matching machines are recorded in the
+	// operation.  The operation will start acting on them right away.
+	//
+	//     Responses:
+	//       201: BulkOperationResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/bulk_operations",
+		func(c *gin.Context) {
+			// We don't use f.Create() because the filter has to be
+			// resolved to a list of machines, and the operation needs a UUID.
+			b := &backend.BulkOperation{}
+			if !assureDecode(c, b) {
+				return
+			}
+			backend.Fill(b)
+			if !f.assureAuth(c, b.Prefix(), "create", "") {
+				return
+			}
+			if !f.assureAuth(c, "machines", "update", "") {
+				return
+			}
+			if b.Uuid == nil || len(b.Uuid) == 0 {
+				b.Uuid = uuid.NewRandom()
+			}
+			b.Fill()
+			b.Machines = []models.BulkOperationMachine{}
+			var res models.Model
+			var err error
+			rt := f.rt(c, b.Locks("create")...)
+			rt.Do(func(d backend.Stores) {
+				ref := &backend.Machine{}
+				backend.Fill(ref)
+				var filters []index.Filter
+				filters, err = f.processFilters(rt, d, ref, b.Filter)
+				if err != nil {
+					err = models.NewError(c.Request.Method, http.StatusBadRequest, err.Error())
+					return
+				}
+				var idx *index.Index
+				idx, err = index.All(filters...)(&d("machines").Index)
+				if err != nil {
+					err = models.NewError(c.Request.Method, http.StatusBadRequest, err.Error())
+					return
+				}
+				for _, item := range idx.Items() {
+					m := backend.AsMachine(item)
+					b.Machines = append(b.Machines, models.BulkOperationMachine{
+						Uuid:  m.Uuid,
+						Name:  m.Name,
+						State: "pending",
+					})
+				}
+				_, err = rt.Create(b)
+				if err == nil {
+					res = models.Clone(b)
+				}
+			})
+			if err != nil {
+				jsonError(c, err, http.StatusBadRequest, b.Prefix())
+				return
+			}
+			c.JSON(http.StatusCreated, res)
+		})
+
+	// swagger:route GET /bulk_operations/{uuid} BulkOperations getBulkOperation
+	//
+	// Get a BulkOperation
+	//
+	// Get the BulkOperation specified by {uuid} or return NotFound.
+	//
+	//     Responses:
+	//       200: BulkOperationResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/bulk_operations/:uuid",
+		func(c *gin.Context) {
+			f.Fetch(c, &backend.BulkOperation{}, c.Param(`uuid`))
+		})
+
+	// swagger:route HEAD /bulk_operations/{uuid} BulkOperations headBulkOperation
+	//
+	// See if a BulkOperation exists
+	//
+	// Return 200 if the BulkOperation specifiec by {uuid} exists, or return NotFound.
+	//
+	//     Responses:
+	//       200: NoContentResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: NoContentResponse
+	f.ApiGroup.HEAD("/bulk_operations/:uuid",
+		func(c *gin.Context) {
+			f.Exists(c, &backend.BulkOperation{}, c.Param(`uuid`))
+		})
+
+	// swagger:route PATCH /bulk_operations/{uuid} BulkOperations patchBulkOperation
+	//
+	// Patch a BulkOperation
+	//
+	// Update a BulkOperation specified by {uuid} using a RFC6902 Patch structure
+	//
+	//     Responses:
+	//       200: BulkOperationResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       406: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.PATCH("/bulk_operations/:uuid",
+		func(c *gin.Context) {
+			f.Patch(c, &backend.BulkOperation{}, c.Param(`uuid`))
+		})
+
+	// swagger:route PUT /bulk_operations/{uuid} BulkOperations putBulkOperation
+	//
+	// Put a BulkOperation
+	//
+	// Update a BulkOperation specified by {uuid} using a JSON BulkOperation
+	//
+	//     Responses:
+	//       200: BulkOperationResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.PUT("/bulk_operations/:uuid",
+		func(c *gin.Context) {
+			f.Update(c, &backend.BulkOperation{}, c.Param(`uuid`))
+		})
+
+	// swagger:route DELETE /bulk_operations/{uuid} BulkOperations deleteBulkOperation
+	//
+	// Delete a BulkOperation
+	//
+	// Delete a BulkOperation specified by {uuid}.  Running or paused
+	// BulkOperations must be aborted first.
+	//
+	//     Responses:
+	//       200: BulkOperationResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       412: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.DELETE("/bulk_operations/:uuid",
+		func(c *gin.Context) {
+			f.Remove(c, &backend.BulkOperation{}, c.Param(`uuid`))
+		})
+
+	// swagger:route POST /bulk_operations/{uuid}/pause BulkOperations pauseBulkOperation
+	//
+	// Pause a BulkOperation
+	//
+	// No new machines will be acted on until the BulkOperation is
+	// resumed.  Machines that are already running will be tracked to
+	// completion.
+	//
+	//     Responses:
+	//       200: BulkOperationResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/bulk_operations/:uuid/pause",
+		func(c *gin.Context) {
+			f.bulkOperationState(c, []string{"created", "running"}, "paused")
+		})
+
+	// swagger:route POST /bulk_operations/{uuid}/resume BulkOperations resumeBulkOperation
+	//
+	// Resume a paused BulkOperation
+	//
+	//     Responses:
+	//       200: BulkOperationResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/bulk_operations/:uuid/resume",
+		func(c *gin.Context) {
+			f.bulkOperationState(c, []string{"paused"}, "running")
+		})
+
+	// swagger:route POST /bulk_operations/{uuid}/abort BulkOperations abortBulkOperation
+	//
+	// Abort a BulkOperation
+	//
+	// All machines that have not finished will be marked as skipped,
+	// and the BulkOperation will not act on any more machines.
+	//
+	//     Responses:
+	//       200: BulkOperationResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/bulk_operations/:uuid/abort",
+		func(c *gin.Context) {
+			f.bulkOperationState(c, []string{"created", "running", "paused"}, "aborted")
+		})
+}
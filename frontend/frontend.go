@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -54,6 +55,8 @@ type Frontend struct {
 	dt         *backend.DataTracker
 	pc         *midlayer.PluginController
 	authSource AuthSource
+	oidc       *backend.OidcAuth
+	apiKeys    *backend.ApiKeyAuth
 	pubs       *backend.Publishers
 	melody     *melody.Melody
 	ApiPort    int
@@ -77,8 +80,39 @@ func (f *Frontend) l(c *gin.Context) logger.Logger {
 	return f.Logger
 }
 
+// rt returns a RequestTracker for the request.  Once the request is
+// authenticated, the changes it makes are recorded in the audit log.
 func (f *Frontend) rt(c *gin.Context, locks ...string) *backend.RequestTracker {
-	return f.dt.Request(f.l(c), locks...)
+	rt := f.dt.Request(f.l(c), locks...)
+	if obj, ok := c.Get("DRP-CLAIM"); ok {
+		if drpClaim, ok := obj.(*backend.DrpCustomClaims); ok {
+			rt.AuditAs(drpClaim.Id, drpClaim.TokenId, c.ClientIP()).LimitTo(drpClaim)
+		}
+	}
+	return rt
+}
+
+// canGetSecure reports whether the claim of the request allows it to
+// see the values of secure params on the prefix object named by key.
+// obj is that object, if the caller has it.
+func (f *Frontend) canGetSecure(c *gin.Context, prefix, key string, obj models.Model) bool {
+	claim, ok := c.Get("DRP-CLAIM")
+	return ok && (f.assureClaimMatch(c, claim, prefix, "getSecure", key) ||
+		f.assureObjectMatch(claim, prefix, "getSecure", key, obj))
+}
+
+// sanitize prepares res to be sent in response to the request.
+// Sanitizable objects are sanitized, and the values of secure params
+// are redacted unless the request is allowed to see them.
+func (f *Frontend) sanitize(c *gin.Context, res models.Model) models.Model {
+	if s, ok := res.(Sanitizable); ok {
+		res = s.Sanitize()
+	}
+	key := res.Key()
+	if a, ok := res.(backend.AuthSaver); ok {
+		key = a.AuthKey()
+	}
+	return f.dt.RedactModel(res, f.canGetSecure(c, res.Prefix(), key, res))
 }
 
 type AuthSource interface {
@@ -105,6 +139,44 @@ func NewDefaultAuthSource(dt *backend.DataTracker) (das AuthSource) {
 	return
 }
 
+// PasswordAuthSource is an AuthSource that checks passwords itself
+// instead of leaving it to the User it finds.
+type PasswordAuthSource interface {
+	AuthSource
+	Authenticate(f *Frontend, c *gin.Context, username, password string) *backend.User
+}
+
+// LdapAuthSource authenticates users against LDAP when the ldapUrl
+// preference is set.  Local users are tried when LDAP is not set up,
+// is down, or rejects the user, so that break-glass admins can still
+// log in.
+type LdapAuthSource struct {
+	DefaultAuthSource
+	ldap *backend.LdapAuth
+}
+
+func (l LdapAuthSource) Authenticate(f *Frontend, c *gin.Context, username, password string) *backend.User {
+	u, err := l.ldap.Authenticate(f.rt(c, "users", "roles"), username, password)
+	if u != nil {
+		return u
+	}
+	if err != nil {
+		f.l(c).Warnf("LDAP authentication of %s failed: %v", username, err)
+	}
+	u = l.GetUser(f, c, username)
+	if u == nil || !u.CheckPassword(password) {
+		return nil
+	}
+	return u
+}
+
+func NewLdapAuthSource(dt *backend.DataTracker) AuthSource {
+	return LdapAuthSource{
+		DefaultAuthSource: DefaultAuthSource{dt: dt},
+		ldap:              backend.NewLdapAuth(dt),
+	}
+}
+
 func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 	getAll, getOne, patchThem, setThem, setOne, deleteOne func(c *gin.Context)) {
 	trimmer := func(s string) string {
@@ -113,6 +185,9 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 	aggregator := func(c *gin.Context) bool {
 		return c.Query("aggregate") == "true"
 	}
+	explainer := func(c *gin.Context) bool {
+		return c.Query("explain") == "true"
+	}
 	item404 := func(c *gin.Context, found bool, key, line string) bool {
 		if !found {
 			err := &models.Error{
@@ -139,16 +214,36 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 				return
 			}
 			var params map[string]interface{}
+			var explained map[string]*models.ExplainedParam
 			var found bool
+			var ob models.Model
 			rt.Do(func(d backend.Stores) {
-				ob := rt.Find(obj.Prefix(), id)
-				if ob != nil {
-					params, found = rt.GetParams(ob.(models.Paramer), aggregator(c)), true
+				ob = rt.Find(obj.Prefix(), id)
+				if ob == nil {
+					return
+				}
+				found = true
+				if explainer(c) {
+					explained = rt.ExplainParams(ob.(models.Paramer), aggregator(c))
+				} else {
+					params = rt.GetParams(ob.(models.Paramer), aggregator(c))
 				}
 			})
-			if !item404(c, found, id, "Params") {
-				c.JSON(http.StatusOK, params)
+			if item404(c, found, id, "Params") {
+				return
+			}
+			decrypt := f.canGetSecure(c, obj.Prefix(), id, ob)
+			if explained == nil {
+				c.JSON(http.StatusOK, f.dt.RedactParams(params, decrypt))
+				return
 			}
+			for _, ep := range explained {
+				ep.Value = f.dt.RedactParam(ep.Value, decrypt)
+				for i := range ep.Shadowed {
+					ep.Shadowed[i].Value = f.dt.RedactParam(ep.Shadowed[i].Value, decrypt)
+				}
+			}
+			c.JSON(http.StatusOK, explained)
 		},
 		/* getOne */ func(c *gin.Context) {
 			id, rt, key, ok := idrtkeyok(c, "get")
@@ -157,15 +252,16 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 			}
 			var found bool
 			var val interface{}
+			var ob models.Model
 			rt.Do(func(d backend.Stores) {
-				ob := rt.Find(obj.Prefix(), id)
+				ob = rt.Find(obj.Prefix(), id)
 				if ob != nil {
 					found = true
 					val, _ = rt.GetParam(ob.(models.Paramer), key, aggregator(c))
 				}
 			})
 			if !item404(c, found, id, "Param") {
-				c.JSON(http.StatusOK, val)
+				c.JSON(http.StatusOK, f.dt.RedactParam(val, f.canGetSecure(c, obj.Prefix(), id, ob)))
 			}
 		},
 		/* patchThem */ func(c *gin.Context) {
@@ -181,8 +277,10 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 			var res map[string]interface{}
 			var found bool
 			var patchErr *models.Error
+			var ob models.Model
+			var etag string
 			rt.Do(func(d backend.Stores) {
-				ob := rt.Find(obj.Prefix(), id)
+				ob = rt.Find(obj.Prefix(), id)
 				if ob == nil {
 					return
 				}
@@ -199,6 +297,10 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 					Model: obj.Prefix(),
 					Key:   id,
 				}
+				if err := f.ifMatch(c, rt, obj.Prefix(), id); err != nil {
+					patchErr = err.(*models.Error)
+					return
+				}
 				buf, err := json.Marshal(params)
 				if err != nil {
 					patchErr.AddError(err)
@@ -216,12 +318,16 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 				if !patchErr.ContainsError() {
 					patchErr.AddError(rt.SetParams(ob.(models.Paramer), res))
 				}
+				if !patchErr.ContainsError() {
+					etag = backend.ETag(rt.Version(obj.Prefix(), ob.Key()))
+				}
 			})
 			if !item404(c, found, id, "Params") {
 				if patchErr.ContainsError() {
 					c.JSON(patchErr.Code, patchErr)
 				} else {
-					c.JSON(http.StatusOK, res)
+					c.Header("ETag", etag)
+					c.JSON(http.StatusOK, f.dt.RedactParams(res, f.canGetSecure(c, obj.Prefix(), id, ob)))
 				}
 			}
 		},
@@ -236,18 +342,26 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 			}
 			var found bool
 			var err error
+			var etag string
 			rt.Do(func(d backend.Stores) {
 				ob := rt.Find(obj.Prefix(), id)
 				if ob == nil {
 					return
 				}
 				found = true
+				if err = f.ifMatch(c, rt, obj.Prefix(), id); err != nil {
+					return
+				}
 				err = rt.SetParams(ob.(models.Paramer), replacement)
+				if err == nil {
+					etag = backend.ETag(rt.Version(obj.Prefix(), ob.Key()))
+				}
 			})
 			if !item404(c, found, id, "Params") {
 				if err != nil {
 					c.JSON(err.(*models.Error).Code, err)
 				} else {
+					c.Header("ETag", etag)
 					c.JSON(http.StatusOK, replacement)
 				}
 			}
@@ -263,18 +377,26 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 			}
 			var found bool
 			var err error
+			var etag string
 			rt.Do(func(d backend.Stores) {
 				ob := rt.Find(obj.Prefix(), id)
 				if ob == nil {
 					return
 				}
 				found = true
+				if err = f.ifMatch(c, rt, obj.Prefix(), id); err != nil {
+					return
+				}
 				err = rt.SetParam(ob.(models.Paramer), key, replacement)
+				if err == nil {
+					etag = backend.ETag(rt.Version(obj.Prefix(), ob.Key()))
+				}
 			})
 			if !item404(c, found, id, "Params") {
 				if err != nil {
 					c.JSON(err.(*models.Error).Code, err)
 				} else {
+					c.Header("ETag", etag)
 					c.JSON(http.StatusOK, replacement)
 				}
 			}
@@ -287,19 +409,28 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 			var found bool
 			var val interface{}
 			var err error
+			var ob models.Model
+			var etag string
 			rt.Do(func(d backend.Stores) {
-				ob := rt.Find(obj.Prefix(), id)
+				ob = rt.Find(obj.Prefix(), id)
 				if ob == nil {
 					return
 				}
 				found = true
+				if err = f.ifMatch(c, rt, obj.Prefix(), id); err != nil {
+					return
+				}
 				val, err = rt.DelParam(ob.(models.Paramer), key)
+				if err == nil {
+					etag = backend.ETag(rt.Version(obj.Prefix(), ob.Key()))
+				}
 			})
 			if !item404(c, found, id, "Params") {
 				if err != nil {
 					c.JSON(err.(*models.Error).Code, err)
 				} else {
-					c.JSON(http.StatusOK, val)
+					c.Header("ETag", etag)
+					c.JSON(http.StatusOK, f.dt.RedactParam(val, f.canGetSecure(c, obj.Prefix(), id, ob)))
 				}
 			}
 		}
@@ -311,6 +442,11 @@ func (fe *Frontend) userAuth() gin.HandlerFunc {
 		if len(authHeader) == 0 {
 			authHeader = c.Query("token")
 			if len(authHeader) == 0 {
+				if t := fe.certClaim(c); t != nil {
+					c.Set("DRP-CLAIM", t)
+					c.Next()
+					return
+				}
 				fe.l(c).Warnf("No authentication header or token")
 				c.Header("WWW-Authenticate", "dr-provision")
 				c.AbortWithStatus(http.StatusUnauthorized)
@@ -324,7 +460,7 @@ func (fe *Frontend) userAuth() gin.HandlerFunc {
 			}
 		}
 		hdrParts := strings.SplitN(authHeader, " ", 2)
-		if len(hdrParts) != 2 || (hdrParts[0] != "Basic" && hdrParts[0] != "Bearer") {
+		if len(hdrParts) != 2 || (hdrParts[0] != "Basic" && hdrParts[0] != "Bearer" && hdrParts[0] != "Key") {
 			fe.l(c).Warnf("Bad auth header: %s", authHeader)
 			c.Header("WWW-Authenticate", "dr-provision")
 			c.AbortWithStatus(http.StatusUnauthorized)
@@ -345,22 +481,87 @@ func (fe *Frontend) userAuth() gin.HandlerFunc {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
 			}
-			user := fe.authSource.GetUser(fe, c, string(userpass[0]))
-			if user == nil {
-				fe.l(c).Warnf("No such user: %s", string(userpass[0]))
-				c.AbortWithStatus(http.StatusForbidden)
+			name, ip := string(userpass[0]), c.ClientIP()
+			if wait := fe.dt.LoginLocked(name, ip); wait > 0 {
+				fe.l(c).Warnf("Logins as %s from %s are locked out", name, ip)
+				c.Header("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+				c.AbortWithStatus(http.StatusTooManyRequests)
+				return
+			}
+			var user *backend.User
+			if pas, ok := fe.authSource.(PasswordAuthSource); ok {
+				user = pas.Authenticate(fe, c, name, string(userpass[1]))
+				if user == nil {
+					fe.l(c).Warnf("Authentication failed for user: %s", name)
+					fe.dt.LoginFailed(fe.rt(c), name, ip)
+					c.AbortWithStatus(http.StatusForbidden)
+					return
+				}
+			} else {
+				user = fe.authSource.GetUser(fe, c, name)
+				if user == nil {
+					fe.l(c).Warnf("No such user: %s", name)
+					fe.dt.LoginFailed(fe.rt(c), name, ip)
+					c.AbortWithStatus(http.StatusForbidden)
+					return
+				}
+				if !user.CheckPassword(string(userpass[1])) {
+					fe.dt.LoginFailed(fe.rt(c), name, ip)
+					c.AbortWithStatus(http.StatusForbidden)
+					return
+				}
+			}
+			// Users with TOTP enabled can only use their password to
+			// get a token, since each code can only be used once.
+			if user.TotpEnabled {
+				if !isTokenRequest(c, name) {
+					fe.l(c).Warnf("User %s has TOTP enabled and must use a token", name)
+					c.Header("WWW-Authenticate", "dr-provision")
+					c.AbortWithStatus(http.StatusUnauthorized)
+					return
+				}
+				if code := totpCode(c); !fe.dt.CheckTotp(user, code) {
+					fe.l(c).Warnf("Missing or invalid TOTP code for user: %s", name)
+					if code != "" {
+						fe.dt.LoginFailed(fe.rt(c), name, ip)
+					}
+					c.Header("WWW-Authenticate", "dr-provision")
+					c.AbortWithStatus(http.StatusUnauthorized)
+					return
+				}
+			}
+			fe.dt.LoginSucceeded(name)
+			t := backend.NewClaim(string(userpass[0]), string(userpass[0]), 30).AddClaims(fe.userClaims(c, user)...)
+			t.SecondFactor = user.TotpEnabled
+			fe.rt(c).Auditf("Authenticated user %s from %s", userpass[0], c.ClientIP())
+			c.Set("DRP-CLAIM", t)
+		} else if hdrParts[0] == "Key" {
+			// API keys are checked with scrypt, so guessing them
+			// is limited by address the same way passwords are.
+			ip := c.ClientIP()
+			if wait := fe.dt.LoginLocked("", ip); wait > 0 {
+				fe.l(c).Warnf("API key logins from %s are locked out", ip)
+				c.Header("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+				c.AbortWithStatus(http.StatusTooManyRequests)
 				return
 			}
-			if !user.CheckPassword(string(userpass[1])) {
+			t := fe.apiKeyClaim(c, hdrParts[1])
+			if t == nil {
+				fe.dt.LoginFailed(fe.rt(c), "", ip)
+				c.Header("WWW-Authenticate", "dr-provision")
 				c.AbortWithStatus(http.StatusForbidden)
 				return
 			}
-			t := backend.NewClaim(string(userpass[0]), string(userpass[0]), 30).Add("*", "*", "*")
-			fe.rt(c).Auditf("Authenticated user %s from %s", userpass[0], c.ClientIP())
 			c.Set("DRP-CLAIM", t)
 		} else if hdrParts[0] == "Bearer" {
 			t, err := fe.dt.GetToken(string(hdrParts[1]))
 			if err != nil {
+				t = fe.oidcClaim(c, string(hdrParts[1]))
+			} else if !fe.secondFactorOK(c, t) {
+				fe.l(c).Warnf("Token for %s was issued without a TOTP code", t.Id)
+				t = nil
+			}
+			if t == nil {
 				fe.l(c).Warnf("No DRP authentication token")
 				c.Header("WWW-Authenticate", "dr-provision")
 				c.AbortWithStatus(http.StatusForbidden)
@@ -372,6 +573,101 @@ func (fe *Frontend) userAuth() gin.HandlerFunc {
 	}
 }
 
+// isTokenRequest returns true if c is a request for a token for the
+// user called name.
+func isTokenRequest(c *gin.Context, name string) bool {
+	return c.Request.Method == http.MethodGet &&
+		c.Param("name") == name &&
+		strings.HasSuffix(c.Request.URL.Path, "/users/"+name+"/token")
+}
+
+// secondFactorOK returns false if t is a token of a user with TOTP
+// enabled that was issued without a TOTP code.
+func (fe *Frontend) secondFactorOK(c *gin.Context, t *backend.DrpCustomClaims) bool {
+	if t.SecondFactor || !t.HasUserId() {
+		return true
+	}
+	ok := true
+	rt := fe.rt(c, "users")
+	rt.Do(func(d backend.Stores) {
+		if obj := rt.Find("users", t.UserId()); obj != nil {
+			ok = !backend.AsUser(obj).TotpEnabled
+		}
+	})
+	return ok
+}
+
+// totpCode returns the TOTP code of the request, from the X-DRP-TOTP
+// header or the totp query parameter.
+func totpCode(c *gin.Context) string {
+	if code := c.Request.Header.Get("X-DRP-TOTP"); code != "" {
+		return code
+	}
+	return c.Query("totp")
+}
+
+// certClaim returns the claims for the User or Machine named by the
+// verified client certificate of the request, if it has one.  Client
+// certificates are only verified when the server has a client CA.
+func (fe *Frontend) certClaim(c *gin.Context) *backend.DrpCustomClaims {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	cert := c.Request.TLS.VerifiedChains[0][0]
+	user, machine := fe.dt.CertIdentity(fe.rt(c, "users", "machines"), cert)
+	if machine != nil {
+		fe.rt(c).Auditf("Authenticated machine %s from %s with a client certificate", machine.Key(), c.ClientIP())
+		return fe.dt.MachineClaim(machine, 30)
+	}
+	if user != nil {
+		fe.rt(c).Auditf("Authenticated user %s from %s with a client certificate", user.Name, c.ClientIP())
+		return backend.NewClaim(user.Name, user.Name, 30).AddClaims(fe.userClaims(c, user)...)
+	}
+	fe.l(c).Warnf("No User or Machine for client certificate %s", cert.Subject.CommonName)
+	return nil
+}
+
+// oidcClaim returns the claims for token if it was issued by the
+// OpenID Connect provider in the oidcIssuer preference.
+func (fe *Frontend) oidcClaim(c *gin.Context, token string) *backend.DrpCustomClaims {
+	user, err := fe.oidc.Authenticate(fe.rt(c, "users", "roles"), token)
+	if user == nil {
+		if err != nil {
+			fe.l(c).Warnf("OpenID Connect authentication failed: %v", err)
+		}
+		return nil
+	}
+	fe.rt(c).Auditf("Authenticated user %s from %s with OpenID Connect", user.Name, c.ClientIP())
+	return backend.NewClaim(user.Name, user.Name, 30).AddClaims(fe.userClaims(c, user)...)
+}
+
+// apiKeyClaim returns the claims for apiKey, which can do what both
+// its own Claims and the Roles of its User allow.
+func (fe *Frontend) apiKeyClaim(c *gin.Context, apiKey string) *backend.DrpCustomClaims {
+	user, key, err := fe.apiKeys.Authenticate(fe.rt(c, "users", "roles"), apiKey, net.ParseIP(c.ClientIP()))
+	if err != nil {
+		fe.l(c).Warnf("API key authentication failed: %v", err)
+		return nil
+	}
+	userClaims := fe.userClaims(c, user)
+	t := backend.NewClaim(user.Name, user.Name, 30)
+	if len(key.Claims) == 0 {
+		return t.AddClaims(userClaims...)
+	}
+	kt := backend.NewClaim(user.Name, user.Name, 30).AddClaims(key.Claims...)
+	return t.AddClaims(kt.Limit(userClaims)...)
+}
+
+// userClaims returns the Claims of all the Roles of user.
+func (fe *Frontend) userClaims(c *gin.Context, user *backend.User) []*backend.Claim {
+	var res []*backend.Claim
+	rt := fe.rt(c, "roles")
+	rt.Do(func(d backend.Stores) {
+		res = user.Claims(rt)
+	})
+	return res
+}
+
 var EmbeddedAssetsServerFunc func(*gin.Engine, logger.Logger) error
 
 func NewFrontend(
@@ -402,11 +698,13 @@ func NewFrontend(
 		NoBinl:     noBinl,
 		SaasDir:    saasDir,
 		authSource: authSource,
+		oidc:       backend.NewOidcAuth(dt),
+		apiKeys:    backend.NewApiKeyAuth(),
 	}
 	gin.SetMode(gin.ReleaseMode)
 
 	if me.authSource == nil {
-		me.authSource = NewDefaultAuthSource(dt)
+		me.authSource = NewLdapAuthSource(dt)
 	}
 
 	mgmtApi := gin.New()
@@ -460,6 +758,8 @@ func NewFrontend(
 			"X-Return-Attributes",
 			"X-Log-Level",
 			"X-Log-Token",
+			"X-DRP-TOTP",
+			"If-Match",
 			"Range",
 		},
 		ExposeHeaders: []string{
@@ -472,6 +772,8 @@ func NewFrontend(
 			"X-Return-Attributes",
 			"X-DRP-LIST-COUNT",
 			"X-DRP-LIST-TOTAL-COUNT",
+			"Retry-After",
+			"ETag",
 		},
 	}))
 
@@ -495,6 +797,9 @@ func NewFrontend(
 	me.InitReservationApi()
 	me.InitSubnetApi()
 	me.InitUserApi(drpid)
+	me.InitRoleApi()
+	me.InitTokenApi()
+	me.InitAuditApi()
 	me.InitInterfaceApi()
 	me.InitPrefApi()
 	me.InitParamApi()
@@ -505,9 +810,11 @@ func NewFrontend(
 	me.InitTaskApi()
 	me.InitJobApi()
 	me.InitWorkflowApi()
+	me.InitBulkOperationApi()
 	me.InitEventApi()
 	me.InitContentApi()
 	me.InitSystemApi()
+	me.InitOidcApi()
 
 	if EmbeddedAssetsServerFunc != nil {
 		EmbeddedAssetsServerFunc(mgmtApi, lgr)
@@ -582,14 +889,59 @@ func (f *Frontend) assureClaimMatch(c *gin.Context, claim interface{}, scope, ac
 	return false
 }
 
-//
-// THIS MUST NOT BE CALLED UNDER LOCKS!
-//
-func (f *Frontend) assureAuthWithClaim(c *gin.Context, claim interface{}, scope, action, specific string) bool {
-	if !f.assureClaimMatch(c, claim, scope, action, specific) {
+// assureObjectMatch tests the claims that are limited by a Filter
+// against obj, which is the object named by scope and specific.  It
+// can be called under locks, but will not validate the secrets.
+func (f *Frontend) assureObjectMatch(claim interface{}, scope, action, specific string, obj models.Model) bool {
+	drpClaim, ok := claim.(*backend.DrpCustomClaims)
+	if !ok || obj == nil || !drpClaim.HasFilters(scope, action) {
 		return false
 	}
+	if drpClaim.MatchObject(scope, action, specific, obj) {
+		f.Logger.Debugf("Filtered claims ok: '%s' '%s' '%s'", scope, action, specific)
+		return true
+	}
+	f.Logger.Debugf("Filtered claims failed: '%s' '%s' '%s'", scope, action, specific)
+	return false
+}
+
+// findForAuth fetches the object that scope and key name so that it
+// can be tested against claims with a Filter.  It must not be called
+// under locks.
+func (f *Frontend) findForAuth(c *gin.Context, claim interface{}, scope, action, key string) models.Model {
+	drpClaim, ok := claim.(*backend.DrpCustomClaims)
+	if !ok || key == "" || !drpClaim.HasFilters(scope, action) || !f.dt.HasStore(scope) {
+		return nil
+	}
+	var res models.Model
+	rt := f.rt(c, scope)
+	rt.Do(func(d backend.Stores) {
+		res = rt.Find(scope, key)
+	})
+	return res
+}
 
+// assureAuthWithClaim must not be called under locks.  objs are the
+// objects the request is for, if the caller has them.  Otherwise the
+// object is looked up when a claim with a Filter needs it.  Claims
+// with a Filter must match all of objs.
+func (f *Frontend) assureAuthWithClaim(c *gin.Context, claim interface{}, scope, action, specific string, objs ...models.Model) bool {
+	if !f.assureClaimMatch(c, claim, scope, action, specific) {
+		if len(objs) == 0 {
+			objs = []models.Model{f.findForAuth(c, claim, scope, action, specific)}
+		}
+		for _, obj := range objs {
+			if !f.assureObjectMatch(claim, scope, action, specific, obj) {
+				return false
+			}
+		}
+	}
+	return f.assureClaimSecrets(c, claim.(*backend.DrpCustomClaims))
+}
+
+// assureClaimSecrets checks that the secrets in drpClaim are still
+// current.  It must not be called under locks.
+func (f *Frontend) assureClaimSecrets(c *gin.Context, drpClaim *backend.DrpCustomClaims) bool {
 	userSecret := ""
 	grantorSecret := ""
 	machineSecret := ""
@@ -597,7 +949,6 @@ func (f *Frontend) assureAuthWithClaim(c *gin.Context, claim interface{}, scope,
 	machineRef := &backend.Machine{}
 	userRT := f.rt(c, userRef.Locks("get")...)
 	machineRT := f.rt(c, machineRef.Locks("get")...)
-	drpClaim := claim.(*backend.DrpCustomClaims)
 	if drpClaim.HasUserId() {
 		userRT.Do(func(d backend.Stores) {
 			userRT.Debugf("claim has user id %v", drpClaim.UserId())
@@ -639,16 +990,45 @@ func (f *Frontend) assureAuthWithClaim(c *gin.Context, claim interface{}, scope,
 // THIS MUST NOT BE CALLED UNDER LOCKS!
 //
 func (f *Frontend) assureAuth(c *gin.Context, scope, action, specific string) bool {
+	return f.assureAuthFor(c, scope, action, specific)
+}
+
+// assureAuthFor is assureAuth for when the caller already has the
+// objects the request is for, such as a new object or both the old
+// and new versions of an updated one.  It must not be called under
+// locks.
+func (f *Frontend) assureAuthFor(c *gin.Context, scope, action, specific string, refs ...models.Model) bool {
 	obj, ok := c.Get("DRP-CLAIM")
-	if !ok || !f.assureAuthWithClaim(c, obj, scope, action, specific) {
-		f.rt(c).Auditf("Failed auth %s - %s %s %s - %s", obj.(*backend.DrpCustomClaims).Id,
-			scope, action, specific, c.ClientIP())
-		c.AbortWithStatus(http.StatusForbidden)
+	if !ok || !f.assureAuthWithClaim(c, obj, scope, action, specific, refs...) {
+		f.authFailed(c, obj, scope, action, specific)
 		return false
 	}
 	return true
 }
 
+func (f *Frontend) authFailed(c *gin.Context, obj interface{}, scope, action, specific string) {
+	f.rt(c).Auditf("Failed auth %s - %s %s %s - %s", obj.(*backend.DrpCustomClaims).Id,
+		scope, action, specific, c.ClientIP())
+	c.AbortWithStatus(http.StatusForbidden)
+}
+
+// assureListAuth is assureAuth for listing the prefix objects.  If
+// the request can only list the objects that match the Filters of its
+// claims, those claims are returned so the caller can limit the list.
+// It must not be called under locks.
+func (f *Frontend) assureListAuth(c *gin.Context, prefix string) (*backend.DrpCustomClaims, bool) {
+	obj, _ := c.Get("DRP-CLAIM")
+	drpClaim, ok := obj.(*backend.DrpCustomClaims)
+	if !ok || drpClaim.Match(prefix, "list", "") || !drpClaim.HasFilters(prefix, "list") {
+		return nil, f.assureAuth(c, prefix, "list", "")
+	}
+	if !f.assureClaimSecrets(c, drpClaim) {
+		f.authFailed(c, obj, prefix, "list", "")
+		return nil, false
+	}
+	return drpClaim, true
+}
+
 func assureDecode(c *gin.Context, val interface{}) bool {
 	if !assureContentType(c, "application/json") {
 		return false
@@ -795,6 +1175,36 @@ func (f *Frontend) processFilters(rt *backend.RequestTracker, d backend.Stores,
 	return filters, nil
 }
 
+// ifMatch returns a 412 error if the request has an If-Match header
+// that does not match the ETag of the object of type prefix with key.
+// It must be called in the same Do as the change it guards, so that
+// nothing can change the object in between.  An object that does not
+// exist is left for the change to fail on.
+func (f *Frontend) ifMatch(c *gin.Context, rt *backend.RequestTracker, prefix, key string) error {
+	tags := c.Request.Header.Get("If-Match")
+	if tags == "" {
+		return nil
+	}
+	obj := rt.Find(prefix, key)
+	if obj == nil {
+		return nil
+	}
+	etag := backend.ETag(rt.Version(prefix, obj.Key()))
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return nil
+		}
+	}
+	res := &models.Error{
+		Code:  http.StatusPreconditionFailed,
+		Type:  c.Request.Method,
+		Model: prefix,
+		Key:   key,
+	}
+	res.Errorf("%s has changed: its ETag is %s, not %s", key, etag, tags)
+	return res
+}
+
 func jsonError(c *gin.Context, err error, code int, base string) {
 	if ne, ok := err.(*models.Error); ok {
 		c.JSON(ne.Code, ne)
@@ -811,7 +1221,8 @@ func jsonError(c *gin.Context, err error, code int, base string) {
 
 func (f *Frontend) list(c *gin.Context, ref store.KeySaver, statsOnly bool) {
 	backend.Fill(ref)
-	if !f.assureAuth(c, ref.Prefix(), "list", "") {
+	scoped, ok := f.assureListAuth(c, ref.Prefix())
+	if !ok {
 		return
 	}
 	res := &models.Error{
@@ -831,6 +1242,11 @@ func (f *Frontend) list(c *gin.Context, ref store.KeySaver, statsOnly bool) {
 		}
 
 		mainIndex := &d(ref.Prefix()).Index
+		if scoped != nil {
+			mainIndex, _ = index.Select(func(m models.Model) bool {
+				return scoped.MatchObject(ref.Prefix(), "list", m.(backend.AuthSaver).AuthKey(), m)
+			})(mainIndex)
+		}
 		c.Header("X-DRP-LIST-TOTAL-COUNT", fmt.Sprintf("%d", mainIndex.Count()))
 
 		idx, err := index.All(filters...)(mainIndex)
@@ -847,14 +1263,10 @@ func (f *Frontend) list(c *gin.Context, ref store.KeySaver, statsOnly bool) {
 		items := idx.Items()
 		for i, item := range items {
 			arr = append(arr, models.Clone(item))
-			f, ok := arr[i].(models.Filler)
-			if ok {
-				f.Fill()
-			}
-			s, ok := arr[i].(Sanitizable)
-			if ok {
-				arr[i] = s.Sanitize()
+			if fl, ok := arr[i].(models.Filler); ok {
+				fl.Fill()
 			}
+			arr[i] = f.sanitize(c, arr[i])
 		}
 	})
 
@@ -874,7 +1286,6 @@ func (f *Frontend) ListStats(c *gin.Context, ref store.KeySaver) {
 	f.list(c, ref, true)
 }
 
-// XXX: Auth enforce may need to limit return values based up access to get - one day.
 func (f *Frontend) List(c *gin.Context, ref store.KeySaver) {
 	f.list(c, ref, false)
 }
@@ -883,11 +1294,16 @@ func (f *Frontend) Exists(c *gin.Context, ref store.KeySaver, key string) {
 	backend.Fill(ref)
 	prefix := ref.Prefix()
 	var found bool
+	var etag string
 	rt := f.rt(c, ref.(Lockable).Locks("get")...)
 	rt.Do(func(d backend.Stores) {
-		found = rt.Find(prefix, key) != nil
+		if obj := rt.Find(prefix, key); obj != nil {
+			found = true
+			etag = backend.ETag(rt.Version(prefix, obj.Key()))
+		}
 	})
 	if found {
+		c.Header("ETag", etag)
 		c.Status(http.StatusOK)
 	} else {
 		c.Status(http.StatusNotFound)
@@ -899,19 +1315,21 @@ func (f *Frontend) Fetch(c *gin.Context, ref store.KeySaver, key string) {
 	prefix := ref.Prefix()
 	var err error
 	var res models.Model
+	var etag string
 	rt := f.rt(c, ref.(Lockable).Locks("get")...)
 	rt.Do(func(d backend.Stores) {
 		res = rt.Find(prefix, key)
+		if res != nil {
+			etag = backend.ETag(rt.Version(prefix, res.Key()))
+		}
 	})
 	if res != nil {
 		aref, _ := res.(backend.AuthSaver)
-		if !f.assureAuth(c, prefix, "get", aref.AuthKey()) {
+		if !f.assureAuthFor(c, prefix, "get", aref.AuthKey(), res) {
 			return
 		}
-		s, ok := res.(Sanitizable)
-		if ok {
-			res = s.Sanitize()
-		}
+		res = f.sanitize(c, res)
+		c.Header("ETag", etag)
 		c.JSON(http.StatusOK, res)
 	} else {
 		rerr := &models.Error{
@@ -933,29 +1351,47 @@ func (f *Frontend) Create(c *gin.Context, val store.KeySaver) {
 	if !assureDecode(c, val) {
 		return
 	}
-	if !f.assureAuth(c, val.Prefix(), "create", "") {
+	if !f.assureAuthFor(c, val.Prefix(), "create", "", val) {
 		return
 	}
 	var err error
 	var res models.Model
+	var etag string
 	rt := f.rt(c, val.(Lockable).Locks("create")...)
 	rt.Do(func(d backend.Stores) {
 		_, err = rt.Create(val)
 		if err == nil {
 			res = models.Clone(val)
+			etag = backend.ETag(rt.Version(val.Prefix(), val.Key()))
 		}
 	})
 	if err != nil {
 		jsonError(c, err, http.StatusBadRequest, "")
 	} else {
-		s, ok := res.(Sanitizable)
-		if ok {
-			res = s.Sanitize()
-		}
+		res = f.sanitize(c, res)
+		c.Header("ETag", etag)
 		c.JSON(http.StatusCreated, res)
 	}
 }
 
+// patchedForAuth returns what tref would be after patch is applied,
+// so that claims with a Filter can be tested against it.
+func patchedForAuth(ref store.KeySaver, tref models.Model, patch jsonpatch2.Patch) models.Model {
+	buf, err := json.Marshal(tref)
+	if err != nil {
+		return nil
+	}
+	patched, err, _ := patch.Apply(buf)
+	if err != nil {
+		return nil
+	}
+	res := ref.New()
+	if json.Unmarshal(patched, res) != nil {
+		return nil
+	}
+	return res
+}
+
 func (f *Frontend) Patch(c *gin.Context, ref store.KeySaver, key string) {
 	backend.Fill(ref)
 	patch := make(jsonpatch2.Patch, 0)
@@ -973,21 +1409,26 @@ func (f *Frontend) Patch(c *gin.Context, ref store.KeySaver, key string) {
 		}
 	})
 
-	if authKey != "" && !f.assureAuth(c, ref.Prefix(), "patch", authKey) {
+	if authKey != "" && !f.assureAuthFor(c, ref.Prefix(), "patch", authKey, tref, patchedForAuth(ref, tref, patch)) {
 		return
 	}
 
 	var res models.Model
+	var etag string
 	rt.Do(func(d backend.Stores) {
+		if err = f.ifMatch(c, rt, ref.Prefix(), key); err != nil {
+			return
+		}
 		// This will fail with notfound as well.
 		a, b := rt.Patch(ref, key, patch)
 		res, err = models.Clone(a), b
+		if err == nil {
+			etag = backend.ETag(rt.Version(ref.Prefix(), a.Key()))
+		}
 	})
 	if err == nil {
-		s, ok := res.(Sanitizable)
-		if ok {
-			res = s.Sanitize()
-		}
+		res = f.sanitize(c, res)
+		c.Header("ETag", etag)
 		c.JSON(http.StatusOK, res)
 		return
 	}
@@ -1011,27 +1452,37 @@ func (f *Frontend) Update(c *gin.Context, ref store.KeySaver, key string) {
 		return
 	}
 	var err error
+	var tref models.Model
 	authKey := ""
 	rt := f.rt(c, ref.(Lockable).Locks("update")...)
 	rt.Do(func(d backend.Stores) {
-		tref := rt.Find(ref.Prefix(), ref.Key())
+		tref = rt.Find(ref.Prefix(), ref.Key())
 		if tref != nil {
 			authKey = tref.(backend.AuthSaver).AuthKey()
 		}
 	})
-	if !f.assureAuth(c, ref.Prefix(), "update", authKey) {
+	if tref == nil {
+		if !f.assureAuth(c, ref.Prefix(), "update", authKey) {
+			return
+		}
+	} else if !f.assureAuthFor(c, ref.Prefix(), "update", authKey, tref, ref) {
 		return
 	}
 	var res models.Model
+	var etag string
 	rt.Do(func(d backend.Stores) {
+		if err = f.ifMatch(c, rt, ref.Prefix(), key); err != nil {
+			return
+		}
 		_, b := rt.Update(ref)
 		res, err = models.Clone(ref), b
+		if err == nil {
+			etag = backend.ETag(rt.Version(ref.Prefix(), key))
+		}
 	})
 	if err == nil {
-		s, ok := ref.(Sanitizable)
-		if ok {
-			res = s.Sanitize()
-		}
+		res = f.sanitize(c, res)
+		c.Header("ETag", etag)
 		c.JSON(http.StatusOK, res)
 		return
 	}
@@ -1061,20 +1512,20 @@ func (f *Frontend) Remove(c *gin.Context, ref store.KeySaver, key string) {
 		return
 	}
 
-	if !f.assureAuth(c, ref.Prefix(), "delete", res.(backend.AuthSaver).AuthKey()) {
+	if !f.assureAuthFor(c, ref.Prefix(), "delete", res.(backend.AuthSaver).AuthKey(), res) {
 		return
 	}
 	rt.Do(func(d backend.Stores) {
+		if err = f.ifMatch(c, rt, ref.Prefix(), key); err != nil {
+			return
+		}
 		_, err = rt.Remove(res)
 	})
 
 	if err != nil {
 		jsonError(c, err, http.StatusNotFound, "")
 	} else {
-		s, ok := res.(Sanitizable)
-		if ok {
-			res = s.Sanitize()
-		}
+		res = f.sanitize(c, res)
 		c.JSON(http.StatusOK, res)
 	}
 }
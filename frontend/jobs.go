@@ -2,7 +2,10 @@ package frontend
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -57,6 +60,17 @@ type JobLogResponse struct {
 	Body string
 }
 
+// JobLogQueryParameter used to read part of a Job log
+// swagger:parameters getJobLog
+type JobLogQueryParameter struct {
+	// The byte offset in the log to start reading from.  This can be
+	// used along with the Offset of jobs.log events to resume reading
+	// a log.
+	//
+	// in: query
+	Offset int64 `json:"offset"`
+}
+
 // JobBodyParameter used to inject a Job
 // swagger:parameters createJob putJob
 type JobBodyParameter struct {
@@ -82,7 +96,7 @@ type JobLogPutBodyParameter struct {
 }
 
 // JobPathParameter used to find a Job in the path
-// swagger:parameters putJobs getJob putJob patchJob deleteJob getJobParams postJobParams getJobActions getJobLog putJobLog headJob
+// swagger:parameters putJobs getJob putJob patchJob deleteJob getJobParams postJobParams getJobActions getJobLog putJobLog headJob listJobArtifacts
 type JobPathParameter struct {
 	// in: path
 	// required: true
@@ -90,6 +104,51 @@ type JobPathParameter struct {
 	Uuid uuid.UUID `json:"uuid"`
 }
 
+// JobArtifactsResponse return on a successful GET of a Job's artifacts
+// swagger:response
+type JobArtifactsResponse struct {
+	// in: body
+	Body []models.JobArtifact
+}
+
+// JobArtifactInfoResponse returned on a successful upload of a Job artifact
+// swagger:response
+type JobArtifactInfoResponse struct {
+	// in: body
+	Body *models.JobArtifact
+}
+
+// This is a HACK - I can't figure out how to get
+// swagger to render this a binary.  So we lie.
+//
+// JobArtifactResponse returned on a successful GET of a Job artifact
+// swagger:response
+type JobArtifactResponse struct {
+	// in: body
+	// format: binary
+	Body string
+}
+
+// JobArtifactPathParameter used to find a Job artifact in the path
+// swagger:parameters getJobArtifact uploadJobArtifact deleteJobArtifact
+type JobArtifactPathParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: path
+	// required: true
+	Path string `json:"path"`
+}
+
+// JobArtifactBodyParameter used to upload a Job artifact
+// swagger:parameters uploadJobArtifact
+type JobArtifactBodyParameter struct {
+	// in: body
+	// required: true
+	Body interface{}
+}
+
 // JobParamsBodyParameter used to set Job Params
 // swagger:parameters postJobParams
 type JobParamsBodyParameter struct {
@@ -546,6 +605,7 @@ func (f *Frontend) InitJobApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       406: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/jobs/:uuid",
 		func(c *gin.Context) {
@@ -564,6 +624,7 @@ func (f *Frontend) InitJobApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/jobs/:uuid",
 		func(c *gin.Context) {
@@ -581,6 +642,7 @@ func (f *Frontend) InitJobApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/jobs/:uuid",
 		func(c *gin.Context) {
@@ -644,6 +706,13 @@ func (f *Frontend) InitJobApi() {
 	// Get the log for this job
 	//
 	// Get log for the Job specified by {uuid} or return NotFound.
+	// If offset is given, the log will be returned starting at that
+	// byte offset.
+	//
+	// Anything appended to the log will also be published as a
+	// jobs.log.{uuid} event with the offset it was written at, so a
+	// client can follow a running job by registering for those events
+	// over the websocket.
 	//
 	//     Produces:
 	//       application/octet-stream
@@ -651,6 +720,7 @@ func (f *Frontend) InitJobApi() {
 	//
 	//     Responses:
 	//       200: JobLogResponse
+	//       400: ErrorResponse
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
@@ -683,8 +753,36 @@ func (f *Frontend) InitJobApi() {
 				return
 			}
 
+			var offset int64
+			if val := c.Query("offset"); val != "" {
+				var perr error
+				offset, perr = strconv.ParseInt(val, 10, 64)
+				if perr != nil || offset < 0 {
+					c.JSON(http.StatusBadRequest,
+						models.NewError(c.Request.Method, http.StatusBadRequest,
+							fmt.Sprintf("Invalid offset %s", val)))
+					return
+				}
+			}
 			c.Writer.Header().Set("Content-Type", "application/octet-stream")
-			c.File(path)
+			if offset == 0 {
+				c.File(path)
+				return
+			}
+			fi, ferr := os.Open(path)
+			if ferr != nil {
+				c.JSON(http.StatusInternalServerError,
+					models.NewError(c.Request.Method, http.StatusInternalServerError, ferr.Error()))
+				return
+			}
+			defer fi.Close()
+			if _, ferr := fi.Seek(offset, io.SeekStart); ferr != nil {
+				c.JSON(http.StatusInternalServerError,
+					models.NewError(c.Request.Method, http.StatusInternalServerError, ferr.Error()))
+				return
+			}
+			c.Status(http.StatusOK)
+			io.Copy(c.Writer, fi)
 		})
 
 	// swagger:route PUT /jobs/{uuid}/log Jobs putJobLog
@@ -766,6 +864,167 @@ func (f *Frontend) InitJobApi() {
 			}
 		})
 
+	// findJob fetches the Job named by the uuid path parameter and
+	// makes sure the caller is allowed to perform action on it.
+	findJob := func(c *gin.Context, rt *backend.RequestTracker, action string) *backend.Job {
+		uuid := c.Param(`uuid`)
+		var j *backend.Job
+		rt.Do(func(d backend.Stores) {
+			if jo := d("jobs").Find(uuid); jo != nil {
+				j = backend.AsJob(models.Clone(jo).(*models.Job))
+			}
+		})
+		if j == nil {
+			err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+				Messages: []string{fmt.Sprintf("Job %s does not exist", uuid)}}
+			c.JSON(err.Code, err)
+			return nil
+		}
+		if !f.assureAuth(c, "jobs", action, j.AuthKey()) {
+			return nil
+		}
+		return j
+	}
+
+	// swagger:route GET /jobs/{uuid}/artifacts Jobs listJobArtifacts
+	//
+	// List the artifacts for this job
+	//
+	// List the artifacts that have been uploaded for the Job specified by {uuid}.
+	//
+	//     Responses:
+	//       200: JobArtifactsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/jobs/:uuid/artifacts",
+		func(c *gin.Context) {
+			j := findJob(c, f.rt(c, "jobs"), "get")
+			if j == nil {
+				return
+			}
+			j.Fill()
+			c.JSON(http.StatusOK, j.Artifacts)
+		})
+
+	// swagger:route GET /jobs/{uuid}/artifacts/{path} Jobs getJobArtifact
+	//
+	// Get an artifact for this job
+	//
+	// Get the artifact at {path} for the Job specified by {uuid}.  The
+	// artifact will be returned with the content type it was uploaded with.
+	//
+	//     Produces:
+	//       application/octet-stream
+	//       application/json
+	//
+	//     Responses:
+	//       200: JobArtifactResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/jobs/:uuid/artifacts/*path",
+		func(c *gin.Context) {
+			rt := f.rt(c, "jobs")
+			j := findJob(c, rt, "get")
+			if j == nil {
+				return
+			}
+			artifact := j.Artifact(c.Param(`path`))
+			if artifact == nil {
+				err := &models.Error{Code: http.StatusNotFound, Type: c.Request.Method,
+					Model: j.Prefix(), Key: j.Key()}
+				err.Errorf("Artifact %s does not exist", c.Param(`path`))
+				c.JSON(err.Code, err)
+				return
+			}
+			fileName, _ := j.ArtifactPath(rt, artifact.Path)
+			c.Writer.Header().Set("Content-Type", artifact.ContentType)
+			c.File(fileName)
+		})
+
+	// swagger:route POST /jobs/{uuid}/artifacts/{path} Jobs uploadJobArtifact
+	//
+	// Upload an artifact for this job
+	//
+	// The body of the request will be stored as the artifact at {path}
+	// for the Job specified by {uuid}, replacing any artifact already
+	// at {path}.  The Content-Type of the request is recorded as the
+	// content type of the artifact.  If it is application/octet-stream,
+	// the content type will be guessed from the extension of {path}.
+	//
+	// Artifacts cannot be uploaded to archived jobs.  The size of
+	// artifacts is limited by the jobArtifactMaxSize and jobArtifactQuota
+	// preferences.
+	//
+	//     Consumes:
+	//       application/octet-stream
+	//
+	//     Produces:
+	//       application/json
+	//
+	//     Responses:
+	//       201: JobArtifactInfoResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       413: ErrorResponse
+	//       507: ErrorResponse
+	f.ApiGroup.POST("/jobs/:uuid/artifacts/*path",
+		func(c *gin.Context) {
+			if c.Request.Body == nil {
+				err := &models.Error{Code: http.StatusBadRequest, Type: c.Request.Method}
+				err.Errorf("Missing upload body")
+				c.JSON(err.Code, err)
+				return
+			}
+			defer c.Request.Body.Close()
+			j := &backend.Job{}
+			rt := f.rt(c, j.Locks("update")...)
+			if j = findJob(c, rt, "artifacts"); j == nil {
+				return
+			}
+			res, err := j.AddArtifact(rt, c.Param(`path`), c.Request.Header.Get(`Content-Type`), c.Request.Body)
+			if err != nil {
+				jsonError(c, err, http.StatusBadRequest, j.Prefix())
+				return
+			}
+			c.JSON(http.StatusCreated, res)
+		})
+
+	// swagger:route DELETE /jobs/{uuid}/artifacts/{path} Jobs deleteJobArtifact
+	//
+	// Delete an artifact for this job
+	//
+	// Delete the artifact at {path} for the Job specified by {uuid}.
+	//
+	//     Responses:
+	//       204: NoContentResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.DELETE("/jobs/:uuid/artifacts/*path",
+		func(c *gin.Context) {
+			j := &backend.Job{}
+			rt := f.rt(c, j.Locks("update")...)
+			if j = findJob(c, rt, "artifacts"); j == nil {
+				return
+			}
+			var err error
+			rt.Do(func(d backend.Stores) {
+				if jo := d("jobs").Find(j.Key()); jo != nil {
+					err = backend.AsJob(jo).RemoveArtifact(rt, c.Param(`path`))
+				}
+			})
+			if err != nil {
+				jsonError(c, err, http.StatusBadRequest, j.Prefix())
+				return
+			}
+			c.Data(http.StatusNoContent, gin.MIMEJSON, nil)
+		})
+
 	job := &backend.Job{}
 	pActions, pAction, pRun := f.makeActionEndpoints(job.Prefix(), job, "uuid")
 
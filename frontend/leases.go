@@ -241,6 +241,7 @@ func (f *Frontend) InitLeaseApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/leases/:address",
 		func(c *gin.Context) {
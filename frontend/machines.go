@@ -1,7 +1,9 @@
 package frontend
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/VictorLowther/jsonpatch2"
 	"github.com/digitalrebar/provision/backend"
@@ -82,8 +84,62 @@ type MachinePostParamsParameter struct {
 	Body map[string]interface{}
 }
 
+// MachineTokenParameter used to get a new token for a Machine
+// swagger:parameters getMachineToken
+type MachineTokenParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+}
+
+// MachineInventoryResponse return on a successful GET of a Machine inventory snapshot
+// swagger:response
+type MachineInventoryResponse struct {
+	// in: body
+	Body *models.Inventory
+}
+
+// MachineInventoryHistoryResponse return on a successful GET of the inventory snapshot IDs of a Machine
+// swagger:response
+type MachineInventoryHistoryResponse struct {
+	// in: body
+	Body []string
+}
+
+// MachineInventorySnapshotResponse return on a successful POST of a Machine inventory
+// swagger:response
+type MachineInventorySnapshotResponse struct {
+	// in: body
+	Body *models.InventorySnapshot
+}
+
+// MachineInventoryParameter used to upload the inventory of a Machine
+// swagger:parameters postMachineInventory
+type MachineInventoryParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: body
+	// required: true
+	Body *models.Inventory
+}
+
+// MachineInventoryPathParameter used to find a Machine inventory snapshot in the path
+// swagger:parameters getMachineInventory
+type MachineInventoryPathParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: path
+	// required: true
+	Id string `json:"id"`
+}
+
 // MachinePathParameter used to find a Machine in the path
-// swagger:parameters putMachines getMachine putMachine patchMachine deleteMachine headMachine patchMachineParams postMachineParams
+// swagger:parameters putMachines getMachine putMachine patchMachine deleteMachine headMachine patchMachineParams postMachineParams listMachineInventory
 type MachinePathParameter struct {
 	// in: path
 	// required: true
@@ -108,6 +164,8 @@ type MachinePostParamPathParemeter struct {
 type MachineGetParamsPathParameter struct {
 	// in: query
 	Aggregate string `json:"aggregate"`
+	// in: query
+	Explain string `json:"explain"`
 	// in: path
 	// required: true
 	// swagger:strfmt uuid
@@ -331,11 +389,7 @@ func (f *Frontend) InitMachineApi() {
 					c.JSON(http.StatusBadRequest, models.NewError(c.Request.Method, http.StatusBadRequest, err.Error()))
 				}
 			} else {
-				s, ok := models.Model(res).(Sanitizable)
-				if ok {
-					res = s.Sanitize()
-				}
-				c.JSON(http.StatusCreated, res)
+				c.JSON(http.StatusCreated, f.sanitize(c, res))
 			}
 		})
 
@@ -385,6 +439,7 @@ func (f *Frontend) InitMachineApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/machines/:uuid",
 		func(c *gin.Context) {
@@ -409,6 +464,7 @@ func (f *Frontend) InitMachineApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/machines/:uuid",
 		func(c *gin.Context) {
@@ -431,6 +487,7 @@ func (f *Frontend) InitMachineApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/machines/:uuid",
 		func(c *gin.Context) {
@@ -445,6 +502,11 @@ func (f *Frontend) InitMachineApi() {
 	//
 	// List Machine parms for a Machine specified by {uuid}
 	//
+	// If explain is true, each param is returned as an ExplainedParam
+	// that also says where its value came from and which values it
+	// overrides.  Combine it with aggregate=true to see the values
+	// from profiles and Param defaults as well.
+	//
 	//     Responses:
 	//       200: MachineParamsResponse
 	//       401: NoContentResponse
@@ -476,6 +538,7 @@ func (f *Frontend) InitMachineApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.DELETE("/machines/:uuid/params/*key", pDeleteOne)
 
 	// swagger:route PATCH /machines/{uuid}/params Machines patchMachineParams
@@ -488,6 +551,7 @@ func (f *Frontend) InitMachineApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.PATCH("/machines/:uuid/params", pPatch)
 
 	// swagger:route POST /machines/{uuid}/params Machines postMachineParams
@@ -500,6 +564,7 @@ func (f *Frontend) InitMachineApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.POST("/machines/:uuid/params", pSetThem)
 
 	// swagger:route POST /machines/{uuid}/params/{key} Machines postMachineParam
@@ -512,6 +577,7 @@ func (f *Frontend) InitMachineApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.POST("/machines/:uuid/params/*key", pSetOne)
 
 	machine := &backend.Machine{}
@@ -565,4 +631,180 @@ func (f *Frontend) InitMachineApi() {
 	//       404: ErrorResponse
 	//       409: ErrorResponse
 	f.ApiGroup.POST("/machines/:uuid/actions/:cmd", pRun)
+
+	// swagger:route POST /machines/{uuid}/inventory Machines postMachineInventory
+	//
+	// Upload the hardware inventory of a Machine
+	//
+	// Stores the passed-in inventory as the newest snapshot for the
+	// Machine specified by {uuid}, and sets the inventory/* params on
+	// the Machine from it.  The returned snapshot lists the hardware
+	// that changed since the previous one, and a machines.drift event
+	// is published if anything did.
+	//
+	//     Responses:
+	//       200: MachineInventorySnapshotResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/machines/:uuid/inventory",
+		func(c *gin.Context) {
+			inv := &models.Inventory{}
+			if !assureDecode(c, inv) {
+				return
+			}
+			ref := &backend.Machine{}
+			key := c.Param("uuid")
+			if !f.assureAuth(c, "machines", "inventory", key) {
+				return
+			}
+			rt := f.rt(c, ref.Locks("update")...)
+			res, err := f.dt.StoreInventory(rt, key, inv)
+			if err != nil {
+				be, ok := err.(*models.Error)
+				if !ok {
+					be = models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error())
+				}
+				c.JSON(be.Code, be)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route GET /machines/{uuid}/inventory Machines listMachineInventory
+	//
+	// List the inventory snapshots of a Machine
+	//
+	// Returns the IDs of the inventory snapshots stored for the
+	// Machine specified by {uuid}, oldest first.
+	//
+	//     Responses:
+	//       200: MachineInventoryHistoryResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       500: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/inventory",
+		func(c *gin.Context) {
+			f.machineInventory(c, func(rt *backend.RequestTracker, m *backend.Machine) (interface{}, error) {
+				return m.InventoryHistory(rt)
+			})
+		})
+
+	// swagger:route GET /machines/{uuid}/inventory/{id} Machines getMachineInventory
+	//
+	// Get an inventory snapshot of a Machine
+	//
+	// Returns the inventory snapshot {id} of the Machine specified by
+	// {uuid}.  An {id} of latest returns the most recent one.
+	//
+	//     Responses:
+	//       200: MachineInventoryResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       500: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/inventory/:id",
+		func(c *gin.Context) {
+			f.machineInventory(c, func(rt *backend.RequestTracker, m *backend.Machine) (interface{}, error) {
+				return m.InventorySnapshot(rt, c.Param("id"))
+			})
+		})
+
+	// swagger:route POST /machines/{uuid}/token Machines getMachineToken
+	//
+	// Get a new token for a Machine
+	//
+	// Exchanges the current token of the Machine specified by {uuid},
+	// or a verified client certificate for it, for a new token that
+	// the machine agent can use.  The current token may have expired
+	// no more than knownTokenTimeout seconds ago, and the Secret of
+	// the Machine must not have changed since it was issued.  This
+	// lets an agent that has been running longer than its token is
+	// valid for get a fresh one.  Agents that are cut off for longer
+	// than that must use a client certificate.  Each Machine can get a
+	// new token once every 10 seconds, and client addresses that have
+	// too many requests refused are locked out for a while.
+	//
+	//     Responses:
+	//       200: UserTokenResponse
+	//       400: ErrorResponse
+	//       403: NoContentResponse
+	//       429: NoContentResponse
+	f.MgmtApi.POST("/api/v3/machines/:uuid/token",
+		func(c *gin.Context) {
+			rt := f.rt(c)
+			key := strings.ToLower(c.Param("uuid"))
+			if wait := f.dt.MachineTokenLocked(key, c.ClientIP()); wait > 0 {
+				f.l(c).Warnf("Token requests for machine %s from %s are locked out", key, c.ClientIP())
+				c.Header("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+				c.AbortWithStatus(http.StatusTooManyRequests)
+				return
+			}
+			claim := f.certClaim(c)
+			if hdr := strings.SplitN(c.Request.Header.Get("Authorization"), " ", 2); claim == nil && len(hdr) == 2 && hdr[0] == "Bearer" {
+				claim, _ = f.dt.GetExpiredToken(hdr[1])
+			}
+			var claims *backend.DrpCustomClaims
+			if claim != nil && claim.MachineUuid() == key && f.assureClaimSecrets(c, claim) {
+				ref := &backend.Machine{}
+				mrt := f.rt(c, ref.Locks("get")...)
+				mrt.Do(func(d backend.Stores) {
+					if obj := mrt.Find("machines", key); obj != nil {
+						claims = f.dt.MachineClaim(backend.AsMachine(obj), f.dt.KnownTokenTTL())
+					}
+				})
+			}
+			if claims == nil {
+				rt.Auditf("Refused token for machine %s from %s", key, c.ClientIP())
+				f.dt.MachineTokenFailed(rt, c.ClientIP())
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			t, err := f.dt.SealClaims(claims)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.NewError(c.Request.Method, http.StatusBadRequest, err.Error()))
+				return
+			}
+			f.dt.MachineTokenIssued(key)
+			if err := f.dt.RecordToken(claims, c.ClientIP()); err != nil {
+				f.l(c).Warnf("Unable to record token for machine %s: %v", key, err)
+			}
+			c.JSON(http.StatusOK, models.UserToken{Token: t})
+		})
+}
+
+// machineInventory looks up the Machine in the request and answers
+// it with whatever fetch returns from its inventory history.
+func (f *Frontend) machineInventory(c *gin.Context,
+	fetch func(*backend.RequestTracker, *backend.Machine) (interface{}, error)) {
+	key := c.Param("uuid")
+	if !f.assureAuth(c, "machines", "inventory", key) {
+		return
+	}
+	ref := &backend.Machine{}
+	var res interface{}
+	var err error
+	rt := f.rt(c, ref.Locks("get")...)
+	rt.Do(func(d backend.Stores) {
+		obj := rt.Find("machines", key)
+		if obj == nil {
+			err = &models.Error{Code: http.StatusNotFound, Type: c.Request.Method, Model: "machines", Key: key,
+				Messages: []string{"Not Found"}}
+			return
+		}
+		res, err = fetch(rt, backend.AsMachine(obj))
+	})
+	if err != nil {
+		be, ok := err.(*models.Error)
+		if !ok {
+			be = models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error())
+		}
+		c.JSON(be.Code, be)
+		return
+	}
+	c.JSON(http.StatusOK, res)
 }
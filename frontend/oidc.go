@@ -0,0 +1,57 @@
+package frontend
+
+import (
+	"net/http"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/gin-gonic/gin"
+)
+
+// OidcConfigResponse returned on a successful GET of the OpenID Connect configuration
+// swagger:response
+type OidcConfigResponse struct {
+	// in: body
+	Body *models.OidcConfig
+}
+
+func (f *Frontend) InitOidcApi() {
+	// swagger:route GET /oidc Oidc getOidcConfig
+	//
+	// Return how to log in through OpenID Connect.
+	//
+	// This does not need authentication, since clients need it to get
+	// a token in the first place.
+	//
+	//     Produces:
+	//       application/json
+	//
+	//     Responses:
+	//       200: OidcConfigResponse
+	//       404: ErrorResponse
+	//       502: ErrorResponse
+	f.MgmtApi.GET("/api/v3/oidc",
+		func(c *gin.Context) {
+			cfg, err := f.oidc.Config()
+			if err != nil {
+				res := &models.Error{
+					Code:  http.StatusBadGateway,
+					Type:  c.Request.Method,
+					Model: "oidc",
+				}
+				res.AddError(err)
+				c.JSON(res.Code, res)
+				return
+			}
+			if cfg == nil {
+				res := &models.Error{
+					Code:  http.StatusNotFound,
+					Type:  c.Request.Method,
+					Model: "oidc",
+				}
+				res.Errorf("OpenID Connect is not configured")
+				c.JSON(res.Code, res)
+				return
+			}
+			c.JSON(http.StatusOK, cfg)
+		})
+}
@@ -1,6 +1,7 @@
 package frontend
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/VictorLowther/jsonpatch2"
@@ -33,6 +34,23 @@ type ParamParamsResponse struct {
 // ParamBodyParameter used to inject a Param
 // swagger:parameters createParam putParam
 type ParamBodyParameter struct {
+	// in: query
+	Force string `json:"force"`
+	// in: body
+	// required: true
+	Body *models.Param
+}
+
+// ParamReportResponse returned on a successful POST of a Param to check
+// swagger:response
+type ParamReportResponse struct {
+	// in: body
+	Body *models.ParamReport
+}
+
+// ParamCheckBodyParameter used to check a changed Param
+// swagger:parameters checkParam
+type ParamCheckBodyParameter struct {
 	// in: body
 	// required: true
 	Body *models.Param
@@ -41,6 +59,8 @@ type ParamBodyParameter struct {
 // ParamPatchBodyParameter used to patch a Param
 // swagger:parameters patchParam
 type ParamPatchBodyParameter struct {
+	// in: query
+	Force string `json:"force"`
 	// in: body
 	// required: true
 	Body jsonpatch2.Patch
@@ -176,6 +196,39 @@ func (f *Frontend) InitParamApi() {
 			b := &backend.Param{}
 			f.Create(c, b)
 		})
+
+	// swagger:route POST /params/check Params checkParam
+	//
+	// Check a changed Param
+	//
+	// Reports which values of the Param stored on other objects would
+	// not match the Schema of the passed-in Param, without changing
+	// anything.  Values of secure params are redacted.
+	//
+	//     Responses:
+	//       200: ParamReportResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/params/check",
+		func(c *gin.Context) {
+			req := &models.Param{}
+			if !assureDecode(c, req) {
+				return
+			}
+			if !f.assureAuth(c, "params", "update", req.Name) {
+				return
+			}
+			rt := f.rt(c, (&backend.Param{}).Locks("update")...)
+			res, err := f.dt.CheckParam(rt, req)
+			if err != nil {
+				jsonError(c, err, http.StatusBadRequest, "params")
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
 	// swagger:route GET /params/{name} Params getParam
 	//
 	// Get a Param
@@ -224,11 +277,17 @@ func (f *Frontend) InitParamApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/params/*name",
 		func(c *gin.Context) {
 			name := strings.TrimLeft(c.Param(`name`), `/`)
-			f.Patch(c, &backend.Param{}, name)
+			param := &backend.Param{}
+			backend.Fill(param)
+			if c.Query("force") == "true" {
+				param.ForceChange()
+			}
+			f.Patch(c, param, name)
 		})
 
 	// swagger:route PUT /params/{name} Params putParam
@@ -244,11 +303,17 @@ func (f *Frontend) InitParamApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/params/*name",
 		func(c *gin.Context) {
 			name := strings.TrimLeft(c.Param(`name`), `/`)
-			f.Update(c, &backend.Param{}, name)
+			param := &backend.Param{}
+			backend.Fill(param)
+			if c.Query("force") == "true" {
+				param.ForceChange()
+			}
+			f.Update(c, param, name)
 		})
 
 	// swagger:route DELETE /params/{name} Params deleteParam
@@ -262,6 +327,7 @@ func (f *Frontend) InitParamApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/params/*name",
 		func(c *gin.Context) {
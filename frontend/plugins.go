@@ -326,6 +326,7 @@ func (f *Frontend) InitPluginApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/plugins/:name",
 		func(c *gin.Context) {
@@ -345,6 +346,7 @@ func (f *Frontend) InitPluginApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/plugins/:name",
 		func(c *gin.Context) {
@@ -362,6 +364,7 @@ func (f *Frontend) InitPluginApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/plugins/:name",
 		func(c *gin.Context) {
@@ -407,6 +410,7 @@ func (f *Frontend) InitPluginApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.DELETE("/plugins/:name/params/*key", pDeleteOne)
 
 	// swagger:route PATCH /plugins/{name}/params Plugins patchPluginParams
@@ -419,6 +423,7 @@ func (f *Frontend) InitPluginApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.PATCH("/plugins/:name/params", pPatch)
 
 	// swagger:route POST /plugins/{name}/params Plugins postPluginParams
@@ -431,6 +436,7 @@ func (f *Frontend) InitPluginApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.POST("/plugins/:name/params", pSetThem)
 
 	// swagger:route POST /plugins/{name}/params/{key} Plugins postPluginParam
@@ -443,6 +449,7 @@ func (f *Frontend) InitPluginApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.POST("/plugins/:name/params/*key", pSetOne)
 
 	plugin := &backend.Plugin{}
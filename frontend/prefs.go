@@ -23,6 +23,16 @@ type PrefBodyParameter struct {
 	Body map[string]string
 }
 
+// publicPrefs returns the preferences that may be sent to clients.
+func (f *Frontend) publicPrefs() map[string]string {
+	prefs := f.dt.Prefs()
+	// The key for secure params never leaves the server, and
+	// neither does the password for searching LDAP.
+	delete(prefs, "secureParamSecret")
+	delete(prefs, "ldapBindPassword")
+	return prefs
+}
+
 func (f *Frontend) InitPrefApi() {
 	// swagger:route GET /prefs Prefs listPrefs
 	//
@@ -39,7 +49,7 @@ func (f *Frontend) InitPrefApi() {
 			if !f.assureAuth(c, "prefs", "list", "") {
 				return
 			}
-			c.JSON(http.StatusOK, f.dt.Prefs())
+			c.JSON(http.StatusOK, f.publicPrefs())
 		})
 
 	// swagger:route POST /prefs Prefs setPrefs
@@ -80,13 +90,29 @@ func (f *Frontend) InitPrefApi() {
 					if !f.assureAuth(c, "prefs", "post", k) {
 						return
 					}
-				case "knownTokenTimeout", "unknownTokenTimeout":
+				case "knownTokenTimeout", "unknownTokenTimeout", "jobArtifactMaxSize", "jobArtifactQuota", "jobLogMaxSize",
+					"jobRetentionAge", "jobRetentionCount", "jobPurgeAge", "inventoryHistory", "ldapCacheTTL",
+					"passwordMinLength", "passwordMinClasses", "passwordHistory", "loginMaxFailures", "loginMaxIpFailures",
+					"loginLockoutTime":
 					if !f.assureAuth(c, "prefs", "post", k) {
 						return
 					}
 					if _, e := strconv.Atoi(prefs[k]); e != nil {
 						err.Errorf("%s: %v", k, e)
 					}
+				case "ldapUrl", "ldapBindDN", "ldapBindPassword", "ldapBaseDN", "ldapUserFilter",
+					"ldapGroupAttr", "ldapGroupRoles", "oidcIssuer", "oidcClientId", "oidcAudience",
+					"oidcUsernameClaim", "oidcGroupsClaim", "oidcGroupRoles", "oidcScopes", "auditSyslog":
+					if !f.assureAuth(c, "prefs", "post", k) {
+						return
+					}
+				case "jobPurgeExport", "ldapStartTLS", "tokenRegistry":
+					if !f.assureAuth(c, "prefs", "post", k) {
+						return
+					}
+					if _, e := strconv.ParseBool(prefs[k]); e != nil {
+						err.Errorf("%s: %v", k, e)
+					}
 				default:
 					err.Errorf("Unknown Preference %s", k)
 				}
@@ -101,7 +127,7 @@ func (f *Frontend) InitPrefApi() {
 			if err.ContainsError() {
 				c.JSON(err.Code, err)
 			} else {
-				c.JSON(http.StatusCreated, f.dt.Prefs())
+				c.JSON(http.StatusCreated, f.publicPrefs())
 			}
 		})
 }
@@ -285,6 +285,7 @@ func (f *Frontend) InitProfileApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/profiles/:name",
 		func(c *gin.Context) {
@@ -303,6 +304,7 @@ func (f *Frontend) InitProfileApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/profiles/:name",
 		func(c *gin.Context) {
@@ -321,6 +323,7 @@ func (f *Frontend) InitProfileApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/profiles/:name",
 		func(c *gin.Context) {
@@ -366,6 +369,7 @@ func (f *Frontend) InitProfileApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.DELETE("/profiles/:name/params/*key", pDeleteOne)
 
 	// swagger:route PATCH /profiles/{name}/params Profiles patchProfileParams
@@ -378,6 +382,7 @@ func (f *Frontend) InitProfileApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.PATCH("/profiles/:name/params", pPatch)
 
 	// swagger:route POST /profiles/{name}/params Profiles postProfileParams
@@ -390,6 +395,7 @@ func (f *Frontend) InitProfileApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.POST("/profiles/:name/params", pSetThem)
 
 	// swagger:route POST /profiles/{name}/params/{key} Profiles postProfileParam
@@ -402,6 +408,7 @@ func (f *Frontend) InitProfileApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	f.ApiGroup.POST("/profiles/:name/params/*key", pSetOne)
 
 	profile := &backend.Profile{}
@@ -272,6 +272,7 @@ func (f *Frontend) InitReservationApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/reservations/:address",
 		func(c *gin.Context) {
@@ -291,6 +292,7 @@ func (f *Frontend) InitReservationApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/reservations/:address",
 		func(c *gin.Context) {
@@ -309,6 +311,7 @@ func (f *Frontend) InitReservationApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/reservations/:address",
 		func(c *gin.Context) {
@@ -30,7 +30,7 @@ type StageBodyParameter struct {
 }
 
 // StagePatchBodyParameter used to patch a Stage
-// swagger:parameters patchStage
+// swagger:parameters patchStage patchStageParams
 type StagePatchBodyParameter struct {
 	// in: body
 	// required: true
@@ -38,13 +38,54 @@ type StagePatchBodyParameter struct {
 }
 
 // StagePathParameter used to name a Stage in the path
-// swagger:parameters putStages getStage putStage patchStage deleteStage headStage
+// swagger:parameters putStages getStage putStage patchStage deleteStage headStage getStageParams patchStageParams postStageParams
 type StagePathParameter struct {
 	// in: path
 	// required: true
 	Name string `json:"name"`
 }
 
+// StageParamsResponse return on a successful GET of all Stage's Params
+// swagger:response
+type StageParamsResponse struct {
+	// in: body
+	Body map[string]interface{}
+}
+
+// StageParamResponse return on a successful GET of a single Param for a Stage
+// swagger:response
+type StageParamResponse struct {
+	// in: body
+	Body interface{}
+}
+
+// StageParamsPathParameter used to get or set a single Parameter in a Stage
+// swagger:parameters getStageParam postStageParam deleteStageParam
+type StageParamsPathParameter struct {
+	// in: path
+	// required: true
+	Name string `json:"name"`
+	// in: path
+	// required: true
+	Key string `json:"key"`
+}
+
+// StageParamsBodyParameter used to set Stage Params
+// swagger:parameters postStageParams
+type StageParamsBodyParameter struct {
+	// in: body
+	// required: true
+	Body map[string]interface{}
+}
+
+// StageParamBodyParameter used to set Stage Param
+// swagger:parameters postStageParam
+type StageParamBodyParameter struct {
+	// in: body
+	// required: true
+	Body interface{}
+}
+
 // StageListPathParameter used to limit lists of Stage by path options
 // swagger:parameters listStages listStatsStages
 type StageListPathParameter struct {
@@ -250,6 +291,7 @@ func (f *Frontend) InitStageApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/stages/:name",
 		func(c *gin.Context) {
@@ -269,6 +311,7 @@ func (f *Frontend) InitStageApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/stages/:name",
 		func(c *gin.Context) {
@@ -287,12 +330,94 @@ func (f *Frontend) InitStageApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/stages/:name",
 		func(c *gin.Context) {
 			f.Remove(c, &backend.Stage{}, c.Param(`name`))
 		})
 
+	pGetAll, pGetOne, pPatch, pSetThem, pSetOne, pDeleteOne := f.makeParamEndpoints(&backend.Stage{}, "name")
+
+	// swagger:route GET /stages/{name}/params Stages getStageParams
+	//
+	// List stage params Stage
+	//
+	// List Stage parms for a Stage specified by {name}
+	//
+	//     Responses:
+	//       200: StageParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/stages/:name/params", pGetAll)
+
+	// swagger:route GET /stages/{name}/params/{key} Stages getStageParam
+	//
+	// Get a single stage parameter
+	//
+	// Get a single parameter {key} for a Stage specified by {name}
+	//
+	//     Responses:
+	//       200: StageParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/stages/:name/params/*key", pGetOne)
+
+	// swagger:route DELETE /stages/{name}/params/{key} Stages deleteStageParam
+	//
+	// Delete a single stage parameter
+	//
+	// Delete a single parameter {key} for a Stage specified by {name}
+	//
+	//     Responses:
+	//       200: StageParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.DELETE("/stages/:name/params/*key", pDeleteOne)
+
+	// swagger:route PATCH /stages/{name}/params Stages patchStageParams
+	//
+	// Update params for Stage {name} with the passed-in patch
+	//
+	//     Responses:
+	//       200: StageParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.PATCH("/stages/:name/params", pPatch)
+
+	// swagger:route POST /stages/{name}/params Stages postStageParams
+	//
+	// Sets parameters for a stage specified by {name}
+	//
+	//     Responses:
+	//       200: StageParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.POST("/stages/:name/params", pSetThem)
+
+	// swagger:route POST /stages/{name}/params/{key} Stages postStageParam
+	//
+	// Set as single Parameter {key} for a stage specified by {name}
+	//
+	//     Responses:
+	//       200: StageParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.POST("/stages/:name/params/*key", pSetOne)
+
 	stage := &backend.Stage{}
 	pActions, pAction, pRun := f.makeActionEndpoints(stage.Prefix(), stage, "name")
 
@@ -267,6 +267,7 @@ func (f *Frontend) InitSubnetApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/subnets/:name",
 		func(c *gin.Context) {
@@ -286,6 +287,7 @@ func (f *Frontend) InitSubnetApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/subnets/:name",
 		func(c *gin.Context) {
@@ -303,6 +305,7 @@ func (f *Frontend) InitSubnetApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/subnets/:name",
 		func(c *gin.Context) {
@@ -298,6 +298,7 @@ func (f *Frontend) InitTaskApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/tasks/:name",
 		func(c *gin.Context) {
@@ -317,6 +318,7 @@ func (f *Frontend) InitTaskApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/tasks/:name",
 		func(c *gin.Context) {
@@ -334,6 +336,7 @@ func (f *Frontend) InitTaskApi() {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/tasks/:name",
 		func(c *gin.Context) {
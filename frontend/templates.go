@@ -1,6 +1,8 @@
 package frontend
 
 import (
+	"net/http"
+
 	"github.com/VictorLowther/jsonpatch2"
 	"github.com/digitalrebar/provision/backend"
 	"github.com/digitalrebar/provision/models"
@@ -45,6 +47,21 @@ type TemplatePathParameter struct {
 	Id string `json:"id"`
 }
 
+// RenderResponse return on a successful POST of a RenderRequest
+// swagger:response
+type RenderResponse struct {
+	// in: body
+	Body *models.RenderResult
+}
+
+// RenderBodyParameter used to ask for templates to be rendered
+// swagger:parameters renderTemplates
+type RenderBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.RenderRequest
+}
+
 // TemplateListPathParameter used to limit lists of Template by path options
 // swagger:parameters listTemplates listStatsTemplates
 type TemplateListPathParameter struct {
@@ -245,6 +262,7 @@ func (f *Frontend) InitTemplateApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/templates/:id",
 		func(c *gin.Context) {
@@ -264,6 +282,7 @@ func (f *Frontend) InitTemplateApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/templates/:id",
 		func(c *gin.Context) {
@@ -282,6 +301,7 @@ func (f *Frontend) InitTemplateApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/templates/:id",
 		func(c *gin.Context) {
@@ -340,4 +360,61 @@ func (f *Frontend) InitTemplateApi() {
 	//       404: ErrorResponse
 	//       409: ErrorResponse
 	f.ApiGroup.POST("/templates/:id/actions/:cmd", pRun)
+
+	// swagger:route POST /render Templates renderTemplates
+	//
+	// Preview rendered templates
+	//
+	// Renders a Template, or the templates of a Task, BootEnv, or
+	// Stage, the way they would be rendered for a Machine.  The
+	// Machine and Params in the request are combined on a copy of the
+	// Machine, so nothing is changed, and token helpers render to a
+	// placeholder instead of a working token.  Secure params render as
+	// a redacted placeholder unless the caller can getSecure the
+	// Machine.  Templates that fail to render and missing required
+	// params are reported in the result.
+	//
+	//     Responses:
+	//       200: RenderResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/render",
+		func(c *gin.Context) {
+			req := &models.RenderRequest{}
+			if !assureDecode(c, req) {
+				return
+			}
+			prefix, key := "templates", req.Template
+			switch {
+			case req.Task != "":
+				prefix, key = "tasks", req.Task
+			case req.BootEnv != "":
+				prefix, key = "bootenvs", req.BootEnv
+			case req.Stage != "":
+				prefix, key = "stages", req.Stage
+			}
+			if !f.assureAuth(c, prefix, "render", key) {
+				return
+			}
+			if len(req.Machine) > 0 && !f.assureAuth(c, "machines", "get", req.Machine.String()) {
+				return
+			}
+			rt := f.rt(c, "templates", "tasks", "stages", "bootenvs", "machines", "profiles", "params")
+			var machine models.Model
+			if len(req.Machine) > 0 {
+				rt.Do(func(d backend.Stores) {
+					machine = rt.Find("machines", req.Machine.String())
+				})
+			}
+			decrypt := f.canGetSecure(c, "machines", req.Machine.String(), machine)
+			res, err := f.dt.RenderPreview(rt, req, decrypt)
+			if err != nil {
+				jsonError(c, err, http.StatusBadRequest, "templates")
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
 }
@@ -0,0 +1,134 @@
+package frontend
+
+import (
+	"net/http"
+
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+	"github.com/gin-gonic/gin"
+)
+
+// TokenResponse returned on a successful GET or DELETE of a token
+// swagger:response
+type TokenResponse struct {
+	// in: body
+	Body *models.TokenRecord
+}
+
+// TokensResponse returned on a successful GET of all the tokens
+// swagger:response
+type TokensResponse struct {
+	// in: body
+	Body []*models.TokenRecord
+}
+
+// TokenPathParameter used to name a token in the path
+// swagger:parameters getToken revokeToken
+type TokenPathParameter struct {
+	// in: path
+	// required: true
+	Id string `json:"id"`
+}
+
+// TokenListParameter used to limit the list of tokens
+// swagger:parameters listTokens
+type TokenListParameter struct {
+	// in: query
+	User string `json:"user"`
+}
+
+func tokenError(c *gin.Context, err error) {
+	be, ok := err.(*models.Error)
+	if !ok {
+		be = models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error())
+	}
+	be.Type = c.Request.Method
+	c.JSON(be.Code, be)
+}
+
+func (f *Frontend) InitTokenApi() {
+	// swagger:route GET /tokens Tokens listTokens
+	//
+	// Lists the unexpired tokens in the token registry
+	//
+	// Tokens are only recorded while the tokenRegistry preference is
+	// on.  The list can be limited to the tokens of one User with the
+	// user query parameter.
+	//
+	//     Responses:
+	//       200: TokensResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	f.ApiGroup.GET("/tokens",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "tokens", "list", "") {
+				return
+			}
+			c.JSON(http.StatusOK, f.dt.Tokens().List(c.Query("user")))
+		})
+
+	// swagger:route GET /tokens/{id} Tokens getToken
+	//
+	// Get a token from the token registry
+	//
+	// An id of current describes the token the request was made
+	// with, even if it was not recorded.
+	//
+	//     Responses:
+	//       200: TokenResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/tokens/:id",
+		func(c *gin.Context) {
+			id := c.Param("id")
+			if id == "current" {
+				obj, _ := c.Get("DRP-CLAIM")
+				claims, ok := obj.(*backend.DrpCustomClaims)
+				if !ok {
+					c.AbortWithStatus(http.StatusForbidden)
+					return
+				}
+				c.JSON(http.StatusOK, f.dt.Tokens().Describe(claims))
+				return
+			}
+			if !f.assureAuth(c, "tokens", "get", id) {
+				return
+			}
+			rec, err := f.dt.Tokens().Get(id)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, rec)
+		})
+
+	// swagger:route DELETE /tokens/{id} Tokens revokeToken
+	//
+	// Revoke a token in the token registry
+	//
+	// The token is refused from then on.  Its record is kept until it
+	// would have expired.
+	//
+	//     Responses:
+	//       200: TokenResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.DELETE("/tokens/:id",
+		func(c *gin.Context) {
+			id := c.Param("id")
+			if !f.assureAuth(c, "tokens", "revoke", id) {
+				return
+			}
+			rec, err := f.dt.Tokens().Revoke(id, f.getAuthUser(c))
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+			rt := f.rt(c)
+			rt.Auditf("Token %s of %s revoked by %s from %s", id, rec.User, rec.RevokedBy, c.ClientIP())
+			rt.AuditAction("tokens", id, "revoke")
+			c.JSON(http.StatusOK, rec)
+		})
+}
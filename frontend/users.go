@@ -57,8 +57,49 @@ type UserPutPasswordParameter struct {
 	Body models.UserPassword
 }
 
+// UserApiKeyResponse returned on a successful creation of an API key
+// swagger:response
+type UserApiKeyResponse struct {
+	// in: body
+	Body *models.UserApiKey
+}
+
+// UserApiKeyBodyParameter used to create an API key
+// swagger:parameters createUserApiKey
+type UserApiKeyBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.ApiKey
+}
+
+// UserTotpResponse returned when TOTP enrolment is started
+// swagger:response
+type UserTotpResponse struct {
+	// in: body
+	Body *models.UserTotp
+}
+
+// UserTotpCodeBodyParameter used to confirm TOTP enrolment
+// swagger:parameters confirmUserTotp
+type UserTotpCodeBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.UserTotpCode
+}
+
+// UserApiKeyPathParameter used to name an API key in the path
+// swagger:parameters deleteUserApiKey
+type UserApiKeyPathParameter struct {
+	// in: path
+	// required: true
+	Name string `json:"name"`
+	// in: path
+	// required: true
+	Key string `json:"key"`
+}
+
 // UserPathParameter used to name a User in the path
-// swagger:parameters getUser putUser patchUser deleteUser getUserToken putUserPassword headUser
+// swagger:parameters getUser putUser patchUser deleteUser getUserToken putUserPassword headUser startUserTotp confirmUserTotp deleteUserTotp
 type UserPathParameter struct {
 	// in: path
 	// required: true
@@ -291,6 +332,7 @@ func (f *Frontend) InitUserApi(drpid string) {
 		func(c *gin.Context) {
 			ref := &backend.User{}
 			var userName, grantorName, userSecret, grantorSecret string
+			var userClaims []*backend.Claim
 			var err *models.Error
 			rt := f.rt(c, ref.Locks("get")...)
 			rt.Do(func(d backend.Stores) {
@@ -309,6 +351,7 @@ func (f *Frontend) InitUserApi(drpid string) {
 				uobj := backend.AsUser(u)
 				gobj := backend.AsUser(g)
 				userName, userSecret = uobj.Name, uobj.Secret
+				userClaims = uobj.Claims(rt)
 				grantorName, grantorSecret = gobj.Name, gobj.Secret
 				err = nil
 			})
@@ -350,8 +393,35 @@ func (f *Frontend) InitUserApi(drpid string) {
 			}
 
 			claims := backend.NewClaim(c.Param(`name`), grantorName, ttl).
-				Add(scope, action, specific).
 				AddSecrets(grantorSecret, userSecret, "")
+			// The token cannot allow more than the caller is allowed
+			// to do, even if the user's Roles allow more.  A user with
+			// TOTP enabled keeps the second factor it logged in with
+			// in the tokens it gets for itself.
+			var limits []*backend.Claim
+			if obj, ok := c.Get("DRP-CLAIM"); ok {
+				if caller, ok := obj.(*backend.DrpCustomClaims); ok {
+					limits = caller.Limit(userClaims)
+					claims.SecondFactor = caller.SecondFactor && caller.Id == userName
+				}
+			}
+			if scope == "*" && action == "*" && specific == "*" {
+				// An unscoped token gets everything both of them allow.
+				claims.AddClaims(limits...)
+			} else {
+				// A scoped token must be allowed by both of them.
+				if !claims.AddLimited(limits, scope, action, specific) {
+					res := &models.Error{
+						Type:  c.Request.Method,
+						Model: "users",
+						Key:   c.Param(`name`),
+						Code:  http.StatusForbidden,
+					}
+					res.Errorf("Roles of user %s and the caller do not allow %s %s %s", userName, scope, action, specific)
+					c.JSON(res.Code, res)
+					return
+				}
+			}
 
 			if t, err := f.dt.SealClaims(claims); err != nil {
 				ne, ok := err.(*models.Error)
@@ -361,6 +431,9 @@ func (f *Frontend) InitUserApi(drpid string) {
 					c.JSON(http.StatusBadRequest, models.NewError(c.Request.Method, http.StatusBadRequest, err.Error()))
 				}
 			} else {
+				if err := f.dt.RecordToken(claims, c.ClientIP()); err != nil {
+					f.l(c).Warnf("Unable to record token for %s: %v", userName, err)
+				}
 				// Error is only if stats are not filled in.  User
 				// Token should work regardless of that.
 				info, _ := f.GetInfo(c, drpid)
@@ -387,6 +460,7 @@ func (f *Frontend) InitUserApi(drpid string) {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/users/:name",
 		func(c *gin.Context) {
@@ -406,6 +480,7 @@ func (f *Frontend) InitUserApi(drpid string) {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/users/:name",
 		func(c *gin.Context) {
@@ -468,6 +543,211 @@ func (f *Frontend) InitUserApi(drpid string) {
 			}
 		})
 
+	// swagger:route POST /users/{name}/apikeys Users createUserApiKey
+	//
+	// Create an API key for a user.
+	//
+	// The response holds the key that clients should present in an
+	// Authorization header of the form "Key <key>".  It is not stored
+	// and cannot be retrieved again.  A key created by someone other
+	// than the user cannot allow more than its creator is allowed, so
+	// its Claims are limited to what both of them allow.
+	//
+	//     Responses:
+	//       201: UserApiKeyResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/users/:name/apikeys",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "users", "apikey", c.Param("name")) {
+				return
+			}
+			key := &models.ApiKey{}
+			if !assureDecode(c, key) {
+				return
+			}
+			var res *models.UserApiKey
+			var err *models.Error
+			ref := &backend.User{}
+			rt := f.rt(c, ref.Locks("update")...)
+			rt.Do(func(d backend.Stores) {
+				obj := rt.Find("users", c.Param("name"))
+				if obj == nil {
+					err = &models.Error{Type: c.Request.Method, Model: "users", Key: c.Param("name"),
+						Code: http.StatusNotFound, Messages: []string{"Not Found"}}
+					return
+				}
+				user := backend.AsUser(obj)
+				claim, _ := c.Get("DRP-CLAIM")
+				if caller, ok := claim.(*backend.DrpCustomClaims); ok && caller.Id != user.Name {
+					claims := key.Claims
+					if len(claims) == 0 {
+						claims = user.Claims(rt)
+					}
+					key.Claims = caller.Limit(claims)
+					if len(key.Claims) == 0 {
+						err = &models.Error{Type: c.Request.Method, Model: "users", Key: user.Name,
+							Code: http.StatusForbidden}
+						err.Errorf("Roles of user %s and the caller have no Claims in common", user.Name)
+						return
+					}
+				}
+				secret, kErr := user.AddApiKey(rt, key)
+				if kErr != nil {
+					be, ok := kErr.(*models.Error)
+					if !ok {
+						be = models.NewError(c.Request.Method, http.StatusBadRequest, kErr.Error())
+					}
+					err = be
+					return
+				}
+				// key is now part of the stored User, so only hide the
+				// hash in a copy.
+				out := *key
+				out.KeyHash = []byte{}
+				res = &models.UserApiKey{Key: secret, ApiKey: &out}
+			})
+			if err != nil {
+				c.JSON(err.Code, err)
+				return
+			}
+			rt.Auditf("API key %s created for %s by %s", key.Name, c.Param("name"), f.getAuthUser(c))
+			c.JSON(http.StatusCreated, res)
+		})
+
+	// swagger:route DELETE /users/{name}/apikeys/{key} Users deleteUserApiKey
+	//
+	// Delete an API key of a user.
+	//
+	//     Responses:
+	//       200: UserResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.DELETE("/users/:name/apikeys/:key",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "users", "apikey", c.Param("name")) {
+				return
+			}
+			var user *models.User
+			var err *models.Error
+			ref := &backend.User{}
+			rt := f.rt(c, ref.Locks("update")...)
+			rt.Do(func(d backend.Stores) {
+				obj := rt.Find("users", c.Param("name"))
+				if obj == nil {
+					err = &models.Error{Type: c.Request.Method, Model: "users", Key: c.Param("name"),
+						Code: http.StatusNotFound, Messages: []string{"Not Found"}}
+					return
+				}
+				rUser := backend.AsUser(obj)
+				if kErr := rUser.RemoveApiKey(rt, c.Param("key")); kErr != nil {
+					be, ok := kErr.(*models.Error)
+					if !ok {
+						be = models.NewError(c.Request.Method, http.StatusBadRequest, kErr.Error())
+					}
+					err = be
+					return
+				}
+				user = models.Clone(rUser.User).(*models.User)
+			})
+			if err != nil {
+				c.JSON(err.Code, err)
+				return
+			}
+			rt.Auditf("API key %s of %s deleted by %s", c.Param("key"), c.Param("name"), f.getAuthUser(c))
+			c.JSON(http.StatusOK, user.Sanitize())
+		})
+
+	// swagger:route POST /users/{name}/totp Users startUserTotp
+	//
+	// Start TOTP enrolment for a user.
+	//
+	// The response holds a new TOTP secret for the user, as is and as
+	// an otpauth:// URL.  TOTP is not enabled until it is confirmed
+	// with a code made from the secret, and any TOTP the user already
+	// had is disabled.
+	//
+	//     Responses:
+	//       201: UserTotpResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/users/:name/totp",
+		func(c *gin.Context) {
+			var res *models.UserTotp
+			if f.changeUserTotp(c, func(rt *backend.RequestTracker, u *backend.User) (err error) {
+				res, err = u.StartTotp(rt)
+				return
+			}) {
+				c.JSON(http.StatusCreated, res)
+			}
+		})
+
+	// swagger:route PUT /users/{name}/totp Users confirmUserTotp
+	//
+	// Confirm TOTP enrolment for a user.
+	//
+	// Once it is confirmed, basic authentication as the user needs a
+	// one-time code in the X-DRP-TOTP header or the totp query
+	// parameter as well as the password.  Each code can only be used
+	// once.
+	//
+	//     Responses:
+	//       200: UserResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.PUT("/users/:name/totp",
+		func(c *gin.Context) {
+			code := &models.UserTotpCode{}
+			if !assureDecode(c, code) {
+				return
+			}
+			var user *models.User
+			if f.changeUserTotp(c, func(rt *backend.RequestTracker, u *backend.User) error {
+				if err := u.ConfirmTotp(rt, code.Code); err != nil {
+					return err
+				}
+				user = models.Clone(u.User).(*models.User)
+				return nil
+			}) {
+				c.JSON(http.StatusOK, user.Sanitize())
+			}
+		})
+
+	// swagger:route DELETE /users/{name}/totp Users deleteUserTotp
+	//
+	// Disable TOTP for a user.
+	//
+	//     Responses:
+	//       200: UserResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.DELETE("/users/:name/totp",
+		func(c *gin.Context) {
+			var user *models.User
+			if f.changeUserTotp(c, func(rt *backend.RequestTracker, u *backend.User) error {
+				if err := u.DisableTotp(rt); err != nil {
+					return err
+				}
+				user = models.Clone(u.User).(*models.User)
+				return nil
+			}) {
+				c.JSON(http.StatusOK, user.Sanitize())
+			}
+		})
+
 	// swagger:route DELETE /users/{name} Users deleteUser
 	//
 	// Delete a User
@@ -479,6 +759,7 @@ func (f *Frontend) InitUserApi(drpid string) {
 	//       401: NoContentResponse
 	//       403: NoContentResponse
 	//       404: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/users/:name",
 		func(c *gin.Context) {
@@ -538,3 +819,36 @@ func (f *Frontend) InitUserApi(drpid string) {
 	//       409: ErrorResponse
 	f.ApiGroup.POST("/users/:name/actions/:cmd", pRun)
 }
+
+// changeUserTotp runs change on the User named in the path of c for
+// the TOTP endpoints.  It returns false if it already wrote a
+// response.
+func (f *Frontend) changeUserTotp(c *gin.Context, change func(*backend.RequestTracker, *backend.User) error) bool {
+	if !f.assureAuth(c, "users", "totp", c.Param("name")) {
+		return false
+	}
+	var err *models.Error
+	ref := &backend.User{}
+	rt := f.rt(c, ref.Locks("update")...)
+	rt.Do(func(d backend.Stores) {
+		obj := rt.Find("users", c.Param("name"))
+		if obj == nil {
+			err = &models.Error{Type: c.Request.Method, Model: "users", Key: c.Param("name"),
+				Code: http.StatusNotFound, Messages: []string{"Not Found"}}
+			return
+		}
+		if cErr := change(rt, backend.AsUser(obj)); cErr != nil {
+			be, ok := cErr.(*models.Error)
+			if !ok {
+				be = models.NewError(c.Request.Method, http.StatusBadRequest, cErr.Error())
+			}
+			err = be
+		}
+	})
+	if err != nil {
+		c.JSON(err.Code, err)
+		return false
+	}
+	rt.Auditf("TOTP of %s changed with %s by %s", c.Param("name"), c.Request.Method, f.getAuthUser(c))
+	return true
+}
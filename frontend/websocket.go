@@ -55,12 +55,42 @@ func (f *Frontend) filterFunction(emap []string, claim interface{}, e *models.Ev
 
 	// Make sure we are authorized to see this event.
 	if matched {
-		matched = f.assureClaimMatch(nil, claim, e.Type, e.Action, e.Key)
+		obj, _ := e.Object.(models.Model)
+		matched = f.assureClaimMatch(nil, claim, e.Type, e.Action, e.Key) ||
+			f.assureObjectMatch(claim, e.Type, e.Action, e.Key, obj)
 	}
 	return matched
 }
 
 func (f *Frontend) Publish(e *models.Event) error {
+	m, ok := e.Object.(models.Model)
+	if !ok {
+		return f.publish(e, nil)
+	}
+	redacted := f.dt.RedactModel(m, false)
+	if redacted == m {
+		return f.publish(e, nil)
+	}
+	// The object has secure params, so sessions that are allowed to see
+	// them get a copy of the event with them decrypted, and everyone
+	// else gets one with them redacted.
+	canGetSecure := func(claim interface{}) bool {
+		return f.assureClaimMatch(nil, claim, e.Type, "getSecure", e.Key) ||
+			f.assureObjectMatch(claim, e.Type, "getSecure", e.Key, m)
+	}
+	plain, re := *e, *e
+	plain.Object = f.dt.RedactModel(m, true)
+	re.Object = redacted
+	if err := f.publish(&plain, canGetSecure); err != nil {
+		return err
+	}
+	return f.publish(&re, func(claim interface{}) bool { return !canGetSecure(claim) })
+}
+
+// publish sends e to the sessions that registered for it and are
+// allowed to see it.  If allowed is not nil, it must also return true
+// for the claim of the session.
+func (f *Frontend) publish(e *models.Event, allowed func(interface{}) bool) error {
 	if msg, err := json.Marshal(e); err != nil {
 		return err
 	} else {
@@ -85,7 +115,10 @@ func (f *Frontend) Publish(e *models.Event) error {
 			if !hasMap {
 				return false
 			}
-			return f.filterFunction(emap, claim, e)
+			if !f.filterFunction(emap, claim, e) {
+				return false
+			}
+			return allowed == nil || allowed(claim)
 		})
 	}
 }
@@ -30,7 +30,7 @@ type WorkflowBodyParameter struct {
 }
 
 // WorkflowPatchBodyParameter used to patch a Workflow
-// swagger:parameters patchWorkflow
+// swagger:parameters patchWorkflow patchWorkflowParams
 type WorkflowPatchBodyParameter struct {
 	// in: body
 	// required: true
@@ -38,13 +38,54 @@ type WorkflowPatchBodyParameter struct {
 }
 
 // WorkflowPathParameter used to name a Workflow in the path
-// swagger:parameters putWorkflows getWorkflow putWorkflow patchWorkflow deleteWorkflow headWorkflow
+// swagger:parameters putWorkflows getWorkflow putWorkflow patchWorkflow deleteWorkflow headWorkflow getWorkflowParams patchWorkflowParams postWorkflowParams
 type WorkflowPathParameter struct {
 	// in: path
 	// required: true
 	Name string `json:"name"`
 }
 
+// WorkflowParamsResponse return on a successful GET of all Workflow's Params
+// swagger:response
+type WorkflowParamsResponse struct {
+	// in: body
+	Body map[string]interface{}
+}
+
+// WorkflowParamResponse return on a successful GET of a single Param for a Workflow
+// swagger:response
+type WorkflowParamResponse struct {
+	// in: body
+	Body interface{}
+}
+
+// WorkflowParamsPathParameter used to get or set a single Parameter in a Workflow
+// swagger:parameters getWorkflowParam postWorkflowParam deleteWorkflowParam
+type WorkflowParamsPathParameter struct {
+	// in: path
+	// required: true
+	Name string `json:"name"`
+	// in: path
+	// required: true
+	Key string `json:"key"`
+}
+
+// WorkflowParamsBodyParameter used to set Workflow Params
+// swagger:parameters postWorkflowParams
+type WorkflowParamsBodyParameter struct {
+	// in: body
+	// required: true
+	Body map[string]interface{}
+}
+
+// WorkflowParamBodyParameter used to set Workflow Param
+// swagger:parameters postWorkflowParam
+type WorkflowParamBodyParameter struct {
+	// in: body
+	// required: true
+	Body interface{}
+}
+
 // WorkflowListPathParameter used to limit lists of Workflow by path options
 // swagger:parameters listWorkflows listStatsWorkflows
 type WorkflowListPathParameter struct {
@@ -250,6 +291,7 @@ func (f *Frontend) InitWorkflowApi() {
 	//       404: ErrorResponse
 	//       406: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PATCH("/workflows/:name",
 		func(c *gin.Context) {
@@ -269,6 +311,7 @@ func (f *Frontend) InitWorkflowApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.PUT("/workflows/:name",
 		func(c *gin.Context) {
@@ -287,12 +330,94 @@ func (f *Frontend) InitWorkflowApi() {
 	//       403: NoContentResponse
 	//       404: ErrorResponse
 	//       409: ErrorResponse
+	//       412: ErrorResponse
 	//       422: ErrorResponse
 	f.ApiGroup.DELETE("/workflows/:name",
 		func(c *gin.Context) {
 			f.Remove(c, &backend.Workflow{}, c.Param(`name`))
 		})
 
+	pGetAll, pGetOne, pPatch, pSetThem, pSetOne, pDeleteOne := f.makeParamEndpoints(&backend.Workflow{}, "name")
+
+	// swagger:route GET /workflows/{name}/params Workflows getWorkflowParams
+	//
+	// List workflow params Workflow
+	//
+	// List Workflow parms for a Workflow specified by {name}
+	//
+	//     Responses:
+	//       200: WorkflowParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/workflows/:name/params", pGetAll)
+
+	// swagger:route GET /workflows/{name}/params/{key} Workflows getWorkflowParam
+	//
+	// Get a single workflow parameter
+	//
+	// Get a single parameter {key} for a Workflow specified by {name}
+	//
+	//     Responses:
+	//       200: WorkflowParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/workflows/:name/params/*key", pGetOne)
+
+	// swagger:route DELETE /workflows/{name}/params/{key} Workflows deleteWorkflowParam
+	//
+	// Delete a single workflow parameter
+	//
+	// Delete a single parameter {key} for a Workflow specified by {name}
+	//
+	//     Responses:
+	//       200: WorkflowParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.DELETE("/workflows/:name/params/*key", pDeleteOne)
+
+	// swagger:route PATCH /workflows/{name}/params Workflows patchWorkflowParams
+	//
+	// Update params for Workflow {name} with the passed-in patch
+	//
+	//     Responses:
+	//       200: WorkflowParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.PATCH("/workflows/:name/params", pPatch)
+
+	// swagger:route POST /workflows/{name}/params Workflows postWorkflowParams
+	//
+	// Sets parameters for a workflow specified by {name}
+	//
+	//     Responses:
+	//       200: WorkflowParamsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.POST("/workflows/:name/params", pSetThem)
+
+	// swagger:route POST /workflows/{name}/params/{key} Workflows postWorkflowParam
+	//
+	// Set as single Parameter {key} for a workflow specified by {name}
+	//
+	//     Responses:
+	//       200: WorkflowParamResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       412: ErrorResponse
+	f.ApiGroup.POST("/workflows/:name/params/*key", pSetOne)
+
 	workflow := &backend.Workflow{}
 	pActions, pAction, pRun := f.makeActionEndpoints(workflow.Prefix(), workflow, "name")
 
@@ -0,0 +1,283 @@
+package midlayer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+)
+
+/*
+ * The BulkController drives BulkOperations forward.
+ *
+ * Any change to a bulk operation, to a machine that is running one,
+ * or a failed job on such a machine causes every unfinished bulk
+ * operation to be re-evaluated:
+ *   * Running machines are checked to see if they have run out of
+ *     tasks (finished) or their current job failed (failed).
+ *   * If the failure budget has been exceeded the operation fails.
+ *   * Otherwise pending machines are started until the concurrency
+ *     window is full.
+ *   * Once there are no pending or running machines, the operation
+ *     is finished.
+ *
+ * All evaluation happens in a single goroutine.  Events only wake it
+ * up, so any number of them that arrive while it is busy are handled
+ * by one more pass.
+ */
+type BulkController struct {
+	logger.Logger
+	dt       *backend.DataTracker
+	done     chan bool
+	finished chan bool
+	wake     chan bool
+	mux      *sync.Mutex
+	running  map[string]bool
+}
+
+// bulkLocks are the locks needed to evaluate bulk operations and act on
+// the machines in them.
+var bulkLocks = []string{
+	"stages", "bootenvs", "machines", "tasks", "profiles",
+	"templates", "params", "workflows", "jobs", "bulk_operations",
+}
+
+func InitBulkController(dt *backend.DataTracker, pubs *backend.Publishers) *BulkController {
+	bc := &BulkController{
+		Logger:   dt.Logger,
+		dt:       dt,
+		done:     make(chan bool),
+		finished: make(chan bool),
+		wake:     make(chan bool, 1),
+		mux:      &sync.Mutex{},
+		running:  map[string]bool{},
+	}
+	pubs.Add(bc)
+	go func() {
+		// Pick up any operations that were in flight when we last stopped.
+		bc.process()
+		done := false
+		for !done {
+			select {
+			case <-bc.wake:
+				bc.process()
+			case <-bc.done:
+				done = true
+			}
+		}
+		bc.finished <- true
+	}()
+	return bc
+}
+
+func (bc *BulkController) Shutdown(ctx context.Context) error {
+	bc.Debugf("Stopping bulk operation controller\n")
+	bc.done <- true
+	<-bc.finished
+	return nil
+}
+
+// relevant returns whether e could change the outcome of an unfinished
+// bulk operation.
+func (bc *BulkController) relevant(e *models.Event) bool {
+	switch e.Action {
+	case "create", "update", "save", "delete":
+	default:
+		return false
+	}
+	switch e.Type {
+	case "bulk_operations":
+		op, ok := e.Object.(*models.BulkOperation)
+		return !ok || e.Action == "delete" || !op.Done()
+	case "machines":
+		bc.mux.Lock()
+		defer bc.mux.Unlock()
+		return bc.running[e.Key]
+	case "jobs":
+		j, ok := e.Object.(*models.Job)
+		if !ok || j.State != "failed" || j.Machine == nil {
+			return false
+		}
+		bc.mux.Lock()
+		defer bc.mux.Unlock()
+		return bc.running[j.Machine.String()]
+	}
+	return false
+}
+
+// Publish never blocks: it is called from the controller goroutine as
+// well, when the changes it makes are published.
+func (bc *BulkController) Publish(e *models.Event) error {
+	if !bc.relevant(e) {
+		return nil
+	}
+	select {
+	case bc.wake <- true:
+	default:
+	}
+	return nil
+}
+
+// This never gets unloaded.
+func (bc *BulkController) Reserve() error {
+	return nil
+}
+func (bc *BulkController) Release() {}
+func (bc *BulkController) Unload()  {}
+
+func (bc *BulkController) process() {
+	running := map[string]bool{}
+	rt := bc.dt.Request(bc.Logger, bulkLocks...)
+	rt.Do(func(d backend.Stores) {
+		for _, item := range d("bulk_operations").Items() {
+			if backend.AsBulkOperation(item).Done() {
+				continue
+			}
+			op := models.Clone(item).(*models.BulkOperation)
+			bc.step(rt, op)
+			if op.Done() {
+				continue
+			}
+			for _, bm := range op.Machines {
+				if bm.State == "running" {
+					running[bm.Uuid.String()] = true
+				}
+			}
+		}
+		// Set before the changes made here are published, so
+		// that the events for them are filtered correctly.
+		bc.mux.Lock()
+		bc.running = running
+		bc.mux.Unlock()
+	})
+}
+
+func (bc *BulkController) overBudget(op *models.BulkOperation) bool {
+	return op.MaxFailures >= 0 && op.Failures() > op.MaxFailures
+}
+
+func (bc *BulkController) step(rt *backend.RequestTracker, op *models.BulkOperation) {
+	changed := false
+	if op.State == "created" {
+		op.State = "running"
+		changed = true
+	}
+	running, pending := 0, 0
+	for i := range op.Machines {
+		bm := &op.Machines[i]
+		if bm.State == "running" && bc.check(rt, bm) {
+			changed = true
+		}
+		switch bm.State {
+		case "running":
+			running++
+		case "pending":
+			pending++
+		}
+	}
+	for i := range op.Machines {
+		if op.State != "running" || running >= op.Concurrency || bc.overBudget(op) {
+			break
+		}
+		bm := &op.Machines[i]
+		if bm.State != "pending" {
+			continue
+		}
+		changed = true
+		pending--
+		bc.start(rt, op, bm)
+		if bm.State == "running" {
+			running++
+		}
+	}
+	if bc.overBudget(op) {
+		op.State = "failed"
+		changed = true
+	} else if running == 0 && pending == 0 {
+		op.State = "finished"
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if _, err := rt.Update(op); err != nil {
+		bc.Errorf("Failed to update bulk operation %s: %v", op.Key(), err)
+	}
+}
+
+func (bc *BulkController) fail(bm *models.BulkOperationMachine, msg string) {
+	bm.State = "failed"
+	bm.Message = msg
+	bm.EndTime = time.Now()
+}
+
+// start applies the operation to a single machine.
+func (bc *BulkController) start(rt *backend.RequestTracker, op *models.BulkOperation, bm *models.BulkOperationMachine) {
+	bm.StartTime = time.Now()
+	key := bm.Uuid.String()
+	if rt.Find("machines", key) == nil {
+		bc.fail(bm, "Machine no longer exists")
+		return
+	}
+	if len(op.Patch) > 0 {
+		ref := &models.Machine{}
+		if op.Force {
+			ref.ForceChange()
+		}
+		if _, err := rt.Patch(ref, key, op.Patch); err != nil {
+			bc.fail(bm, fmt.Sprintf("Patch failed: %v", err))
+			return
+		}
+	}
+	if op.Workflow == "" && op.Stage == "" {
+		bm.State = "finished"
+		bm.Message = "Patched"
+		bm.EndTime = time.Now()
+		return
+	}
+	m := models.Clone(rt.Find("machines", key)).(*models.Machine)
+	if op.Workflow != "" {
+		m.Workflow = op.Workflow
+		bm.Message = fmt.Sprintf("Moved to workflow %s", op.Workflow)
+	} else {
+		m.Stage = op.Stage
+		bm.Message = fmt.Sprintf("Moved to stage %s", op.Stage)
+	}
+	if op.Force {
+		m.ForceChange()
+	}
+	if _, err := rt.Update(m); err != nil {
+		bc.fail(bm, fmt.Sprintf("Update failed: %v", err))
+		return
+	}
+	bm.State = "running"
+}
+
+// check sees if a running machine has finished or failed, and returns
+// whether anything changed.
+func (bc *BulkController) check(rt *backend.RequestTracker, bm *models.BulkOperationMachine) bool {
+	obj := rt.Find("machines", bm.Uuid.String())
+	if obj == nil {
+		bc.fail(bm, "Machine no longer exists")
+		return true
+	}
+	m := backend.AsMachine(obj)
+	if jo := rt.Find("jobs", m.CurrentJob.String()); jo != nil {
+		j := backend.AsJob(jo)
+		if j.State == "failed" && !j.StartTime.Before(bm.StartTime) {
+			bc.fail(bm, fmt.Sprintf("Job %s for task %s failed", j.Key(), j.Task))
+			return true
+		}
+	}
+	if len(m.Tasks) == 0 || m.CurrentTask >= len(m.Tasks) {
+		bm.State = "finished"
+		bm.Message = "Out of tasks"
+		bm.EndTime = time.Now()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package midlayer
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func bulkSetup(t *testing.T) (*BulkController, *backend.RequestTracker) {
+	t.Helper()
+	bc := &BulkController{
+		Logger:  dataTracker.Logger,
+		dt:      dataTracker,
+		mux:     &sync.Mutex{},
+		running: map[string]bool{},
+	}
+	rt := dataTracker.Request(dataTracker.Logger, bulkLocks...)
+	var err error
+	rt.Do(func(d backend.Stores) {
+		if rt.Find("stages", "bulk-stage") != nil {
+			return
+		}
+		if _, err = rt.Create(&models.Task{Name: "bulk-task"}); err != nil {
+			return
+		}
+		_, err = rt.Create(&models.Stage{Name: "bulk-stage", Tasks: []string{"bulk-task"}})
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bulk test content: %v", err)
+	}
+	return bc, rt
+}
+
+func bulkMachines(t *testing.T, rt *backend.RequestTracker, names ...string) []models.BulkOperationMachine {
+	t.Helper()
+	res := []models.BulkOperationMachine{}
+	rt.Do(func(d backend.Stores) {
+		for _, name := range names {
+			m := &models.Machine{Name: name, Uuid: uuid.NewRandom(), Stage: "none", BootEnv: "local"}
+			if _, err := rt.Create(m); err != nil {
+				t.Fatalf("Failed to create machine %s: %v", name, err)
+			}
+			res = append(res, models.BulkOperationMachine{Uuid: m.Uuid, Name: name})
+		}
+	})
+	return res
+}
+
+func bulkCreate(t *testing.T, rt *backend.RequestTracker, op *models.BulkOperation) string {
+	t.Helper()
+	op.Uuid = uuid.NewRandom()
+	op.Filter = map[string][]string{"Name": []string{"Re(bulk)"}}
+	rt.Do(func(d backend.Stores) {
+		if _, err := rt.Create(op); err != nil {
+			t.Fatalf("Failed to create bulk operation: %v", err)
+		}
+	})
+	return op.Key()
+}
+
+// bulkStep runs one controller pass over the operation and returns
+// what was saved.
+func bulkStep(bc *BulkController, rt *backend.RequestTracker, key string) *models.BulkOperation {
+	var op *models.BulkOperation
+	rt.Do(func(d backend.Stores) {
+		op = models.Clone(rt.Find("bulk_operations", key)).(*models.BulkOperation)
+		bc.step(rt, op)
+		op = models.Clone(rt.Find("bulk_operations", key)).(*models.BulkOperation)
+	})
+	return op
+}
+
+func bulkSetState(t *testing.T, rt *backend.RequestTracker, key, state string) {
+	t.Helper()
+	rt.Do(func(d backend.Stores) {
+		op := models.Clone(rt.Find("bulk_operations", key)).(*models.BulkOperation)
+		op.State = state
+		if _, err := rt.Update(op); err != nil {
+			t.Fatalf("Failed to set bulk operation %s to %s: %v", key, state, err)
+		}
+	})
+}
+
+func bulkRemove(t *testing.T, rt *backend.RequestTracker, bm models.BulkOperationMachine) {
+	t.Helper()
+	rt.Do(func(d backend.Stores) {
+		if _, err := rt.Remove(&models.Machine{Uuid: bm.Uuid}); err != nil {
+			t.Fatalf("Failed to remove machine %s: %v", bm.Name, err)
+		}
+	})
+}
+
+func bulkStates(t *testing.T, op *models.BulkOperation, state string, machines ...string) {
+	t.Helper()
+	if op.State != state {
+		t.Errorf("Expected bulk operation to be %s, not %s", state, op.State)
+	}
+	for i, want := range machines {
+		if got := op.Machines[i].State; got != want {
+			t.Errorf("Expected machine %s to be %s, not %s", op.Machines[i].Name, want, got)
+		}
+	}
+}
+
+func TestBulkConcurrency(t *testing.T) {
+	bc, rt := bulkSetup(t)
+	machines := bulkMachines(t, rt, "bulk-c1", "bulk-c2", "bulk-c3")
+	key := bulkCreate(t, rt, &models.BulkOperation{
+		Stage:       "bulk-stage",
+		Concurrency: 2,
+		MaxFailures: -1,
+		Machines:    machines,
+	})
+	op := bulkStep(bc, rt, key)
+	bulkStates(t, op, "running", "running", "running", "pending")
+	op = bulkStep(bc, rt, key)
+	bulkStates(t, op, "running", "running", "running", "pending")
+	bulkRemove(t, rt, machines[0])
+	op = bulkStep(bc, rt, key)
+	bulkStates(t, op, "running", "failed", "running", "running")
+	bulkRemove(t, rt, machines[1])
+	bulkRemove(t, rt, machines[2])
+	op = bulkStep(bc, rt, key)
+	bulkStates(t, op, "finished", "failed", "failed", "failed")
+}
+
+func TestBulkPatchOnly(t *testing.T) {
+	bc, rt := bulkSetup(t)
+	machines := bulkMachines(t, rt, "bulk-p1", "bulk-p2")
+	key := bulkCreate(t, rt, &models.BulkOperation{
+		Patch:       jsonpatch2.Patch{{Op: "replace", Path: "/Description", Value: "patched"}},
+		Concurrency: 1,
+		Machines:    machines,
+	})
+	op := bulkStep(bc, rt, key)
+	bulkStates(t, op, "finished", "finished", "finished")
+	rt.Do(func(d backend.Stores) {
+		for _, bm := range machines {
+			if m := backend.AsMachine(rt.Find("machines", bm.Uuid.String())); m.Description != "patched" {
+				t.Errorf("Machine %s was not patched: %q", bm.Name, m.Description)
+			}
+		}
+	})
+}
+
+func TestBulkFailureBudget(t *testing.T) {
+	bc, rt := bulkSetup(t)
+	machines := bulkMachines(t, rt, "bulk-f1", "bulk-f2")
+	machines = append([]models.BulkOperationMachine{{Uuid: uuid.NewRandom(), Name: "bulk-missing"}}, machines...)
+	key := bulkCreate(t, rt, &models.BulkOperation{
+		Stage:       "bulk-stage",
+		Concurrency: 3,
+		MaxFailures: 0,
+		Machines:    machines,
+	})
+	op := bulkStep(bc, rt, key)
+	bulkStates(t, op, "failed", "failed", "skipped", "skipped")
+}
+
+func TestBulkPauseResumeAbort(t *testing.T) {
+	bc, rt := bulkSetup(t)
+	machines := bulkMachines(t, rt, "bulk-r1", "bulk-r2", "bulk-r3")
+	key := bulkCreate(t, rt, &models.BulkOperation{
+		Stage:       "bulk-stage",
+		Concurrency: 1,
+		MaxFailures: -1,
+		Machines:    machines,
+	})
+	op := bulkStep(bc, rt, key)
+	bulkStates(t, op, "running", "running", "pending", "pending")
+	bulkSetState(t, rt, key, "paused")
+	bulkRemove(t, rt, machines[0])
+	op = bulkStep(bc, rt, key)
+	bulkStates(t, op, "paused", "failed", "pending", "pending")
+	bulkSetState(t, rt, key, "running")
+	op = bulkStep(bc, rt, key)
+	bulkStates(t, op, "running", "failed", "running", "pending")
+	bulkSetState(t, rt, key, "aborted")
+	bc.process()
+	rt.Do(func(d backend.Stores) {
+		op = models.Clone(rt.Find("bulk_operations", key)).(*models.BulkOperation)
+	})
+	bulkStates(t, op, "aborted", "failed", "skipped", "skipped")
+	if bc.running[machines[1].Uuid.String()] {
+		t.Errorf("Aborted bulk operation is still tracking machine %s", machines[1].Name)
+	}
+}
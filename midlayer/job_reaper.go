@@ -0,0 +1,73 @@
+package midlayer
+
+import (
+	"context"
+	"time"
+
+	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/backend"
+)
+
+// JobReaper periodically archives and purges old jobs according to
+// the job retention preferences.  See backend.DataTracker.ReapJobs
+// for the details of the policy.  An interval of 0 or less disables
+// it.
+type JobReaper struct {
+	logger.Logger
+	dt       *backend.DataTracker
+	interval time.Duration
+	done     chan bool
+	finished chan bool
+}
+
+func InitJobReaper(dt *backend.DataTracker, interval time.Duration) *JobReaper {
+	jr := &JobReaper{
+		Logger:   dt.Logger,
+		dt:       dt,
+		interval: interval,
+		done:     make(chan bool),
+		finished: make(chan bool),
+	}
+	if jr.interval <= 0 {
+		jr.Infof("Job reaper is disabled\n")
+		return jr
+	}
+	go func() {
+		ticker := time.NewTicker(jr.interval)
+		defer ticker.Stop()
+		jr.reap()
+		done := false
+		for !done {
+			select {
+			case <-ticker.C:
+				jr.reap()
+			case <-jr.done:
+				done = true
+			}
+		}
+		jr.finished <- true
+	}()
+	return jr
+}
+
+func (jr *JobReaper) Shutdown(ctx context.Context) error {
+	if jr.interval <= 0 {
+		return nil
+	}
+	jr.Debugf("Stopping job reaper\n")
+	jr.done <- true
+	<-jr.finished
+	return nil
+}
+
+func (jr *JobReaper) reap() {
+	j := &backend.Job{}
+	rt := jr.dt.Request(jr.Logger, j.Locks("update")...)
+	res, err := jr.dt.ReapJobs(rt, time.Now())
+	if err != nil {
+		jr.Errorf("Job reaper: %v", err)
+	}
+	if len(res.Archived) > 0 || len(res.Purged) > 0 {
+		jr.Infof("Job reaper archived %d jobs and purged %d jobs", len(res.Archived), len(res.Purged))
+	}
+}
@@ -0,0 +1,23 @@
+package midlayer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJobReaperDisabled(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		jr := InitJobReaper(dataTracker, interval)
+		done := make(chan error)
+		go func() { done <- jr.Shutdown(context.Background()) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Shutting down a disabled job reaper failed: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Shutting down a job reaper with interval %v hung", interval)
+		}
+	}
+}
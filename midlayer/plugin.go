@@ -153,7 +153,8 @@ func (pc *PluginController) allPlugins(provider, action string) (err error) {
 	return
 }
 
-// Must be called under rt.Do()
+// Must be called under rt.Do().  The values of secure params were
+// validated before they were encrypted, so they are skipped.
 func validateParameters(rt *backend.RequestTracker, pp *models.PluginProvider, plugin *models.Plugin) []string {
 	errors := []string{}
 	for _, parmName := range pp.RequiredParams {
@@ -162,7 +163,7 @@ func validateParameters(rt *backend.RequestTracker, pp *models.PluginProvider, p
 			errors = append(errors, fmt.Sprintf("Missing required parameter: %s", parmName))
 		} else {
 			pobj := rt.Find("params", parmName)
-			if pobj != nil {
+			if _, secure := models.AsSecureData(obj); pobj != nil && !secure {
 				rp := pobj.(*backend.Param)
 
 				if ev := rp.ValidateValue(obj); ev != nil {
@@ -175,7 +176,7 @@ func validateParameters(rt *backend.RequestTracker, pp *models.PluginProvider, p
 		obj, ok := plugin.Params[parmName]
 		if ok {
 			pobj := rt.Find("params", parmName)
-			if pobj != nil {
+			if _, secure := models.AsSecureData(obj); pobj != nil && !secure {
 				rp := pobj.(*backend.Param)
 
 				if ev := rp.ValidateValue(obj); ev != nil {
@@ -376,7 +377,8 @@ func (pc *PluginController) configPlugin(mp models.Model) {
 
 	// Configure the plugin
 	pc.Debugf("Config Plugin: %s\n", plugin)
-	terr := r.Client.Config(plugin.Params)
+	// Plugins get the plain values of secure params.
+	terr := r.Client.Config(pc.dt.RedactParams(plugin.Params, true))
 
 	pc.lock.Lock()
 
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/VictorLowther/jsonpatch2"
+)
+
+// AuditEntry records one change that was made through the API.
+// Entries are only ever appended to the audit log.
+//
+// swagger:model
+type AuditEntry struct {
+	// Id is the unique ID of the entry.  Entries sort in the order
+	// they were recorded by Id.
+	// required: true
+	Id string
+	// Time is when the change was made.
+	// required: true
+	Time time.Time
+	// User is the ID of the claim the change was made with.  That
+	// is the name of a User, or the UUID of a Machine for machine
+	// tokens.
+	// required: true
+	User string
+	// TokenId is the unique ID of the token the change was made
+	// with, if it has one.
+	TokenId string
+	// ClientIP is the address of the client that made the change.
+	ClientIP string
+	// Action is one of create, update, patch, save, delete, or
+	// action.
+	// required: true
+	Action string
+	// Model is the prefix of the object that was changed.
+	// required: true
+	Model string
+	// ObjectKey is the key of the object that was changed.
+	// required: true
+	ObjectKey string
+	// Command is the command that was run for an action.
+	Command string
+	// Patch is the JSON patch that turns the old object into the
+	// new one.  A created object is patched from an empty object, and
+	// a deleted one to an empty object.  Secrets are not included.
+	Patch jsonpatch2.Patch
+}
+
+func (a *AuditEntry) Prefix() string {
+	return "audit"
+}
+
+func (a *AuditEntry) Key() string {
+	return a.Id
+}
+
+func (a *AuditEntry) KeyName() string {
+	return "Id"
+}
@@ -85,6 +85,10 @@ type BootEnv struct {
 	//
 	// required: true
 	OnlyUnknown bool
+	// Params that a machine gets while it is in this boot environment.
+	// These are used after the Params of the Workflow of the machine,
+	// but before the global profile.
+	Params map[string]interface{} `json:",omitempty"`
 }
 
 func (b *BootEnv) Validate() {
@@ -98,6 +102,9 @@ func (b *BootEnv) Validate() {
 	for _, t := range b.Templates {
 		b.AddError(ValidName("Invalid Template Name", t.Name))
 	}
+	for k := range b.Params {
+		b.AddError(ValidParamName("Invalid Param Name", k))
+	}
 }
 
 func (b *BootEnv) Prefix() string {
@@ -149,6 +156,15 @@ func (b *BootEnv) Fill() {
 	}
 }
 
+// match Paramer interface
+func (b *BootEnv) GetParams() map[string]interface{} {
+	return copyMap(b.Params)
+}
+
+func (b *BootEnv) SetParams(p map[string]interface{}) {
+	b.Params = copyMap(p)
+}
+
 func (b *BootEnv) SetName(n string) {
 	b.Name = n
 }
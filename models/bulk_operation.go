@@ -0,0 +1,187 @@
+package models
+
+import (
+	"time"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/pborman/uuid"
+)
+
+// BulkOperationMachine tracks the progress of a single machine
+// that is part of a BulkOperation.
+//
+// swagger:model
+type BulkOperationMachine struct {
+	// The UUID of the machine.
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID
+	// The name of the machine at the time the operation was created.
+	Name string
+	// The state the machine is in with respect to the operation.
+	// Must be one of "pending", "running", "finished", "failed", or "skipped"
+	// required: true
+	State string
+	// A message describing the last thing that happened to the machine.
+	Message string
+	// The time the operation started acting on the machine.
+	StartTime time.Time
+	// The time the operation stopped acting on the machine.
+	EndTime time.Time
+}
+
+// BulkOperation applies a change to a set of machines selected by an
+// index filter, a few machines at a time.
+//
+// swagger:model
+type BulkOperation struct {
+	Validation
+	Access
+	Meta
+	// The UUID of the bulk operation.  The primary key.
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID
+	// Description is a short description of what the operation is for.
+	Description string
+	// Filter selects the machines the operation applies to.  It uses
+	// the same syntax as the query parameters for listing machines,
+	// e.g. {"Profiles": ["rack12"], "Runnable": ["true"]}
+	//
+	// The filter is resolved to a fixed list of machines when the
+	// operation is created.
+	Filter map[string][]string
+	// Patch is an optional RFC6902 patch that will be applied to each machine.
+	Patch jsonpatch2.Patch
+	// Workflow is the optional workflow to move each machine to.
+	Workflow string
+	// Stage is the optional stage to move each machine to.
+	Stage string
+	// Force indicates that changes should be forced on the machines.
+	Force bool
+	// Concurrency is the maximum number of machines that can be
+	// acted on at the same time.
+	//
+	// required: true
+	Concurrency int
+	// MaxFailures is the number of machine failures tolerated before
+	// the operation stops.  A negative number means that failures are
+	// never fatal.
+	//
+	// required: true
+	MaxFailures int
+	// The state the operation is in.  Must be one of "created",
+	// "running", "paused", "aborted", "failed", or "finished"
+	//
+	// required: true
+	State string
+	// The machines the operation is acting on.
+	//
+	// read only: true
+	Machines []BulkOperationMachine
+	// The time the operation entered running.
+	StartTime time.Time
+	// The time the operation entered aborted, failed, or finished.
+	EndTime time.Time
+}
+
+func (b *BulkOperation) Prefix() string {
+	return "bulk_operations"
+}
+
+func (b *BulkOperation) Key() string {
+	return b.Uuid.String()
+}
+
+func (b *BulkOperation) KeyName() string {
+	return "Uuid"
+}
+
+func (b *BulkOperation) Fill() {
+	if b.Meta == nil {
+		b.Meta = Meta{}
+	}
+	if b.Filter == nil {
+		b.Filter = map[string][]string{}
+	}
+	if b.Patch == nil {
+		b.Patch = jsonpatch2.Patch{}
+	}
+	if b.Machines == nil {
+		b.Machines = []BulkOperationMachine{}
+	}
+	if b.Concurrency == 0 {
+		b.Concurrency = 1
+	}
+	if b.State == "" {
+		b.State = "created"
+	}
+}
+
+func (b *BulkOperation) AuthKey() string {
+	return b.Key()
+}
+
+func (b *BulkOperation) SliceOf() interface{} {
+	s := []*BulkOperation{}
+	return &s
+}
+
+func (b *BulkOperation) ToModels(obj interface{}) []Model {
+	items := obj.(*[]*BulkOperation)
+	res := make([]Model, len(*items))
+	for i, item := range *items {
+		res[i] = Model(item)
+	}
+	return res
+}
+
+// Done returns true if the operation is in a terminal state.
+func (b *BulkOperation) Done() bool {
+	switch b.State {
+	case "aborted", "failed", "finished":
+		return true
+	}
+	return false
+}
+
+// Failures returns the number of machines that failed.
+func (b *BulkOperation) Failures() int {
+	res := 0
+	for _, m := range b.Machines {
+		if m.State == "failed" {
+			res++
+		}
+	}
+	return res
+}
+
+func (b *BulkOperation) Validate() {
+	if b.Uuid == nil {
+		b.Errorf("BulkOperation does not have a UUID")
+	}
+	if b.Concurrency < 1 {
+		b.Errorf("Concurrency must be greater than 0, not %d", b.Concurrency)
+	}
+	if len(b.Patch) == 0 && b.Workflow == "" && b.Stage == "" {
+		b.Errorf("BulkOperation must have at least one of Patch, Workflow, or Stage")
+	}
+	if b.Workflow != "" {
+		b.AddError(ValidName("Invalid Workflow", b.Workflow))
+	}
+	if b.Stage != "" {
+		b.AddError(ValidName("Invalid Stage", b.Stage))
+	}
+	switch b.State {
+	case "created", "running", "paused", "aborted", "failed", "finished":
+	default:
+		b.Errorf("Invalid State %s", b.State)
+	}
+	for _, m := range b.Machines {
+		switch m.State {
+		case "pending", "running", "finished", "failed", "skipped":
+		default:
+			b.Errorf("Machine %s has invalid State %s", m.Uuid, m.State)
+		}
+	}
+}
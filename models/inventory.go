@@ -0,0 +1,304 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// InventoryCPU describes a single CPU package in a Machine.
+type InventoryCPU struct {
+	// Socket is the physical package ID of the CPU.
+	Socket int
+	Vendor string
+	Model  string
+	Cores  int
+	// Threads is the number of hardware threads in the package.
+	Threads int
+	MHz     float64
+}
+
+// InventoryDIMM describes a single populated memory slot in a
+// Machine.
+type InventoryDIMM struct {
+	// Locator is the name of the slot the DIMM is in.
+	Locator      string
+	Manufacturer string
+	PartNumber   string
+	Serial       string
+	Type         string
+	SizeMB       int64
+	// Speed is the speed of the DIMM in MT/s.
+	Speed int
+}
+
+// InventoryLLDPNeighbor describes the switch port a NIC is plugged
+// into, as seen via LLDP.
+type InventoryLLDPNeighbor struct {
+	ChassisID       string
+	SystemName      string
+	PortID          string
+	PortDescription string
+}
+
+// InventoryNIC describes a physical network interface in a Machine.
+type InventoryNIC struct {
+	Name   string
+	MAC    string
+	Driver string
+	// SpeedMbps is the link speed of the interface, or 0 if the link
+	// is down.
+	SpeedMbps int
+	Neighbors []InventoryLLDPNeighbor
+}
+
+// InventoryDisk describes a physical disk in a Machine.
+type InventoryDisk struct {
+	Name       string
+	Vendor     string
+	Model      string
+	Serial     string
+	SizeBytes  int64
+	Rotational bool
+	// SmartStatus is the result of the SMART overall health test
+	// (usually PASSED or FAILED), or empty if it is not available.
+	SmartStatus string
+}
+
+// InventoryPCIDevice describes a device on the PCI bus of a Machine.
+type InventoryPCIDevice struct {
+	// Address is the domain:bus:device.function address of the device.
+	Address string
+	Class   string
+	Vendor  string
+	Device  string
+	Driver  string
+}
+
+// Inventory is the hardware inventory of a Machine, as collected by
+// the machine agent.
+//
+// swagger:model
+type Inventory struct {
+	// Time is when the inventory was collected.
+	//
+	// required: true
+	Time time.Time
+	// DMI holds the system, board, chassis, and BIOS information from
+	// the DMI tables of the Machine.
+	//
+	// required: true
+	DMI    map[string]string
+	CPUs   []InventoryCPU
+	Memory []InventoryDIMM
+	NICs   []InventoryNIC
+	Disks  []InventoryDisk
+	PCI    []InventoryPCIDevice
+}
+
+// Fill makes sure none of the lists in the Inventory are nil.
+func (i *Inventory) Fill() {
+	if i.DMI == nil {
+		i.DMI = map[string]string{}
+	}
+	if i.CPUs == nil {
+		i.CPUs = []InventoryCPU{}
+	}
+	if i.Memory == nil {
+		i.Memory = []InventoryDIMM{}
+	}
+	if i.NICs == nil {
+		i.NICs = []InventoryNIC{}
+	}
+	if i.Disks == nil {
+		i.Disks = []InventoryDisk{}
+	}
+	if i.PCI == nil {
+		i.PCI = []InventoryPCIDevice{}
+	}
+}
+
+// Validate checks that the Inventory is well-formed.
+func (i *Inventory) Validate(e ErrorAdder) {
+	seen := map[string]bool{}
+	for idx, d := range i.Memory {
+		if d.Locator == "" {
+			e.Errorf("Memory[%d] is missing a Locator", idx)
+		} else if seen["dimm "+d.Locator] {
+			e.Errorf("Memory[%d] has a duplicate Locator %s", idx, d.Locator)
+		}
+		seen["dimm "+d.Locator] = true
+		if d.SizeMB < 0 {
+			e.Errorf("Memory[%d] has a negative size", idx)
+		}
+	}
+	for idx, n := range i.NICs {
+		if n.Name == "" {
+			e.Errorf("NICs[%d] is missing a Name", idx)
+		} else if seen["nic "+n.Name] {
+			e.Errorf("NICs[%d] has a duplicate Name %s", idx, n.Name)
+		}
+		seen["nic "+n.Name] = true
+		if n.MAC != "" {
+			if _, err := net.ParseMAC(n.MAC); err != nil {
+				e.Errorf("NICs[%d] has an invalid MAC %s", idx, n.MAC)
+			}
+		}
+	}
+	for idx, d := range i.Disks {
+		if d.Name == "" {
+			e.Errorf("Disks[%d] is missing a Name", idx)
+		} else if seen["disk "+d.Name] {
+			e.Errorf("Disks[%d] has a duplicate Name %s", idx, d.Name)
+		}
+		seen["disk "+d.Name] = true
+		if d.SizeBytes < 0 {
+			e.Errorf("Disks[%d] has a negative size", idx)
+		}
+	}
+	for idx, p := range i.PCI {
+		if p.Address == "" {
+			e.Errorf("PCI[%d] is missing an Address", idx)
+		} else if seen["pci "+p.Address] {
+			e.Errorf("PCI[%d] has a duplicate Address %s", idx, p.Address)
+		}
+		seen["pci "+p.Address] = true
+	}
+}
+
+// Params returns the parts of the Inventory as the params they are
+// stored as on the Machine.
+func (i *Inventory) Params() map[string]interface{} {
+	return map[string]interface{}{
+		"inventory/dmi":    i.DMI,
+		"inventory/cpus":   i.CPUs,
+		"inventory/memory": i.Memory,
+		"inventory/nics":   i.NICs,
+		"inventory/disks":  i.Disks,
+		"inventory/pci":    i.PCI,
+	}
+}
+
+// InventoryChange is a single difference between two Inventories.
+type InventoryChange struct {
+	// Kind is the kind of hardware that changed: dmi, cpu, memory,
+	// nic, disk, or pci.
+	Kind string
+	// Key identifies the piece of hardware that changed.
+	Key string
+	// Change is one of added, removed, or changed.
+	Change string
+}
+
+func (c InventoryChange) String() string {
+	return fmt.Sprintf("%s %s %s", c.Kind, c.Key, c.Change)
+}
+
+func diffItems(kind string, prev, cur map[string]interface{}) []InventoryChange {
+	res := []InventoryChange{}
+	for k, v := range prev {
+		if nv, ok := cur[k]; !ok {
+			res = append(res, InventoryChange{Kind: kind, Key: k, Change: "removed"})
+		} else if !reflect.DeepEqual(v, nv) {
+			res = append(res, InventoryChange{Kind: kind, Key: k, Change: "changed"})
+		}
+	}
+	for k := range cur {
+		if _, ok := prev[k]; !ok {
+			res = append(res, InventoryChange{Kind: kind, Key: k, Change: "added"})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+func (i *Inventory) items() map[string]map[string]interface{} {
+	res := map[string]map[string]interface{}{
+		"dmi":    {},
+		"cpu":    {},
+		"memory": {},
+		"nic":    {},
+		"disk":   {},
+		"pci":    {},
+	}
+	for k, v := range i.DMI {
+		res["dmi"][k] = v
+	}
+	for _, c := range i.CPUs {
+		res["cpu"][fmt.Sprintf("socket %d", c.Socket)] = c
+	}
+	for _, d := range i.Memory {
+		res["memory"][d.Locator] = d
+	}
+	for _, n := range i.NICs {
+		res["nic"][n.Name] = n
+	}
+	for _, d := range i.Disks {
+		res["disk"][d.Name] = d
+	}
+	for _, p := range i.PCI {
+		res["pci"][p.Address] = p
+	}
+	return res
+}
+
+// Diff returns the hardware that was added, removed, or changed
+// between prev and i.  Speeds and SMART status are not compared,
+// since they change without the hardware changing.
+func (i *Inventory) Diff(prev *Inventory) []InventoryChange {
+	strip := func(inv *Inventory) *Inventory {
+		res := &Inventory{DMI: inv.DMI, PCI: inv.PCI}
+		for _, c := range inv.CPUs {
+			c.MHz = 0
+			res.CPUs = append(res.CPUs, c)
+		}
+		res.Memory = inv.Memory
+		for _, n := range inv.NICs {
+			n.SpeedMbps = 0
+			res.NICs = append(res.NICs, n)
+		}
+		for _, d := range inv.Disks {
+			d.SmartStatus = ""
+			res.Disks = append(res.Disks, d)
+		}
+		return res
+	}
+	prevItems := strip(prev).items()
+	curItems := strip(i).items()
+	res := []InventoryChange{}
+	for _, kind := range []string{"dmi", "cpu", "memory", "nic", "disk", "pci"} {
+		res = append(res, diffItems(kind, prevItems[kind], curItems[kind])...)
+	}
+	return res
+}
+
+// InventorySnapshot is the result of storing an Inventory for a
+// Machine.
+//
+// swagger:model
+type InventorySnapshot struct {
+	// ID identifies this snapshot in the inventory history of the
+	// Machine.
+	//
+	// required: true
+	ID string
+	// Previous is the ID of the snapshot this one was compared to,
+	// if any.
+	Previous string
+	// Changes is the hardware that changed since the Previous
+	// snapshot.
+	//
+	// required: true
+	Changes []InventoryChange
+}
+
+// InventoryDrift is the Object of the machines.drift event that is
+// published when the hardware of a Machine changes.
+//
+// swagger:model
+type InventoryDrift struct {
+	Machine string
+	InventorySnapshot
+}
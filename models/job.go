@@ -19,6 +19,57 @@ type JobAction struct {
 	Path string
 	// required: true
 	Content string
+	// Interpreter is how the agent should handle Content.  It comes
+	// from the Interpreter of the TemplateInfo this action was
+	// rendered from.
+	Interpreter string
+}
+
+// JobArtifact describes a file that a Job has uploaded.
+//
+// swagger:model
+type JobArtifact struct {
+	// The path of the artifact relative to the artifacts of the job.
+	// required: true
+	Path string
+	// The size of the artifact in bytes.
+	// required: true
+	Size int64
+	// The content type the artifact was uploaded with.
+	// required: true
+	ContentType string
+	// The time the artifact was uploaded.
+	Time time.Time
+}
+
+// JobLogChunk is the Object of the jobs.log.<uuid> events that are
+// published whenever something is appended to the log of a Job.
+//
+// swagger:model
+type JobLogChunk struct {
+	// The byte offset in the log that Data was written at.
+	// required: true
+	Offset int64
+	// The data that was appended to the log.
+	// required: true
+	Data []byte
+}
+
+// JobReaperReport is the Object of the jobs.reap events that are
+// published whenever old jobs are archived or purged according to the
+// job retention preferences.
+//
+// swagger:model
+type JobReaperReport struct {
+	// The UUIDs of the jobs that were archived.
+	// required: true
+	Archived []string
+	// The UUIDs of the jobs that were purged.
+	// required: true
+	Purged []string
+	// The path relative to the log root of the tarball the purged
+	// jobs were exported to, if any.
+	Export string
 }
 
 // swagger:model
@@ -78,6 +129,13 @@ type Job struct {
 	// The bootenv that the task was created in.
 	// read only: true
 	BootEnv string
+	// The files the job has uploaded.  Artifacts are removed when
+	// the job is archived.
+	// read only: true
+	Artifacts []JobArtifact
+	// The values for the OutputParams of the task that the job produced.
+	// They are validated and set on the machine when the job finishes.
+	Outputs map[string]interface{}
 }
 
 func (j *Job) Validate() {
@@ -91,6 +149,9 @@ func (j *Job) Validate() {
 	default:
 		j.AddError(fmt.Errorf("Invalid State `%s`", j.State))
 	}
+	for k := range j.Outputs {
+		j.AddError(ValidParamName("Invalid Output", k))
+	}
 	if j.ExitState != "" {
 		switch j.ExitState {
 		case "reboot", "poweroff", "stop", "complete", "failed":
@@ -116,6 +177,12 @@ func (j *Job) Fill() {
 	if j.Meta == nil {
 		j.Meta = Meta{}
 	}
+	if j.Artifacts == nil {
+		j.Artifacts = []JobArtifact{}
+	}
+	if j.Outputs == nil {
+		j.Outputs = map[string]interface{}{}
+	}
 	j.Validation.fill()
 }
 
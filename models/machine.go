@@ -70,7 +70,8 @@ type Machine struct {
 	Runnable bool
 
 	// Secret for machine token revocation.  Changing the secret will invalidate
-	// all existing tokens for this machine
+	// all existing tokens for this machine.  It is never sent out by the
+	// API, and leaving it empty when updating a Machine keeps the current one.
 	Secret string
 	// OS is the operating system that the node is running in
 	//
@@ -160,6 +161,12 @@ func (n *Machine) AuthKey() string {
 	return n.Key()
 }
 
+func (n *Machine) Sanitize() Model {
+	res := Clone(n)
+	res.(*Machine).Secret = ""
+	return res
+}
+
 func (b *Machine) SliceOf() interface{} {
 	s := []*Machine{}
 	return &s
@@ -11,6 +11,16 @@ import (
 // swagger: model
 type Meta map[string]string
 
+// MetaHaver is implemented by models that have Meta.
+type MetaHaver interface {
+	Model
+	GetMeta() Meta
+}
+
+func (m Meta) GetMeta() Meta {
+	return m
+}
+
 func (m Meta) ClearFeatures() {
 	m["feature-flags"] = ""
 }
@@ -0,0 +1,27 @@
+package models
+
+// OidcConfig is what a client needs to log in to dr-provision through
+// the OpenID Connect provider it trusts.
+// swagger:model
+type OidcConfig struct {
+	// Issuer is the URL of the OpenID Connect provider.
+	//
+	// required: true
+	Issuer string `json:"issuer"`
+	// ClientId is the OAuth2 client that clients should log in as.
+	//
+	// required: true
+	ClientId string `json:"client_id"`
+	// UsernameClaim is the claim in the token that has the name of
+	// the User.
+	//
+	// required: true
+	UsernameClaim string `json:"username_claim"`
+	// Scopes are the scopes clients should ask for.
+	Scopes []string `json:"scopes,omitempty"`
+	// TokenEndpoint is where clients exchange codes for tokens.
+	TokenEndpoint string `json:"token_endpoint,omitempty"`
+	// DeviceAuthorizationEndpoint is where clients start the device
+	// code flow.  It is empty if the provider does not support it.
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+}
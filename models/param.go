@@ -24,6 +24,39 @@ type Param struct {
 	//
 	// required: true
 	Schema interface{}
+	// Secure marks the values of this Param as secrets.  They are
+	// encrypted when they are stored on Machines and Profiles, and they
+	// are redacted when they are sent to clients that are not allowed
+	// to see them.
+	Secure bool
+}
+
+// RedactedValue is what the value of a Secure Param is replaced with
+// when it is sent to a client that is not allowed to see it.  Sending
+// it back unchanged keeps the stored value.
+const RedactedValue = "*** REDACTED ***"
+
+// SecureData is how the value of a Secure Param is stored.
+type SecureData struct {
+	// Secure is the encrypted JSON of the value.
+	Secure string
+}
+
+// AsSecureData returns the encrypted value held in v, if v is the
+// stored value of a Secure Param.
+func AsSecureData(v interface{}) (string, bool) {
+	switch sd := v.(type) {
+	case SecureData:
+		return sd.Secure, true
+	case *SecureData:
+		return sd.Secure, true
+	case map[string]interface{}:
+		if len(sd) == 1 {
+			s, ok := sd["Secure"].(string)
+			return s, ok
+		}
+	}
+	return "", false
 }
 
 func (p *Param) DefaultValue() (interface{}, bool) {
@@ -105,3 +138,48 @@ func (b *Param) ToModels(obj interface{}) []Model {
 	}
 	return res
 }
+
+// ParamSource is a value of a param and the object it came from.
+type ParamSource struct {
+	// Source is the object the value came from, as prefix:key.  It is
+	// params:<name> for the default value of a Param.
+	Source string
+	Value  interface{}
+}
+
+// ExplainedParam is the value a param resolves to on an object, where
+// that value came from, and the values from lower in the param
+// hierarchy that it overrides, in the order they would have been
+// used.
+//
+// swagger:model
+type ExplainedParam struct {
+	ParamSource
+	Shadowed []ParamSource
+}
+
+// InvalidParamValue is a value of a param stored on an object that
+// does not match the Schema of the Param.
+type InvalidParamValue struct {
+	// Model is the prefix of the object that holds the value.
+	Model string
+	// Key is the key of the object that holds the value.
+	Key string
+	// Value is the stored value.  Values of secure params are
+	// redacted.
+	Value interface{}
+	// Errors lists why the value does not match the Schema.
+	Errors []string
+}
+
+// ParamReport lists the values of a Param stored on other objects
+// that do not match its Schema.  It is what changing the Schema of a
+// Param would leave behind.
+//
+// swagger:model
+type ParamReport struct {
+	// Param is the name of the Param that was checked.
+	Param string
+	// Invalid lists the stored values that do not match the Schema.
+	Invalid []InvalidParamValue
+}
@@ -0,0 +1,110 @@
+package models
+
+import "net/url"
+
+// Claim is an individial specifier for something we are allowed access to.
+type Claim struct {
+	Scope    string `json:"scope"`
+	Action   string `json:"action"`
+	Specific string `json:"specific"`
+	// Filter limits the Claim to objects that match it.  It uses the
+	// same Field=value form as the filters on list requests, joined
+	// with `&`.  Field can be Profiles, Meta.<key>, or the name of an
+	// index of the object.  An object must match every Field, and
+	// matches a Field that is given more than once if any value does.
+	Filter string `json:"filter,omitempty"`
+}
+
+// Match tests to see if this claim allows access for the specified
+// scope, action, and specific item.  It does not look at Filter.
+//
+// If the Claim has `*` for any field, it matches all possible values
+// for that field.
+func (c *Claim) Match(scope, action, specific string) bool {
+	return (c.Scope == scope || c.Scope == "*") &&
+		(c.Action == action || c.Action == "*") &&
+		(c.Specific == specific || c.Specific == "*")
+}
+
+// Role is a named set of Claims that can be assigned to Users.
+// swagger:model
+type Role struct {
+	Validation
+	Access
+	Meta
+	// Name is the name of the role
+	//
+	// required: true
+	Name string
+	// Description of role
+	Description string
+	// Claims lists what the role allows access to.  A User has all
+	// the Claims of all of its Roles.
+	Claims []*Claim
+}
+
+func (r *Role) Validate() {
+	r.AddError(ValidName("Invalid Name", r.Name))
+	for i, c := range r.Claims {
+		if c == nil || c.Scope == "" || c.Action == "" || c.Specific == "" {
+			r.Errorf("Claim %d must have a scope, action, and specific", i)
+			continue
+		}
+		if c.Filter == "" {
+			continue
+		}
+		if terms, err := url.ParseQuery(c.Filter); err != nil {
+			r.Errorf("Claim %d has an invalid filter: %v", i, err)
+		} else if len(terms) == 0 {
+			r.Errorf("Claim %d has an empty filter", i)
+		}
+	}
+}
+
+func (r *Role) Prefix() string {
+	return "roles"
+}
+
+func (r *Role) Key() string {
+	return r.Name
+}
+
+func (r *Role) KeyName() string {
+	return "Name"
+}
+
+func (r *Role) Fill() {
+	r.Validation.fill()
+	if r.Meta == nil {
+		r.Meta = Meta{}
+	}
+	if r.Claims == nil {
+		r.Claims = []*Claim{}
+	}
+}
+
+func (r *Role) AuthKey() string {
+	return r.Key()
+}
+
+func (r *Role) SliceOf() interface{} {
+	s := []*Role{}
+	return &s
+}
+
+func (r *Role) ToModels(obj interface{}) []Model {
+	items := obj.(*[]*Role)
+	res := make([]Model, len(*items))
+	for i, item := range *items {
+		res[i] = Model(item)
+	}
+	return res
+}
+
+func (r *Role) SetName(n string) {
+	r.Name = n
+}
+
+func (r *Role) CanHaveActions() bool {
+	return true
+}
@@ -45,6 +45,9 @@ type Stage struct {
 	// The list of profiles a machine should use while in this stage.
 	// These are used after machine profiles, but before global.
 	Profiles []string
+	// Params that a machine gets while in this stage.  These are used
+	// after machine profiles, but before the Profiles of the stage.
+	Params map[string]interface{} `json:",omitempty"`
 	// Flag to indicate if a node should be PXE booted on this
 	// transition into this Stage.  The nextbootpxe and reboot
 	// machine actions will be called if present and Reboot is true
@@ -71,6 +74,9 @@ func (s *Stage) Validate() {
 	for _, p := range s.Profiles {
 		s.AddError(ValidName("Invalid Profile", p))
 	}
+	for k := range s.Params {
+		s.AddError(ValidParamName("Invalid Param Name", k))
+	}
 	for _, t := range s.Tasks {
 		s.AddError(ValidName("Invalid Task", t))
 	}
@@ -162,3 +168,12 @@ func (b *Stage) SetName(n string) {
 func (b *Stage) CanHaveActions() bool {
 	return true
 }
+
+// match Paramer interface
+func (s *Stage) GetParams() map[string]interface{} {
+	return copyMap(s.Params)
+}
+
+func (s *Stage) SetParams(p map[string]interface{}) {
+	s.Params = copyMap(p)
+}
@@ -1,5 +1,7 @@
 package models
 
+import "strings"
+
 // Task is a thing that can run on a Machine.
 //
 // swagger:model
@@ -29,6 +31,64 @@ type Task struct {
 	//
 	// required: true
 	OptionalParams []string
+	// OutputParams are the parameters that the Task may set on the
+	// Machine when its Job finishes.  Each one must have a matching
+	// Param, and the values the Task produces will be validated
+	// against the Schema of that Param.
+	//
+	// required: true
+	OutputParams []string
+	// Sandbox holds the limits that the machine agent will run the
+	// actions of this Task under.  If it is not set, the agent uses
+	// the task-sandbox param of the Machine, if any.
+	//
+	// required: false
+	Sandbox *TaskSandbox `json:",omitempty"`
+}
+
+// TaskSandbox describes the restricted environment the machine agent
+// should run the script actions of a Task in.  The CPU and memory
+// limits and the User are only enforced by agents running on Linux.
+//
+// swagger:model
+type TaskSandbox struct {
+	// CPUs is the most CPU time each action may use, in units of
+	// whole CPUs.  0 means no limit.
+	CPUs float64
+	// MemoryMB is the most memory each action may use, in megabytes.
+	// 0 means no limit.
+	MemoryMB int64
+	// Timeout is how long each action may run for, in seconds,
+	// before it is killed and the Task fails.  0 means no limit.
+	Timeout int
+	// User is the name of the local user the actions will run as.
+	// If it is empty, actions run as the same user as the agent.
+	User string
+	// PrivateTmp gives each action its own temporary directory
+	// inside the task directory, which TMPDIR will point at.
+	PrivateTmp bool
+	// Env lists the names of the environment variables of the agent
+	// that will be passed through to the actions.  PATH and the RS_
+	// variables the agent sets are always passed.
+	Env []string
+}
+
+// Validate checks that the limits in the TaskSandbox make sense.
+func (ts *TaskSandbox) Validate(e ErrorAdder) {
+	if ts.CPUs < 0 {
+		e.Errorf("Sandbox CPUs cannot be negative")
+	}
+	if ts.MemoryMB < 0 {
+		e.Errorf("Sandbox MemoryMB cannot be negative")
+	}
+	if ts.Timeout < 0 {
+		e.Errorf("Sandbox Timeout cannot be negative")
+	}
+	for _, name := range ts.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			e.Errorf("Sandbox Env has an invalid variable name %q", name)
+		}
+	}
 }
 
 func (t *Task) Validate() {
@@ -40,8 +100,16 @@ func (t *Task) Validate() {
 	for _, p := range t.OptionalParams {
 		t.AddError(ValidParamName("Invalid Optional Param", p))
 	}
-	for _, tt := range t.Templates {
+	for _, p := range t.OutputParams {
+		t.AddError(ValidParamName("Invalid Output Param", p))
+	}
+	for i := range t.Templates {
+		tt := &t.Templates[i]
 		t.AddError(ValidName("Invalid Template Name", tt.Name))
+		tt.checkInterpreter(i, t)
+	}
+	if t.Sandbox != nil {
+		t.Sandbox.Validate(t)
 	}
 }
 
@@ -71,6 +139,9 @@ func (t *Task) Fill() {
 	if t.OptionalParams == nil {
 		t.OptionalParams = []string{}
 	}
+	if t.OutputParams == nil {
+		t.OutputParams = []string{}
+	}
 }
 
 func (t *Task) AuthKey() string {
@@ -1,5 +1,7 @@
 package models
 
+import "github.com/pborman/uuid"
+
 // Template represents a template that will be associated with a boot
 // environment.
 //
@@ -65,3 +67,64 @@ func (b *Template) ToModels(obj interface{}) []Model {
 func (b *Template) CanHaveActions() bool {
 	return true
 }
+
+// RenderRequest asks dr-provision to render templates the way they
+// would be rendered for a Machine, without running a Job or changing
+// anything.  Exactly one of Template, Task, BootEnv, or Stage must be
+// set.
+//
+// swagger:model
+type RenderRequest struct {
+	// Template is the ID of a Template to render.
+	Template string
+	// Task is the name of a Task whose templates will be rendered.
+	Task string
+	// BootEnv is the name of a BootEnv whose templates will be rendered.
+	BootEnv string
+	// Stage is the name of a Stage whose templates will be rendered.
+	Stage string
+	// Machine is the UUID of the Machine to render against.  If it is
+	// not set, the templates are rendered against a scratch Machine
+	// that only has Params.
+	//
+	// swagger:strfmt uuid
+	Machine uuid.UUID
+	// Params are used in place of the params of the Machine with the
+	// same names.
+	Params map[string]interface{}
+}
+
+// RenderedTemplate is a single template rendered for a
+// RenderRequest.
+//
+// swagger:model
+type RenderedTemplate struct {
+	// Name is the name of the template.
+	Name string
+	// Path is where the rendered template would be written, if
+	// anywhere.
+	Path string
+	// Interpreter is how the machine agent would handle the template.
+	Interpreter string
+	// Content is what the template rendered to.
+	Content string
+	// Error is why the template could not be rendered, if it could
+	// not be.
+	Error string
+}
+
+// RenderResult is what a RenderRequest rendered to.
+//
+// swagger:model
+type RenderResult struct {
+	// Templates are the rendered templates, in the order they would
+	// be rendered.
+	//
+	// required: true
+	Templates []RenderedTemplate
+	// Errors are problems that would keep the templates from being
+	// rendered for real, such as missing required params.
+	//
+	// required: true
+	Errors []string
+}
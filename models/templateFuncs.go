@@ -0,0 +1,424 @@
+package models
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateFuncs returns the functions that are available to every
+// template dr-provision renders.  Functions that take the value being
+// worked on take it as their last argument, so that they can be used
+// at the end of a pipeline:
+//
+//	{{ .Param "hostname" | default "localhost" | upper }}
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Strings
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"contains":   func(sub, s string) bool { return strings.Contains(s, sub) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       tmplJoin,
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"quote":      func(s interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(s)) },
+		"squote":     func(s interface{}) string { return "'" + fmt.Sprint(s) + "'" },
+		"indent":     tmplIndent,
+		"nindent":    func(spaces int, s string) string { return "\n" + tmplIndent(spaces, s) },
+		// Defaults
+		"empty":    tmplEmpty,
+		"default":  tmplDefault,
+		"coalesce": tmplCoalesce,
+		"ternary":  tmplTernary,
+		// Lists and maps
+		"list":      func(items ...interface{}) []interface{} { return items },
+		"first":     tmplFirst,
+		"last":      tmplLast,
+		"has":       tmplHas,
+		"uniq":      tmplUniq,
+		"sortAlpha": tmplSortAlpha,
+		"dict":      tmplDict,
+		"keys":      tmplKeys,
+		"hasKey":    func(m map[string]interface{}, key string) bool { _, ok := m[key]; return ok },
+		"get":       func(m map[string]interface{}, key string) interface{} { return m[key] },
+		// IP math
+		"cidrHost":    tmplCidrHost,
+		"cidrNetmask": tmplCidrNetmask,
+		"cidrNetwork": tmplCidrNetwork,
+		"cidrPrefix":  tmplCidrPrefix,
+		"ipIncrement": tmplIPIncrement,
+		// Encoding and hashing
+		"b64enc":      func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":      tmplB64Dec,
+		"md5sum":      func(s string) string { v := md5.Sum([]byte(s)); return hex.EncodeToString(v[:]) },
+		"sha1sum":     func(s string) string { v := sha1.Sum([]byte(s)); return hex.EncodeToString(v[:]) },
+		"sha256sum":   func(s string) string { v := sha256.Sum256([]byte(s)); return hex.EncodeToString(v[:]) },
+		"sha512sum":   func(s string) string { v := sha512.Sum512([]byte(s)); return hex.EncodeToString(v[:]) },
+		"sha512crypt": tmplSha512Crypt,
+	}
+}
+
+// NewTemplate returns a new template with the functions from
+// TemplateFuncs registered.
+func NewTemplate(name string) *template.Template {
+	return template.New(name).Funcs(TemplateFuncs())
+}
+
+// tmplList turns a slice or array of anything into a []interface{}.
+func tmplList(list interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(list)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		res := make([]interface{}, v.Len())
+		for i := range res {
+			res[i] = v.Index(i).Interface()
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("Cannot use %T as a list", list)
+}
+
+func tmplJoin(sep string, list interface{}) (string, error) {
+	items, err := tmplList(list)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(items))
+	for i := range items {
+		parts[i] = fmt.Sprint(items[i])
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func tmplIndent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// tmplEmpty returns true if val is nil or the zero value of its type,
+// or an empty string, slice, or map.
+func tmplEmpty(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(val, reflect.Zero(v.Type()).Interface())
+}
+
+func tmplDefault(def interface{}, val ...interface{}) interface{} {
+	if len(val) == 0 || tmplEmpty(val[0]) {
+		return def
+	}
+	return val[0]
+}
+
+func tmplCoalesce(vals ...interface{}) interface{} {
+	for _, val := range vals {
+		if !tmplEmpty(val) {
+			return val
+		}
+	}
+	return nil
+}
+
+func tmplTernary(yes, no interface{}, cond bool) interface{} {
+	if cond {
+		return yes
+	}
+	return no
+}
+
+func tmplFirst(list interface{}) (interface{}, error) {
+	items, err := tmplList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func tmplLast(list interface{}) (interface{}, error) {
+	items, err := tmplList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+func tmplHas(needle, list interface{}) (bool, error) {
+	items, err := tmplList(list)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if reflect.DeepEqual(item, needle) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func tmplUniq(list interface{}) ([]interface{}, error) {
+	items, err := tmplList(list)
+	if err != nil {
+		return nil, err
+	}
+	res := []interface{}{}
+	for _, item := range items {
+		if ok, _ := tmplHas(item, res); !ok {
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
+
+func tmplSortAlpha(list interface{}) ([]string, error) {
+	items, err := tmplList(list)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, len(items))
+	for i := range items {
+		res[i] = fmt.Sprint(items[i])
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func tmplDict(kv ...interface{}) (map[string]interface{}, error) {
+	if len(kv)%2 != 0 {
+		return nil, fmt.Errorf("dict needs an even number of arguments")
+	}
+	res := map[string]interface{}{}
+	for i := 0; i < len(kv); i += 2 {
+		res[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	return res, nil
+}
+
+func tmplKeys(m map[string]interface{}) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func tmplB64Dec(s string) (string, error) {
+	buf, err := base64.StdEncoding.DecodeString(s)
+	return string(buf), err
+}
+
+// ipAdd adds n to ip, and fails if the result does not fit in the
+// address family of ip.
+func ipAdd(ip net.IP, n int64) (net.IP, error) {
+	size := net.IPv6len
+	if v4 := ip.To4(); v4 != nil {
+		ip, size = v4, net.IPv4len
+	}
+	val := big.NewInt(0).SetBytes(ip)
+	val.Add(val, big.NewInt(n))
+	if val.Sign() < 0 || len(val.Bytes()) > size {
+		return nil, fmt.Errorf("%s + %d is out of range", ip, n)
+	}
+	res := make(net.IP, size)
+	buf := val.Bytes()
+	copy(res[size-len(buf):], buf)
+	return res, nil
+}
+
+// tmplCidrHost returns the host number num in the network cidr.
+// Negative numbers count back from the end of the network.
+func tmplCidrHost(num int64, cidr string) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	ones, bits := network.Mask.Size()
+	if num < 0 {
+		if bits-ones > 62 {
+			return "", fmt.Errorf("Network %s is too large to count back from its end", cidr)
+		}
+		num += int64(1) << uint(bits-ones)
+	}
+	ip, err := ipAdd(network.IP, num)
+	if err != nil || !network.Contains(ip) {
+		return "", fmt.Errorf("Host %d is not in network %s", num, cidr)
+	}
+	return ip.String(), nil
+}
+
+func tmplCidrNetmask(cidr string) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	return net.IP(network.Mask).String(), nil
+}
+
+func tmplCidrNetwork(cidr string) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	return network.IP.String(), nil
+}
+
+func tmplCidrPrefix(cidr string) (int, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return 0, err
+	}
+	ones, _ := network.Mask.Size()
+	return ones, nil
+}
+
+func tmplIPIncrement(n int64, addr string) (string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", fmt.Errorf("Invalid IP address %s", addr)
+	}
+	res, err := ipAdd(ip, n)
+	if err != nil {
+		return "", err
+	}
+	return res.String(), nil
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// tmplSha512Crypt hashes password in the SHA-512 crypt(3) format used
+// for /etc/shadow and kickstart rootpw --iscrypted.  If a salt is not
+// passed, a random one is generated.
+func tmplSha512Crypt(password string, salt ...string) (string, error) {
+	var s string
+	if len(salt) > 0 {
+		s = salt[0]
+	} else {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for i := range buf {
+			buf[i] = cryptAlphabet[int(buf[i])%len(cryptAlphabet)]
+		}
+		s = string(buf)
+	}
+	if len(s) > 16 {
+		s = s[:16]
+	}
+	return sha512Crypt([]byte(password), []byte(s), 5000), nil
+}
+
+func sha512Crypt(pw, salt []byte, rounds int) string {
+	h := sha512.New()
+	h.Write(pw)
+	h.Write(salt)
+	h.Write(pw)
+	b := h.Sum(nil)
+
+	h.Reset()
+	h.Write(pw)
+	h.Write(salt)
+	for i := len(pw); i > 0; i -= 64 {
+		if i > 64 {
+			h.Write(b)
+		} else {
+			h.Write(b[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(pw)
+		}
+	}
+	a := h.Sum(nil)
+
+	h.Reset()
+	for range pw {
+		h.Write(pw)
+	}
+	dp := h.Sum(nil)
+	p := make([]byte, 0, len(pw))
+	for len(p) < len(pw) {
+		p = append(p, dp...)
+	}
+	p = p[:len(pw)]
+
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(salt)
+	}
+	ds := h.Sum(nil)
+	s := ds[:len(salt)]
+
+	c := a
+	for r := 0; r < rounds; r++ {
+		h.Reset()
+		if r&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if r%3 != 0 {
+			h.Write(s)
+		}
+		if r%7 != 0 {
+			h.Write(p)
+		}
+		if r&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	out := &strings.Builder{}
+	b64 := func(b2, b1, b0 byte, n int) {
+		w := uint32(b2)<<16 | uint32(b1)<<8 | uint32(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	// crypt(3) rotates which byte of each group of three leads.
+	for i := 0; i < 21; i++ {
+		switch i % 3 {
+		case 0:
+			b64(c[i], c[i+21], c[i+42], 4)
+		case 1:
+			b64(c[i+21], c[i+42], c[i], 4)
+		case 2:
+			b64(c[i+42], c[i], c[i+21], 4)
+		}
+	}
+	b64(0, 0, c[63], 2)
+	return fmt.Sprintf("$6$%s$%s", salt, out.String())
+}
@@ -31,7 +31,21 @@ type TemplateInfo struct {
 	//
 	// required: false
 	Contents string
-	pathTmpl *template.Template
+	// Interpreter is how the agent should handle the rendered
+	// template when it is part of a Task.  It can be one of:
+	//
+	//    "" or "shell": If Path is set, the template is written to
+	//    Path.  Otherwise it is executed directly as a script.
+	//    "python", "powershell": The template is a script that will be
+	//    run with the matching interpreter.  Path must be empty.
+	//    "set-param", "reboot", "download", "inventory": The template is handled by
+	//    the agent itself without running any external commands.  Path
+	//    must be empty.
+	//    "render": The template is written to Path, which must be set.
+	//
+	// required: false
+	Interpreter string
+	pathTmpl    *template.Template
 }
 
 func (ti *TemplateInfo) Id() string {
@@ -48,7 +62,7 @@ func (ti *TemplateInfo) SanityCheck(idx int, e ErrorAdder, missingPathOK bool) {
 	if !missingPathOK {
 		if ti.Path == "" {
 			e.Errorf("Template[%d] is missing a Path", idx)
-		} else if _, err := template.New(ti.Name).Parse(ti.Path); err != nil {
+		} else if _, err := NewTemplate(ti.Name).Parse(ti.Path); err != nil {
 			e.Errorf("Template[%d] Path is not a valid text/template: %v", idx, err)
 		}
 	}
@@ -58,6 +72,25 @@ func (ti *TemplateInfo) SanityCheck(idx int, e ErrorAdder, missingPathOK bool) {
 	if ti.Contents != "" && ti.ID != "" {
 		e.Errorf("Template[%d] has both an ID and Contents", idx)
 	}
+	ti.checkInterpreter(idx, e)
+}
+
+// checkInterpreter makes sure that the Interpreter is one the agent
+// knows how to handle, and that Path is set when it needs to be.
+func (ti *TemplateInfo) checkInterpreter(idx int, e ErrorAdder) {
+	switch ti.Interpreter {
+	case "", "shell":
+	case "render":
+		if ti.Path == "" {
+			e.Errorf("Template[%d] with Interpreter %s must have a Path", idx, ti.Interpreter)
+		}
+	case "python", "powershell", "set-param", "reboot", "download":
+		if ti.Path != "" {
+			e.Errorf("Template[%d] with Interpreter %s cannot have a Path", idx, ti.Interpreter)
+		}
+	default:
+		e.Errorf("Template[%d] has an unknown Interpreter %s", idx, ti.Interpreter)
+	}
 }
 
 func (ti *TemplateInfo) PathTemplate() *template.Template {
@@ -68,7 +101,7 @@ func MergeTemplates(root *template.Template, tmpls []TemplateInfo, e ErrorAdder)
 	var res *template.Template
 	var err error
 	if root == nil {
-		res = template.New("")
+		res = NewTemplate("")
 	} else {
 		res, err = root.Clone()
 	}
@@ -84,7 +117,7 @@ func MergeTemplates(root *template.Template, tmpls []TemplateInfo, e ErrorAdder)
 			continue
 		}
 		if ti.Path != "" {
-			pathTmpl, err := template.New(ti.Name).Parse(ti.Path)
+			pathTmpl, err := NewTemplate(ti.Name).Parse(ti.Path)
 			if err != nil {
 				e.Errorf("Error compiling path template %s (%s): %v",
 					ti.Name,
@@ -1,7 +1,43 @@
 package models
 
+import "time"
+
 // swagger:model
 type UserToken struct {
 	Token string
 	Info  Info
 }
+
+// TokenRecord is what the token registry remembers about a token that
+// was issued while the tokenRegistry preference was on.  It never
+// holds the token itself.
+//
+// swagger:model
+type TokenRecord struct {
+	// Id is the unique ID of the token.
+	// required: true
+	Id string
+	// User is the User the token acts as.
+	// required: true
+	User string
+	// Grantor is the User that asked for the token.
+	Grantor string
+	// Machine is the UUID of the Machine the token is for, if any.
+	Machine string
+	// Claims lists what the token allows access to.
+	Claims []*Claim
+	// IssuedAt is when the token was issued.
+	// required: true
+	IssuedAt time.Time
+	// ExpiresAt is when the token stops working.
+	// required: true
+	ExpiresAt time.Time
+	// IssuedTo is the address of the client that asked for the token.
+	IssuedTo string
+	// Revoked is true if the token was revoked before it expired.
+	Revoked bool
+	// RevokedAt is when the token was revoked.
+	RevokedAt time.Time
+	// RevokedBy is the User that revoked the token.
+	RevokedBy string
+}
@@ -1,9 +1,72 @@
 package models
 
 import (
+	"net"
+	"time"
+
 	sc "github.com/elithrar/simple-scrypt"
 )
 
+// ApiKey is a long-lived credential for automation that acts as the
+// User it belongs to.  Clients present it in an Authorization header
+// of the form "Key <user>:<name>:<secret>".
+// swagger:model
+type ApiKey struct {
+	// Name identifies the key among the keys of its User.
+	//
+	// required: true
+	Name string
+	// Description of the key
+	Description string
+	// KeyHash is the scrypt-hashed version of the secret of the key.
+	// The secret itself is only returned when the key is created.
+	KeyHash []byte `json:",omitempty"`
+	// Claims limit what the key can do.  The key can never do more
+	// than the Roles of its User allow.  A key with no Claims can do
+	// everything its User can.
+	Claims []*Claim `json:",omitempty"`
+	// ExpiresAt is when the key stops working.  A zero value means
+	// it never does.
+	ExpiresAt time.Time
+	// AllowedCIDRs limits the addresses the key can be used from.  An
+	// empty list allows any address.
+	AllowedCIDRs []string `json:",omitempty"`
+	// LastUsed is roughly when the key was last used.
+	LastUsed time.Time
+}
+
+// AllowedFrom tests whether the key can be used from ip.
+func (k *ApiKey) AllowedFrom(ip net.IP) bool {
+	if len(k.AllowedCIDRs) == 0 {
+		return true
+	}
+	for _, cidr := range k.AllowedCIDRs {
+		if _, subnet, err := net.ParseCIDR(cidr); err == nil && subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckKey tests whether secret is the secret of the key.
+func (k *ApiKey) CheckKey(secret string) bool {
+	return sc.CompareHashAndPassword(k.KeyHash, []byte(secret)) == nil
+}
+
+// UserApiKey is returned when an ApiKey is created.
+// swagger:model
+type UserApiKey struct {
+	// Key is what clients present to authenticate with the ApiKey.
+	// It cannot be retrieved again.
+	//
+	// required: true
+	Key string
+	// ApiKey is the key that was created.
+	//
+	// required: true
+	ApiKey *ApiKey
+}
+
 // User is an API user of DigitalRebar Provision
 // swagger:model
 type User struct {
@@ -24,10 +87,67 @@ type User struct {
 	// will invalidate all existing tokens that have this user as a user
 	// or a grantor.
 	Secret string
+	// Roles lists the Roles that determine what the user is allowed
+	// to do.  A user without Roles is not allowed to do anything.
+	// Users stored before Roles existed are given the superuser Role
+	// when they are loaded.
+	Roles []string
+	// ApiKeys are the API keys that act as the user.  They can only
+	// be added and removed through the apikeys API.
+	ApiKeys []*ApiKey `json:",omitempty"`
+	// PasswordHistory holds the hashes of the previous passwords of
+	// the user, newest first, when the passwordHistory preference is
+	// set.
+	PasswordHistory [][]byte `json:",omitempty"`
+	// TotpSecret is the base32-encoded secret that time-based one
+	// time codes are generated from.  It is only returned when TOTP
+	// enrolment is started.
+	TotpSecret string `json:",omitempty"`
+	// TotpEnabled is true once the user has confirmed TOTP
+	// enrolment.  Basic authentication as the user then needs a
+	// one-time code as well as the password.
+	TotpEnabled bool
 }
 
 func (u *User) Validate() {
 	u.AddError(ValidName("Invalid Name", u.Name))
+	for _, r := range u.Roles {
+		u.AddError(ValidName("Invalid Role", r))
+	}
+	seen := map[string]struct{}{}
+	for i, k := range u.ApiKeys {
+		if k == nil {
+			u.Errorf("ApiKey %d is empty", i)
+			continue
+		}
+		u.AddError(ValidName("Invalid ApiKey Name", k.Name))
+		if _, ok := seen[k.Name]; ok {
+			u.Errorf("ApiKey %s is defined more than once", k.Name)
+		}
+		seen[k.Name] = struct{}{}
+		for j, c := range k.Claims {
+			if c == nil || c.Scope == "" || c.Action == "" || c.Specific == "" {
+				u.Errorf("ApiKey %s: Claim %d must have a scope, action, and specific", k.Name, j)
+			} else if c.Filter != "" {
+				u.Errorf("ApiKey %s: Claim %d cannot have a Filter, use a Role for that", k.Name, j)
+			}
+		}
+		for _, cidr := range k.AllowedCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				u.Errorf("ApiKey %s: %v", k.Name, err)
+			}
+		}
+	}
+}
+
+// ApiKey returns the ApiKey of the user called name, or nil.
+func (u *User) ApiKey(name string) *ApiKey {
+	for _, k := range u.ApiKeys {
+		if k != nil && k.Name == name {
+			return k
+		}
+	}
+	return nil
 }
 
 func (u *User) Prefix() string {
@@ -59,6 +179,13 @@ func (u *User) CheckPassword(pass string) bool {
 func (u *User) Sanitize() Model {
 	res := Clone(u)
 	res.(*User).PasswordHash = []byte{}
+	res.(*User).PasswordHistory = nil
+	res.(*User).TotpSecret = ""
+	for _, k := range res.(*User).ApiKeys {
+		if k != nil {
+			k.KeyHash = []byte{}
+		}
+	}
 	return res
 }
 
@@ -71,6 +198,44 @@ type UserPassword struct {
 	Password string
 }
 
+// UserTotp is returned when TOTP enrolment is started.
+// swagger:model
+type UserTotp struct {
+	// Secret is the base32-encoded TOTP secret.
+	//
+	// required: true
+	Secret string
+	// Url is the otpauth:// URL of the secret, for authenticator apps
+	// that read QR codes.
+	//
+	// required: true
+	Url string
+}
+
+// UserTotpCode confirms TOTP enrolment.
+// swagger:model
+type UserTotpCode struct {
+	// Code is a one-time code generated from the new secret.
+	//
+	// required: true
+	Code string
+}
+
+// LoginLockout is the Object of the events that are published when
+// too many failed logins lock out a user or a client address.
+// swagger:model
+type LoginLockout struct {
+	// User is the name of the user that is locked out, if it is one.
+	User string
+	// ClientIP is the address that is locked out, if it is one.
+	ClientIP string
+	// Failures is the number of failed logins that caused it.
+	Failures int
+	// Until is when the lockout ends.
+	// swagger:strfmt date-time
+	Until time.Time
+}
+
 func (b *User) SliceOf() interface{} {
 	s := []*User{}
 	return &s
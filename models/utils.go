@@ -43,6 +43,7 @@ type Slicer interface {
 func All() []Model {
 	return []Model{
 		&BootEnv{},
+		&BulkOperation{},
 		&Interface{},
 		&Job{},
 		&Lease{},
@@ -53,6 +54,7 @@ func All() []Model {
 		&Pref{},
 		&Profile{},
 		&Reservation{},
+		&Role{},
 		&Stage{},
 		&Subnet{},
 		&Task{},
@@ -67,6 +69,8 @@ func New(kind string) (Slicer, error) {
 	switch kind {
 	case "bootenvs", "bootenv":
 		res = &BootEnv{}
+	case "bulk_operations", "bulk_operation":
+		res = &BulkOperation{}
 	case "interfaces":
 		res = &Interface{}
 	case "jobs", "job":
@@ -87,6 +91,8 @@ func New(kind string) (Slicer, error) {
 		res = &Profile{}
 	case "reservations", "reservation":
 		res = &Reservation{}
+	case "roles", "role":
+		res = &Role{}
 	case "stages", "stage":
 		res = &Stage{}
 	case "subnets", "subnet":
@@ -7,6 +7,9 @@ type Workflow struct {
 	Name        string
 	Description string
 	Stages      []string
+	// Params that a machine gets while it is running this workflow.
+	// These are used after the Profiles of the Stage of the machine.
+	Params map[string]interface{} `json:",omitempty"`
 }
 
 func (w *Workflow) Prefix() string {
@@ -53,8 +56,20 @@ func (w *Workflow) Validate() {
 	for _, stageName := range w.Stages {
 		w.AddError(ValidName("Invalid Stage Name", stageName))
 	}
+	for k := range w.Params {
+		w.AddError(ValidParamName("Invalid Param Name", k))
+	}
 }
 
 func (w *Workflow) CanHaveActions() bool {
 	return true
 }
+
+// match Paramer interface
+func (w *Workflow) GetParams() map[string]interface{} {
+	return copyMap(w.Params)
+}
+
+func (w *Workflow) SetParams(p map[string]interface{}) {
+	w.Params = copyMap(p)
+}
@@ -16,6 +16,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"net"
 	"os"
@@ -154,3 +155,17 @@ func buildKeys(curveOrBits, certFile, keyFile string) error {
 	keyOut.Close()
 	return nil
 }
+
+// loadClientCAs loads the PEM encoded CA certificates in caFile that
+// client certificates are verified against.
+func loadClientCAs(caFile string) (*x509.CertPool, error) {
+	buf, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf("No PEM encoded certificates in %s", caFile)
+	}
+	return pool, nil
+}
@@ -80,3 +80,23 @@ func TestCert(t *testing.T) {
 	validFile(t, "2048", certFile, keyFile)
 	validFile(t, "1024", certFile, keyFile)
 }
+
+func TestLoadClientCAs(t *testing.T) {
+	certFile := fmt.Sprintf("%s/ca.pem", tmpDir)
+	keyFile := fmt.Sprintf("%s/ca-key.pem", tmpDir)
+	if err := buildKeys("P256", certFile, keyFile); err != nil {
+		t.Fatalf("Should not have failed: %s", err)
+	}
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+
+	if _, err := loadClientCAs(certFile); err != nil {
+		t.Errorf("Should have loaded %s: %s", certFile, err)
+	}
+	if _, err := loadClientCAs(keyFile); err == nil {
+		t.Errorf("Should have failed with no certificates in %s", keyFile)
+	}
+	if _, err := loadClientCAs(fmt.Sprintf("%s/missing.pem", tmpDir)); err == nil {
+		t.Errorf("Should have failed with a missing file")
+	}
+}
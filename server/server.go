@@ -63,6 +63,7 @@ type ProgOpts struct {
 	BinlPort            int    `long:"binl-port" description:"Port for the PXE/BINL server to listen on" default:"4011"`
 	UnknownTokenTimeout int    `long:"unknown-token-timeout" description:"The default timeout in seconds for the machine create authorization token" default:"600"`
 	KnownTokenTimeout   int    `long:"known-token-timeout" description:"The default timeout in seconds for the machine update authorization token" default:"3600"`
+	JobReaperInterval   int    `long:"job-reaper-interval" description:"How often in seconds old jobs should be archived and purged, 0 disables it" default:"3600"`
 	OurAddress          string `long:"static-ip" description:"IP address to advertise for the static HTTP file server" default:""`
 	ForceStatic         bool   `long:"force-static" description:"Force the system to always use the static IP."`
 
@@ -93,6 +94,7 @@ type ProgOpts struct {
 	DebugPlugins  string `long:"debug-plugins" description:"Debug level for the Plug-in layer" default:"warn"`
 	TlsKeyFile    string `long:"tls-key" description:"The TLS Key File" default:"server.key"`
 	TlsCertFile   string `long:"tls-cert" description:"The TLS Cert File" default:"server.crt"`
+	TlsClientCA   string `long:"tls-client-ca" description:"A PEM file of CAs to verify client certificates against.  Clients with a verified certificate are authenticated as the User or Machine it names" default:""`
 	UseOldCiphers bool   `long:"use-old-ciphers" description:"Use Original Less Secure Cipher List"`
 	DrpId         string `long:"drp-id" description:"The id of this Digital Rebar Provision instance" default:""`
 	CurveOrBits   string `long:"cert-type" description:"Type of cert to generate. values are: P224, P256, P384, P521, RSA, or <number of RSA bits>" default:"P384"`
@@ -258,6 +260,8 @@ func server(localLogger *log.Logger, c_opts *ProgOpts) string {
 	} else {
 		services = append(services, pc)
 	}
+	services = append(services, midlayer.InitBulkController(dt, publishers))
+	services = append(services, midlayer.InitJobReaper(dt, time.Duration(c_opts.JobReaperInterval)*time.Second))
 
 	fe := frontend.NewFrontend(dt, buf.Log("frontend"),
 		c_opts.OurAddress,
@@ -341,6 +345,17 @@ func server(localLogger *log.Logger, c_opts *ProgOpts) string {
 			},
 		}
 	}
+	if c_opts.TlsClientCA != "" {
+		pool, err := loadClientCAs(c_opts.TlsClientCA)
+		if err != nil {
+			return fmt.Sprintf("Error loading client CAs: %v", err)
+		}
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
 	srv := &http.Server{
 		TLSConfig: cfg,
 		Addr:      fmt.Sprintf(":%d", c_opts.ApiPort),